@@ -477,7 +477,8 @@ class BaseEntity extends CollisionCore {
                     this.attachedTo.id,
                     this.attachmentOffset.x,
                     this.attachmentOffset.y,
-                    this.rotation || 0
+                    this.rotation || 0,
+                    this.weaponId || 0
                 );
             }
             // If this is the local player, send player update
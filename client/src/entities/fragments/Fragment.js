@@ -1,7 +1,5 @@
 import { BaseEntity } from "../core/BaseEntity.js";
 import CollisionCore from "../../systems/CollisionCore.js";
-import socket from "../../systems/sockets.js";
-import { STATE } from "../../configuration/constants.js";
 import { canvas, ctx as gl } from "../../configuration/canvas.js";
 class Fragment extends BaseEntity {
 	constructor({ x, y, width, height, color }) {
@@ -10,6 +8,7 @@ class Fragment extends BaseEntity {
         this.enableLife = false;
 		this.destroyed = false;
 		this.isFragment = true;
+		this.serverOwned = false; // Spawned by the server, which decides when it goes away
 		this.originalEntityId = 0; // ID of the entity this fragment came from
 		this.type = 'fragment';
 		this.renderLayer = 1; // Ensure fragments are visible
@@ -18,17 +17,15 @@ class Fragment extends BaseEntity {
 	update(deltaTime, allEntities, spatialGrid) {
         super.update(deltaTime, allEntities, spatialGrid);
         
+        // Fragments spawned by the server are cleared by it; local effects
+        // remove themselves once expired or far off-screen
+        if (this.serverOwned) return;
+        
         // Decrease lifetime and mark as destroyed when expired.
 		if (this.enableLife) {
 			this.lifetime -= deltaTime;
 			if (this.lifetime <= 0) {
 				this.destroyed = true;
-				
-				// If this is a fragment created by the local player, notify the server about destruction
-				if (STATE.myPlayer && this.id) {
-					// Send fragment destruction message
-					socket.sendFragmentDestroy(this.id);
-				}
 			}
 		}
         
@@ -41,12 +38,13 @@ class Fragment extends BaseEntity {
                 this.y < camera.y - offscreenMargin || 
                 this.y > camera.y + camera.viewportHeight + offscreenMargin) {
                 this.destroyed = true;
-                
-                // If this is a fragment created by the local player, notify the server about destruction
-                if (STATE.myPlayer && this.id) {
-                    // Send fragment destruction message
-                    socket.sendFragmentDestroy(this.id);
-                }
+            }
+        }
+        
+        if (this.destroyed) {
+            const index = allEntities.indexOf(this);
+            if (index > -1) {
+                allEntities.splice(index, 1);
             }
         }
 	}
@@ -6,13 +6,14 @@ import { STATE } from "../../configuration/constants.js";
 import { canvas, ctx as gl } from "../../configuration/canvas.js";
 
 class Bullet extends BaseEntity {
-  constructor({ x, y, rotation, speed = 800, damage = 10, lifetime = 2 } = {}) {
+  constructor({ x, y, rotation, speed = 800, damage = 10, lifetime = 2, gravity = 0 } = {}) {
     // Set a small hitbox for the bullet (e.g., 10x5) and a red color.
     super({x, y, width: 10, height: 5, color: [1.0, 0.0, 0.0, 1.0]});
     this.rotation = rotation;
     this.damage = damage;
     this.speed = speed;
     this.lifetime = lifetime; // Lifetime in seconds
+    this.gravity = gravity; // Bullet drop in px/s², as simulated by the server
     this.hasGravity = false;
     this.hasCollision = true;
     this.sleeping = false;
@@ -28,6 +29,7 @@ class Bullet extends BaseEntity {
 
   update(deltaTime, allEntities, spatialGrid) {
     // Update bullet position using its velocity.
+    this.velocity.y += this.gravity * deltaTime;
     this.x += this.velocity.x * deltaTime;
     this.y += this.velocity.y * deltaTime;
     
@@ -47,8 +49,9 @@ class Bullet extends BaseEntity {
       return;
     }
     
-    // Apply damage to the hit entity if it has health
-    if (hitEntity.health !== undefined && !hitEntity.isDead && !hitEntity.invulnerable) {
+    // Apply damage to the hit entity if it has health, unless the server
+    // simulates bullets and decides the damage itself
+    if (!socket.serverProjectiles && hitEntity.health !== undefined && !hitEntity.isDead && !hitEntity.invulnerable) {
       // Apply damage locally
       hitEntity.takeDamage(this.damage, this);
       
@@ -61,11 +64,17 @@ class Bullet extends BaseEntity {
     const index = allEntities.findIndex(entity => entity === hitEntity && hitEntity.type !== 'player');
     
     if (index !== -1) {
-      socket.sendPlatformDestroy(allEntities[index].id)
-      allEntities.splice(index, 1); // Remove the entity from the array
-      this.deleteSelf(allEntities)
-      if (hitEntity instanceof Platform) this.splitEntity(hitEntity, allEntities)
-      
+      if (hitEntity instanceof Platform && socket.isOnline()) {
+        // The server counts the hits on each platform and announces the ones
+        // that break, so only our own bullets are reported
+        if (!socket.serverProjectiles && STATE.myPlayer && this.ownerId === STATE.myPlayer.id) {
+          socket.sendPlatformDestroy(hitEntity.id);
+        }
+      } else {
+        allEntities.splice(index, 1); // Remove the entity from the array
+        this.deleteSelf(allEntities)
+        if (hitEntity instanceof Platform) this.splitEntity(hitEntity, allEntities)
+      }
     }
     // Delete the bullet after collision
     this.deleteSelf(allEntities);
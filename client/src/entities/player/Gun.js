@@ -17,7 +17,8 @@ class Gun extends BaseWeapon {
       damage = 10,
       range = 50,
       rotation = 0,
-      id = null
+      id = null,
+      weaponId = 1
     } = options;
     
     // Call parent constructor with options
@@ -34,6 +35,7 @@ class Gun extends BaseWeapon {
     });
     
     this.name = null;
+    this.weaponId = weaponId; // Server weapon catalogue ID
     this.damage = damage;
     this.range = range;
     this.fireRate = 15;
@@ -58,7 +60,8 @@ class Gun extends BaseWeapon {
         this.attachedTo.id,
         this.attachmentOffset.x,
         this.attachmentOffset.y,
-        this.rotation || 0
+        this.rotation || 0,
+        this.weaponId
     );
     
     // The network update will be handled by the sendNetworkUpdate method
@@ -76,7 +79,8 @@ class Gun extends BaseWeapon {
       this.attachedTo.id,
       this.attachmentOffset.x,
       this.attachmentOffset.y,
-      this.rotation || 0
+      this.rotation || 0,
+      this.weaponId
   );
   }
 
@@ -135,7 +139,7 @@ class Gun extends BaseWeapon {
     
     // If this is the local player's gun, send the gun fire event to the server
     if (this.attachedTo && this.attachedTo.isLocalPlayer) {
-      socket.sendGunFire(bulletX, bulletY, this.rotation, this.damage);
+      socket.sendGunFire(bulletX, bulletY, this.rotation, this.damage, this.weaponId);
     }
   }
   
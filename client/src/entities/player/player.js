@@ -4,6 +4,7 @@ import Fragment from "../fragments/Fragment.js";
 import Gun from "./Gun.js"; // Import the new Gun class
 import { keys, allEntities, STATE, LAYERS } from "../../configuration/constants.js";
 import uiManager from "../../systems/UIManager.js";
+import socket from "../../systems/sockets.js";
 import { Animation, AnimationController } from "../../systems/Animation.js";
 import { canvas, ctx as gl } from "../../configuration/canvas.js";
 
@@ -232,8 +233,17 @@ class Player extends BaseEntity {
             return;
         }
         
+        // Online, the server moves us from our input commands and we
+        // predict where it will put us instead of running our own physics
+        const serverMoved = this.isLocalPlayer && socket.isOnline();
+        
         if (this.isLocalPlayer) {
-            this.handleMovement(deltaTime, allEntities);
+            if (serverMoved) {
+                socket.predictLocalPlayer(this, deltaTime);
+                this.playMovementAnimation();
+            } else {
+                this.handleMovement(deltaTime, allEntities);
+            }
             this.updateWorldMousePosition(); // Update world mouse position every frame
             this.updateGunRotation();
             if (this.shooting) {
@@ -270,7 +280,12 @@ class Player extends BaseEntity {
         }
         
         this.animationController.update(deltaTime);
-        super.update(deltaTime, allEntities, spatialGrid);
+        if (serverMoved) {
+            // Still report our appearance; the server ignores the position
+            this.sendNetworkUpdate();
+        } else {
+            super.update(deltaTime, allEntities, spatialGrid);
+        }
         
         // Update health bar if this is a player
         if (window.camera) {
@@ -306,6 +321,33 @@ class Player extends BaseEntity {
         }
     }
 
+    // The input sent to the server for one tick of movement
+    movementInput() {
+        let moveX = 0;
+        if (keys['ArrowRight'] || keys['KeyD']) moveX += 1;
+        if (keys['ArrowLeft'] || keys['KeyA']) moveX -= 1;
+        
+        return {
+            moveX,
+            moveY: 0,
+            jump: !!(keys['ArrowUp'] || keys['KeyW']),
+            aimAngle: this.equippedWeapon ? this.equippedWeapon.rotation : 0,
+            fire: this.shooting
+        };
+    }
+    
+    // Play the run or idle animation for the direction we are moving in
+    playMovementAnimation() {
+        if (this.velocity.x > 0) {
+            this.direction = 1;
+        } else if (this.velocity.x < 0) {
+            this.direction = -1;
+        } else {
+            this.direction = 0;
+        }
+        this.animationController.play(this.direction === 0 ? 'idle' : 'run');
+    }
+
     handleMovement(interval, entities) {
         const accelerationFactor = this.grounded ? 1 : 0.9;
         if ((keys['ArrowUp'] || keys['KeyW']) && this.grounded) {
@@ -0,0 +1,741 @@
+// Code generated by protocol/gen from go-gameserver/protocol/schema.json. DO NOT EDIT.
+//
+// Encoders for the messages the client sends and decoders for the ones the
+// server sends. BinaryProtocol.js builds on these and encodes the messages
+// the schema marks as custom by hand.
+
+const textEncoder = new TextEncoder();
+const textDecoder = new TextDecoder();
+
+// Writes little-endian fields to a buffer that grows as needed
+class Writer {
+    constructor() {
+        this.buffer = new ArrayBuffer(64);
+        this.view = new DataView(this.buffer);
+        this.offset = 0;
+    }
+
+    reserve(size) {
+        if (this.offset + size <= this.buffer.byteLength) return;
+        let capacity = this.buffer.byteLength * 2;
+        while (capacity < this.offset + size) capacity *= 2;
+        const buffer = new ArrayBuffer(capacity);
+        new Uint8Array(buffer).set(new Uint8Array(this.buffer, 0, this.offset));
+        this.buffer = buffer;
+        this.view = new DataView(buffer);
+    }
+
+    bool(value) { this.uint8(value ? 1 : 0); }
+    uint8(value) { this.reserve(1); this.view.setUint8(this.offset, value); this.offset += 1; }
+    uint16(value) { this.reserve(2); this.view.setUint16(this.offset, value, true); this.offset += 2; }
+    uint32(value) { this.reserve(4); this.view.setUint32(this.offset, value, true); this.offset += 4; }
+    int32(value) { this.reserve(4); this.view.setInt32(this.offset, value, true); this.offset += 4; }
+    float32(value) { this.reserve(4); this.view.setFloat32(this.offset, value, true); this.offset += 4; }
+
+    bytes(bytes) {
+        this.reserve(bytes.length);
+        new Uint8Array(this.buffer, this.offset, bytes.length).set(bytes);
+        this.offset += bytes.length;
+    }
+
+    finish() {
+        return this.buffer.slice(0, this.offset);
+    }
+}
+
+// Reads little-endian fields from a DataView; reading past its end throws
+class Reader {
+    constructor(view, offset) {
+        this.view = view;
+        this.offset = offset;
+    }
+
+    remaining() { return this.view.byteLength - this.offset; }
+
+    bool() { return this.uint8() !== 0; }
+    uint8() { const value = this.view.getUint8(this.offset); this.offset += 1; return value; }
+    uint16() { const value = this.view.getUint16(this.offset, true); this.offset += 2; return value; }
+    uint32() { const value = this.view.getUint32(this.offset, true); this.offset += 4; return value; }
+    int32() { const value = this.view.getInt32(this.offset, true); this.offset += 4; return value; }
+    float32() { const value = this.view.getFloat32(this.offset, true); this.offset += 4; return value; }
+
+    bytes(length) {
+        if (length < 0 || length > this.remaining()) {
+            throw new RangeError('Length beyond the end of the message');
+        }
+        const bytes = new Uint8Array(this.view.buffer, this.view.byteOffset + this.offset, length);
+        this.offset += length;
+        return bytes;
+    }
+}
+
+// Message types
+export const MessageTypes = {
+    // Client -> Server messages
+    PLAYER_UPDATE: 1,
+    CHAT_MESSAGE: 2,
+    GUN_FIRE: 3,
+    HIT_REPORT: 4,
+    PLAYER_JOIN: 5,
+    PLAYER_LEAVE: 6,
+    PLATFORM_DESTROY: 7,
+    FRAGMENT_CREATE: 8,
+    FRAGMENT_DESTROY: 9,
+    GUN_ATTACHMENT: 10,
+    INPUT_COMMAND: 11,
+    TEAM_SWITCH: 12,
+    SNAPSHOT_ACK: 13,
+    HELLO: 14,
+
+    // Server -> Client messages
+    BROADCAST_PLAYER_UPDATE: 101,
+    BROADCAST_CHAT_MESSAGE: 102,
+    BROADCAST_GUN_FIRE: 103,
+    BROADCAST_HIT_REPORT: 104,
+    BROADCAST_PLAYER_JOIN: 105,
+    BROADCAST_PLAYER_LEAVE: 106,
+    INITIAL_STATE: 107,
+    BROADCAST_PLATFORM_DESTROY: 108,
+    BROADCAST_FRAGMENT_CREATE: 109,
+    BROADCAST_FRAGMENT_DESTROY: 110,
+    BROADCAST_GUN_ATTACHMENT: 111,
+    WORLD_SNAPSHOT: 112,
+    SCOREBOARD_UPDATE: 113,
+    MATCH_STATE: 114,
+
+    // Quantized server -> client messages, sent instead of their float32
+    // counterparts to clients that negotiated FeatureQuantized
+    QUANTIZED_WORLD_SNAPSHOT: 115,
+    QUANTIZATION: 116,
+    QUANTIZED_BROADCAST_GUN_FIRE: 117,
+
+    // Area of interest events
+    PLAYER_ENTER_VIEW: 118,
+    PLAYER_LEAVE_VIEW: 119,
+
+    // Server-simulated projectiles
+    PROJECTILE_SPAWN: 120,
+    PROJECTILE_IMPACT: 121,
+
+    // Destructible terrain
+    TERRAIN_STATE: 122,
+    PLATFORM_RESTORE: 123,
+
+    // Handshake
+    WELCOME: 124,
+
+    // More quantized server -> client messages, added after the area of
+    // interest and server projectiles
+    QUANTIZED_BROADCAST_PLAYER_UPDATE: 125,
+    QUANTIZED_PLAYER_ENTER_VIEW: 126,
+    QUANTIZED_PROJECTILE_SPAWN: 127,
+
+    // Messages that can travel in either direction
+    BUNDLE: 200,
+};
+
+function writePlayer(w, v) {
+    w.int32(v.id);
+    const nameBytes = textEncoder.encode(v.name ?? '');
+    if (nameBytes.length > 32) throw new RangeError('Player.name is too long');
+    w.int32(nameBytes.length);
+    w.bytes(nameBytes);
+    w.float32(v.x);
+    w.float32(v.y);
+    w.float32(v.width);
+    w.float32(v.height);
+    w.float32(v.colorR);
+    w.float32(v.colorG);
+    w.float32(v.colorB);
+    w.float32(v.colorA);
+    w.float32(v.health);
+    w.float32(v.maxHealth);
+    w.bool(v.isDead);
+    w.float32(v.direction);
+    w.int32(v.faceDirection);
+    w.float32(v.velocityX);
+    w.float32(v.velocityY);
+    w.int32(v.teamId);
+}
+
+function readPlayer(r) {
+    const v = {};
+    v.id = r.int32();
+    v.name = textDecoder.decode(r.bytes(r.int32()));
+    v.x = r.float32();
+    v.y = r.float32();
+    v.width = r.float32();
+    v.height = r.float32();
+    v.colorR = r.float32();
+    v.colorG = r.float32();
+    v.colorB = r.float32();
+    v.colorA = r.float32();
+    v.health = r.float32();
+    v.maxHealth = r.float32();
+    v.isDead = r.bool();
+    v.direction = r.remaining() > 0 ? r.float32() : 0;
+    v.faceDirection = r.remaining() > 0 ? r.int32() : 1;
+    v.velocityX = r.remaining() > 0 ? r.float32() : 0;
+    v.velocityY = r.remaining() > 0 ? r.float32() : 0;
+    v.teamId = r.remaining() > 0 ? r.int32() : 0;
+    return v;
+}
+
+function writeChatMessage(w, v) {
+    w.int32(v.playerId);
+    const messageBytes = textEncoder.encode(v.message ?? '');
+    if (messageBytes.length > 256) throw new RangeError('ChatMessage.message is too long');
+    w.int32(messageBytes.length);
+    w.bytes(messageBytes);
+}
+
+function readChatMessage(r) {
+    const v = {};
+    v.playerId = r.int32();
+    v.message = textDecoder.decode(r.bytes(r.int32()));
+    return v;
+}
+
+function writeGunFire(w, v) {
+    w.int32(v.playerId);
+    w.float32(v.x);
+    w.float32(v.y);
+    w.float32(v.angle);
+    w.float32(v.damage);
+    w.int32(v.weaponId);
+}
+
+function readGunFire(r) {
+    const v = {};
+    v.playerId = r.int32();
+    v.x = r.float32();
+    v.y = r.float32();
+    v.angle = r.float32();
+    v.damage = r.float32();
+    v.weaponId = r.remaining() > 0 ? r.int32() : 0;
+    return v;
+}
+
+function writeHitReport(w, v) {
+    w.int32(v.shooterId);
+    w.int32(v.targetId);
+    w.float32(v.damage);
+}
+
+function readHitReport(r) {
+    const v = {};
+    v.shooterId = r.int32();
+    v.targetId = r.int32();
+    v.damage = r.float32();
+    return v;
+}
+
+function writePlatformDestroy(w, v) {
+    w.int32(v.platformId);
+    w.int32(v.shooterId);
+}
+
+function readPlatformDestroy(r) {
+    const v = {};
+    v.platformId = r.int32();
+    v.shooterId = r.int32();
+    return v;
+}
+
+function writeFragment(w, v) {
+    w.int32(v.id);
+    w.int32(v.originalEntityId);
+    w.float32(v.x);
+    w.float32(v.y);
+    w.float32(v.width);
+    w.float32(v.height);
+    w.float32(v.velocityX);
+    w.float32(v.velocityY);
+    w.float32(v.colorR);
+    w.float32(v.colorG);
+    w.float32(v.colorB);
+    w.float32(v.colorA);
+}
+
+function readFragment(r) {
+    const v = {};
+    v.id = r.int32();
+    v.originalEntityId = r.int32();
+    v.x = r.float32();
+    v.y = r.float32();
+    v.width = r.float32();
+    v.height = r.float32();
+    v.velocityX = r.float32();
+    v.velocityY = r.float32();
+    v.colorR = r.float32();
+    v.colorG = r.float32();
+    v.colorB = r.float32();
+    v.colorA = r.float32();
+    return v;
+}
+
+function writeFragmentDestroy(w, v) {
+    w.int32(v.fragmentId);
+}
+
+function readFragmentDestroy(r) {
+    const v = {};
+    v.fragmentId = r.int32();
+    return v;
+}
+
+function writeGunAttachment(w, v) {
+    w.int32(v.gunId);
+    w.int32(v.playerId);
+    w.float32(v.offsetX);
+    w.float32(v.offsetY);
+    w.float32(v.rotation);
+    w.int32(v.weaponId);
+}
+
+function readGunAttachment(r) {
+    const v = {};
+    v.gunId = r.int32();
+    v.playerId = r.int32();
+    v.offsetX = r.float32();
+    v.offsetY = r.float32();
+    v.rotation = r.float32();
+    v.weaponId = r.remaining() > 0 ? r.int32() : 0;
+    return v;
+}
+
+function writeScoreEntry(w, v) {
+    w.int32(v.playerId);
+    w.int32(v.kills);
+    w.int32(v.deaths);
+    w.int32(v.assists);
+    w.int32(v.teamId);
+}
+
+function readScoreEntry(r) {
+    const v = {};
+    v.playerId = r.int32();
+    v.kills = r.int32();
+    v.deaths = r.int32();
+    v.assists = r.int32();
+    v.teamId = r.int32();
+    return v;
+}
+
+function writeMatchState(w, v) {
+    w.uint8(v.phase);
+    w.float32(v.timeRemaining);
+    w.int32(v.scoreLimit);
+    w.int32(v.winnerId);
+    w.uint8(v.mode);
+    w.int32(v.winnerTeamId);
+}
+
+function readMatchState(r) {
+    const v = {};
+    v.phase = r.uint8();
+    v.timeRemaining = r.float32();
+    v.scoreLimit = r.int32();
+    v.winnerId = r.int32();
+    v.mode = r.uint8();
+    v.winnerTeamId = r.int32();
+    return v;
+}
+
+function writeProjectile(w, v) {
+    w.int32(v.id);
+    w.int32(v.shooterId);
+    w.int32(v.weaponId);
+    w.float32(v.x);
+    w.float32(v.y);
+    w.float32(v.velocityX);
+    w.float32(v.velocityY);
+    w.float32(v.gravity);
+    w.uint32(v.tick);
+}
+
+function readProjectile(r) {
+    const v = {};
+    v.id = r.int32();
+    v.shooterId = r.int32();
+    v.weaponId = r.int32();
+    v.x = r.float32();
+    v.y = r.float32();
+    v.velocityX = r.float32();
+    v.velocityY = r.float32();
+    v.gravity = r.float32();
+    v.tick = r.uint32();
+    return v;
+}
+
+function writeProjectileImpact(w, v) {
+    w.int32(v.projectileId);
+    w.int32(v.shooterId);
+    w.uint8(v.kind);
+    w.int32(v.targetId);
+    w.float32(v.x);
+    w.float32(v.y);
+    w.float32(v.normalX);
+    w.float32(v.normalY);
+    w.float32(v.damage);
+}
+
+function readProjectileImpact(r) {
+    const v = {};
+    v.projectileId = r.int32();
+    v.shooterId = r.int32();
+    v.kind = r.uint8();
+    v.targetId = r.int32();
+    v.x = r.float32();
+    v.y = r.float32();
+    v.normalX = r.float32();
+    v.normalY = r.float32();
+    v.damage = r.float32();
+    return v;
+}
+
+function writeTerrainState(w, v) {
+    w.int32(v.destroyedPlatforms.length);
+    for (const elem of v.destroyedPlatforms) {
+        w.int32(elem);
+    }
+    w.int32(v.fragments.length);
+    for (const elem of v.fragments) {
+        writeFragment(w, elem);
+    }
+}
+
+function readTerrainState(r) {
+    const v = {};
+    const destroyedPlatformsCount = r.int32();
+    v.destroyedPlatforms = [];
+    for (let i = 0; i < destroyedPlatformsCount; i++) {
+        v.destroyedPlatforms.push(r.int32());
+    }
+    const fragmentsCount = r.int32();
+    v.fragments = [];
+    for (let i = 0; i < fragmentsCount; i++) {
+        v.fragments.push(readFragment(r));
+    }
+    return v;
+}
+
+function writeHello(w, v) {
+    w.uint16(v.version);
+    const clientBuildBytes = textEncoder.encode(v.clientBuild ?? '');
+    if (clientBuildBytes.length > 64) throw new RangeError('Hello.clientBuild is too long');
+    w.uint8(clientBuildBytes.length);
+    w.bytes(clientBuildBytes);
+    w.uint32(v.features);
+}
+
+function readHello(r) {
+    const v = {};
+    v.version = r.uint16();
+    v.clientBuild = textDecoder.decode(r.bytes(r.uint8()));
+    v.features = r.uint32();
+    return v;
+}
+
+function writeWelcome(w, v) {
+    w.uint16(v.version);
+    w.int32(v.playerId);
+    w.uint16(v.tickRate);
+    w.uint32(v.features);
+}
+
+function readWelcome(r) {
+    const v = {};
+    v.version = r.uint16();
+    v.playerId = r.int32();
+    v.tickRate = r.uint16();
+    v.features = r.uint32();
+    return v;
+}
+
+// Encode a PlayerUpdate message
+export function encodePlayerUpdate(message) {
+    const w = new Writer();
+    w.uint8(MessageTypes.PLAYER_UPDATE);
+    writePlayer(w, message.player);
+    return w.finish();
+}
+
+// Encode a ChatMessage message
+export function encodeChatMessage(message) {
+    const w = new Writer();
+    w.uint8(MessageTypes.CHAT_MESSAGE);
+    writeChatMessage(w, message.chat);
+    return w.finish();
+}
+
+// Encode a GunFire message
+export function encodeGunFire(message) {
+    const w = new Writer();
+    w.uint8(MessageTypes.GUN_FIRE);
+    writeGunFire(w, message.fire);
+    return w.finish();
+}
+
+// Encode a HitReport message
+export function encodeHitReport(message) {
+    const w = new Writer();
+    w.uint8(MessageTypes.HIT_REPORT);
+    writeHitReport(w, message.hit);
+    return w.finish();
+}
+
+// Encode a PlayerJoin message
+export function encodePlayerJoin(message) {
+    const w = new Writer();
+    w.uint8(MessageTypes.PLAYER_JOIN);
+    w.int32(message.playerId);
+    return w.finish();
+}
+
+// Encode a PlayerLeave message
+export function encodePlayerLeave(message) {
+    const w = new Writer();
+    w.uint8(MessageTypes.PLAYER_LEAVE);
+    w.int32(message.playerId);
+    return w.finish();
+}
+
+// Encode a PlatformDestroy message
+export function encodePlatformDestroy(message) {
+    const w = new Writer();
+    w.uint8(MessageTypes.PLATFORM_DESTROY);
+    writePlatformDestroy(w, message.destroy);
+    return w.finish();
+}
+
+// Encode a FragmentCreate message
+export function encodeFragmentCreate(message) {
+    const w = new Writer();
+    w.uint8(MessageTypes.FRAGMENT_CREATE);
+    writeFragment(w, message.fragment);
+    return w.finish();
+}
+
+// Encode a FragmentDestroy message
+export function encodeFragmentDestroy(message) {
+    const w = new Writer();
+    w.uint8(MessageTypes.FRAGMENT_DESTROY);
+    writeFragmentDestroy(w, message.destroy);
+    return w.finish();
+}
+
+// Encode a GunAttachment message
+export function encodeGunAttachment(message) {
+    const w = new Writer();
+    w.uint8(MessageTypes.GUN_ATTACHMENT);
+    writeGunAttachment(w, message.attachment);
+    return w.finish();
+}
+
+// Encode a TeamSwitch message
+export function encodeTeamSwitch(message) {
+    const w = new Writer();
+    w.uint8(MessageTypes.TEAM_SWITCH);
+    w.int32(message.teamId);
+    return w.finish();
+}
+
+// Encode a SnapshotAck message
+export function encodeSnapshotAck(message) {
+    const w = new Writer();
+    w.uint8(MessageTypes.SNAPSHOT_ACK);
+    w.uint32(message.tick);
+    return w.finish();
+}
+
+// Encode a Hello message
+export function encodeHello(message) {
+    const w = new Writer();
+    w.uint8(MessageTypes.HELLO);
+    writeHello(w, message.hello);
+    return w.finish();
+}
+
+// Decode a BroadcastPlayerUpdate message, from just after its type
+export function decodeBroadcastPlayerUpdate(view, offset) {
+    const r = new Reader(view, offset);
+    const message = { type: 'BroadcastPlayerUpdate' };
+    message.player = readPlayer(r);
+    return message;
+}
+
+// Decode a BroadcastChatMessage message, from just after its type
+export function decodeBroadcastChatMessage(view, offset) {
+    const r = new Reader(view, offset);
+    const message = { type: 'BroadcastChatMessage' };
+    message.chat = readChatMessage(r);
+    return message;
+}
+
+// Decode a BroadcastGunFire message, from just after its type
+export function decodeBroadcastGunFire(view, offset) {
+    const r = new Reader(view, offset);
+    const message = { type: 'BroadcastGunFire' };
+    message.fire = readGunFire(r);
+    return message;
+}
+
+// Decode a BroadcastHitReport message, from just after its type
+export function decodeBroadcastHitReport(view, offset) {
+    const r = new Reader(view, offset);
+    const message = { type: 'BroadcastHitReport' };
+    message.hit = readHitReport(r);
+    return message;
+}
+
+// Decode a BroadcastPlayerJoin message, from just after its type
+export function decodeBroadcastPlayerJoin(view, offset) {
+    const r = new Reader(view, offset);
+    const message = { type: 'BroadcastPlayerJoin' };
+    message.playerId = r.int32();
+    return message;
+}
+
+// Decode a BroadcastPlayerLeave message, from just after its type
+export function decodeBroadcastPlayerLeave(view, offset) {
+    const r = new Reader(view, offset);
+    const message = { type: 'BroadcastPlayerLeave' };
+    message.playerId = r.int32();
+    return message;
+}
+
+// Decode an InitialState message, from just after its type
+export function decodeInitialState(view, offset) {
+    const r = new Reader(view, offset);
+    const message = { type: 'InitialState' };
+    const playersCount = r.int32();
+    message.players = [];
+    for (let i = 0; i < playersCount; i++) {
+        message.players.push(readPlayer(r));
+    }
+    return message;
+}
+
+// Decode a BroadcastPlatformDestroy message, from just after its type
+export function decodeBroadcastPlatformDestroy(view, offset) {
+    const r = new Reader(view, offset);
+    const message = { type: 'BroadcastPlatformDestroy' };
+    message.destroy = readPlatformDestroy(r);
+    return message;
+}
+
+// Decode a BroadcastFragmentCreate message, from just after its type
+export function decodeBroadcastFragmentCreate(view, offset) {
+    const r = new Reader(view, offset);
+    const message = { type: 'BroadcastFragmentCreate' };
+    message.fragment = readFragment(r);
+    return message;
+}
+
+// Decode a BroadcastFragmentDestroy message, from just after its type
+export function decodeBroadcastFragmentDestroy(view, offset) {
+    const r = new Reader(view, offset);
+    const message = { type: 'BroadcastFragmentDestroy' };
+    message.destroy = readFragmentDestroy(r);
+    return message;
+}
+
+// Decode a BroadcastGunAttachment message, from just after its type
+export function decodeBroadcastGunAttachment(view, offset) {
+    const r = new Reader(view, offset);
+    const message = { type: 'BroadcastGunAttachment' };
+    message.attachment = readGunAttachment(r);
+    return message;
+}
+
+// Decode a ScoreboardUpdate message, from just after its type
+export function decodeScoreboardUpdate(view, offset) {
+    const r = new Reader(view, offset);
+    const message = { type: 'ScoreboardUpdate' };
+    const entriesCount = r.uint16();
+    message.entries = [];
+    for (let i = 0; i < entriesCount; i++) {
+        message.entries.push(readScoreEntry(r));
+    }
+    return message;
+}
+
+// Decode a MatchState message, from just after its type
+export function decodeMatchState(view, offset) {
+    const r = new Reader(view, offset);
+    const message = { type: 'MatchState' };
+    message.state = readMatchState(r);
+    return message;
+}
+
+// Decode a PlayerLeaveView message, from just after its type
+export function decodePlayerLeaveView(view, offset) {
+    const r = new Reader(view, offset);
+    const message = { type: 'PlayerLeaveView' };
+    message.playerId = r.int32();
+    return message;
+}
+
+// Decode a ProjectileSpawn message, from just after its type
+export function decodeProjectileSpawn(view, offset) {
+    const r = new Reader(view, offset);
+    const message = { type: 'ProjectileSpawn' };
+    message.projectile = readProjectile(r);
+    return message;
+}
+
+// Decode a ProjectileImpact message, from just after its type
+export function decodeProjectileImpact(view, offset) {
+    const r = new Reader(view, offset);
+    const message = { type: 'ProjectileImpact' };
+    message.impact = readProjectileImpact(r);
+    return message;
+}
+
+// Decode a TerrainState message, from just after its type
+export function decodeTerrainState(view, offset) {
+    const r = new Reader(view, offset);
+    const message = { type: 'TerrainState' };
+    message.state = readTerrainState(r);
+    return message;
+}
+
+// Decode a PlatformRestore message, from just after its type
+export function decodePlatformRestore(view, offset) {
+    const r = new Reader(view, offset);
+    const message = { type: 'PlatformRestore' };
+    message.platformId = r.int32();
+    return message;
+}
+
+// Decode a Welcome message, from just after its type
+export function decodeWelcome(view, offset) {
+    const r = new Reader(view, offset);
+    const message = { type: 'Welcome' };
+    message.welcome = readWelcome(r);
+    return message;
+}
+
+// Decoders of the messages above, by type
+export const decoders = {
+    [MessageTypes.BROADCAST_PLAYER_UPDATE]: decodeBroadcastPlayerUpdate,
+    [MessageTypes.BROADCAST_CHAT_MESSAGE]: decodeBroadcastChatMessage,
+    [MessageTypes.BROADCAST_GUN_FIRE]: decodeBroadcastGunFire,
+    [MessageTypes.BROADCAST_HIT_REPORT]: decodeBroadcastHitReport,
+    [MessageTypes.BROADCAST_PLAYER_JOIN]: decodeBroadcastPlayerJoin,
+    [MessageTypes.BROADCAST_PLAYER_LEAVE]: decodeBroadcastPlayerLeave,
+    [MessageTypes.INITIAL_STATE]: decodeInitialState,
+    [MessageTypes.BROADCAST_PLATFORM_DESTROY]: decodeBroadcastPlatformDestroy,
+    [MessageTypes.BROADCAST_FRAGMENT_CREATE]: decodeBroadcastFragmentCreate,
+    [MessageTypes.BROADCAST_FRAGMENT_DESTROY]: decodeBroadcastFragmentDestroy,
+    [MessageTypes.BROADCAST_GUN_ATTACHMENT]: decodeBroadcastGunAttachment,
+    [MessageTypes.SCOREBOARD_UPDATE]: decodeScoreboardUpdate,
+    [MessageTypes.MATCH_STATE]: decodeMatchState,
+    [MessageTypes.PLAYER_LEAVE_VIEW]: decodePlayerLeaveView,
+    [MessageTypes.PROJECTILE_SPAWN]: decodeProjectileSpawn,
+    [MessageTypes.PROJECTILE_IMPACT]: decodeProjectileImpact,
+    [MessageTypes.TERRAIN_STATE]: decodeTerrainState,
+    [MessageTypes.PLATFORM_RESTORE]: decodePlatformRestore,
+    [MessageTypes.WELCOME]: decodeWelcome,
+};
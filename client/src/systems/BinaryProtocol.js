@@ -1,98 +1,37 @@
 // BinaryProtocol.js - Client-side implementation of the binary protocol
+//
+// Most messages are encoded and decoded by BinaryMessages.js, which is
+// generated from the server's protocol schema (run go generate in
+// go-gameserver/protocol after changing it). This module keeps the encoders'
+// original signatures, turns decoded messages into the shapes the rest of the
+// client uses, and handles the messages the schema leaves to hand-written code.
 
-// Message types
-const MessageTypes = {
-    // Client -> Server messages
-    PLAYER_UPDATE: 1,
-    CHAT_MESSAGE: 2,
-    GUN_FIRE: 3,
-    HIT_REPORT: 4,
-    PLAYER_JOIN: 5,
-    PLAYER_LEAVE: 6,
-    PLATFORM_DESTROY: 7,
-    FRAGMENT_CREATE: 8,
-    FRAGMENT_DESTROY: 9,
-    GUN_ATTACHMENT: 10,
-
-    // Server -> Client messages
-    BROADCAST_PLAYER_UPDATE: 101,
-    BROADCAST_CHAT_MESSAGE: 102,
-    BROADCAST_GUN_FIRE: 103,
-    BROADCAST_HIT_REPORT: 104,
-    BROADCAST_PLAYER_JOIN: 105,
-    BROADCAST_PLAYER_LEAVE: 106,
-    INITIAL_STATE: 107,
-    BROADCAST_PLATFORM_DESTROY: 108,
-    BROADCAST_FRAGMENT_CREATE: 109,
-    BROADCAST_FRAGMENT_DESTROY: 110,
-    BROADCAST_GUN_ATTACHMENT: 111
-};
-
-// Encode a player update message
-function encodePlayerUpdate(player) {
-    // Calculate buffer size
-    const nameBytes = new TextEncoder().encode(player.name || '');
-    const bufferSize =
-        1 + // Message type
-        4 + // Player ID
-        4 + // Name length
-        nameBytes.length + // Name
-        4 + // X
-        4 + // Y
-        4 + // Width
-        4 + // Height
-        4 + // Color R
-        4 + // Color G
-        4 + // Color B
-        4 + // Color A
-        4 + // Health
-        4 + // Max Health
-        1 + // Is Dead
-        4 + // Direction
-        4 + // FaceDirection
-        4 + // VelocityX
-        4;  // VelocityY
-
-    // Create buffer
-    const buffer = new ArrayBuffer(bufferSize);
-    const view = new DataView(buffer);
-    let offset = 0;
-
-    // Write message type
-    view.setUint8(offset, MessageTypes.PLAYER_UPDATE);
-    offset += 1;
-
-    // Write player ID
-    view.setInt32(offset, player.id, true);
-    offset += 4;
+import * as Messages from './BinaryMessages.js';
 
-    // Write player name
-    view.setInt32(offset, nameBytes.length, true);
-    offset += 4;
-    
-    for (let i = 0; i < nameBytes.length; i++) {
-        view.setUint8(offset + i, nameBytes[i]);
+// Message types
+const { MessageTypes } = Messages;
+
+// Longest strings the server accepts, in UTF-8 bytes
+const MAX_CLIENT_BUILD_LENGTH = 64;
+const MAX_PLAYER_NAME_LENGTH = 32;
+const MAX_CHAT_MESSAGE_LENGTH = 256;
+
+// Cut a string short enough to encode to at most maxLength bytes of UTF-8
+function truncate(text, maxLength) {
+    const encoder = new TextEncoder();
+    let result = text || '';
+    while (encoder.encode(result).length > maxLength) {
+        result = result.slice(0, -1);
     }
-    offset += nameBytes.length;
-
-    // Write player position and dimensions
-    view.setFloat32(offset, player.x, true);
-    offset += 4;
-    
-    view.setFloat32(offset, player.y, true);
-    offset += 4;
-    
-    view.setFloat32(offset, player.width, true);
-    offset += 4;
-    
-    view.setFloat32(offset, player.height, true);
-    offset += 4;
+    return result;
+}
 
-    // Parse and write player color
+// Split a player's color string into the components the wire format carries
+function parseColor(color) {
     let colorR = 1.0, colorG = 1.0, colorB = 1.0, colorA = 1.0;
-    if (player.color) {
+    if (color) {
         try {
-            const colorArray = JSON.parse(player.color);
+            const colorArray = JSON.parse(color);
             colorR = colorArray[0] || 1.0;
             colorG = colorArray[1] || 1.0;
             colorB = colorArray[2] || 1.0;
@@ -101,262 +40,242 @@ function encodePlayerUpdate(player) {
             console.error("Error parsing color:", e);
         }
     }
-    
-    view.setFloat32(offset, colorR, true);
-    offset += 4;
-    
-    view.setFloat32(offset, colorG, true);
-    offset += 4;
-    
-    view.setFloat32(offset, colorB, true);
-    offset += 4;
-    
-    view.setFloat32(offset, colorA, true);
-    offset += 4;
+    return { colorR, colorG, colorB, colorA };
+}
 
-    // Write player health
-    view.setFloat32(offset, player.health || 100, true);
-    offset += 4;
-    
-    view.setFloat32(offset, player.maxHealth || 100, true);
-    offset += 4;
+// Give a decoded player the color string the rest of the client uses
+function withColor(player) {
+    player.color = JSON.stringify([player.colorR, player.colorG, player.colorB, player.colorA]);
+    return player;
+}
 
-    // Write player is dead flag
-    view.setUint8(offset, player.isDead ? 1 : 0);
-    offset += 1;
+// Encode a player update message
+function encodePlayerUpdate(player) {
+    return Messages.encodePlayerUpdate({
+        player: {
+            id: player.id,
+            name: truncate(player.name, MAX_PLAYER_NAME_LENGTH),
+            x: player.x,
+            y: player.y,
+            width: player.width,
+            height: player.height,
+            ...parseColor(player.color),
+            health: player.health || 100,
+            maxHealth: player.maxHealth || 100,
+            isDead: player.isDead,
+            direction: player.direction || 0,
+            faceDirection: player.faceDirection || 1,
+            velocityX: player.velocityX || 0,
+            velocityY: player.velocityY || 0,
+            teamId: player.teamId || 0
+        }
+    });
+}
 
-    // Write player direction and face direction
-    view.setFloat32(offset, player.direction || 0, true);
-    offset += 4;
-    
-    view.setInt32(offset, player.faceDirection || 1, true);
-    offset += 4;
-    
-    // Write player velocity
-    view.setFloat32(offset, player.velocityX || 0, true);
-    offset += 4;
-    
-    view.setFloat32(offset, player.velocityY || 0, true);
-    offset += 4;
+// Input button flags
+const InputButtons = {
+    JUMP: 1 << 0,
+    FIRE: 1 << 1
+};
 
-    return buffer;
-}
+// Match phases sent in match state messages
+const MatchPhases = {
+    WARMUP: 0,
+    LIVE: 1,
+    ENDED: 2
+};
 
-// Encode a chat message
-function encodeChatMessage(playerId, message) {
-    const messageBytes = new TextEncoder().encode(message);
-    const bufferSize = 
-        1 + // Message type
-        4 + // Player ID
-        4 + // Message length
-        messageBytes.length; // Message
+// Protocol version this client speaks, sent in Hello
+const PROTOCOL_VERSION = 1;
 
-    const buffer = new ArrayBuffer(bufferSize);
-    const view = new DataView(buffer);
-    let offset = 0;
+// Optional features negotiated in Hello and Welcome
+const Features = {
+    QUANTIZED: 1 << 0,
+    SERVER_PROJECTILES: 1 << 1
+};
 
-    // Write message type
-    view.setUint8(offset, MessageTypes.CHAT_MESSAGE);
-    offset += 1;
+// Close codes the server rejects a Hello with
+const CloseCodes = {
+    HELLO_REQUIRED: 4000,
+    VERSION_UNSUPPORTED: 4001,
+    FEATURE_MISSING: 4002,
+    JSON_DISABLED: 4003
+};
 
-    // Write player ID
-    view.setInt32(offset, playerId, true);
-    offset += 4;
+// WebSocket subprotocols, preferred first. The quantized one makes the server
+// send messages carrying positions with compact fixed-point fields.
+const Protocols = ['gta-binary-v2', 'gta-binary-v1'];
 
-    // Write message
-    view.setInt32(offset, messageBytes.length, true);
-    offset += 4;
-    
-    for (let i = 0; i < messageBytes.length; i++) {
-        view.setUint8(offset + i, messageBytes[i]);
-    }
+// Steps of the quantized wire format's fixed-point fields, as on the server
+const VELOCITY_STEP = 1 / 8;
+const HEALTH_STEP = 1 / 10;
+const ANGLE_STEP = 2 * Math.PI / 65536;
 
-    return buffer;
+// Area positions are quantized across, sent by the server before any quantized message
+let quantization = null;
+
+// Decode a quantized position along one axis
+function dequantizePosition(value, min, max) {
+    return min + value / 65535 * (max - min);
 }
 
-// Encode a gun fire message
-function encodeGunFire(playerId, x, y, angle, damage) {
-    const bufferSize = 
+// Player fields named in a world snapshot's per-player change mask
+const PlayerFields = {
+    NAME: 1 << 0,
+    X: 1 << 1,
+    Y: 1 << 2,
+    WIDTH: 1 << 3,
+    HEIGHT: 1 << 4,
+    COLOR_R: 1 << 5,
+    COLOR_G: 1 << 6,
+    COLOR_B: 1 << 7,
+    COLOR_A: 1 << 8,
+    HEALTH: 1 << 9,
+    MAX_HEALTH: 1 << 10,
+    IS_DEAD: 1 << 11,
+    DIRECTION: 1 << 12,
+    FACE_DIRECTION: 1 << 13,
+    VELOCITY_X: 1 << 14,
+    VELOCITY_Y: 1 << 15,
+    TEAM_ID: 1 << 16
+};
+
+// Encode an input command (one frame of player input)
+function encodeInputCommand(input) {
+    const bufferSize =
         1 + // Message type
-        4 + // Player ID
-        4 + // X
-        4 + // Y
-        4 + // Angle
-        4;  // Damage
+        4 + // Sequence
+        4 + // Tick
+        4 + // Move X
+        4 + // Move Y
+        4 + // Aim angle
+        1;  // Buttons
 
     const buffer = new ArrayBuffer(bufferSize);
     const view = new DataView(buffer);
     let offset = 0;
 
     // Write message type
-    view.setUint8(offset, MessageTypes.GUN_FIRE);
+    view.setUint8(offset, MessageTypes.INPUT_COMMAND);
     offset += 1;
 
-    // Write player ID
-    view.setInt32(offset, playerId, true);
-    offset += 4;
-
-    // Write position and angle
-    view.setFloat32(offset, x, true);
-    offset += 4;
-    
-    view.setFloat32(offset, y, true);
-    offset += 4;
-    
-    view.setFloat32(offset, angle, true);
+    // Write sequence number and tick
+    view.setUint32(offset, input.sequence, true);
     offset += 4;
     
-    view.setFloat32(offset, damage, true);
+    view.setUint32(offset, input.tick || 0, true);
     offset += 4;
 
-    return buffer;
-}
-
-// Encode a hit report message
-function encodeHitReport(shooterId, targetId, damage) {
-    const bufferSize = 
-        1 + // Message type
-        4 + // Shooter ID
-        4 + // Target ID
-        4;  // Damage
-
-    const buffer = new ArrayBuffer(bufferSize);
-    const view = new DataView(buffer);
-    let offset = 0;
-
-    // Write message type
-    view.setUint8(offset, MessageTypes.HIT_REPORT);
-    offset += 1;
-
-    // Write shooter and target IDs
-    view.setInt32(offset, shooterId, true);
+    // Write movement axes
+    view.setFloat32(offset, input.moveX || 0, true);
     offset += 4;
     
-    view.setInt32(offset, targetId, true);
+    view.setFloat32(offset, input.moveY || 0, true);
     offset += 4;
 
-    // Write damage
-    view.setFloat32(offset, damage, true);
+    // Write aim angle
+    view.setFloat32(offset, input.aimAngle || 0, true);
     offset += 4;
 
+    // Write button flags
+    let buttons = 0;
+    if (input.jump) buttons |= InputButtons.JUMP;
+    if (input.fire) buttons |= InputButtons.FIRE;
+    view.setUint8(offset, buttons);
+    offset += 1;
+
     return buffer;
 }
 
-// Encode a platform destroy message
-function encodePlatformDestroy(platformId, shooterId) {
-    const bufferSize = 
-        1 + // Message type
-        4 + // Platform ID
-        4;  // Shooter ID (who destroyed it)
 
-    const buffer = new ArrayBuffer(bufferSize);
-    const view = new DataView(buffer);
-    let offset = 0;
+// Encode a chat message
+function encodeChatMessage(playerId, message) {
+    // Messages longer than the server accepts are cut short
+    message = truncate(message, MAX_CHAT_MESSAGE_LENGTH);
+    return Messages.encodeChatMessage({ chat: { playerId, message } });
+}
 
-    // Write message type
-    view.setUint8(offset, MessageTypes.PLATFORM_DESTROY);
-    offset += 1;
+// Encode a gun fire message
+function encodeGunFire(playerId, x, y, angle, damage, weaponId = 0) {
+    return Messages.encodeGunFire({ fire: { playerId, x, y, angle, damage, weaponId } });
+}
 
-    // Write platform and shooter IDs
-    view.setInt32(offset, platformId, true);
-    offset += 4;
-    
-    view.setInt32(offset, shooterId, true);
-    offset += 4;
+// Encode a hit report message
+function encodeHitReport(shooterId, targetId, damage) {
+    return Messages.encodeHitReport({ hit: { shooterId, targetId, damage } });
+}
 
-    return buffer;
+// Encode a platform destroy message
+function encodePlatformDestroy(platformId, shooterId) {
+    return Messages.encodePlatformDestroy({ destroy: { platformId, shooterId } });
 }
 
 // Encode a fragment create message
 function encodeFragmentCreate(fragmentData) {
-    const bufferSize = 
-        1 + // Message type
-        4 + // Fragment ID
-        4 + // Original Entity ID
-        4 + // X
-        4 + // Y
-        4 + // Width
-        4 + // Height
-        4 + // Velocity X
-        4 + // Velocity Y
-        4 + // Color R
-        4 + // Color G
-        4 + // Color B
-        4;  // Color A
-
-    const buffer = new ArrayBuffer(bufferSize);
-    const view = new DataView(buffer);
-    let offset = 0;
-
-    // Write message type
-    view.setUint8(offset, MessageTypes.FRAGMENT_CREATE);
-    offset += 1;
-
-    // Write fragment ID
-    view.setInt32(offset, fragmentData.id, true);
-    offset += 4;
-    
-    // Write original entity ID
-    view.setInt32(offset, fragmentData.originalEntityId, true);
-    offset += 4;
-
-    // Write position and dimensions
-    view.setFloat32(offset, fragmentData.x, true);
-    offset += 4;
-    
-    view.setFloat32(offset, fragmentData.y, true);
-    offset += 4;
-    
-    view.setFloat32(offset, fragmentData.width, true);
-    offset += 4;
-    
-    view.setFloat32(offset, fragmentData.height, true);
-    offset += 4;
-    
-    // Write velocity
-    view.setFloat32(offset, fragmentData.velocityX, true);
-    offset += 4;
-    
-    view.setFloat32(offset, fragmentData.velocityY, true);
-    offset += 4;
-
-    // Write color
-    view.setFloat32(offset, fragmentData.colorR, true);
-    offset += 4;
-    
-    view.setFloat32(offset, fragmentData.colorG, true);
-    offset += 4;
-    
-    view.setFloat32(offset, fragmentData.colorB, true);
-    offset += 4;
-    
-    view.setFloat32(offset, fragmentData.colorA, true);
-    offset += 4;
-
-    return buffer;
+    return Messages.encodeFragmentCreate({ fragment: fragmentData });
 }
 
 // Encode a fragment destroy message
 function encodeFragmentDestroy(fragmentId) {
-    const bufferSize = 
-        1 + // Message type
-        4;  // Fragment ID
+    return Messages.encodeFragmentDestroy({ destroy: { fragmentId } });
+}
 
-    const buffer = new ArrayBuffer(bufferSize);
-    const view = new DataView(buffer);
-    let offset = 0;
+// Encode a gun attachment message
+function encodeGunAttachment(gunId, playerId, offsetX, offsetY, rotation, weaponId = 0) {
+    return Messages.encodeGunAttachment({
+        attachment: { gunId, playerId, offsetX, offsetY, rotation, weaponId }
+    });
+}
 
-    // Write message type
-    view.setUint8(offset, MessageTypes.FRAGMENT_DESTROY);
-    offset += 1;
+// Encode a team switch request
+function encodeTeamSwitch(teamId) {
+    return Messages.encodeTeamSwitch({ teamId });
+}
 
-    // Write fragment ID
-    view.setInt32(offset, fragmentId, true);
-    offset += 4;
+// Encode the Hello that opens every connection
+function encodeHello(build, features) {
+    // Builds longer than the server accepts are cut short
+    const clientBuild = truncate(build, MAX_CLIENT_BUILD_LENGTH);
+    return Messages.encodeHello({
+        hello: { version: PROTOCOL_VERSION, clientBuild, features }
+    });
+}
 
-    return buffer;
+// Encode a world snapshot acknowledgement
+function encodeSnapshotAck(tick) {
+    return Messages.encodeSnapshotAck({ tick });
 }
 
+// Turn generated messages into the shapes the rest of the client expects,
+// where the two differ
+const adapters = {
+    [MessageTypes.BROADCAST_PLAYER_UPDATE]: ({ player }) => ({ type: 'PlayerUpdate', player: withColor(player) }),
+    [MessageTypes.BROADCAST_CHAT_MESSAGE]: ({ chat }) => ({ type: 'ChatMessage', ...chat }),
+    [MessageTypes.BROADCAST_GUN_FIRE]: ({ fire }) => ({ type: 'GunFire', ...fire }),
+    [MessageTypes.BROADCAST_HIT_REPORT]: ({ hit }) => ({ type: 'HitReport', ...hit }),
+    [MessageTypes.BROADCAST_PLAYER_JOIN]: ({ playerId }) => ({ type: 'PlayerJoin', playerId }),
+    [MessageTypes.BROADCAST_PLAYER_LEAVE]: ({ playerId }) => ({ type: 'PlayerDisconnect', id: playerId }),
+    [MessageTypes.INITIAL_STATE]: ({ players }) => ({ type: 'InitialState', players: players.map(withColor) }),
+    [MessageTypes.BROADCAST_PLATFORM_DESTROY]: ({ destroy }) => ({ type: 'PlatformDestroy', ...destroy }),
+    [MessageTypes.BROADCAST_FRAGMENT_CREATE]: ({ fragment }) => ({ type: 'FragmentCreate', fragment }),
+    [MessageTypes.BROADCAST_FRAGMENT_DESTROY]: ({ destroy }) => ({ type: 'FragmentDestroy', fragmentId: destroy.fragmentId }),
+    [MessageTypes.BROADCAST_GUN_ATTACHMENT]: ({ attachment }) => ({
+        type: 'GunAttachment',
+        data: {
+            gunId: attachment.gunId,
+            playerId: attachment.playerId,
+            attachmentOffsetX: attachment.offsetX,
+            attachmentOffsetY: attachment.offsetY,
+            rotation: attachment.rotation,
+            weaponId: attachment.weaponId
+        }
+    }),
+    [MessageTypes.MATCH_STATE]: ({ state }) => ({ type: 'MatchState', ...state }),
+    [MessageTypes.PLAYER_LEAVE_VIEW]: ({ playerId }) => ({ type: 'PlayerLeaveView', id: playerId }),
+    [MessageTypes.TERRAIN_STATE]: ({ state }) => ({ type: 'TerrainState', ...state }),
+    [MessageTypes.WELCOME]: ({ welcome }) => ({ type: 'Welcome', ...welcome })
+};
+
 // Decode a message from the server
 function decodeMessage(buffer) {
     const view = new DataView(buffer);
@@ -364,487 +283,328 @@ function decodeMessage(buffer) {
     let offset = 1;
 
     switch (messageType) {
-        case MessageTypes.BROADCAST_PLAYER_UPDATE:
-            return decodeBroadcastPlayerUpdate(view, offset);
-        
-        case MessageTypes.BROADCAST_CHAT_MESSAGE:
-            return decodeBroadcastChatMessage(view, offset);
-        
-        case MessageTypes.BROADCAST_GUN_FIRE:
-            return decodeBroadcastGunFire(view, offset);
-        
-        case MessageTypes.BROADCAST_HIT_REPORT:
-            return decodeBroadcastHitReport(view, offset);
-        
-        case MessageTypes.BROADCAST_PLAYER_JOIN:
-            return decodeBroadcastPlayerJoin(view, offset);
-        
-        case MessageTypes.BROADCAST_PLAYER_LEAVE:
-            return decodeBroadcastPlayerLeave(view, offset);
-        
-        case MessageTypes.INITIAL_STATE:
-            return decodeInitialState(view, offset);
+        case MessageTypes.WORLD_SNAPSHOT:
+            return decodeWorldSnapshot(view, offset);
+
+        case MessageTypes.QUANTIZATION:
+            return decodeQuantization(view, offset);
+            
+        case MessageTypes.QUANTIZED_WORLD_SNAPSHOT:
+            return decodeWorldSnapshot(view, offset, true);
+            
+        case MessageTypes.QUANTIZED_BROADCAST_GUN_FIRE:
+            return decodeQuantizedBroadcastGunFire(view, offset);
             
-        case MessageTypes.BROADCAST_PLATFORM_DESTROY:
-            return decodeBroadcastPlatformDestroy(view, offset);
+        case MessageTypes.QUANTIZED_BROADCAST_PLAYER_UPDATE:
+            return decodeQuantizedBroadcastPlayerUpdate(view, offset);
             
-        case MessageTypes.BROADCAST_FRAGMENT_CREATE:
-            return decodeBroadcastFragmentCreate(view, offset);
+        case MessageTypes.QUANTIZED_PROJECTILE_SPAWN:
+            return decodeQuantizedProjectileSpawn(view, offset);
             
-        case MessageTypes.BROADCAST_FRAGMENT_DESTROY:
-            return decodeBroadcastFragmentDestroy(view, offset);
+        case MessageTypes.PLAYER_ENTER_VIEW:
+            return decodePlayerEnterView(view, offset);
             
-        case MessageTypes.BROADCAST_GUN_ATTACHMENT:
-            return decodeBroadcastGunAttachment(view, offset);
-        
-        default:
-            console.error("Unknown message type:", messageType);
-            return null;
+        case MessageTypes.QUANTIZED_PLAYER_ENTER_VIEW:
+            return decodePlayerEnterView(view, offset, true);
+            
+        case MessageTypes.BUNDLE:
+            return decodeBundle(view, offset);
     }
-}
 
-// Decode a broadcast platform destroy message
-function decodeBroadcastPlatformDestroy(view, offset) {
-    // Read platform and shooter IDs
-    const platformId = view.getInt32(offset, true);
-    offset += 4;
-    
-    const shooterId = view.getInt32(offset, true);
-    offset += 4;
+    const decode = Messages.decoders[messageType];
+    if (!decode) {
+        console.error("Unknown message type:", messageType);
+        return null;
+    }
 
-    return {
-        type: 'PlatformDestroy',
-        platformId: platformId,
-        shooterId: shooterId
-    };
+    const message = decode(view, offset);
+    const adapt = adapters[messageType];
+    return adapt ? adapt(message) : message;
 }
 
-// Decode a broadcast fragment create message
-function decodeBroadcastFragmentCreate(view, offset) {
-    // Read fragment data
-    const fragmentId = view.getInt32(offset, true);
-    offset += 4;
-    
-    const originalEntityId = view.getInt32(offset, true);
-    offset += 4;
-    
-    const x = view.getFloat32(offset, true);
-    offset += 4;
-    
-    const y = view.getFloat32(offset, true);
-    offset += 4;
-    
-    const width = view.getFloat32(offset, true);
-    offset += 4;
-    
-    const height = view.getFloat32(offset, true);
-    offset += 4;
-    
-    const velocityX = view.getFloat32(offset, true);
-    offset += 4;
-    
-    const velocityY = view.getFloat32(offset, true);
-    offset += 4;
-    
-    const colorR = view.getFloat32(offset, true);
-    offset += 4;
-    
-    const colorG = view.getFloat32(offset, true);
-    offset += 4;
-    
-    const colorB = view.getFloat32(offset, true);
-    offset += 4;
-    
-    const colorA = view.getFloat32(offset, true);
-    offset += 4;
+// Decode a bundle of several messages sent in one frame
+function decodeBundle(view, offset) {
+    // Read number of messages
+    const count = view.getUint16(offset, true);
+    offset += 2;
 
-    return {
-        type: 'FragmentCreate',
-        fragment: {
-            id: fragmentId,
-            originalEntityId: originalEntityId,
-            x: x,
-            y: y,
-            width: width,
-            height: height,
-            velocityX: velocityX,
-            velocityY: velocityY,
-            colorR: colorR,
-            colorG: colorG,
-            colorB: colorB,
-            colorA: colorA
+    const messages = [];
+    for (let i = 0; i < count; i++) {
+        // Each message has its length in front
+        const length = view.getUint32(offset, true);
+        offset += 4;
+
+        const start = view.byteOffset + offset;
+        const message = decodeMessage(view.buffer.slice(start, start + length));
+        offset += length;
+
+        if (message) {
+            messages.push(message);
         }
+    }
+
+    return {
+        type: 'Bundle',
+        messages: messages
     };
 }
 
-// Decode a broadcast player update message
-function decodeBroadcastPlayerUpdate(view, offset) {
+// Decode one player's fields that changed since a baseline, returning the
+// player and the offset after it
+function decodePlayerDelta(view, offset, quantized) {
     const player = {};
 
-    // Read player ID
+    // Read player ID and field mask
     player.id = view.getInt32(offset, true);
     offset += 4;
+    
+    const fields = view.getUint32(offset, true);
+    offset += 4;
 
     // Read player name
-    const nameLength = view.getInt32(offset, true);
-    offset += 4;
-    
-    const nameBytes = new Uint8Array(nameLength);
-    for (let i = 0; i < nameLength; i++) {
-        nameBytes[i] = view.getUint8(offset + i);
+    if (fields & PlayerFields.NAME) {
+        const nameLength = view.getInt32(offset, true);
+        offset += 4;
+        player.name = new TextDecoder().decode(new Uint8Array(view.buffer, view.byteOffset + offset, nameLength));
+        offset += nameLength;
     }
-    player.name = new TextDecoder().decode(nameBytes);
-    offset += nameLength;
 
-    // Read player position and dimensions
-    player.x = view.getFloat32(offset, true);
-    offset += 4;
-    
-    player.y = view.getFloat32(offset, true);
-    offset += 4;
-    
-    player.width = view.getFloat32(offset, true);
-    offset += 4;
-    
-    player.height = view.getFloat32(offset, true);
-    offset += 4;
+    // Read the remaining changed fields, in mask order. Quantized snapshots
+    // use fixed-point integers for everything but size and team.
+    const floatField = (field, key) => {
+        if (fields & field) {
+            player[key] = view.getFloat32(offset, true);
+            offset += 4;
+        }
+    };
+    const quantizedField = (field, key, size, read) => {
+        if (fields & field) {
+            player[key] = read(offset);
+            offset += size;
+        }
+    };
+    if (quantized) {
+        const area = quantization;
+        quantizedField(PlayerFields.X, 'x', 2, (o) => dequantizePosition(view.getUint16(o, true), area.minX, area.maxX));
+        quantizedField(PlayerFields.Y, 'y', 2, (o) => dequantizePosition(view.getUint16(o, true), area.minY, area.maxY));
+        floatField(PlayerFields.WIDTH, 'width');
+        floatField(PlayerFields.HEIGHT, 'height');
+        quantizedField(PlayerFields.COLOR_R, 'colorR', 1, (o) => view.getUint8(o) / 255);
+        quantizedField(PlayerFields.COLOR_G, 'colorG', 1, (o) => view.getUint8(o) / 255);
+        quantizedField(PlayerFields.COLOR_B, 'colorB', 1, (o) => view.getUint8(o) / 255);
+        quantizedField(PlayerFields.COLOR_A, 'colorA', 1, (o) => view.getUint8(o) / 255);
+        quantizedField(PlayerFields.HEALTH, 'health', 2, (o) => view.getUint16(o, true) * HEALTH_STEP);
+        quantizedField(PlayerFields.MAX_HEALTH, 'maxHealth', 2, (o) => view.getUint16(o, true) * HEALTH_STEP);
+        quantizedField(PlayerFields.IS_DEAD, 'isDead', 1, (o) => view.getUint8(o) !== 0);
+        quantizedField(PlayerFields.DIRECTION, 'direction', 1, (o) => view.getInt8(o));
+        quantizedField(PlayerFields.FACE_DIRECTION, 'faceDirection', 1, (o) => view.getInt8(o));
+        quantizedField(PlayerFields.VELOCITY_X, 'velocityX', 2, (o) => view.getInt16(o, true) * VELOCITY_STEP);
+        quantizedField(PlayerFields.VELOCITY_Y, 'velocityY', 2, (o) => view.getInt16(o, true) * VELOCITY_STEP);
+        quantizedField(PlayerFields.TEAM_ID, 'teamId', 4, (o) => view.getInt32(o, true));
+    } else {
+        floatField(PlayerFields.X, 'x');
+        floatField(PlayerFields.Y, 'y');
+        floatField(PlayerFields.WIDTH, 'width');
+        floatField(PlayerFields.HEIGHT, 'height');
+        floatField(PlayerFields.COLOR_R, 'colorR');
+        floatField(PlayerFields.COLOR_G, 'colorG');
+        floatField(PlayerFields.COLOR_B, 'colorB');
+        floatField(PlayerFields.COLOR_A, 'colorA');
+        floatField(PlayerFields.HEALTH, 'health');
+        floatField(PlayerFields.MAX_HEALTH, 'maxHealth');
+        if (fields & PlayerFields.IS_DEAD) {
+            player.isDead = view.getUint8(offset) !== 0;
+            offset += 1;
+        }
+        floatField(PlayerFields.DIRECTION, 'direction');
+        if (fields & PlayerFields.FACE_DIRECTION) {
+            player.faceDirection = view.getInt32(offset, true);
+            offset += 4;
+        }
+        floatField(PlayerFields.VELOCITY_X, 'velocityX');
+        floatField(PlayerFields.VELOCITY_Y, 'velocityY');
+        if (fields & PlayerFields.TEAM_ID) {
+            player.teamId = view.getInt32(offset, true);
+            offset += 4;
+        }
+    }
 
-    // Read player color
-    const colorR = view.getFloat32(offset, true);
-    offset += 4;
-    
-    const colorG = view.getFloat32(offset, true);
+    return { player, offset };
+}
+
+// Decode a world snapshot message (dynamic player state for one server tick)
+function decodeWorldSnapshot(view, offset, quantized = false) {
+    // Read tick number, the baseline the deltas are against and our last acknowledged input sequence
+    const tick = view.getUint32(offset, true);
     offset += 4;
     
-    const colorB = view.getFloat32(offset, true);
+    const baselineTick = view.getUint32(offset, true);
     offset += 4;
     
-    const colorA = view.getFloat32(offset, true);
+    const lastInputSequence = view.getUint32(offset, true);
     offset += 4;
-    
-    player.color = JSON.stringify([colorR, colorG, colorB, colorA]);
 
-    // Read player health
-    player.health = view.getFloat32(offset, true);
-    offset += 4;
-    
-    player.maxHealth = view.getFloat32(offset, true);
-    offset += 4;
+    // Read number of players
+    const playerCount = view.getUint16(offset, true);
+    offset += 2;
 
-    // Read player is dead flag
-    player.isDead = view.getUint8(offset) !== 0;
-    offset += 1;
+    // Each player only has the fields that changed since the baseline
+    const players = [];
+    for (let i = 0; i < playerCount; i++) {
+        let player;
+        ({ player, offset } = decodePlayerDelta(view, offset, quantized));
+        players.push(player);
+    }
 
-    // Try to read direction and face direction
-    try {
-        // Read player direction and face direction
-        player.direction = view.getFloat32(offset, true);
-        offset += 4;
-        
-        player.faceDirection = view.getInt32(offset, true);
-        offset += 4;
-        
-        // Read player velocity
-        player.velocityX = view.getFloat32(offset, true);
-        offset += 4;
-        
-        player.velocityY = view.getFloat32(offset, true);
+    // Read players that are no longer sent
+    const removedCount = view.getUint16(offset, true);
+    offset += 2;
+
+    const removed = [];
+    for (let i = 0; i < removedCount; i++) {
+        removed.push(view.getInt32(offset, true));
         offset += 4;
-    } catch (e) {
-        // If we can't read these fields, they might not be present in older messages
-        // Just set default values
-        console.log("Could not read direction/velocity fields, using defaults");
-        player.direction = 0;
-        player.faceDirection = 1;
-        player.velocityX = 0;
-        player.velocityY = 0;
     }
 
     return {
-        type: 'PlayerUpdate',
-        player: player
+        type: 'WorldSnapshot',
+        tick: tick,
+        baselineTick: baselineTick,
+        lastInputSequence: lastInputSequence,
+        players: players,
+        removed: removed
     };
 }
 
-// Decode a broadcast chat message
-function decodeBroadcastChatMessage(view, offset) {
-    // Read player ID
-    const playerId = view.getInt32(offset, true);
-    offset += 4;
-
-    // Read message
-    const messageLength = view.getInt32(offset, true);
-    offset += 4;
-    
-    const messageBytes = new Uint8Array(messageLength);
-    for (let i = 0; i < messageLength; i++) {
-        messageBytes[i] = view.getUint8(offset + i);
-    }
-    const message = new TextDecoder().decode(messageBytes);
-    offset += messageLength;
+// Decode a player coming within our view radius, with their full state
+function decodePlayerEnterView(view, offset, quantized = false) {
+    const { player } = decodePlayerDelta(view, offset, quantized);
 
     return {
-        type: 'ChatMessage',
-        playerId: playerId,
-        message: message
+        type: 'PlayerEnterView',
+        player: withColor(player)
     };
 }
 
-// Decode a broadcast gun fire message
-function decodeBroadcastGunFire(view, offset) {
-    // Read player ID
-    const playerId = view.getInt32(offset, true);
-    offset += 4;
+// Decode the area the server quantizes positions across
+function decodeQuantization(view, offset) {
+    const area = {};
 
-    // Read position and angle
-    const x = view.getFloat32(offset, true);
-    offset += 4;
-    
-    const y = view.getFloat32(offset, true);
+    // Read the area's corners
+    area.minX = view.getFloat32(offset, true);
     offset += 4;
     
-    const angle = view.getFloat32(offset, true);
+    area.minY = view.getFloat32(offset, true);
     offset += 4;
     
-    const damage = view.getFloat32(offset, true);
-    offset += 4;
-
-    return {
-        type: 'GunFire',
-        playerId: playerId,
-        x: x,
-        y: y,
-        angle: angle,
-        damage: damage
-    };
-}
-
-// Decode a broadcast hit report message
-function decodeBroadcastHitReport(view, offset) {
-    // Read shooter and target IDs
-    const shooterId = view.getInt32(offset, true);
+    area.maxX = view.getFloat32(offset, true);
     offset += 4;
     
-    const targetId = view.getInt32(offset, true);
-    offset += 4;
-
-    // Read damage
-    const damage = view.getFloat32(offset, true);
+    area.maxY = view.getFloat32(offset, true);
     offset += 4;
 
+    quantization = area;
     return {
-        type: 'HitReport',
-        shooterId: shooterId,
-        targetId: targetId,
-        damage: damage
+        type: 'Quantization',
+        area: area
     };
 }
 
-// Decode a broadcast player join message
-function decodeBroadcastPlayerJoin(view, offset) {
+// Decode a broadcast gun fire message in the quantized wire format
+function decodeQuantizedBroadcastGunFire(view, offset) {
     // Read player ID
     const playerId = view.getInt32(offset, true);
     offset += 4;
 
-    return {
-        type: 'PlayerJoin',
-        playerId: playerId
-    };
-}
+    // Read position, angle and damage
+    const x = dequantizePosition(view.getUint16(offset, true), quantization.minX, quantization.maxX);
+    offset += 2;
+    
+    const y = dequantizePosition(view.getUint16(offset, true), quantization.minY, quantization.maxY);
+    offset += 2;
+    
+    const angle = view.getUint16(offset, true) * ANGLE_STEP - Math.PI;
+    offset += 2;
+    
+    const damage = view.getUint16(offset, true) * HEALTH_STEP;
+    offset += 2;
 
-// Decode a broadcast player leave message
-function decodeBroadcastPlayerLeave(view, offset) {
-    // Read player ID
-    const playerId = view.getInt32(offset, true);
+    // Read weapon ID
+    const weaponId = view.getInt32(offset, true);
     offset += 4;
 
     return {
-        type: 'PlayerDisconnect',
-        id: playerId
-    };
-}
-
-// Decode an initial state message
-function decodeInitialState(view, offset) {
-    // Read number of players
-    const playerCount = view.getInt32(offset, true);
-    offset += 4;
-
-    const players = [];
-    for (let i = 0; i < playerCount; i++) {
-        const player = {};
-
-        // Read player ID
-        player.id = view.getInt32(offset, true);
-        offset += 4;
-
-        // Read player name
-        const nameLength = view.getInt32(offset, true);
-        offset += 4;
-        
-        const nameBytes = new Uint8Array(nameLength);
-        for (let j = 0; j < nameLength; j++) {
-            nameBytes[j] = view.getUint8(offset + j);
-        }
-        player.name = new TextDecoder().decode(nameBytes);
-        offset += nameLength;
-
-        // Read player position and dimensions
-        player.x = view.getFloat32(offset, true);
-        offset += 4;
-        
-        player.y = view.getFloat32(offset, true);
-        offset += 4;
-        
-        player.width = view.getFloat32(offset, true);
-        offset += 4;
-        
-        player.height = view.getFloat32(offset, true);
-        offset += 4;
-
-        // Read player color
-        const colorR = view.getFloat32(offset, true);
-        offset += 4;
-        
-        const colorG = view.getFloat32(offset, true);
-        offset += 4;
-        
-        const colorB = view.getFloat32(offset, true);
-        offset += 4;
-        
-        const colorA = view.getFloat32(offset, true);
-        offset += 4;
-        
-        player.color = JSON.stringify([colorR, colorG, colorB, colorA]);
-
-        // Read player health
-        player.health = view.getFloat32(offset, true);
-        offset += 4;
-        
-        player.maxHealth = view.getFloat32(offset, true);
-        offset += 4;
-
-        // Read player is dead flag
-        player.isDead = view.getUint8(offset) !== 0;
-        offset += 1;
-
-        // Try to read direction and face direction
-        try {
-            // Read player direction and face direction
-            player.direction = view.getFloat32(offset, true);
-            offset += 4;
-            
-            player.faceDirection = view.getInt32(offset, true);
-            offset += 4;
-            
-            // Read player velocity
-            player.velocityX = view.getFloat32(offset, true);
-            offset += 4;
-            
-            player.velocityY = view.getFloat32(offset, true);
-            offset += 4;
-        } catch (e) {
-            // If we can't read these fields, they might not be present in older messages
-            // Just set default values
-            console.log("Could not read direction/velocity fields in InitialState, using defaults");
-            player.direction = 0;
-            player.faceDirection = 1;
-            player.velocityX = 0;
-            player.velocityY = 0;
-        }
-
-        players.push(player);
-    }
-
-    return {
-        type: 'InitialState',
-        players: players
+        type: 'GunFire',
+        playerId: playerId,
+        x: x,
+        y: y,
+        angle: angle,
+        damage: damage,
+        weaponId: weaponId
     };
 }
 
-// Decode a broadcast fragment destroy message
-function decodeBroadcastFragmentDestroy(view, offset) {
-    // Read fragment ID
-    const fragmentId = view.getInt32(offset, true);
-    offset += 4;
+// Decode a player's full state in the quantized wire format
+function decodeQuantizedBroadcastPlayerUpdate(view, offset) {
+    const { player } = decodePlayerDelta(view, offset, true);
 
     return {
-        type: 'FragmentDestroy',
-        fragmentId: fragmentId
+        type: 'PlayerUpdate',
+        player: withColor(player)
     };
 }
-// Encode a gun attachment message
-function encodeGunAttachment(gunId, playerId, offsetX, offsetY, rotation) {
-    const bufferSize =
-        1 + // Message type
-        4 + // Gun ID
-        4 + // Player ID
-        4 + // Offset X
-        4 + // Offset Y
-        4;  // Rotation
 
-    const buffer = new ArrayBuffer(bufferSize);
-    const view = new DataView(buffer);
-    let offset = 0;
-
-    // Write message type
-    view.setUint8(offset, MessageTypes.GUN_ATTACHMENT);
-    offset += 1;
+// Decode a server-spawned projectile in the quantized wire format
+function decodeQuantizedProjectileSpawn(view, offset) {
+    const projectile = {};
 
-    // Write gun and player IDs
-    view.setInt32(offset, gunId, true);
+    // Read projectile, shooter and weapon IDs
+    projectile.id = view.getInt32(offset, true);
     offset += 4;
     
-    view.setInt32(offset, playerId, true);
-    offset += 4;
-
-    // Write attachment offset and rotation
-    view.setFloat32(offset, offsetX, true);
-    offset += 4;
-    
-    view.setFloat32(offset, offsetY, true);
+    projectile.shooterId = view.getInt32(offset, true);
     offset += 4;
     
-    view.setFloat32(offset, rotation, true);
+    projectile.weaponId = view.getInt32(offset, true);
     offset += 4;
 
-    return buffer;
-}
-
-// Decode a broadcast gun attachment message
-function decodeBroadcastGunAttachment(view, offset) {
-    // Read gun and player IDs
-    const gunId = view.getInt32(offset, true);
-    offset += 4;
+    // Read position and velocity
+    projectile.x = dequantizePosition(view.getUint16(offset, true), quantization.minX, quantization.maxX);
+    offset += 2;
     
-    const playerId = view.getInt32(offset, true);
-    offset += 4;
-
-    // Read attachment offset and rotation
-    const offsetX = view.getFloat32(offset, true);
-    offset += 4;
+    projectile.y = dequantizePosition(view.getUint16(offset, true), quantization.minY, quantization.maxY);
+    offset += 2;
     
-    const offsetY = view.getFloat32(offset, true);
+    projectile.velocityX = view.getInt16(offset, true) * VELOCITY_STEP;
+    offset += 2;
+    
+    projectile.velocityY = view.getInt16(offset, true) * VELOCITY_STEP;
+    offset += 2;
+
+    // Read gravity and spawn tick
+    projectile.gravity = view.getFloat32(offset, true);
     offset += 4;
     
-    const rotation = view.getFloat32(offset, true);
+    projectile.tick = view.getUint32(offset, true);
     offset += 4;
 
     return {
-        type: 'GunAttachment',
-        data: {
-            gunId: gunId,
-            playerId: playerId,
-            attachmentOffsetX: offsetX,
-            attachmentOffsetY: offsetY,
-            rotation: rotation
-        }
+        type: 'ProjectileSpawn',
+        projectile: projectile
     };
 }
 
 export default {
     MessageTypes,
+    Protocols,
+    InputButtons,
+    MatchPhases,
+    PROTOCOL_VERSION,
+    Features,
+    CloseCodes,
+    encodeHello,
     encodePlayerUpdate,
+    encodeInputCommand,
     encodeChatMessage,
     encodeGunFire,
     encodeHitReport,
@@ -852,5 +612,7 @@ export default {
     encodeFragmentCreate,
     encodeFragmentDestroy,
     encodeGunAttachment,
+    encodeTeamSwitch,
+    encodeSnapshotAck,
     decodeMessage
 };
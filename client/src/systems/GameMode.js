@@ -3,6 +3,7 @@
 export const GAME_MODES = {
     FREE_PLAY: 'free_play',
     DEATH_MATCH: 'death_match',
+    TEAM_DEATH_MATCH: 'team_death_match',
     // Add more game modes here as needed
 };
 
@@ -0,0 +1,84 @@
+import { allEntities } from '../configuration/constants.js';
+import Platform from '../entities/platforms/platform.js';
+
+// Movement constants, matching the server's world.go so predicted movement
+// lands where the server will put us
+const Movement = {
+    GRAVITY: 2480,          // px/s²
+    JUMP_SPEED: 1425,       // px/s
+    RUN_ACCELERATION: 4800, // px/s²
+    MAX_RUN_SPEED: 400,     // px/s
+    MAX_FALL_SPEED: 2000,   // px/s
+    GROUND_FRICTION: 0.82,  // Velocity kept per 60 fps frame on the ground
+    AIR_FRICTION: 0.85,     // Velocity kept per 60 fps frame in the air
+    PLAYER_WIDTH: 50,
+    PLAYER_HEIGHT: 70
+};
+
+// Whether a rectangle overlaps any platform we collide with
+function solidAt(x, y, width, height) {
+    for (const entity of allEntities) {
+        if (!(entity instanceof Platform) || !entity.hasCollision) continue;
+        if (x < entity.x + entity.width && x + width > entity.x &&
+            y < entity.y + entity.height && y + height > entity.y) {
+            return true;
+        }
+    }
+    return false;
+}
+
+// Whether a player state is standing on a platform
+function isGrounded(state) {
+    return solidAt(state.x, state.y + 1, state.width, state.height);
+}
+
+// Advance a player state by one input command's worth of time, the way the
+// server's applyInput does. state: { x, y, velocityX, velocityY, width,
+// height, grounded }, modified in place.
+function applyInput(state, input, dt) {
+    const moveX = Math.max(-1, Math.min(1, input.moveX || 0));
+
+    // Run
+    state.velocityX += moveX * Movement.RUN_ACCELERATION * dt;
+    state.velocityX = Math.max(-Movement.MAX_RUN_SPEED, Math.min(Movement.MAX_RUN_SPEED, state.velocityX));
+
+    // Jump
+    if (input.jump && state.grounded) {
+        state.velocityY = -Movement.JUMP_SPEED;
+        state.grounded = false;
+    }
+    state.velocityY = Math.min(state.velocityY + Movement.GRAVITY * dt, Movement.MAX_FALL_SPEED);
+
+    // Move horizontally, then vertically, undoing a step that ends inside a
+    // platform unless we started inside one
+    const stuck = solidAt(state.x, state.y, state.width, state.height);
+
+    const dx = state.velocityX * dt;
+    state.x += dx;
+    if (!stuck && solidAt(state.x, state.y, state.width, state.height)) {
+        state.x -= dx;
+        state.velocityX = 0;
+    }
+
+    const dy = state.velocityY * dt;
+    state.y += dy;
+    if (!stuck && solidAt(state.x, state.y, state.width, state.height)) {
+        state.y -= dy;
+        state.velocityY = 0;
+        state.grounded = dy > 0;
+    } else {
+        state.grounded = false;
+    }
+
+    // Friction, scaled from the per-frame factors
+    if (moveX === 0) {
+        const friction = state.grounded ? Movement.GROUND_FRICTION : Movement.AIR_FRICTION;
+        state.velocityX *= Math.pow(friction, dt * 60);
+        if (Math.abs(state.velocityX) < 0.01) {
+            state.velocityX = 0;
+        }
+    }
+    return state;
+}
+
+export default { Movement, applyInput, isGrounded };
@@ -7,11 +7,22 @@ import BinaryProtocol from './BinaryProtocol.js';
 import Gun from '../entities/player/Gun.js';
 import Bullet from '../entities/player/Bullet.js';
 import Fragment from '../entities/fragments/Fragment.js';
+import Prediction from './Prediction.js';
 
 // Chat message container
 const chatMessages = [];
 const MAX_CHAT_MESSAGES = 10;
 
+// How many snapshots are kept to decode deltas against, as on the server
+const SNAPSHOT_BASELINE_HISTORY = 64;
+
+// Most input commands sent in one frame, so a stalled frame doesn't flood
+// the server, which only takes about one per tick anyway
+const MAX_INPUTS_PER_FRAME = 4;
+
+// Build this client reports in its Hello, for the server's logs
+const CLIENT_BUILD = 'web-1';
+
 class Socket {
     ws = null;
     binaryMode = true; // Use binary protocol by default
@@ -19,27 +30,77 @@ class Socket {
     // Track remote players by ID to prevent duplicates
     remotePlayers = new Map();
     
+    // Client-side prediction: inputs sent but not yet acknowledged by the server
+    inputSequence = 0;
+    pendingInputs = [];
+    lastSnapshotTick = 0;
+    tickRate = 60; // Server ticks per second, as told in its Welcome
+    inputTime = 0; // Frame time not yet sent as input commands, in seconds
+    predicted = null; // Where we expect the server to have our player once it applies our inputs
+    
+    // Full player state of recently applied snapshots, by tick, that later
+    // snapshots are encoded against
+    snapshotBaselines = new Map();
+    authoritativeState = null;
+    
+    // Match phase and scoreboard, as decided by the server
+    matchState = null;
+    scoreboard = [];
+    
+    // Whether the server simulates bullets and decides their hits, as chosen
+    // in its Welcome
+    serverProjectiles = false;
+    projectiles = new Map(); // Bullets of other players, by projectile ID
+    
+    // Platforms destroyed in this room, by ID, kept to put back when they regenerate
+    destroyedPlatforms = new Map();
+    
     connectOnline() {
-        const wsUrl = (location.hostname === 'localhost' || location.hostname === '127.0.0.1')
+        let wsUrl = (location.hostname === 'localhost' || location.hostname === '127.0.0.1')
             ? `ws://localhost:8081/ws`
             : `wss://${location.hostname}/ws`;
         
-        this.ws = new WebSocket(wsUrl);
+        // Each game mode is played in its own room, created with that mode on the server
+        if (window.gameMode) {
+            const mode = encodeURIComponent(window.gameMode.type);
+            wsUrl += `?room=${mode}&mode=${mode}`;
+        }
+        
+        this.ws = new WebSocket(wsUrl, BinaryProtocol.Protocols);
         
         this.ws.onopen = () => {
             console.log('Connected to server');
             toast.show('Connected to server');
             
-            // Send initial player ID to server if we have a local player
-            if (STATE.myPlayer) {
-                console.log('Sending initial player ID to server:', STATE.myPlayer.id);
-                this.sendInitialPlayerID(STATE.myPlayer.id);
+            // Every connection opens with a Hello; the server answers with
+            // a Welcome assigning our player ID. A Hello sent as JSON has the
+            // server expect JSON from us, though it still answers in binary.
+            const features = BinaryProtocol.Features.QUANTIZED | BinaryProtocol.Features.SERVER_PROJECTILES;
+            if (this.binaryMode) {
+                this.ws.send(BinaryProtocol.encodeHello(CLIENT_BUILD, features));
+            } else {
+                this.ws.send(JSON.stringify({
+                    type: 'Hello',
+                    version: BinaryProtocol.PROTOCOL_VERSION,
+                    clientBuild: CLIENT_BUILD,
+                    features: features
+                }));
             }
         };
         
         // Implement ws reconnect
-        this.ws.onclose = () => {
+        this.ws.onclose = (event) => {
+            // Retrying won't help a client the server doesn't support
+            if (event.code === BinaryProtocol.CloseCodes.VERSION_UNSUPPORTED ||
+                event.code === BinaryProtocol.CloseCodes.FEATURE_MISSING ||
+                event.code === BinaryProtocol.CloseCodes.JSON_DISABLED) {
+                console.error('Server rejected this client:', event.reason);
+                toast.show('This game version is not supported by the server, please reload');
+                return;
+            }
+            
             console.log('Connection closed, retrying after 5 seconds');
+            this.snapshotBaselines.clear();
             toast.show('Connection closed, retrying...');
             setTimeout(() => {
                 this.connectOnline();
@@ -54,7 +115,7 @@ class Socket {
         this.ws.onmessage = async (message) => {
             try {
                 // Check if the message is a Blob (binary data)
-                if (this.binaryMode && (message.data instanceof ArrayBuffer || message.data instanceof Blob)) {
+                if (message.data instanceof ArrayBuffer || message.data instanceof Blob) {
                     // Convert Blob to ArrayBuffer if needed
                     let arrayBuffer;
                     if (message.data instanceof Blob) {
@@ -99,6 +160,13 @@ class Socket {
         // console.log(`Received binary message of type: ${data.type}`, data);
         
         switch (data.type) {
+            case 'Bundle':
+                // Handle bundled messages in the order the server sent them
+                for (const message of data.messages) {
+                    await this.handleBinaryMessage(message);
+                }
+                break;
+                
             case 'PlayerUpdate':
                 await this.handlePlayerUpdate(data.player);
                 break;
@@ -107,6 +175,14 @@ class Socket {
                 this.handlePlayerDisconnect(data.id);
                 break;
                 
+            case 'PlayerEnterView':
+                await this.handlePlayerUpdate(data.player);
+                break;
+                
+            case 'PlayerLeaveView':
+                this.handlePlayerLeaveView(data.id);
+                break;
+                
             case 'PlayerJoin':
                 toast.show('New player connected!');
                 break;
@@ -127,6 +203,14 @@ class Socket {
                 this.handleHitReport(data.shooterId, data.targetId, data.damage);
                 break;
                 
+            case 'ProjectileSpawn':
+                this.handleProjectileSpawn(data.projectile);
+                break;
+                
+            case 'ProjectileImpact':
+                this.handleProjectileImpact(data.impact);
+                break;
+                
             case 'PlatformDestroy':
                 this.handlePlatformDestroy(data.platformId, data.shooterId);
                 break;
@@ -139,10 +223,38 @@ class Socket {
                 this.handleFragmentDestroy(data.fragmentId);
                 break;
                 
+            case 'PlatformRestore':
+                this.handlePlatformRestore(data.platformId);
+                break;
+                
+            case 'TerrainState':
+                this.handleTerrainState(data.destroyedPlatforms, data.fragments);
+                break;
+                
             case 'GunAttachment':
                 this.handleGunAttachment(data.data);
                 break;
                 
+            case 'WorldSnapshot':
+                await this.handleWorldSnapshot(data.tick, data.baselineTick, data.lastInputSequence, data.players, data.removed);
+                break;
+                
+            case 'ScoreboardUpdate':
+                this.handleScoreboardUpdate(data.entries);
+                break;
+                
+            case 'MatchState':
+                this.handleMatchState(data);
+                break;
+                
+            case 'Welcome':
+                this.handleWelcome(data);
+                break;
+                
+            case 'Quantization':
+                // Kept by BinaryProtocol for decoding quantized messages
+                break;
+                
             default:
                 console.debug(`Unknown binary message type: ${data.type}`);
         }
@@ -167,8 +279,9 @@ class Socket {
             return;
         }
         
-        // Remove the platform from entities
+        // Remove the platform from entities, keeping it in case it regenerates
         allEntities.splice(platformIndex, 1);
+        this.destroyedPlatforms.set(platformId, platform);
         
         // Find the shooter (if any)
         let shooter = null;
@@ -184,8 +297,40 @@ class Socket {
         console.log(`Platform ${platformId} destroyed by ${shooter ? shooter.name : 'unknown'}`);
     }
     
-    // Handle fragment creation
+    // Handle a destroyed platform growing back
+    handlePlatformRestore(platformId) {
+        const platform = this.destroyedPlatforms.get(platformId);
+        if (!platform) {
+            console.warn(`Platform with ID ${platformId} not found for restoring`);
+            return;
+        }
+        
+        this.destroyedPlatforms.delete(platformId);
+        allEntities.push(platform);
+    }
+    
+    // Handle the terrain of a room we just joined
+    handleTerrainState(destroyedPlatforms, fragments) {
+        for (const platformId of destroyedPlatforms) {
+            this.handlePlatformDestroy(platformId, 0);
+        }
+        for (const fragment of fragments) {
+            this.handleFragmentCreate(fragment);
+        }
+    }
+    
+    // Handle fragment creation. The server sends a fragment again when it
+    // bounces, which moves the one we already have.
     handleFragmentCreate(fragmentData) {
+        const existing = allEntities.find((e) => e.isFragment && e.id === fragmentData.id);
+        if (existing) {
+            existing.x = fragmentData.x;
+            existing.y = fragmentData.y;
+            existing.velocity.x = fragmentData.velocityX;
+            existing.velocity.y = fragmentData.velocityY;
+            return;
+        }
+        
         // Create a new fragment with options
         const fragmentOptions = {
             id: fragmentData.id,
@@ -200,7 +345,9 @@ class Socket {
         
         const fragment = new Fragment(fragmentOptions);
         
-        // Set additional fragment properties
+        // Set additional fragment properties; the server owns its ID and lifetime
+        fragment.id = fragmentData.id;
+        fragment.serverOwned = true;
         fragment.originalEntityId = fragmentData.originalEntityId;
         fragment.velocity.x = fragmentData.velocityX;
         fragment.velocity.y = fragmentData.velocityY;
@@ -317,12 +464,12 @@ class Socket {
     }
     
     // Send gun attachment update
-    sendGunAttachment(gunId, playerId, offsetX, offsetY, rotation) {
+    sendGunAttachment(gunId, playerId, offsetX, offsetY, rotation, weaponId = 0) {
         if (!this.ws || this.ws.readyState !== WebSocket.OPEN || !STATE.myPlayer) return;
         
         if (this.binaryMode) {
             // Use binary protocol
-            const buffer = BinaryProtocol.encodeGunAttachment(gunId, playerId, offsetX, offsetY, rotation);
+            const buffer = BinaryProtocol.encodeGunAttachment(gunId, playerId, offsetX, offsetY, rotation, weaponId);
             this.ws.send(buffer);
         } else {
             // Fall back to JSON
@@ -333,7 +480,8 @@ class Socket {
                     playerId: playerId,
                     attachmentOffsetX: offsetX,
                     attachmentOffsetY: offsetY,
-                    rotation: rotation
+                    rotation: rotation,
+                    weaponId: weaponId
                 }
             }));
         }
@@ -342,6 +490,81 @@ class Socket {
     // Interpolation settings
     interpolationDelay = 100; // ms
     
+    // A server position this far from ours means we were teleported
+    teleportDistance = 200; // px
+    
+    // Send one input command per server tick of frame time and move our
+    // player by them the way the server will
+    predictLocalPlayer(player, deltaTime) {
+        const dt = 1 / this.tickRate;
+        if (!this.predicted) {
+            this.predicted = {
+                x: player.x,
+                y: player.y,
+                velocityX: player.velocity.x,
+                velocityY: player.velocity.y,
+                width: Prediction.Movement.PLAYER_WIDTH,
+                height: Prediction.Movement.PLAYER_HEIGHT
+            };
+            this.predicted.grounded = Prediction.isGrounded(this.predicted);
+        }
+        
+        this.inputTime = Math.min(this.inputTime + deltaTime, MAX_INPUTS_PER_FRAME * dt);
+        while (this.inputTime >= dt) {
+            this.inputTime -= dt;
+            const command = this.sendInputCommand(player.movementInput());
+            if (command) {
+                Prediction.applyInput(this.predicted, command, dt);
+            }
+        }
+        
+        player.x = this.predicted.x;
+        player.y = this.predicted.y;
+        player.velocity.x = this.predicted.velocityX;
+        player.velocity.y = this.predicted.velocityY;
+        player.grounded = this.predicted.grounded;
+    }
+    
+    // Restart the prediction from the server's state of our player and
+    // replay the inputs it has not applied yet on top
+    reconcile() {
+        const server = this.authoritativeState;
+        if (!server || !this.predicted) return;
+        
+        const state = {
+            x: server.x,
+            y: server.y,
+            velocityX: server.velocityX ?? 0,
+            velocityY: server.velocityY ?? 0,
+            width: server.width || Prediction.Movement.PLAYER_WIDTH,
+            height: server.height || Prediction.Movement.PLAYER_HEIGHT
+        };
+        state.grounded = Prediction.isGrounded(state);
+        
+        const dt = 1 / this.tickRate;
+        for (const input of this.pendingInputs) {
+            Prediction.applyInput(state, input, dt);
+        }
+        this.predicted = state;
+    }
+    
+    // Move our own player to where the server put it
+    placeLocalPlayer(playerData) {
+        if (playerData.x !== undefined) {
+            STATE.myPlayer.x = playerData.x;
+        }
+        if (playerData.y !== undefined) {
+            STATE.myPlayer.y = playerData.y;
+        }
+        if (STATE.myPlayer.velocity) {
+            STATE.myPlayer.velocity.x = playerData.velocityX ?? 0;
+            STATE.myPlayer.velocity.y = playerData.velocityY ?? 0;
+        }
+        
+        // Predict onwards from the new position
+        this.predicted = null;
+    }
+    
     // Handle player update
     async handlePlayerUpdate(playerData) {
         if (!playerData || !playerData.id) {
@@ -353,6 +576,15 @@ class Socket {
         if (STATE.myPlayer && playerData.id === STATE.myPlayer.id) {
             console.log(`Updating local player: ${JSON.stringify(playerData)}`);
             
+            // The server moves us itself when we respawn, or when a new
+            // round puts everyone back on a spawn point
+            const revived = STATE.myPlayer.isDead && playerData.isDead === false;
+            const moved = playerData.x !== undefined && playerData.y !== undefined &&
+                Math.hypot(playerData.x - STATE.myPlayer.x, playerData.y - STATE.myPlayer.y) > this.teleportDistance;
+            if (revived || moved) {
+                this.placeLocalPlayer(playerData);
+            }
+            
             // Update health properties
             if (playerData.health !== undefined) {
                 STATE.myPlayer.health = playerData.health;
@@ -477,6 +709,99 @@ class Socket {
         }
     }
     
+    // Handle a world snapshot from the server's simulation tick
+    async handleWorldSnapshot(tick, baselineTick, lastInputSequence, deltas, removed) {
+        // Rebuild every player's full state from the baseline the deltas are against
+        const baseline = baselineTick === 0 ? new Map() : this.snapshotBaselines.get(baselineTick);
+        if (!baseline) {
+            // Without the baseline we wait for the server to fall back to full state
+            return;
+        }
+        
+        const state = new Map(baseline);
+        for (const delta of deltas) {
+            const player = { ...state.get(delta.id), ...delta };
+            player.color = JSON.stringify([player.colorR, player.colorG, player.colorB, player.colorA]);
+            state.set(delta.id, player);
+        }
+        for (const playerId of removed) {
+            state.delete(playerId);
+        }
+        
+        // Remember this snapshot as a baseline and tell the server we have it
+        this.snapshotBaselines.set(tick, state);
+        for (const oldTick of this.snapshotBaselines.keys()) {
+            if (oldTick + SNAPSHOT_BASELINE_HISTORY <= tick) {
+                this.snapshotBaselines.delete(oldTick);
+            }
+        }
+        this.sendSnapshotAck(tick);
+        
+        this.lastSnapshotTick = tick;
+        const players = state.values();
+        
+        // Inputs up to the acknowledged sequence are already part of the server state;
+        // the rest must be replayed on top of it when reconciling
+        this.pendingInputs = this.pendingInputs.filter((input) => input.sequence > lastInputSequence);
+        
+        for (const playerData of players) {
+            // Our own player is predicted locally; keep the server's view for reconciliation
+            if (STATE.myPlayer && playerData.id === STATE.myPlayer.id) {
+                this.authoritativeState = playerData;
+                this.reconcile();
+                continue;
+            }
+            
+            // Players we haven't seen yet are created from their full update
+            if (!this.remotePlayers.has(playerData.id)) {
+                continue;
+            }
+            
+            await this.handlePlayerUpdate(playerData);
+        }
+    }
+    
+    // Handle a scoreboard update; entries arrive sorted best first
+    handleScoreboardUpdate(entries) {
+        this.scoreboard = entries;
+    }
+    
+    // Handle a match phase change
+    handleMatchState(state) {
+        const previousPhase = this.matchState ? this.matchState.phase : null;
+        this.matchState = { ...state, receivedAt: performance.now() };
+        if (state.phase === previousPhase) return;
+        
+        switch (state.phase) {
+            case BinaryProtocol.MatchPhases.WARMUP:
+                toast.show('Warmup');
+                break;
+            case BinaryProtocol.MatchPhases.LIVE:
+                toast.show('Match started');
+                break;
+            case BinaryProtocol.MatchPhases.ENDED:
+                if (state.winnerTeamId) {
+                    toast.show(`Team ${state.winnerTeamId} wins!`);
+                } else if (state.winnerId) {
+                    toast.show(`Player ${state.winnerId} wins!`);
+                } else {
+                    toast.show('Match ended in a draw');
+                }
+                break;
+        }
+    }
+    
+    // Handle a player moving out of our view radius; they are spawned again
+    // when they come back into view
+    handlePlayerLeaveView(playerId) {
+        this.remotePlayers.delete(playerId);
+        
+        const index = allEntities.findIndex((e) => e.id === playerId);
+        if (index !== -1) {
+            allEntities.splice(index, 1);
+        }
+    }
+    
     // Handle player disconnect
     handlePlayerDisconnect(playerId) {
         // Remove from remotePlayers map
@@ -494,31 +819,30 @@ class Socket {
         }
     }
     
-    // Handle initial state
-    async handleInitialState(players) {
-        console.log("Received initial state with players:", players);
+    // Handle the server's answer to our Hello, which comes before anything else
+    handleWelcome(welcome) {
+        console.log(`Welcomed by server (protocol ${welcome.version}, ${welcome.tickRate} ticks/s) as player ${welcome.playerId}`);
+        this.serverProjectiles = (welcome.features & BinaryProtocol.Features.SERVER_PROJECTILES) !== 0;
+        if (welcome.tickRate > 0) {
+            this.tickRate = welcome.tickRate;
+        }
         
-        // First, check if we need to update our local player's ID
+        // Take on the server-assigned ID
         if (STATE.myPlayer) {
-            // The server will send us our own player data with the server-assigned ID
-            // We need to find it and update our local player's ID
-            for (const playerData of players) {
-                // Check if this is our player (based on position or other properties)
-                // Since we don't have a reliable way to identify our player in the initial state,
-                // we'll just use the first player data for now
-                if (players.length > 0 && !STATE.myPlayer.serverIdAssigned) {
-                    console.log(`Updating local player ID from ${STATE.myPlayer.id} to server-assigned ID: ${players[0].id}`);
-                    STATE.myPlayer.id = players[0].id;
-                    STATE.myPlayer.serverIdAssigned = true;
-                    break;
-                }
-            }
+            STATE.myPlayer.id = welcome.playerId;
+            STATE.myPlayer.serverIdAssigned = true;
         }
+    }
+    
+    // Handle initial state
+    async handleInitialState(players) {
+        console.log("Received initial state with players:", players);
         
-        // Then process all other players
         for (const playerData of players) {
-            // Skip our own player since we already updated it
+            // Our own player, whose ID came with the Welcome, starts where
+            // the server spawned it
             if (STATE.myPlayer && playerData.id === STATE.myPlayer.id) {
+                this.placeLocalPlayer(playerData);
                 continue;
             }
             await this.handlePlayerUpdate(playerData);
@@ -585,6 +909,37 @@ class Socket {
         allEntities.push(bullet);
     }
     
+    // Handle a bullet the server started simulating. Our own shots are
+    // already on screen, so only other players' bullets are spawned.
+    handleProjectileSpawn(projectile) {
+        if (STATE.myPlayer && projectile.shooterId === STATE.myPlayer.id) {
+            return;
+        }
+        
+        const speed = Math.hypot(projectile.velocityX, projectile.velocityY);
+        const bullet = new Bullet({
+            x: projectile.x,
+            y: projectile.y,
+            rotation: Math.atan2(projectile.velocityY, projectile.velocityX),
+            speed: speed,
+            gravity: projectile.gravity,
+            lifetime: 2
+        });
+        bullet.ownerId = projectile.shooterId;
+        
+        this.projectiles.set(projectile.id, bullet);
+        allEntities.push(bullet);
+    }
+    
+    // Handle a server-simulated bullet stopping; damage arrives as player updates
+    handleProjectileImpact(impact) {
+        const bullet = this.projectiles.get(impact.projectileId);
+        if (bullet) {
+            bullet.deleteSelf(allEntities);
+            this.projectiles.delete(impact.projectileId);
+        }
+    }
+    
     // Handle hit report
     handleHitReport(shooterId, targetId, damage) {
         console.log(`Hit report: shooter ${shooterId} hit target ${targetId} for ${damage} damage`);
@@ -677,13 +1032,28 @@ class Socket {
         }
     }
     
+    // Send one tick of input for server-side movement
+    // input: { moveX, moveY, jump, aimAngle, fire }
+    sendInputCommand(input) {
+        if (!this.ws || this.ws.readyState !== WebSocket.OPEN || !STATE.myPlayer) return;
+        
+        const command = {
+            ...input,
+            sequence: ++this.inputSequence,
+            tick: this.lastSnapshotTick
+        };
+        this.pendingInputs.push(command);
+        this.ws.send(BinaryProtocol.encodeInputCommand(command));
+        return command;
+    }
+    
     // Send gun fire
-    sendGunFire(x, y, angle, damage) {
+    sendGunFire(x, y, angle, damage, weaponId = 0) {
         if (!this.ws || this.ws.readyState !== WebSocket.OPEN || !STATE.myPlayer) return;
         
         if (this.binaryMode) {
             // Use binary protocol
-            const buffer = BinaryProtocol.encodeGunFire(STATE.myPlayer.id, x, y, angle, damage);
+            const buffer = BinaryProtocol.encodeGunFire(STATE.myPlayer.id, x, y, angle, damage, weaponId);
             this.ws.send(buffer);
         }
     }
@@ -699,77 +1069,44 @@ class Socket {
         }
     }
     
-    // Send platform destroy
-    sendPlatformDestroy(platformId) {
-        if (!this.ws || this.ws.readyState !== WebSocket.OPEN || !STATE.myPlayer) return;
-        
-        if (this.binaryMode) {
-            // Use binary protocol
-            const buffer = BinaryProtocol.encodePlatformDestroy(platformId, STATE.myPlayer.id);
-            this.ws.send(buffer);
-        }
+    // Acknowledge a world snapshot so later ones are encoded against it
+    sendSnapshotAck(tick) {
+        if (!this.ws || this.ws.readyState !== WebSocket.OPEN) return;
+
+        this.ws.send(BinaryProtocol.encodeSnapshotAck(tick));
     }
-    
-    // Send fragment create
-    sendFragmentCreate(fragment) {
+
+    // Ask the server to move us to another team
+    sendTeamSwitch(teamId) {
         if (!this.ws || this.ws.readyState !== WebSocket.OPEN || !STATE.myPlayer) return;
-        
-        // Extract color components
-        let colorR = 1.0, colorG = 1.0, colorB = 1.0, colorA = 1.0;
-        if (fragment.color && Array.isArray(fragment.color) && fragment.color.length >= 4) {
-            [colorR, colorG, colorB, colorA] = fragment.color;
-        }
-        
-        const fragmentData = {
-            id: fragment.id,
-            originalEntityId: fragment.originalEntityId || 0,
-            x: fragment.x,
-            y: fragment.y,
-            width: fragment.width,
-            height: fragment.height,
-            velocityX: fragment.velocity.x,
-            velocityY: fragment.velocity.y,
-            colorR: colorR,
-            colorG: colorG,
-            colorB: colorB,
-            colorA: colorA
-        };
-        
+
         if (this.binaryMode) {
             // Use binary protocol
-            const buffer = BinaryProtocol.encodeFragmentCreate(fragmentData);
+            const buffer = BinaryProtocol.encodeTeamSwitch(teamId);
             this.ws.send(buffer);
         }
     }
+
+    // Whether we are connected to a server
+    isOnline() {
+        return this.ws !== null && this.ws.readyState === WebSocket.OPEN;
+    }
     
-    // Send fragment destroy
-    sendFragmentDestroy(fragmentId) {
+    // Send platform destroy
+    sendPlatformDestroy(platformId) {
         if (!this.ws || this.ws.readyState !== WebSocket.OPEN || !STATE.myPlayer) return;
         
         if (this.binaryMode) {
             // Use binary protocol
-            const buffer = BinaryProtocol.encodeFragmentDestroy(fragmentId);
+            const buffer = BinaryProtocol.encodePlatformDestroy(platformId, STATE.myPlayer.id);
             this.ws.send(buffer);
         }
     }
-
+    
     // Get chat messages
     getChatMessages() {
         return chatMessages;
     }
-    
-    // Send initial player ID to server
-    sendInitialPlayerID(playerId) {
-        if (!this.ws || this.ws.readyState !== WebSocket.OPEN) return;
-        
-        console.log('Sending initial player ID to server:', playerId);
-        
-        // For now, use JSON since we don't have a binary protocol method for this yet
-        this.ws.send(JSON.stringify({
-            type: 'InitialPlayerID',
-            clientId: playerId
-        }));
-    }
 }
 
 const socket = new Socket()
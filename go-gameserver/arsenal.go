@@ -0,0 +1,87 @@
+package main
+
+import (
+	"errors"
+	"time"
+
+	"gameeserever/weapons"
+)
+
+// fireRateTolerance lets shots arrive this much early, so network jitter
+// that bunches messages together does not reject legitimate shots
+const fireRateTolerance = 100 * time.Millisecond
+
+// Reasons a shot is rejected
+var (
+	errUnknownWeapon = errors.New("weapon is not in the catalogue")
+	errFiringTooFast = errors.New("shot exceeds the weapon's fire rate")
+	errReloading     = errors.New("weapon is reloading")
+)
+
+// weaponState tracks a player's magazine and cooldowns for one weapon
+type weaponState struct {
+	ammo       int           // Rounds left in the magazine
+	reloadedAt time.Duration // World time the current reload finishes
+	nextShot   time.Duration // Earliest world time of the next shot
+}
+
+// Equip switches a player to a weapon from the catalogue and returns it.
+// Weapon ID 0 selects the catalogue's default weapon.
+func (w *World) Equip(playerID, weaponID int32) (weapons.Weapon, error) {
+	sim, exists := w.sims[playerID]
+	if !exists {
+		return weapons.Weapon{}, errUnknownShooter
+	}
+	weapon, err := w.weapon(weaponID)
+	if err != nil {
+		return weapons.Weapon{}, err
+	}
+	sim.weaponID = weapon.ID
+	return weapon, nil
+}
+
+// weapon looks up a weapon, treating ID 0 as the default weapon
+func (w *World) weapon(weaponID int32) (weapons.Weapon, error) {
+	if weaponID == 0 {
+		return w.weapons.DefaultWeapon(), nil
+	}
+	weapon, exists := w.weapons.Weapon(weaponID)
+	if !exists {
+		return weapons.Weapon{}, errUnknownWeapon
+	}
+	return weapon, nil
+}
+
+// fire spends one round of a player's weapon, enforcing its fire rate,
+// magazine size and reload time
+func (w *World) fire(sim *playerSim, weapon weapons.Weapon) error {
+	state, exists := sim.arsenal[weapon.ID]
+	if !exists {
+		state = &weaponState{ammo: weapon.MagazineSize}
+		sim.arsenal[weapon.ID] = state
+	}
+
+	now := w.elapsed()
+	if now < state.reloadedAt {
+		return errReloading
+	}
+	if now+fireRateTolerance < state.nextShot {
+		return errFiringTooFast
+	}
+	state.nextShot = max(state.nextShot, now-fireRateTolerance) + weapon.FireInterval()
+
+	if weapon.MagazineSize > 0 {
+		state.ammo--
+		if state.ammo <= 0 {
+			// Reload automatically once the magazine is empty
+			state.ammo = weapon.MagazineSize
+			state.reloadedAt = now + weapon.ReloadTime
+		}
+	}
+	return nil
+}
+
+// elapsed returns the simulated time since the world started
+func (w *World) elapsed() time.Duration {
+	return time.Duration(float64(w.Tick) * float64(w.tickDelta) * float64(time.Second))
+}
@@ -0,0 +1,77 @@
+package main
+
+import "gameeserever/protocol"
+
+// baselineHistory is how many recent snapshots are kept per client to encode
+// deltas against, about a second at the default tick rate. A client whose
+// acknowledgements fall further behind gets full state instead.
+const baselineHistory = 64
+
+// sentSnapshot is the player state a client was sent in one snapshot
+type sentSnapshot struct {
+	tick    uint32
+	players map[int32]protocol.Player // Shared between clients and never modified
+}
+
+// baselines remembers the snapshots recently sent to one client, so each new
+// snapshot only carries what changed since the last one the client acknowledged
+type baselines struct {
+	acked uint32 // Last snapshot tick the client acknowledged (0 = none)
+	sent  [baselineHistory]sentSnapshot
+}
+
+// ack records that the client has applied a snapshot. Acknowledgements of
+// snapshots that were never sent, or older than the current one, are ignored.
+func (b *baselines) ack(tick uint32) {
+	if tick <= b.acked {
+		return
+	}
+	if _, ok := b.lookup(tick); ok {
+		b.acked = tick
+	}
+}
+
+// lookup returns the players sent in the snapshot for tick, if it is still remembered
+func (b *baselines) lookup(tick uint32) (map[int32]protocol.Player, bool) {
+	if tick == 0 {
+		return nil, false
+	}
+	sent := b.sent[tick%baselineHistory]
+	if sent.tick != tick {
+		return nil, false
+	}
+	return sent.players, true
+}
+
+// snapshot builds the client's snapshot of players for tick, as deltas
+// against their acknowledged baseline, and remembers it as a future baseline
+func (b *baselines) snapshot(tick uint32, players map[int32]protocol.Player) protocol.WorldSnapshotMessage {
+	msg := protocol.WorldSnapshotMessage{
+		Tick:    tick,
+		Players: make([]protocol.PlayerDelta, 0, len(players)),
+	}
+
+	baseline, ok := b.lookup(b.acked)
+	if ok {
+		msg.BaselineTick = b.acked
+	}
+
+	for playerID, player := range players {
+		fields := protocol.PlayerFieldsAll
+		if previous, exists := baseline[playerID]; exists {
+			fields = protocol.DiffPlayer(previous, player)
+			if fields == 0 {
+				continue
+			}
+		}
+		msg.Players = append(msg.Players, protocol.PlayerDelta{Fields: fields, Player: player})
+	}
+	for playerID := range baseline {
+		if _, exists := players[playerID]; !exists {
+			msg.Removed = append(msg.Removed, playerID)
+		}
+	}
+
+	b.sent[tick%baselineHistory] = sentSnapshot{tick: tick, players: players}
+	return msg
+}
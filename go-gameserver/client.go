@@ -0,0 +1,259 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"gameeserever/protocol"
+)
+
+const (
+	// sendQueueSize is how many outbound messages a client can have waiting
+	// before it counts as too slow to keep up
+	sendQueueSize = 256
+
+	// writeWait is how long a single write may block before the client is dropped
+	writeWait = 5 * time.Second
+)
+
+// ClientState holds the state of a connected client
+type ClientState struct {
+	Player protocol.Player
+	Conn   *websocket.Conn
+
+	id        int32     // Player.ID, readable without the room's lock
+	baselines baselines // Snapshots sent to the client, guarded by the room's mutex
+
+	// Players the client is sent updates about (nil = every player). Guarded
+	// by the room's mutex and replaced rather than modified, so a copy of the
+	// map can be read after unlocking.
+	visible map[int32]bool
+
+	// Area positions are quantized across for clients that negotiated the
+	// quantized wire format (nil = float32 fields). Set before the client
+	// joins a room and never changed.
+	quantization *protocol.Quantization
+	json         bool                 // Speaks the JSON protocol, chosen at the handshake and never changed
+	send         chan outboundMessage // Encoded messages waiting for the writer goroutine
+	done         chan struct{}        // Closed when the client is disconnected or evicted
+	closeOnce    sync.Once
+}
+
+// outboundMessage is an encoded message waiting in a client's send queue
+type outboundMessage struct {
+	messageType int    // websocket.BinaryMessage or websocket.TextMessage
+	data        []byte // Encoded message, shared between clients and never modified
+	key         staleKey
+}
+
+// staleKey identifies messages that a newer message with the same key makes
+// stale, such as world snapshots or a player's full update. The zero key
+// marks messages that must always be delivered.
+type staleKey struct {
+	messageType byte
+	playerID    int32
+}
+
+// newClientState creates the state of a newly connected client; call
+// writeLoop to start delivering its queued messages
+func newClientState(conn *websocket.Conn, player protocol.Player) *ClientState {
+	return &ClientState{
+		Player: player,
+		Conn:   conn,
+		id:     player.ID,
+		send:   make(chan outboundMessage, sendQueueSize),
+		done:   make(chan struct{}),
+	}
+}
+
+// newOutboundMessage encodes a message for the send queue
+func newOutboundMessage(msg protocol.Message) (outboundMessage, error) {
+	data, err := msg.Encode()
+	if err != nil {
+		return outboundMessage{}, err
+	}
+
+	out := outboundMessage{
+		messageType: websocket.BinaryMessage,
+		data:        data,
+	}
+	switch m := msg.(type) {
+	case protocol.WorldSnapshotMessage, protocol.QuantizedWorldSnapshotMessage:
+		out.key = staleKey{messageType: protocol.WorldSnapshotType}
+	case protocol.BroadcastPlayerUpdateMessage:
+		out.key = staleKey{messageType: protocol.BroadcastPlayerUpdateType, playerID: m.Player.ID}
+	case protocol.QuantizedBroadcastPlayerUpdateMessage:
+		out.key = staleKey{messageType: protocol.BroadcastPlayerUpdateType, playerID: m.Player.ID}
+	}
+	return out, nil
+}
+
+// wireFormat returns the form of a message the client negotiated: the
+// quantized variant for clients using the quantized wire format, for every
+// message that carries positions
+func (c *ClientState) wireFormat(msg protocol.Message) protocol.Message {
+	if c.quantization == nil {
+		return msg
+	}
+	switch m := msg.(type) {
+	case protocol.WorldSnapshotMessage:
+		return protocol.QuantizedWorldSnapshotMessage{Snapshot: m, Quantization: *c.quantization}
+	case protocol.BroadcastGunFireMessage:
+		return protocol.QuantizedBroadcastGunFireMessage{Fire: m.Fire, Quantization: *c.quantization}
+	case protocol.BroadcastPlayerUpdateMessage:
+		return protocol.QuantizedBroadcastPlayerUpdateMessage{Player: m.Player, Quantization: *c.quantization}
+	case protocol.PlayerEnterViewMessage:
+		return protocol.QuantizedPlayerEnterViewMessage{Player: m.Player, Quantization: *c.quantization}
+	case protocol.ProjectileSpawnMessage:
+		return protocol.QuantizedProjectileSpawnMessage{Projectile: m.Projectile, Quantization: *c.quantization}
+	}
+	return msg
+}
+
+// Queue encodes a message in the client's wire format and queues it
+func (c *ClientState) Queue(msg protocol.Message) {
+	msg = c.wireFormat(msg)
+	out, err := newOutboundMessage(msg)
+	if err != nil {
+		log.Printf("Error encoding %T for player %d: %v", msg, c.id, err)
+		return
+	}
+	c.enqueue(out)
+}
+
+// enqueue adds an encoded message to the send queue without blocking. When
+// the queue is full, world snapshots are dropped since the next tick sends
+// a fresh one; anything else evicts the client.
+func (c *ClientState) enqueue(msg outboundMessage) bool {
+	select {
+	case c.send <- msg:
+		return true
+	case <-c.done:
+		return false
+	default:
+	}
+
+	if msg.key.messageType == protocol.WorldSnapshotType {
+		return false
+	}
+	log.Printf("Evicting player %d: send queue is full", c.id)
+	c.close()
+	return false
+}
+
+// close stops the writer goroutine and closes the connection, which makes
+// the reader goroutine exit and remove the client from its room. It is safe
+// to call more than once and from any goroutine.
+func (c *ClientState) close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+		c.Conn.Close()
+	})
+}
+
+// writeLoop is the only goroutine that writes data messages to the client's
+// connection. It runs until the client is closed or a write fails.
+func (c *ClientState) writeLoop() {
+	defer c.close()
+
+	batch := make([]outboundMessage, 0, sendQueueSize)
+	var frameBuf []byte // Bundles of the batch being written, reused for the next one
+	for {
+		select {
+		case msg := <-c.send:
+			batch = append(batch[:0], msg)
+
+			// Take everything else already queued so stale updates in it
+			// can be skipped
+		drain:
+			for len(batch) < cap(batch) {
+				select {
+				case msg := <-c.send:
+					batch = append(batch, msg)
+				default:
+					break drain
+				}
+			}
+
+			var frames []outboundMessage
+			frames, frameBuf = bundle(coalesce(batch), frameBuf)
+			for _, msg := range frames {
+				c.Conn.SetWriteDeadline(time.Now().Add(writeWait))
+				if err := c.Conn.WriteMessage(msg.messageType, msg.data); err != nil {
+					log.Printf("Error writing to player %d: %v", c.id, err)
+					return
+				}
+			}
+
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// coalesce drops messages that a later message in the batch makes stale,
+// keeping the order of everything that is left. It reuses batch's storage.
+func coalesce(batch []outboundMessage) []outboundMessage {
+	latest := make(map[staleKey]int)
+	for i, msg := range batch {
+		if msg.key != (staleKey{}) {
+			latest[msg.key] = i
+		}
+	}
+	if len(latest) == 0 {
+		return batch
+	}
+
+	kept := batch[:0]
+	for i, msg := range batch {
+		if msg.key != (staleKey{}) && latest[msg.key] != i {
+			continue
+		}
+		kept = append(kept, msg)
+	}
+	return kept
+}
+
+// bundle packs each run of binary messages in the batch into Bundle frames
+// so a batch usually goes out as a single WebSocket frame. Text messages
+// are left as frames of their own, and a bundle of one is sent unwrapped.
+// Bundles are encoded into buf, which is returned to be reused once the
+// frames have been written.
+func bundle(batch []outboundMessage, buf []byte) ([]outboundMessage, []byte) {
+	frames := make([]outboundMessage, 0, 1)
+	run := make([][]byte, 0, len(batch))
+	buf = buf[:0]
+
+	flushRun := func() {
+		for _, b := range protocol.SplitBundles(run, protocol.MaxBundleSize) {
+			if len(b.Messages) == 1 {
+				frames = append(frames, outboundMessage{messageType: websocket.BinaryMessage, data: b.Messages[0]})
+				continue
+			}
+			start := len(buf)
+			var err error
+			buf, err = b.AppendEncode(buf)
+			if err != nil {
+				log.Printf("Error encoding bundle: %v", err)
+				buf = buf[:start]
+				continue
+			}
+			frames = append(frames, outboundMessage{messageType: websocket.BinaryMessage, data: buf[start:]})
+		}
+		run = run[:0]
+	}
+
+	for _, msg := range batch {
+		if msg.messageType != websocket.BinaryMessage {
+			flushRun()
+			frames = append(frames, msg)
+			continue
+		}
+		run = append(run, msg.data)
+	}
+	flushRun()
+
+	return frames, buf
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	"gameeserever/protocol"
+)
+
+// testMessage returns a queued message labelled by its second byte
+func testMessage(label byte, key staleKey) outboundMessage {
+	return outboundMessage{
+		messageType: websocket.BinaryMessage,
+		data:        []byte{protocol.ChatMessageType, label},
+		key:         key,
+	}
+}
+
+// labels lists the labels of queued messages in order
+func labels(batch []outboundMessage) string {
+	var s []byte
+	for _, msg := range batch {
+		s = append(s, msg.data[1])
+	}
+	return string(s)
+}
+
+func TestCoalesce(t *testing.T) {
+	snapshot := staleKey{messageType: protocol.WorldSnapshotType}
+	player1 := staleKey{messageType: protocol.BroadcastPlayerUpdateType, playerID: 1}
+	player2 := staleKey{messageType: protocol.BroadcastPlayerUpdateType, playerID: 2}
+
+	tests := []struct {
+		name  string
+		batch []outboundMessage
+		want  string
+	}{
+		{"nothing stale", []outboundMessage{testMessage('a', staleKey{}), testMessage('b', staleKey{})}, "ab"},
+		{
+			"older snapshots dropped",
+			[]outboundMessage{testMessage('a', snapshot), testMessage('b', staleKey{}), testMessage('c', snapshot)},
+			"bc",
+		},
+		{
+			"updates stale per player",
+			[]outboundMessage{
+				testMessage('a', player1), testMessage('b', player2),
+				testMessage('c', player1), testMessage('d', staleKey{}),
+			},
+			"bcd",
+		},
+		{
+			"unkeyed messages always kept in order",
+			[]outboundMessage{
+				testMessage('a', staleKey{}), testMessage('b', snapshot), testMessage('c', staleKey{}),
+				testMessage('d', staleKey{}), testMessage('e', snapshot),
+			},
+			"acde",
+		},
+	}
+	for _, tt := range tests {
+		if got := labels(coalesce(tt.batch)); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+// describeFrames renders frames as "text:a", an unwrapped binary message "a"
+// or "bundle:abc"
+func describeFrames(t *testing.T, frames []outboundMessage) []string {
+	var described []string
+	for _, frame := range frames {
+		if frame.messageType == websocket.TextMessage {
+			described = append(described, "text:"+string(frame.data[1]))
+			continue
+		}
+		if frame.data[0] != protocol.BundleType {
+			described = append(described, string(frame.data[1]))
+			continue
+		}
+		if len(frame.data) > protocol.MaxBundleSize {
+			t.Errorf("bundle of %d bytes is over MaxBundleSize", len(frame.data))
+		}
+		msg, err := protocol.DecodeMessage(frame.data)
+		if err != nil {
+			t.Fatalf("decoding bundle: %v", err)
+		}
+		var s []byte
+		for _, data := range msg.(protocol.BundleMessage).Messages {
+			s = append(s, data[1])
+		}
+		described = append(described, "bundle:"+string(s))
+	}
+	return described
+}
+
+func TestBundle(t *testing.T) {
+	text := func(label byte) outboundMessage {
+		msg := testMessage(label, staleKey{})
+		msg.messageType = websocket.TextMessage
+		return msg
+	}
+	large := func(label byte) outboundMessage {
+		msg := testMessage(label, staleKey{})
+		msg.data = append(msg.data, make([]byte, protocol.MaxBundleSize/2)...)
+		return msg
+	}
+
+	tests := []struct {
+		name  string
+		batch []outboundMessage
+		want  []string
+	}{
+		{"bundle of one sent unwrapped", []outboundMessage{testMessage('a', staleKey{})}, []string{"a"}},
+		{
+			"binary run bundled",
+			[]outboundMessage{testMessage('a', staleKey{}), testMessage('b', staleKey{}), testMessage('c', staleKey{})},
+			[]string{"bundle:abc"},
+		},
+		{
+			"text splits binary runs",
+			[]outboundMessage{
+				testMessage('a', staleKey{}), testMessage('b', staleKey{}), text('c'),
+				testMessage('d', staleKey{}), text('e'), text('f'),
+			},
+			[]string{"bundle:ab", "text:c", "d", "text:e", "text:f"},
+		},
+		{
+			"large messages split across bundles",
+			[]outboundMessage{large('a'), testMessage('b', staleKey{}), large('c'), large('d')},
+			[]string{"bundle:ab", "c", "d"},
+		},
+	}
+
+	var buf []byte
+	for _, tt := range tests {
+		var frames []outboundMessage
+		frames, buf = bundle(tt.batch, buf)
+		if got := describeFrames(t, frames); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"errors"
+	"expvar"
+
+	"github.com/gorilla/websocket"
+	"gameeserever/protocol"
+)
+
+// Use of the JSON protocol, published on /debug/vars of the -debug-addr
+// listener to tell when it can be retired
+var (
+	jsonClients     = expvar.NewInt("json_clients")     // JSON clients connected now
+	jsonConnections = expvar.NewInt("json_connections") // JSON clients accepted since the server started
+	jsonMessages    = expvar.NewInt("json_messages")    // Messages received from JSON clients
+	jsonRejected    = expvar.NewInt("json_rejected")    // JSON clients turned away because JSON is disabled
+)
+
+// decodeMessage decodes a message in the protocol the client chose at its
+// handshake. JSON messages become the binary messages they stand for, so
+// both are handled by handleMessage.
+func (r *Room) decodeMessage(client *ClientState, messageType int, data []byte) (protocol.Message, error) {
+	if !client.json {
+		if messageType != websocket.BinaryMessage {
+			return nil, errors.New("text message from a binary client")
+		}
+		return protocol.DecodeMessage(data)
+	}
+
+	if messageType != websocket.TextMessage {
+		return nil, errors.New("binary message from a JSON client")
+	}
+	msg, err := protocol.DecodeJSON(data)
+	if err != nil {
+		return nil, err
+	}
+	jsonMessages.Add(1)
+
+	// Player updates only replace the fields the client sent
+	r.mu.Lock()
+	sender := client.Player
+	r.mu.Unlock()
+	return msg.Message(sender), nil
+}
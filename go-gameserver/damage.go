@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"time"
+
+	"gameeserever/protocol"
+)
+
+// Reasons damage is not dealt
+var (
+	errMatchEnded   = errors.New("match has ended")
+	errFriendlyFire = errors.New("friendly fire is disabled")
+)
+
+// checkDamage reports why the shooter cannot damage the target right now, if
+// they can't. The shooter may have left the room. The caller must hold r.mu.
+func (r *Room) checkDamage(shooterID int32, target *ClientState) error {
+	if !r.match.CanDamage() {
+		return errMatchEnded
+	}
+	shooter := r.findPlayer(shooterID)
+	if !r.friendlyFire && shooter != nil && shooter.Player.TeamID != 0 &&
+		shooter.Player.TeamID == target.Player.TeamID {
+		return errFriendlyFire
+	}
+	return nil
+}
+
+// applyDamage takes damage off a living target's health. A fatal hit scores
+// the kill and schedules the target's respawn, which a later tick carries
+// out. The caller must hold r.mu.
+func (r *Room) applyDamage(shooterID int32, target *ClientState, damage float32) {
+	if target.Player.IsDead {
+		return
+	}
+
+	now := time.Now()
+	targetID := target.Player.ID
+	target.Player.Health -= damage
+	r.match.OnDamage(shooterID, targetID, now)
+	log.Printf("Player %d hit player %d for %f damage. Health now: %f",
+		shooterID, targetID, damage, target.Player.Health)
+
+	if target.Player.Health > 0 {
+		return
+	}
+	target.Player.Health = 0
+	target.Player.IsDead = true
+	log.Printf("Player %d was killed by player %d", targetID, shooterID)
+
+	// Score the kill; the scoreboard goes out on the next tick
+	if r.match.OnKill(shooterID, targetID, now) {
+		r.scoreboardChanged = true
+	}
+
+	r.respawns[targetID] = now.Add(r.match.RespawnDelay())
+}
+
+// respawnDue brings back the dead players whose respawn time has come, at a
+// spawn point, and returns the updates announcing them. Players who left or
+// were already brought back, such as by the live phase starting, are
+// skipped. The caller must hold r.mu.
+func (r *Room) respawnDue(now time.Time) []BroadcastMessage {
+	var messages []BroadcastMessage
+	for targetID, respawnAt := range r.respawns {
+		if now.Before(respawnAt) {
+			continue
+		}
+		delete(r.respawns, targetID)
+
+		client := r.findPlayer(targetID)
+		if client == nil || !client.Player.IsDead {
+			continue
+		}
+
+		// Respawn the player at a server-chosen spawn point
+		client.Player.Health = client.Player.MaxHealth
+		client.Player.IsDead = false
+		r.placeAtSpawn(&client.Player)
+		log.Printf("Player %d respawned at (%.0f, %.0f) with health %f",
+			targetID, client.Player.X, client.Player.Y, client.Player.Health)
+
+		// Include the respawned player so they move to the new position
+		messages = append(messages, BroadcastMessage{
+			BinaryMsg:   protocol.BroadcastPlayerUpdateMessage{Player: client.Player},
+			IncludeSelf: true,
+		})
+	}
+	return messages
+}
+
+// resolveImpacts deals the damage of projectiles that hit players or
+// platforms and returns the messages announcing the impacts, the damaged
+// players' new state and the destroyed platforms. The caller must hold r.mu.
+func (r *Room) resolveImpacts(impacts []protocol.ProjectileImpact, now time.Time) []BroadcastMessage {
+	var messages []BroadcastMessage
+	for _, impact := range impacts {
+		// Platforms that can't be destroyed just stop the projectile
+		if impact.Kind == protocol.ImpactPlatform {
+			destroyed, _ := r.destroyPlatform(impact.TargetID, impact.ShooterID, now)
+			messages = append(messages, destroyed...)
+		}
+
+		var target *ClientState
+		if impact.Kind == protocol.ImpactPlayer {
+			target = r.findPlayer(impact.TargetID)
+		}
+		if target != nil {
+			if err := r.checkDamage(impact.ShooterID, target); err != nil {
+				impact.Damage = 0
+			} else {
+				r.applyDamage(impact.ShooterID, target, impact.Damage)
+			}
+		}
+
+		messages = append(messages, BroadcastMessage{
+			BinaryMsg: protocol.ProjectileImpactMessage{Impact: impact},
+		})
+
+		// Include the target so their own health stays in sync
+		if target != nil && impact.Damage > 0 {
+			messages = append(messages, BroadcastMessage{
+				BinaryMsg:   protocol.BroadcastPlayerUpdateMessage{Player: target.Player},
+				IncludeSelf: true,
+			})
+		}
+	}
+	return messages
+}
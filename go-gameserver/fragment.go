@@ -0,0 +1,132 @@
+package main
+
+import (
+	"math"
+
+	"gameeserever/level"
+	"gameeserever/protocol"
+)
+
+// Fragment constants; sizes follow the client's Bullet.splitEntity and the
+// physics follow the player's
+const (
+	fragmentMinSize        = 12  // px, the smallest piece a platform breaks into
+	maxFragmentsPerShatter = 16  // Pieces a single platform breaks into at most
+	maxFragments           = 512 // Live fragments per room; platforms destroyed beyond it don't shatter
+	fragmentScatterSpeed   = 400 // px/s, the fastest a piece flies sideways
+	fragmentPopSpeed       = 600 // px/s, the fastest a piece flies upwards
+
+	fragmentLifetime   = 5   // s before a fragment is cleared, as the client's Fragment.lifetime
+	fragmentSettleTime = 0.5 // s a fragment lies still before it is cleared
+	fragmentFallMargin = 1000
+
+	// fragmentCorrectionSpeed is how much a collision has to change a
+	// fragment's velocity before clients are sent its new motion; smaller
+	// changes, like resting on the ground, are left to their own physics
+	fragmentCorrectionSpeed = 100
+)
+
+// fragment is a piece of a destroyed platform, simulated by the server
+type fragment struct {
+	protocol.Fragment
+	age     float32 // s since it broke off
+	resting float32 // s it has lain still
+}
+
+// rect returns the fragment's bounding rectangle
+func (f *fragment) rect() level.Rect {
+	return level.Rect{MinX: f.X, MinY: f.Y, MaxX: f.X + f.Width, MaxY: f.Y + f.Height}
+}
+
+// shatter breaks a destroyed platform into fragments flying apart from where
+// it stood, and returns them
+func (t *terrain) shatter(platform level.Platform) []protocol.Fragment {
+	size := max(fragmentMinSize, platform.Width/2)
+	cols := int(platform.Width / size)
+	rows := int(platform.Height / size)
+	r, g, b, a := platform.RGBA()
+
+	var spawned []protocol.Fragment
+	for row := 0; row < rows; row++ {
+		for col := 0; col < cols; col++ {
+			if len(spawned) == maxFragmentsPerShatter || len(t.fragments) == maxFragments {
+				return spawned
+			}
+			t.nextFragmentID++
+			f := &fragment{Fragment: protocol.Fragment{
+				ID:               t.nextFragmentID,
+				OriginalEntityID: platform.ID,
+				X:                platform.X + float32(col)*size,
+				Y:                platform.Y + float32(row)*size,
+				Width:            size,
+				Height:           size,
+				VelocityX:        (t.rng.Float32()*2 - 1) * fragmentScatterSpeed,
+				VelocityY:        -t.rng.Float32() * fragmentPopSpeed,
+				ColorR:           r,
+				ColorG:           g,
+				ColorB:           b,
+				ColorA:           a,
+			}}
+			t.fragments[f.ID] = f
+			spawned = append(spawned, f.Fragment)
+		}
+	}
+	return spawned
+}
+
+// stepFragments moves every fragment by one tick. It returns the fragments
+// whose motion was changed by a collision, for clients to correct theirs, and
+// the IDs of the ones that settled, fell out of the level or grew too old,
+// which are removed.
+func (w *World) stepFragments() (moved []protocol.Fragment, expired []int32) {
+	dt := w.tickDelta
+	for fragmentID, f := range w.terrain.fragments {
+		f.age += dt
+		if f.age >= fragmentLifetime || (w.level != nil && f.Y > w.level.Bounds.MaxY+fragmentFallMargin) {
+			delete(w.terrain.fragments, fragmentID)
+			expired = append(expired, fragmentID)
+			continue
+		}
+
+		velocityX, velocityY := f.VelocityX, f.VelocityY
+		f.VelocityY = min(f.VelocityY+playerGravity*dt, playerMaxFallSpeed)
+
+		// Move horizontally, then vertically, stopping at platforms
+		grounded := false
+		dx := f.VelocityX * dt
+		f.X += dx
+		if w.solidAt(f.rect()) {
+			f.X -= dx
+			f.VelocityX = 0
+		}
+		dy := f.VelocityY * dt
+		f.Y += dy
+		if w.solidAt(f.rect()) {
+			f.Y -= dy
+			f.VelocityY = 0
+			grounded = dy > 0
+		}
+		if grounded {
+			f.VelocityX *= float32(math.Pow(playerGroundFriction, float64(dt*60)))
+		}
+
+		if abs(f.VelocityX-velocityX) > fragmentCorrectionSpeed || abs(f.VelocityY-velocityY) > fragmentCorrectionSpeed {
+			moved = append(moved, f.Fragment)
+		}
+
+		if grounded && abs(f.VelocityX) < 1 {
+			f.resting += dt
+		} else {
+			f.resting = 0
+		}
+		if f.resting >= fragmentSettleTime {
+			delete(w.terrain.fragments, fragmentID)
+			expired = append(expired, fragmentID)
+		}
+	}
+	return moved, expired
+}
+
+func abs(v float32) float32 {
+	return float32(math.Abs(float64(v)))
+}
@@ -0,0 +1,93 @@
+package gamemode
+
+import "time"
+
+// DeathMatchRules mirror DEATH_MATCH in the client's GameMode.js
+var DeathMatchRules = Rules{
+	Warmup:       15 * time.Second,
+	TimeLimit:    300 * time.Second,
+	ScoreLimit:   10,
+	Intermission: 10 * time.Second,
+	MinPlayers:   2,
+
+	PlatformRegen: 60 * time.Second,
+}
+
+// DeathMatch is every player for themselves; the first to the score limit,
+// or the player with the most kills when time runs out, wins
+type DeathMatch struct {
+	rules   Rules
+	kills   map[int32]int
+	elapsed time.Duration
+}
+
+// NewDeathMatch creates a death match mode with the given limits
+func NewDeathMatch(rules Rules) *DeathMatch {
+	return &DeathMatch{
+		rules: rules,
+		kills: make(map[int32]int),
+	}
+}
+
+func (m *DeathMatch) ID() ModeID                  { return ModeDeathMatch }
+func (m *DeathMatch) Name() string                { return DeathMatchName }
+func (m *DeathMatch) Rules() Rules                { return m.rules }
+func (m *DeathMatch) RespawnDelay() time.Duration { return 3 * time.Second }
+
+func (m *DeathMatch) OnJoin(playerID int32) {
+	m.kills[playerID] = 0
+}
+
+func (m *DeathMatch) OnLeave(playerID int32) {
+	delete(m.kills, playerID)
+}
+
+func (m *DeathMatch) OnKill(killerID, victimID int32) {
+	if _, exists := m.kills[killerID]; exists && killerID != victimID {
+		m.kills[killerID]++
+	}
+}
+
+func (m *DeathMatch) OnTick(elapsed time.Duration) {
+	m.elapsed = elapsed
+}
+
+func (m *DeathMatch) IsOver() bool {
+	if m.rules.TimeLimit > 0 && m.elapsed >= m.rules.TimeLimit {
+		return true
+	}
+	if m.rules.ScoreLimit > 0 {
+		for _, kills := range m.kills {
+			if kills >= m.rules.ScoreLimit {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Winner returns the player with the most kills, or a draw when nobody
+// scored or the lead is shared
+func (m *DeathMatch) Winner() Result {
+	var best int32
+	bestKills, tied := 0, false
+	for playerID, kills := range m.kills {
+		switch {
+		case kills > bestKills:
+			best, bestKills, tied = playerID, kills, false
+		case kills == bestKills && kills > 0:
+			tied = true
+		}
+	}
+	if tied {
+		return Result{}
+	}
+	return Result{PlayerID: best}
+}
+
+func (m *DeathMatch) Reset() {
+	for playerID := range m.kills {
+		m.kills[playerID] = 0
+	}
+	m.elapsed = 0
+}
@@ -0,0 +1,28 @@
+package gamemode
+
+import "time"
+
+// FreePlayRules start playing as soon as someone joins and never end
+var FreePlayRules = Rules{
+	MinPlayers: 1,
+}
+
+// FreePlay mirrors FREE_PLAY in the client's GameMode.js: no limits and no winner
+type FreePlay struct{}
+
+// NewFreePlay creates a free play mode
+func NewFreePlay() *FreePlay {
+	return &FreePlay{}
+}
+
+func (m *FreePlay) ID() ModeID                      { return ModeFreePlay }
+func (m *FreePlay) Name() string                    { return FreePlayName }
+func (m *FreePlay) Rules() Rules                    { return FreePlayRules }
+func (m *FreePlay) RespawnDelay() time.Duration     { return 3 * time.Second }
+func (m *FreePlay) OnJoin(playerID int32)           {}
+func (m *FreePlay) OnLeave(playerID int32)          {}
+func (m *FreePlay) OnKill(killerID, victimID int32) {}
+func (m *FreePlay) OnTick(elapsed time.Duration)    {}
+func (m *FreePlay) IsOver() bool                    { return false }
+func (m *FreePlay) Winner() Result                  { return Result{} }
+func (m *FreePlay) Reset()                          {}
@@ -0,0 +1,207 @@
+package gamemode
+
+import "time"
+
+// Phase is a stage of a match's lifecycle
+type Phase byte
+
+const (
+	// PhaseWarmup waits for enough players; kills do not count
+	PhaseWarmup Phase = iota
+
+	// PhaseLive is the scored part of the match
+	PhaseLive
+
+	// PhaseEnded shows the result until the next warmup
+	PhaseEnded
+)
+
+func (p Phase) String() string {
+	switch p {
+	case PhaseWarmup:
+		return "warmup"
+	case PhaseLive:
+		return "live"
+	case PhaseEnded:
+		return "ended"
+	default:
+		return "unknown"
+	}
+}
+
+// Rules configure a match's limits and phase durations
+type Rules struct {
+	Warmup       time.Duration // Time from enough players joining to going live
+	TimeLimit    time.Duration // Length of the live phase (0 = no limit)
+	ScoreLimit   int           // Kills that end the live phase (0 = no limit)
+	Intermission time.Duration // Time the result is shown before the next warmup
+	MinPlayers   int           // Players needed to leave warmup
+
+	// PlatformRegen is how long a destroyed platform stays gone (0 = for good)
+	PlatformRegen time.Duration
+}
+
+// Match runs the warmup -> live -> ended lifecycle of a room under its game
+// mode and keeps the scoreboard. It is not safe for concurrent use.
+type Match struct {
+	Mode       GameMode
+	Rules      Rules
+	Scoreboard *Scoreboard
+
+	phase      Phase
+	phaseStart time.Time
+	winner     Result
+	reported   Phase // Phase as of the last Tick, to report changes
+}
+
+// NewMatch creates a match in warmup, played under the given mode
+func NewMatch(mode GameMode, now time.Time) *Match {
+	m := &Match{
+		Mode:       mode,
+		Rules:      mode.Rules(),
+		phase:      PhaseWarmup,
+		phaseStart: now,
+	}
+	m.Scoreboard = NewScoreboard(m.Team)
+	return m
+}
+
+// Phase returns the current phase
+func (m *Match) Phase() Phase {
+	return m.phase
+}
+
+// Winner returns the result of the last match; it is a draw while the
+// match is not over
+func (m *Match) Winner() Result {
+	return m.winner
+}
+
+// RespawnDelay is how long a killed player waits before respawning
+func (m *Match) RespawnDelay() time.Duration {
+	return m.Mode.RespawnDelay()
+}
+
+// TimeRemaining returns how long the current phase lasts, or 0 when it has
+// no time limit
+func (m *Match) TimeRemaining(now time.Time) time.Duration {
+	var length time.Duration
+	switch m.phase {
+	case PhaseWarmup:
+		if m.Scoreboard.Len() < m.Rules.MinPlayers {
+			return 0
+		}
+		length = m.Rules.Warmup
+	case PhaseLive:
+		length = m.Rules.TimeLimit
+	case PhaseEnded:
+		length = m.Rules.Intermission
+	}
+	if length == 0 {
+		return 0
+	}
+	return max(0, length-now.Sub(m.phaseStart))
+}
+
+// OnJoin adds a player to the scoreboard and the mode
+func (m *Match) OnJoin(playerID int32, now time.Time) {
+	if m.phase == PhaseWarmup && m.Scoreboard.Len() < m.Rules.MinPlayers {
+		// The warmup countdown starts once enough players are here
+		m.phaseStart = now
+	}
+	m.Scoreboard.AddPlayer(playerID)
+	m.Mode.OnJoin(playerID)
+}
+
+// OnLeave removes a player from the scoreboard and the mode
+func (m *Match) OnLeave(playerID int32) {
+	m.Scoreboard.RemovePlayer(playerID)
+	m.Mode.OnLeave(playerID)
+}
+
+// Team returns the team a player is on, or 0 outside team modes
+func (m *Match) Team(playerID int32) int32 {
+	if teamMode, ok := m.Mode.(TeamMode); ok {
+		return teamMode.Teams().Team(playerID)
+	}
+	return 0
+}
+
+// SwitchTeam moves a player to another team in team modes
+func (m *Match) SwitchTeam(playerID, teamID int32) error {
+	teamMode, ok := m.Mode.(TeamMode)
+	if !ok {
+		return ErrNoTeams
+	}
+	return teamMode.Teams().Switch(playerID, teamID)
+}
+
+// CanDamage reports whether players can hurt each other in the current phase
+func (m *Match) CanDamage() bool {
+	return m.phase != PhaseEnded
+}
+
+// OnDamage records damage for assists
+func (m *Match) OnDamage(attackerID, victimID int32, now time.Time) {
+	if m.phase == PhaseLive {
+		m.Scoreboard.RecordDamage(attackerID, victimID, now)
+	}
+}
+
+// OnKill scores a kill and ends the match when the mode says it is over.
+// It reports whether the kill counted; kills outside the live phase do not.
+func (m *Match) OnKill(killerID, victimID int32, now time.Time) bool {
+	if m.phase != PhaseLive {
+		return false
+	}
+	m.Scoreboard.RecordKill(killerID, victimID, now)
+	m.Mode.OnKill(killerID, victimID)
+
+	if m.Mode.IsOver() {
+		m.end(now)
+	}
+	return true
+}
+
+// Tick advances the phase when its time is up and reports whether the
+// phase changed since the previous Tick
+func (m *Match) Tick(now time.Time) bool {
+	elapsed := now.Sub(m.phaseStart)
+
+	switch m.phase {
+	case PhaseWarmup:
+		if m.Scoreboard.Len() < m.Rules.MinPlayers {
+			m.phaseStart = now
+		} else if elapsed >= m.Rules.Warmup {
+			m.Scoreboard.Reset()
+			m.Mode.Reset()
+			m.winner = Result{}
+			m.setPhase(PhaseLive, now)
+		}
+	case PhaseLive:
+		m.Mode.OnTick(elapsed)
+		if m.Mode.IsOver() {
+			m.end(now)
+		}
+	case PhaseEnded:
+		if elapsed >= m.Rules.Intermission {
+			m.Scoreboard.Reset()
+			m.setPhase(PhaseWarmup, now)
+		}
+	}
+
+	changed := m.phase != m.reported
+	m.reported = m.phase
+	return changed
+}
+
+// end finishes the live phase with the mode's winner
+func (m *Match) end(now time.Time) {
+	m.winner = m.Mode.Winner()
+	m.setPhase(PhaseEnded, now)
+}
+
+func (m *Match) setPhase(phase Phase, now time.Time) {
+	m.phase = phase
+	m.phaseStart = now
+}
@@ -0,0 +1,81 @@
+package gamemode
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMatchPhases(t *testing.T) {
+	rules := Rules{Warmup: 10 * time.Second, TimeLimit: time.Minute, ScoreLimit: 2, Intermission: 5 * time.Second, MinPlayers: 2}
+	start := time.Now()
+	m := NewMatch(NewDeathMatch(rules), start)
+	at := func(d time.Duration) time.Time { return start.Add(d) }
+
+	// The warmup countdown waits for enough players
+	m.OnJoin(1, start)
+	if m.Tick(at(time.Minute)) || m.Phase() != PhaseWarmup {
+		t.Fatalf("left warmup with one player, in phase %v", m.Phase())
+	}
+	m.OnJoin(2, at(time.Minute))
+	if m.OnKill(1, 2, at(time.Minute)) {
+		t.Error("a warmup kill counted")
+	}
+	if m.Tick(at(time.Minute + 9*time.Second)) {
+		t.Fatal("went live before the warmup was over")
+	}
+	if !m.Tick(at(time.Minute+10*time.Second)) || m.Phase() != PhaseLive {
+		t.Fatalf("in phase %v after the warmup, want live", m.Phase())
+	}
+	if stats, _ := m.Scoreboard.Stats(1); stats.Kills != 0 {
+		t.Errorf("warmup kills carried into the live phase: %+v", stats)
+	}
+
+	// Reaching the score limit ends the match with a winner
+	live := at(time.Minute + 10*time.Second)
+	if !m.OnKill(1, 2, live) || m.Phase() != PhaseLive {
+		t.Fatalf("first kill: in phase %v, want still live", m.Phase())
+	}
+	m.OnKill(1, 2, live)
+	if !m.Tick(live) || m.Phase() != PhaseEnded || m.Winner() != (Result{PlayerID: 1}) {
+		t.Fatalf("in phase %v with winner %+v, want ended with player 1 winning", m.Phase(), m.Winner())
+	}
+	if m.CanDamage() {
+		t.Error("players can be damaged after the match ended")
+	}
+
+	// The intermission leads back to warmup with a fresh scoreboard
+	if !m.Tick(live.Add(5*time.Second)) || m.Phase() != PhaseWarmup {
+		t.Fatalf("in phase %v after the intermission, want warmup", m.Phase())
+	}
+	if stats, _ := m.Scoreboard.Stats(1); stats != (Stats{PlayerID: 1}) {
+		t.Errorf("scoreboard not reset for the next match: %+v", stats)
+	}
+}
+
+func TestMatchTimeLimit(t *testing.T) {
+	rules := Rules{TimeLimit: time.Minute, MinPlayers: 1}
+	start := time.Now()
+	m := NewMatch(NewTeamDeathMatch(rules), start)
+	m.OnJoin(1, start)
+	m.OnJoin(2, start)
+	m.OnJoin(3, start)
+	m.Tick(start)
+
+	// A team kill scores nothing for the team
+	red, blue := m.Team(1), m.Team(2)
+	m.OnKill(1, 3, start)
+	if m.Team(3) != red {
+		t.Fatalf("players 1 and 3 are on teams %d and %d, want both on red", red, m.Team(3))
+	}
+	m.OnKill(2, 1, start)
+
+	if m.Tick(start.Add(59 * time.Second)) {
+		t.Fatal("ended before the time limit")
+	}
+	if !m.Tick(start.Add(time.Minute)) || m.Winner() != (Result{TeamID: blue}) {
+		t.Errorf("in phase %v with winner %+v, want ended with team %d winning", m.Phase(), m.Winner(), blue)
+	}
+	if stats, _ := m.Scoreboard.Stats(1); stats.Kills != 0 {
+		t.Errorf("team kill credited on the scoreboard: %+v", stats)
+	}
+}
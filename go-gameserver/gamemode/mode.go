@@ -0,0 +1,73 @@
+package gamemode
+
+import (
+	"fmt"
+	"time"
+)
+
+// ModeID identifies a game mode on the wire
+type ModeID byte
+
+const (
+	ModeFreePlay       ModeID = 0
+	ModeDeathMatch     ModeID = 1
+	ModeTeamDeathMatch ModeID = 2
+)
+
+// Mode names, matching GAME_MODES in the client's GameMode.js
+const (
+	FreePlayName       = "free_play"
+	DeathMatchName     = "death_match"
+	TeamDeathMatchName = "team_death_match"
+)
+
+// Result is the outcome of a match. A zero Result is a draw.
+type Result struct {
+	PlayerID int32 // Winning player in free-for-all modes
+	TeamID   int32 // Winning team in team modes
+}
+
+// GameMode is the set of rules a room's match is played under. The Match
+// owns the lifecycle and calls into the mode; modes only keep score.
+// Implementations are not safe for concurrent use.
+type GameMode interface {
+	ID() ModeID
+	Name() string
+
+	// Rules returns the phase durations and limits of the mode
+	Rules() Rules
+
+	// RespawnDelay is how long a killed player waits before respawning
+	RespawnDelay() time.Duration
+
+	OnJoin(playerID int32)
+	OnLeave(playerID int32)
+	OnKill(killerID, victimID int32)
+
+	// OnTick is called every tick of the live phase with the time since it began
+	OnTick(elapsed time.Duration)
+
+	// IsOver reports whether the live phase should end
+	IsOver() bool
+	Winner() Result
+
+	// Reset clears the score for a new match, keeping the players
+	Reset()
+}
+
+// Names lists every mode name accepted by New
+var Names = []string{FreePlayName, DeathMatchName, TeamDeathMatchName}
+
+// New creates a game mode by name
+func New(name string) (GameMode, error) {
+	switch name {
+	case FreePlayName:
+		return NewFreePlay(), nil
+	case DeathMatchName:
+		return NewDeathMatch(DeathMatchRules), nil
+	case TeamDeathMatchName:
+		return NewTeamDeathMatch(TeamDeathMatchRules), nil
+	default:
+		return nil, fmt.Errorf("unknown game mode %q (want %s, %s or %s)", name, FreePlayName, DeathMatchName, TeamDeathMatchName)
+	}
+}
@@ -0,0 +1,144 @@
+package gamemode
+
+import (
+	"sort"
+	"time"
+)
+
+// AssistWindow is how recently a player must have damaged a victim to earn an assist
+const AssistWindow = 10 * time.Second
+
+// Stats is one player's line on the scoreboard
+type Stats struct {
+	PlayerID int32
+	Kills    int
+	Deaths   int
+	Assists  int
+}
+
+// Scoreboard counts kills, deaths and assists per player.
+// It is not safe for concurrent use.
+type Scoreboard struct {
+	stats  map[int32]*Stats
+	teamOf func(playerID int32) int32 // Team of each player, 0 for none
+
+	// Last time each attacker damaged each victim, keyed by victim
+	damage map[int32]map[int32]time.Time
+}
+
+// NewScoreboard creates an empty scoreboard. teamOf returns the team a
+// player is on, or 0 if they have none; it may be nil outside team modes.
+func NewScoreboard(teamOf func(playerID int32) int32) *Scoreboard {
+	if teamOf == nil {
+		teamOf = func(int32) int32 { return 0 }
+	}
+	return &Scoreboard{
+		stats:  make(map[int32]*Stats),
+		teamOf: teamOf,
+		damage: make(map[int32]map[int32]time.Time),
+	}
+}
+
+// AddPlayer gives a player an empty line on the scoreboard
+func (s *Scoreboard) AddPlayer(playerID int32) {
+	if _, exists := s.stats[playerID]; !exists {
+		s.stats[playerID] = &Stats{PlayerID: playerID}
+	}
+}
+
+// RemovePlayer drops a player's line and any damage they dealt or took
+func (s *Scoreboard) RemovePlayer(playerID int32) {
+	delete(s.stats, playerID)
+	delete(s.damage, playerID)
+	for _, attackers := range s.damage {
+		delete(attackers, playerID)
+	}
+}
+
+// RecordDamage remembers that attacker damaged victim, for assists
+func (s *Scoreboard) RecordDamage(attackerID, victimID int32, at time.Time) {
+	attackers, exists := s.damage[victimID]
+	if !exists {
+		attackers = make(map[int32]time.Time)
+		s.damage[victimID] = attackers
+	}
+	attackers[attackerID] = at
+}
+
+// RecordKill credits the killer, the victim's death and an assist to everyone
+// else who damaged the victim within AssistWindow. Killing or damaging a
+// teammate earns nothing. It returns the assisting players.
+func (s *Scoreboard) RecordKill(killerID, victimID int32, at time.Time) []int32 {
+	if killer, exists := s.stats[killerID]; exists && killerID != victimID && !s.teammates(killerID, victimID) {
+		killer.Kills++
+	}
+	if victim, exists := s.stats[victimID]; exists {
+		victim.Deaths++
+	}
+
+	var assists []int32
+	for attackerID, last := range s.damage[victimID] {
+		if attackerID == killerID || attackerID == victimID || at.Sub(last) > AssistWindow ||
+			s.teammates(attackerID, victimID) {
+			continue
+		}
+		if attacker, exists := s.stats[attackerID]; exists {
+			attacker.Assists++
+			assists = append(assists, attackerID)
+		}
+	}
+	delete(s.damage, victimID)
+
+	return assists
+}
+
+// teammates reports whether two players are on the same team
+func (s *Scoreboard) teammates(a, b int32) bool {
+	team := s.teamOf(a)
+	return team != 0 && team == s.teamOf(b)
+}
+
+// Stats returns a player's line on the scoreboard
+func (s *Scoreboard) Stats(playerID int32) (Stats, bool) {
+	stats, exists := s.stats[playerID]
+	if !exists {
+		return Stats{}, false
+	}
+	return *stats, true
+}
+
+// Entries returns every player's line, best first: most kills, then fewest
+// deaths, then most assists
+func (s *Scoreboard) Entries() []Stats {
+	entries := make([]Stats, 0, len(s.stats))
+	for _, stats := range s.stats {
+		entries = append(entries, *stats)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.Kills != b.Kills {
+			return a.Kills > b.Kills
+		}
+		if a.Deaths != b.Deaths {
+			return a.Deaths < b.Deaths
+		}
+		if a.Assists != b.Assists {
+			return a.Assists > b.Assists
+		}
+		return a.PlayerID < b.PlayerID
+	})
+	return entries
+}
+
+// Reset zeroes every player's stats, keeping the players
+func (s *Scoreboard) Reset() {
+	for playerID := range s.stats {
+		s.stats[playerID] = &Stats{PlayerID: playerID}
+	}
+	s.damage = make(map[int32]map[int32]time.Time)
+}
+
+// Len returns the number of players on the scoreboard
+func (s *Scoreboard) Len() int {
+	return len(s.stats)
+}
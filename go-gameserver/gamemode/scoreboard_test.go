@@ -0,0 +1,68 @@
+package gamemode
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScoreboardAssists(t *testing.T) {
+	s := NewScoreboard(nil)
+	for id := int32(1); id <= 4; id++ {
+		s.AddPlayer(id)
+	}
+
+	start := time.Now()
+	s.RecordDamage(2, 1, start)                    // Too long before the kill
+	s.RecordDamage(3, 1, start.Add(5*time.Second)) // Within the window
+	s.RecordDamage(4, 1, start.Add(AssistWindow))  // The killer's own damage
+	assists := s.RecordKill(4, 1, start.Add(AssistWindow+time.Second))
+
+	if len(assists) != 1 || assists[0] != 3 {
+		t.Errorf("got assists %v, want only player 3", assists)
+	}
+	want := map[int32]Stats{
+		1: {PlayerID: 1, Deaths: 1},
+		2: {PlayerID: 2},
+		3: {PlayerID: 3, Assists: 1},
+		4: {PlayerID: 4, Kills: 1},
+	}
+	for id, stats := range want {
+		if got, _ := s.Stats(id); got != stats {
+			t.Errorf("player %d: got %+v, want %+v", id, got, stats)
+		}
+	}
+
+	// Damage is forgotten once it has counted towards a kill
+	if assists := s.RecordKill(4, 1, start.Add(AssistWindow+2*time.Second)); len(assists) != 0 {
+		t.Errorf("got assists %v on a second kill without new damage", assists)
+	}
+	if entries := s.Entries(); entries[0].PlayerID != 4 || entries[len(entries)-1].PlayerID != 1 {
+		t.Errorf("entries %+v are not best first", entries)
+	}
+}
+
+func TestScoreboardTeamKills(t *testing.T) {
+	teams := map[int32]int32{1: TeamRed, 2: TeamRed, 3: TeamBlue}
+	s := NewScoreboard(func(playerID int32) int32 { return teams[playerID] })
+	for id := range teams {
+		s.AddPlayer(id)
+	}
+
+	now := time.Now()
+	s.RecordDamage(2, 1, now)
+	if assists := s.RecordKill(3, 1, now); len(assists) != 0 {
+		t.Errorf("got assists %v for damaging a teammate", assists)
+	}
+	s.RecordKill(2, 1, now)
+
+	want := map[int32]Stats{
+		1: {PlayerID: 1, Deaths: 2},
+		2: {PlayerID: 2},
+		3: {PlayerID: 3, Kills: 1},
+	}
+	for id, stats := range want {
+		if got, _ := s.Stats(id); got != stats {
+			t.Errorf("player %d: got %+v, want %+v", id, got, stats)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package gamemode
+
+import "time"
+
+// TeamDeathMatchRules are the default limits of a team death match
+var TeamDeathMatchRules = Rules{
+	Warmup:       15 * time.Second,
+	TimeLimit:    600 * time.Second,
+	ScoreLimit:   30,
+	Intermission: 10 * time.Second,
+	MinPlayers:   2,
+
+	PlatformRegen: 90 * time.Second,
+}
+
+// TeamDeathMatch splits players into two teams; the first team to the score
+// limit, or the team with the most kills when time runs out, wins
+type TeamDeathMatch struct {
+	rules   Rules
+	teams   *Teams
+	scores  map[int32]int // Kills per team
+	elapsed time.Duration
+}
+
+// NewTeamDeathMatch creates a team death match mode with the given limits
+func NewTeamDeathMatch(rules Rules) *TeamDeathMatch {
+	return &TeamDeathMatch{
+		rules:  rules,
+		teams:  NewTeams(TeamRed, TeamBlue),
+		scores: map[int32]int{TeamRed: 0, TeamBlue: 0},
+	}
+}
+
+func (m *TeamDeathMatch) ID() ModeID                  { return ModeTeamDeathMatch }
+func (m *TeamDeathMatch) Name() string                { return TeamDeathMatchName }
+func (m *TeamDeathMatch) Rules() Rules                { return m.rules }
+func (m *TeamDeathMatch) RespawnDelay() time.Duration { return 5 * time.Second }
+
+// OnJoin puts the player on the team with fewer players
+func (m *TeamDeathMatch) OnJoin(playerID int32) {
+	m.teams.Assign(playerID)
+}
+
+func (m *TeamDeathMatch) OnLeave(playerID int32) {
+	m.teams.Remove(playerID)
+}
+
+// OnKill scores a point for the killer's team. Killing a teammate scores nothing.
+func (m *TeamDeathMatch) OnKill(killerID, victimID int32) {
+	killerTeam := m.teams.Team(killerID)
+	if killerTeam == 0 || killerTeam == m.teams.Team(victimID) {
+		return
+	}
+	m.scores[killerTeam]++
+}
+
+func (m *TeamDeathMatch) OnTick(elapsed time.Duration) {
+	m.elapsed = elapsed
+}
+
+func (m *TeamDeathMatch) IsOver() bool {
+	if m.rules.TimeLimit > 0 && m.elapsed >= m.rules.TimeLimit {
+		return true
+	}
+	if m.rules.ScoreLimit > 0 {
+		for _, score := range m.scores {
+			if score >= m.rules.ScoreLimit {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Winner returns the team with the most kills, or a draw when scores are level
+func (m *TeamDeathMatch) Winner() Result {
+	switch red, blue := m.scores[TeamRed], m.scores[TeamBlue]; {
+	case red > blue:
+		return Result{TeamID: TeamRed}
+	case blue > red:
+		return Result{TeamID: TeamBlue}
+	default:
+		return Result{}
+	}
+}
+
+func (m *TeamDeathMatch) Reset() {
+	m.scores[TeamRed] = 0
+	m.scores[TeamBlue] = 0
+	m.elapsed = 0
+}
+
+// Teams returns the mode's team assignments
+func (m *TeamDeathMatch) Teams() *Teams {
+	return m.teams
+}
+
+// Score returns a team's kills in the current match
+func (m *TeamDeathMatch) Score(teamID int32) int {
+	return m.scores[teamID]
+}
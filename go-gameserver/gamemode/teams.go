@@ -0,0 +1,133 @@
+package gamemode
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Team IDs used by team modes (0 = no team)
+const (
+	TeamRed  int32 = 1
+	TeamBlue int32 = 2
+)
+
+// Color is an RGBA color with components from 0 to 1, as in protocol.Player
+type Color struct {
+	R, G, B, A float32
+}
+
+// teamColors are the colors players are forced to wear on each team
+var teamColors = map[int32]Color{
+	TeamRed:  {R: 0.9, G: 0.2, B: 0.2, A: 1},
+	TeamBlue: {R: 0.2, G: 0.4, B: 0.9, A: 1},
+}
+
+// TeamColor returns the color of a team
+func TeamColor(teamID int32) (Color, bool) {
+	color, exists := teamColors[teamID]
+	return color, exists
+}
+
+// Reasons a team switch is refused
+var (
+	ErrUnknownTeam     = errors.New("unknown team")
+	ErrTeamsUnbalanced = errors.New("switching would unbalance the teams")
+	ErrNoTeams         = errors.New("game mode has no teams")
+)
+
+// TeamMode is a GameMode that splits players into teams
+type TeamMode interface {
+	GameMode
+	Teams() *Teams
+}
+
+// Teams assigns players to teams and keeps the teams balanced.
+// It is not safe for concurrent use.
+type Teams struct {
+	ids     []int32         // Team IDs, in the order ties are broken
+	members map[int32]int32 // Team of each player
+}
+
+// NewTeams creates empty teams with the given IDs
+func NewTeams(ids ...int32) *Teams {
+	return &Teams{
+		ids:     ids,
+		members: make(map[int32]int32),
+	}
+}
+
+// Assign puts a player on the team with the fewest players and returns it
+func (t *Teams) Assign(playerID int32) int32 {
+	if team, exists := t.members[playerID]; exists {
+		return team
+	}
+
+	sizes := t.Sizes()
+	best := t.ids[0]
+	for _, id := range t.ids[1:] {
+		if sizes[id] < sizes[best] {
+			best = id
+		}
+	}
+	t.members[playerID] = best
+	return best
+}
+
+// Remove takes a player off their team
+func (t *Teams) Remove(playerID int32) {
+	delete(t.members, playerID)
+}
+
+// Team returns the team a player is on, or 0 if they have none
+func (t *Teams) Team(playerID int32) int32 {
+	return t.members[playerID]
+}
+
+// Switch moves a player to another team, as long as that team would not end
+// up with more than one player over any other team
+func (t *Teams) Switch(playerID, teamID int32) error {
+	current, exists := t.members[playerID]
+	if !exists {
+		return fmt.Errorf("player %d is not on a team", playerID)
+	}
+	if !t.has(teamID) {
+		return ErrUnknownTeam
+	}
+	if current == teamID {
+		return nil
+	}
+
+	sizes := t.Sizes()
+	sizes[current]--
+	sizes[teamID]++
+	for _, id := range t.ids {
+		if sizes[teamID]-sizes[id] > 1 {
+			return ErrTeamsUnbalanced
+		}
+	}
+
+	t.members[playerID] = teamID
+	return nil
+}
+
+// Sizes counts the players on each team
+func (t *Teams) Sizes() map[int32]int {
+	sizes := make(map[int32]int, len(t.ids))
+	for _, id := range t.ids {
+		sizes[id] = 0
+	}
+	for _, team := range t.members {
+		sizes[team]++
+	}
+	return sizes
+}
+
+// has reports whether teamID is one of the teams
+func (t *Teams) has(teamID int32) bool {
+	for _, id := range t.ids {
+		if id == teamID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,62 @@
+package gamemode
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTeamsAssign(t *testing.T) {
+	teams := NewTeams(TeamRed, TeamBlue)
+	for id, want := range []int32{TeamRed, TeamBlue, TeamRed, TeamBlue} {
+		if got := teams.Assign(int32(id + 1)); got != want {
+			t.Errorf("player %d assigned to team %d, want %d", id+1, got, want)
+		}
+	}
+	if got := teams.Assign(1); got != TeamRed {
+		t.Errorf("assigning again moved player 1 to team %d", got)
+	}
+
+	teams.Remove(1)
+	if got := teams.Team(1); got != 0 {
+		t.Errorf("removed player is on team %d", got)
+	}
+	if got := teams.Assign(5); got != TeamRed {
+		t.Errorf("player 5 assigned to team %d, want the smaller red team", got)
+	}
+}
+
+func TestTeamsSwitch(t *testing.T) {
+	teams := NewTeams(TeamRed, TeamBlue)
+	teams.Assign(1) // Red
+	teams.Assign(2) // Blue
+	teams.Assign(3) // Red
+
+	tests := []struct {
+		name     string
+		playerID int32
+		teamID   int32
+		want     error
+		wantTeam int32
+	}{
+		{"to the same team", 1, TeamRed, nil, TeamRed},
+		{"to an unknown team", 1, 7, ErrUnknownTeam, TeamRed},
+		{"to the smaller team", 1, TeamBlue, nil, TeamBlue},
+		{"back to one player over", 2, TeamRed, nil, TeamRed},
+		{"leaving a team empty", 1, TeamRed, ErrTeamsUnbalanced, TeamBlue},
+	}
+	for _, tt := range tests {
+		if err := teams.Switch(tt.playerID, tt.teamID); err != tt.want {
+			t.Errorf("%s: got error %v, want %v", tt.name, err, tt.want)
+		}
+		if got := teams.Team(tt.playerID); got != tt.wantTeam {
+			t.Errorf("%s: player %d is on team %d, want %d", tt.name, tt.playerID, got, tt.wantTeam)
+		}
+	}
+
+	if err := teams.Switch(9, TeamRed); err == nil {
+		t.Error("switched a player who is not on a team")
+	}
+	if err := NewMatch(NewDeathMatch(DeathMatchRules), time.Now()).SwitchTeam(1, TeamRed); err != ErrNoTeams {
+		t.Errorf("switching teams in a death match got error %v, want %v", err, ErrNoTeams)
+	}
+}
@@ -2,4 +2,4 @@ module gameeserever
 
 go 1.22.1
 
-require github.com/gorilla/websocket v1.5.3 // indirect
+require github.com/gorilla/websocket v1.5.3
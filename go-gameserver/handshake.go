@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"gameeserever/protocol"
+)
+
+// handshakeTimeout is how long a client has to send its Hello after connecting
+const handshakeTimeout = 5 * time.Second
+
+// handshakeError is a rejected Hello and the close code it is rejected with
+type handshakeError struct {
+	code   int
+	reason string
+}
+
+func (e *handshakeError) Error() string {
+	return e.reason
+}
+
+// session is what a handshake settles for a connection
+type session struct {
+	hello    protocol.Hello
+	features protocol.Features // Features to use on the connection
+	json     bool              // The client speaks the JSON protocol
+}
+
+// handshake waits for the client's Hello and returns the session it opens.
+// A client that doesn't open with a Hello the room can serve is sent a close
+// frame saying why, and the connection is closed.
+func (r *Room) handshake(conn *websocket.Conn) (session, error) {
+	s, err := r.readHello(conn)
+	if err != nil {
+		code := websocket.CloseProtocolError
+		if rejected, ok := err.(*handshakeError); ok {
+			code = rejected.code
+		}
+		deadline := time.Now().Add(time.Second)
+		conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, err.Error()), deadline)
+		conn.Close()
+	}
+	return s, err
+}
+
+// readHello reads the first message and checks it is a Hello from a client
+// the room can serve. A Hello in a text frame picks the JSON protocol for
+// the rest of the connection.
+func (r *Room) readHello(conn *websocket.Conn) (session, error) {
+	conn.SetReadDeadline(time.Now().Add(handshakeTimeout))
+	messageType, data, err := conn.ReadMessage()
+	if err != nil {
+		return session{}, err
+	}
+	conn.SetReadDeadline(time.Time{})
+
+	var msg protocol.Message
+	s := session{json: messageType == websocket.TextMessage}
+	if s.json {
+		if !r.allowJSON {
+			jsonRejected.Add(1)
+			return s, &handshakeError{protocol.CloseJSONDisabled, "the server does not accept JSON clients"}
+		}
+		var jsonMsg protocol.JSONMessage
+		if jsonMsg, err = protocol.DecodeJSON(data); err == nil {
+			msg = jsonMsg.Message(protocol.Player{})
+		}
+	} else {
+		msg, err = protocol.DecodeMessage(data)
+	}
+	hello, ok := msg.(protocol.HelloMessage)
+	if err != nil || !ok {
+		return s, &handshakeError{protocol.CloseHelloRequired, "expected a Hello message"}
+	}
+	s.hello = hello.Hello
+
+	version := s.hello.Version
+	if version < protocol.MinProtocolVersion || version > protocol.ProtocolVersion {
+		return s, &handshakeError{protocol.CloseVersionUnsupported, fmt.Sprintf(
+			"protocol version %d is not supported, the server accepts %d to %d",
+			version, protocol.MinProtocolVersion, protocol.ProtocolVersion)}
+	}
+
+	// Optional features are used when the client supports them; those the
+	// room depends on are required
+	s.features = s.hello.Features & protocol.FeatureQuantized
+	if r.serverProjectiles {
+		if s.hello.Features&protocol.FeatureServerProjectiles == 0 {
+			return s, &handshakeError{protocol.CloseFeatureMissing,
+				"the room simulates projectiles on the server and the client does not support it"}
+		}
+		s.features |= protocol.FeatureServerProjectiles
+	}
+
+	return s, nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import "gameeserever/protocol"
+
+const (
+	// DefaultViewRadius is how far from a player, in pixels, other players are
+	// still sent to them; a little more than a zoomed-out screen
+	DefaultViewRadius = 2500
+
+	// viewHysteresis is how much farther than the view radius a visible player
+	// has to move before leaving view, so players near the edge don't flicker
+	viewHysteresis = 1.2
+)
+
+// updateInterest recomputes which players are within the client's view radius
+// and returns the players it is sent this tick along with the enter and leave
+// view events it is due. The caller must hold r.mu.
+func (r *Room) updateInterest(client *ClientState, players map[int32]protocol.Player) (map[int32]protocol.Player, []protocol.Message) {
+	if r.viewRadius <= 0 {
+		return players, nil
+	}
+
+	self := client.Player
+	x, y := centerOf(&self)
+
+	visible := map[int32]bool{self.ID: true}
+	for _, playerID := range r.world.PlayersNear(x, y, r.viewRadius) {
+		visible[playerID] = true
+	}
+
+	// Players already in view stay there until they are clearly out of range
+	for _, playerID := range r.world.PlayersNear(x, y, r.viewRadius*viewHysteresis) {
+		if client.visible[playerID] {
+			visible[playerID] = true
+		}
+	}
+
+	var events []protocol.Message
+	inView := make(map[int32]protocol.Player, len(visible))
+	for playerID := range visible {
+		player, exists := players[playerID]
+		if !exists {
+			delete(visible, playerID)
+			continue
+		}
+		inView[playerID] = player
+		if !client.visible[playerID] {
+			events = append(events, protocol.PlayerEnterViewMessage{Player: player})
+		}
+	}
+	for playerID := range client.visible {
+		// Players that left the game are announced by BroadcastPlayerLeaveMessage
+		if _, exists := players[playerID]; exists && !visible[playerID] {
+			events = append(events, protocol.PlayerLeaveViewMessage{PlayerID: playerID})
+		}
+	}
+
+	client.visible = visible
+	return inView, events
+}
+
+// inView reports whether a player is in a client's set of visible players,
+// where a nil set means every player is visible
+func inView(visible map[int32]bool, playerID int32) bool {
+	return visible == nil || visible[playerID]
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"gameeserever/level"
+	"gameeserever/protocol"
+	"gameeserever/weapons"
+)
+
+// Lag compensation constants
+const (
+	// DefaultMaxRewind is how far back in time hits are checked against
+	// player positions, to make up for the shooter's latency
+	DefaultMaxRewind = 250 * time.Millisecond
+
+	// maxMuzzleDistance is how far from the shooter's center a shot may start
+	maxMuzzleDistance = 150
+
+	// hitboxTolerance pads hitboxes to absorb interpolation differences
+	// between the client's view and the server's history
+	hitboxTolerance = 16
+
+	// viewTickTolerance is how many ticks around the shooter's reported view
+	// tick a rewound position is still accepted
+	viewTickTolerance = 3
+
+	// maxShotsPerPlayer bounds how many unresolved shots are kept per player
+	maxShotsPerPlayer = 32
+)
+
+// Reasons a hit report is rejected
+var (
+	errSelfHit        = errors.New("shooter reported hitting themselves")
+	errUnknownShooter = errors.New("shooter is not in the world")
+	errShooterDead    = errors.New("shooter is dead")
+	errUnknownTarget  = errors.New("target is not in the world")
+	errTargetDead     = errors.New("target is already dead")
+	errNoMatchingShot = errors.New("no recent shot could have hit the target")
+	errMuzzleTooFar   = errors.New("shot starts too far from the shooter")
+	errInvalidAngle   = errors.New("shot angle is not a finite number")
+	errWrongWeapon    = errors.New("shot is from a weapon the shooter does not hold")
+)
+
+// positionSample is a player's hitbox at the end of a tick
+type positionSample struct {
+	tick uint32
+	box  level.Rect
+}
+
+// rewindBuffer is a fixed-size ring of a player's most recent hitboxes
+type rewindBuffer struct {
+	samples []positionSample
+	next    int
+	count   int
+}
+
+func newRewindBuffer(size int) *rewindBuffer {
+	return &rewindBuffer{samples: make([]positionSample, size)}
+}
+
+// record stores a sample, overwriting the oldest one when the buffer is full
+func (b *rewindBuffer) record(sample positionSample) {
+	b.samples[b.next] = sample
+	b.next = (b.next + 1) % len(b.samples)
+	b.count = min(b.count+1, len(b.samples))
+}
+
+// between returns the samples recorded for ticks from..to, oldest first
+func (b *rewindBuffer) between(from, to uint32) []positionSample {
+	var result []positionSample
+	for i := 0; i < b.count; i++ {
+		sample := b.samples[(b.next-b.count+i+len(b.samples))%len(b.samples)]
+		if sample.tick >= from && sample.tick <= to {
+			result = append(result, sample)
+		}
+	}
+	return result
+}
+
+// shotRecord is a validated GunFire that has not hit anyone yet
+type shotRecord struct {
+	fire     protocol.GunFire
+	weapon   weapons.Weapon
+	tick     uint32 // Server tick the shot was received on
+	viewTick uint32 // Tick the shooter was looking at, 0 when unknown
+}
+
+// hitboxOf returns the hitbox of a player at their current position
+func hitboxOf(player *protocol.Player) level.Rect {
+	return level.Rect{
+		MinX: player.X,
+		MinY: player.Y,
+		MaxX: player.X + player.Width,
+		MaxY: player.Y + player.Height,
+	}
+}
+
+// centerOf returns the center of a player's hitbox
+func centerOf(player *protocol.Player) (x, y float32) {
+	return player.X + player.Width/2, player.Y + player.Height/2
+}
+
+// recordHistory stores every player's hitbox for the current tick
+func (w *World) recordHistory() {
+	for playerID, sim := range w.sims {
+		sim.history.record(positionSample{tick: w.Tick, box: hitboxOf(w.Players[playerID])})
+	}
+}
+
+// RecordShot remembers a shot so that later hit reports can be checked
+// against it, and returns the weapon it was fired from. Shots from dead
+// players, shots that start too far from the shooter and shots that break the
+// weapon's fire rate or ammo are rejected.
+func (w *World) RecordShot(fire protocol.GunFire) (weapons.Weapon, error) {
+	shooter, exists := w.Players[fire.PlayerID]
+	if !exists {
+		return weapons.Weapon{}, errUnknownShooter
+	}
+	if shooter.IsDead {
+		return weapons.Weapon{}, errShooterDead
+	}
+	sim := w.sims[fire.PlayerID]
+
+	weapon, err := w.weapon(sim.weaponID)
+	if err != nil {
+		return weapons.Weapon{}, err
+	}
+	if fire.WeaponID != 0 && fire.WeaponID != weapon.ID {
+		return weapons.Weapon{}, errWrongWeapon
+	}
+
+	if fire.Angle != fire.Angle || math.IsInf(float64(fire.Angle), 0) {
+		return weapons.Weapon{}, errInvalidAngle
+	}
+	dx := fire.X - (shooter.X + shooter.Width/2)
+	dy := fire.Y - (shooter.Y + shooter.Height/2)
+	if dx != dx || dy != dy || dx*dx+dy*dy > maxMuzzleDistance*maxMuzzleDistance {
+		return weapons.Weapon{}, errMuzzleTooFar
+	}
+
+	if err := w.fire(sim, weapon); err != nil {
+		return weapons.Weapon{}, err
+	}
+
+	// Drop shots whose bullets have expired
+	kept := sim.shots[:0]
+	for _, shot := range sim.shots {
+		if w.Tick-shot.tick <= w.ticksFor(shot.weapon.Lifetime())+w.maxRewindTicks {
+			kept = append(kept, shot)
+		}
+	}
+	sim.shots = kept
+	if len(sim.shots) >= maxShotsPerPlayer {
+		sim.shots = sim.shots[1:]
+	}
+
+	var viewTick uint32
+	if sim.inputDriven {
+		viewTick = sim.viewTick
+	}
+	sim.shots = append(sim.shots, shotRecord{fire: fire, weapon: weapon, tick: w.Tick, viewTick: viewTick})
+	return weapon, nil
+}
+
+// ValidateHit checks a client's hit report against the shooter's recent shots
+// and the target's rewound hitboxes. It returns the damage to apply, taken
+// from the weapon rather than the report, and consumes the shot that hit.
+func (w *World) ValidateHit(hit protocol.HitReport) (float32, error) {
+	if hit.ShooterID == hit.TargetID {
+		return 0, errSelfHit
+	}
+	shooterSim, exists := w.sims[hit.ShooterID]
+	if !exists {
+		return 0, errUnknownShooter
+	}
+	target, exists := w.Players[hit.TargetID]
+	if !exists {
+		return 0, errUnknownTarget
+	}
+	if target.IsDead {
+		return 0, errTargetDead
+	}
+	history := w.sims[hit.TargetID].history
+
+	// Never rewind further than the configured limit
+	var oldest uint32
+	if w.Tick > w.maxRewindTicks {
+		oldest = w.Tick - w.maxRewindTicks
+	}
+
+	// Newest shots first, since hits are usually reported right after firing
+	for i := len(shooterSim.shots) - 1; i >= 0; i-- {
+		shot := shooterSim.shots[i]
+
+		from := oldest
+		if shot.viewTick > viewTickTolerance {
+			from = max(from, shot.viewTick-viewTickTolerance)
+		}
+
+		if !shotHits(shot, w.shotReach(shot), history.between(from, w.Tick)) {
+			continue
+		}
+
+		shooterSim.shots = append(shooterSim.shots[:i], shooterSim.shots[i+1:]...)
+		return shot.weapon.Damage, nil
+	}
+
+	return 0, errNoMatchingShot
+}
+
+// shotReach returns how far a shot's bullet travels: the weapon's range, or
+// less when a platform is in the way
+func (w *World) shotReach(shot shotRecord) float32 {
+	if w.level == nil {
+		return shot.weapon.Range
+	}
+	sin, cos := math.Sincos(float64(shot.fire.Angle))
+	if hit, ok := w.level.Raycast(shot.fire.X, shot.fire.Y, float32(cos), float32(sin), shot.weapon.Range, w.terrain.isDestroyed); ok {
+		return hit.Distance
+	}
+	return shot.weapon.Range
+}
+
+// shotHits reports whether a shot's bullet could have passed through any of
+// the samples within reach, flying anywhere within its weapon's spread
+func shotHits(shot shotRecord, reach float32, samples []positionSample) bool {
+	for _, sample := range samples {
+		if coneHits(shot.fire.X, shot.fire.Y, shot.fire.Angle, shot.weapon.Spread, reach, sample.box.Expand(hitboxTolerance)) {
+			return true
+		}
+	}
+	return false
+}
+
+// coneHits reports whether a box overlaps the cone of directions within
+// spread of angle, out to reach. The box is hit when a ray along the middle
+// or an edge of the cone crosses it, or when one of its corners or the point
+// of it nearest to the origin lies inside the cone.
+func coneHits(originX, originY, angle, spread, reach float32, box level.Rect) bool {
+	for _, a := range []float32{angle, angle - spread, angle + spread} {
+		sin, cos := math.Sincos(float64(a))
+		if _, hit := box.Raycast(originX, originY, float32(cos), float32(sin), reach); hit {
+			return true
+		}
+		if spread == 0 {
+			return false
+		}
+	}
+
+	points := [][2]float32{
+		{box.MinX, box.MinY}, {box.MaxX, box.MinY}, {box.MinX, box.MaxY}, {box.MaxX, box.MaxY},
+		{max(box.MinX, min(originX, box.MaxX)), max(box.MinY, min(originY, box.MaxY))},
+	}
+	for _, p := range points {
+		dx, dy := float64(p[0]-originX), float64(p[1]-originY)
+		if math.Hypot(dx, dy) > float64(reach) {
+			continue
+		}
+		// Angle between the point and the aim direction, wrapped into [-π, π]
+		off := math.Remainder(math.Atan2(dy, dx)-float64(angle), 2*math.Pi)
+		if math.Abs(off) <= float64(spread) {
+			return true
+		}
+	}
+	return false
+}
+
+// ticksFor converts a duration into a whole number of ticks, rounding up
+func (w *World) ticksFor(d time.Duration) uint32 {
+	return uint32(math.Ceil(d.Seconds() / float64(w.tickDelta)))
+}
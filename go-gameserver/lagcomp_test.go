@@ -0,0 +1,174 @@
+package main
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"gameeserever/level"
+	"gameeserever/protocol"
+	"gameeserever/weapons"
+)
+
+func TestConeHits(t *testing.T) {
+	// A 20x20 box 100px to the right of the origin, 10° off the x axis at its edge
+	box := level.Rect{MinX: 100, MinY: 20, MaxX: 120, MaxY: 40}
+
+	tests := []struct {
+		name   string
+		angle  float32
+		spread float32
+		reach  float32
+		want   bool
+	}{
+		{"straight at it", 0.25, 0, 200, true},
+		{"straight past it", 0, 0, 200, false},
+		{"spread reaches it", 0, 0.2, 200, true},
+		{"spread too narrow", 0, 0.1, 200, false},
+		{"box inside the cone", 0.25, 0.5, 200, true},
+		{"out of reach", 0.25, 0.5, 90, false},
+		{"aim wraps around", 0.25 - 2*math.Pi, 0.01, 200, true},
+	}
+	for _, tt := range tests {
+		if got := coneHits(0, 0, tt.angle, tt.spread, tt.reach, box); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSpawnProjectileWithinSpread(t *testing.T) {
+	w := NewWorld(nil, weapons.Default(), 60, time.Second)
+	weapon := weapons.Weapon{ID: 1, Spread: 0.1, Range: 1000, BulletSpeed: 1000}
+
+	deviated := false
+	for i := 0; i < 100; i++ {
+		p := w.SpawnProjectile(protocol.GunFire{Angle: 1}, weapon)
+		off := math.Atan2(float64(p.VelocityY), float64(p.VelocityX)) - 1
+		if math.Abs(off) > float64(weapon.Spread)+1e-6 {
+			t.Fatalf("projectile flies %v rad off the aim, spread is %v", off, weapon.Spread)
+		}
+		deviated = deviated || math.Abs(off) > 1e-6
+	}
+	if !deviated {
+		t.Error("every projectile flew straight along the aim")
+	}
+}
+
+func TestRewindBuffer(t *testing.T) {
+	b := newRewindBuffer(4)
+	for tick := uint32(1); tick <= 10; tick++ {
+		b.record(positionSample{tick: tick})
+	}
+
+	tests := []struct {
+		from, to uint32
+		want     []uint32
+	}{
+		{0, 100, []uint32{7, 8, 9, 10}},
+		{8, 9, []uint32{8, 9}},
+		{1, 6, nil},
+	}
+	for _, tt := range tests {
+		var got []uint32
+		for _, sample := range b.between(tt.from, tt.to) {
+			got = append(got, sample.tick)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("between(%d, %d) = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestValidateHit(t *testing.T) {
+	lvl, err := level.Parse([]byte(wallLevel))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out := float32(-400) // A target height the shot passes under
+
+	tests := []struct {
+		name     string
+		targetX  float32
+		path     []float32 // Target's y on each tick before the shot, the last being current
+		viewTick uint32    // Tick the shooter reports looking at (0 = no input commands)
+		want     error
+	}{
+		{"current position", 100, []float32{-70}, 0, nil},
+		{"rewound position", 100, []float32{-70, out, out, out}, 0, nil},
+		{"older than the rewind limit", 100, []float32{-70, out, out, out, out, out, out, out, out}, 0, errNoMatchingShot},
+		{"view tick clamped to the rewind limit", 100, append(repeat(out, 19), -70), 4, nil},
+		{"view tick narrows the rewind", 100, []float32{-70, -70, out, out, out, out, out}, 7, errNoMatchingShot},
+		{"behind a platform", 300, []float32{-70}, 0, errNoMatchingShot},
+	}
+	for _, tt := range tests {
+		w := NewWorld(lvl, weapons.Default(), 60, 100*time.Millisecond)
+		shooter, target := newTestPlayer(1), newTestPlayer(2)
+		shooter.Y, target.X = -70, tt.targetX
+		w.AddPlayer(shooter)
+		w.AddPlayer(target)
+		if tt.viewTick != 0 {
+			w.QueueInput(shooter.ID, protocol.InputCommand{Sequence: 1, Tick: tt.viewTick})
+		}
+		for _, y := range tt.path {
+			target.Y = y
+			w.Step()
+		}
+
+		x, y := centerOf(shooter)
+		if _, err := w.RecordShot(protocol.GunFire{PlayerID: shooter.ID, X: x, Y: y}); err != nil {
+			t.Fatalf("%s: shot rejected: %v", tt.name, err)
+		}
+		hit := protocol.HitReport{ShooterID: shooter.ID, TargetID: target.ID}
+		damage, err := w.ValidateHit(hit)
+		if err != tt.want {
+			t.Errorf("%s: got error %v, want %v", tt.name, err, tt.want)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if damage != 10 {
+			t.Errorf("%s: got %v damage, want the weapon's 10", tt.name, damage)
+		}
+		if _, err := w.ValidateHit(hit); err != errNoMatchingShot {
+			t.Errorf("%s: second report of the same shot got error %v, want it used up", tt.name, err)
+		}
+	}
+}
+
+// repeat returns n copies of v
+func repeat(v float32, n int) []float32 {
+	s := make([]float32, n)
+	for i := range s {
+		s[i] = v
+	}
+	return s
+}
+
+func TestRecordShot(t *testing.T) {
+	tests := []struct {
+		name string
+		dead bool
+		x, y float32 // Muzzle position relative to the shooter's center
+		want error
+	}{
+		{"from the muzzle", false, 40, 0, nil},
+		{"too far from the shooter", false, maxMuzzleDistance + 1, 0, errMuzzleTooFar},
+		{"from a dead shooter", true, 40, 0, errShooterDead},
+	}
+	for _, tt := range tests {
+		w := NewWorld(nil, weapons.Default(), 60, time.Second)
+		shooter := newTestPlayer(1)
+		shooter.IsDead = tt.dead
+		w.AddPlayer(shooter)
+
+		x, y := centerOf(shooter)
+		if _, err := w.RecordShot(protocol.GunFire{PlayerID: shooter.ID, X: x + tt.x, Y: y + tt.y}); err != tt.want {
+			t.Errorf("%s: got error %v, want %v", tt.name, err, tt.want)
+		}
+		if shots := len(w.sims[shooter.ID].shots); (tt.want == nil) != (shots == 1) {
+			t.Errorf("%s: %d shots recorded", tt.name, shots)
+		}
+	}
+}
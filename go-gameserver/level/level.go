@@ -0,0 +1,318 @@
+package level
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"gameeserever/protocol"
+)
+
+// PlatformIDBase is the ID of a level's first rectangle, as assigned by the
+// client's game.js; platform IDs must not collide with player IDs there
+const PlatformIDBase = 10000000
+
+// platformHitPoints is how many hits destroy a platform of each type. Types
+// that are not listed, such as background and fill, can't be destroyed.
+var platformHitPoints = map[string]int{
+	"grass": 1,
+	"dirt":  2,
+	"stone": 4,
+}
+
+// Layers used by the level editor, mirroring LAYERS in the client's constants.js
+const (
+	LayerBackground = 0
+	LayerWorld      = 1
+	LayerPlayer     = 2
+	LayerForeground = 3
+)
+
+// Level is a parsed and validated level file
+type Level struct {
+	GridSize        int
+	PaintToolSize   int
+	BackgroundColor string
+	PlayerSpawns    []Spawn
+	Platforms       []Platform
+	Bounds          Rect
+
+	platformsByID map[int32]int
+
+	// Solid platforms indexed by their bounds for collision queries
+	solids *protocol.SpatialGrid
+}
+
+// Spawn is a player spawn point from the level's playerSpawns list
+type Spawn struct {
+	X, Y float32
+}
+
+// Rect is an axis-aligned rectangle in world coordinates
+type Rect struct {
+	MinX, MinY, MaxX, MaxY float32
+}
+
+// Width returns the horizontal extent of the rectangle
+func (r Rect) Width() float32 {
+	return r.MaxX - r.MinX
+}
+
+// Height returns the vertical extent of the rectangle
+func (r Rect) Height() float32 {
+	return r.MaxY - r.MinY
+}
+
+// Contains reports whether a point lies inside the rectangle
+func (r Rect) Contains(x, y float32) bool {
+	return x >= r.MinX && x <= r.MaxX && y >= r.MinY && y <= r.MaxY
+}
+
+// Expand returns the rectangle grown by margin on every side
+func (r Rect) Expand(margin float32) Rect {
+	return Rect{MinX: r.MinX - margin, MinY: r.MinY - margin, MaxX: r.MaxX + margin, MaxY: r.MaxY + margin}
+}
+
+// AABB converts the rectangle for spatial grid queries
+func (r Rect) AABB() protocol.AABB {
+	return protocol.AABB{MinX: r.MinX, MinY: r.MinY, MaxX: r.MaxX, MaxY: r.MaxY}
+}
+
+// Raycast returns the distance along the ray from (originX, originY) in
+// direction (dirX, dirY) at which it enters the rectangle. The direction must
+// be a unit vector. A ray starting inside the rectangle hits at distance 0.
+func (r Rect) Raycast(originX, originY, dirX, dirY, maxDistance float32) (float32, bool) {
+	hit, ok := r.Intersect(originX, originY, dirX, dirY, maxDistance)
+	return hit.Distance, ok
+}
+
+// Platform is a rectangle from the level file with a server-assigned ID
+type Platform struct {
+	ID     int32
+	X      float32
+	Y      float32
+	Width  float32
+	Height float32
+	Color  string
+	Type   string
+	Layer  int
+}
+
+// HasCollision reports whether players collide with the platform.
+// Background tiles are decoration only, as in the client's Platform class.
+func (p Platform) HasCollision() bool {
+	return p.Layer != LayerBackground
+}
+
+// HitPoints returns how many hits destroy the platform, or 0 if it can't be
+// destroyed. Background tiles are never destroyed.
+func (p Platform) HitPoints() int {
+	if !p.HasCollision() {
+		return 0
+	}
+	return platformHitPoints[p.Type]
+}
+
+// RGBA returns the platform's color as the client's hexToWebGLColor reads
+// it, opaque and with each channel in [0, 1]. Colors that are not #rgb or
+// #rrggbb are white.
+func (p Platform) RGBA() (r, g, b, a float32) {
+	hex := strings.TrimPrefix(p.Color, "#")
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+	value, err := strconv.ParseUint(hex, 16, 32)
+	if len(hex) != 6 || err != nil {
+		return 1, 1, 1, 1
+	}
+	return float32(value>>16&255) / 255, float32(value>>8&255) / 255, float32(value&255) / 255, 1
+}
+
+// Rect returns the platform's bounding rectangle
+func (p Platform) Rect() Rect {
+	return Rect{MinX: p.X, MinY: p.Y, MaxX: p.X + p.Width, MaxY: p.Y + p.Height}
+}
+
+// file mirrors the JSON written by the level editor
+type file struct {
+	GridSize        int         `json:"gridSize"`
+	PaintToolSize   int         `json:"paintToolSize"`
+	PlayerSpawns    []spawnJSON `json:"playerSpawns"`
+	BackgroundColor string      `json:"backgroundColor"`
+	Rectangles      []rectJSON  `json:"rectangles"`
+}
+
+type spawnJSON struct {
+	X float64 `json:"x"`
+	Y float64 `json:"y"`
+}
+
+type rectJSON struct {
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+	Color  string  `json:"color"`
+	Type   string  `json:"type"`
+	Layer  *int    `json:"layer"` // Older levels omit the layer; those tiles are world tiles
+}
+
+// Load reads and parses a level file from disk
+func Load(path string) (*Level, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	lvl, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return lvl, nil
+}
+
+// Parse decodes and validates a level in the level editor's JSON format.
+// Platform IDs are PlatformIDBase plus the position of each rectangle in the
+// file, so the same file always yields the same IDs, and the same ones as on
+// the client.
+func Parse(data []byte) (*Level, error) {
+	var f file
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, err
+	}
+
+	if f.GridSize <= 0 {
+		return nil, fmt.Errorf("gridSize must be positive, got %d", f.GridSize)
+	}
+	if len(f.PlayerSpawns) == 0 {
+		return nil, errors.New("level has no playerSpawns")
+	}
+	if len(f.Rectangles) > math.MaxInt32-PlatformIDBase {
+		return nil, errors.New("level has too many rectangles")
+	}
+
+	lvl := &Level{
+		GridSize:        f.GridSize,
+		PaintToolSize:   f.PaintToolSize,
+		BackgroundColor: f.BackgroundColor,
+		PlayerSpawns:    make([]Spawn, 0, len(f.PlayerSpawns)),
+		Platforms:       make([]Platform, 0, len(f.Rectangles)),
+		platformsByID:   make(map[int32]int, len(f.Rectangles)),
+	}
+
+	for i, s := range f.PlayerSpawns {
+		if !isFinite(s.X) || !isFinite(s.Y) {
+			return nil, fmt.Errorf("playerSpawns[%d]: coordinates must be finite", i)
+		}
+		lvl.PlayerSpawns = append(lvl.PlayerSpawns, Spawn{X: float32(s.X), Y: float32(s.Y)})
+	}
+
+	for i, r := range f.Rectangles {
+		if !isFinite(r.X) || !isFinite(r.Y) || !isFinite(r.Width) || !isFinite(r.Height) {
+			return nil, fmt.Errorf("rectangles[%d]: coordinates must be finite", i)
+		}
+		if r.Width <= 0 || r.Height <= 0 {
+			return nil, fmt.Errorf("rectangles[%d]: width and height must be positive", i)
+		}
+		if r.Type == "" {
+			return nil, fmt.Errorf("rectangles[%d]: missing type", i)
+		}
+
+		layer := LayerWorld
+		if r.Layer != nil {
+			layer = *r.Layer
+		}
+		if layer < LayerBackground || layer > LayerForeground {
+			return nil, fmt.Errorf("rectangles[%d]: unknown layer %d", i, layer)
+		}
+
+		platform := Platform{
+			ID:     PlatformIDBase + int32(i),
+			X:      float32(r.X),
+			Y:      float32(r.Y),
+			Width:  float32(r.Width),
+			Height: float32(r.Height),
+			Color:  r.Color,
+			Type:   r.Type,
+			Layer:  layer,
+		}
+		lvl.platformsByID[platform.ID] = len(lvl.Platforms)
+		lvl.Platforms = append(lvl.Platforms, platform)
+	}
+
+	lvl.Bounds = lvl.computeBounds()
+	lvl.indexSolids()
+	return lvl, nil
+}
+
+// Platform returns the platform with the given ID
+func (l *Level) Platform(id int32) (Platform, bool) {
+	index, exists := l.platformsByID[id]
+	if !exists {
+		return Platform{}, false
+	}
+	return l.Platforms[index], true
+}
+
+// SolidPlatformsIn returns the platforms with collision that overlap rect,
+// other than those removed reports true for. removed may be nil. The level is
+// never modified after parsing, so this is safe to call from several rooms at
+// once; each room tracks its own destroyed platforms.
+func (l *Level) SolidPlatformsIn(rect Rect, removed func(id int32) bool) []Platform {
+	var result []Platform
+	for _, id := range l.solids.QueryRect(rect.AABB()) {
+		if removed != nil && removed(id) {
+			continue
+		}
+		platform := l.Platforms[l.platformsByID[id]]
+		if overlaps(platform.Rect(), rect) {
+			result = append(result, platform)
+		}
+	}
+	return result
+}
+
+// indexSolids builds the collision index over platforms that have collision
+func (l *Level) indexSolids() {
+	l.solids = protocol.NewSpatialGrid(float32(l.GridSize * 4))
+	for _, p := range l.Platforms {
+		if !p.HasCollision() {
+			continue
+		}
+		l.solids.InsertRect(p.ID, p.Rect().AABB())
+	}
+}
+
+// overlaps reports whether two rectangles intersect with a non-zero area
+func overlaps(a, b Rect) bool {
+	return a.MinX < b.MaxX && a.MaxX > b.MinX && a.MinY < b.MaxY && a.MaxY > b.MinY
+}
+
+// computeBounds returns the rectangle enclosing every platform and spawn point
+func (l *Level) computeBounds() Rect {
+	first := l.PlayerSpawns[0]
+	bounds := Rect{MinX: first.X, MinY: first.Y, MaxX: first.X, MaxY: first.Y}
+
+	for _, s := range l.PlayerSpawns {
+		bounds.MinX = min(bounds.MinX, s.X)
+		bounds.MinY = min(bounds.MinY, s.Y)
+		bounds.MaxX = max(bounds.MaxX, s.X)
+		bounds.MaxY = max(bounds.MaxY, s.Y)
+	}
+	for _, p := range l.Platforms {
+		bounds.MinX = min(bounds.MinX, p.X)
+		bounds.MinY = min(bounds.MinY, p.Y)
+		bounds.MaxX = max(bounds.MaxX, p.X+p.Width)
+		bounds.MaxY = max(bounds.MaxY, p.Y+p.Height)
+	}
+
+	return bounds
+}
+
+func isFinite(v float64) bool {
+	return !math.IsNaN(v) && !math.IsInf(v, 0)
+}
@@ -0,0 +1,122 @@
+package level
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// testLevel is a small level: a grass floor, a stone wall standing on it and
+// a background tile, with spawns on either side of the wall
+const testLevel = `{
+	"gridSize": 10,
+	"playerSpawns": [{"x": 0, "y": -100}, {"x": 500, "y": -100}],
+	"rectangles": [
+		{"x": -100, "y": 0, "width": 800, "height": 20, "type": "grass", "color": "#0f0"},
+		{"x": 240, "y": -200, "width": 20, "height": 200, "type": "stone", "color": "#808080", "layer": 1},
+		{"x": 100, "y": -50, "width": 10, "height": 10, "type": "dirt", "layer": 0}
+	]
+}`
+
+func mustParse(t *testing.T, data string) *Level {
+	t.Helper()
+	lvl, err := Parse([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return lvl
+}
+
+func TestParse(t *testing.T) {
+	lvl := mustParse(t, testLevel)
+
+	if len(lvl.Platforms) != 3 || len(lvl.PlayerSpawns) != 2 {
+		t.Fatalf("got %d platforms and %d spawns, want 3 and 2", len(lvl.Platforms), len(lvl.PlayerSpawns))
+	}
+	wall, exists := lvl.Platform(PlatformIDBase + 1)
+	if !exists || wall.Type != "stone" || wall.HitPoints() != 4 {
+		t.Errorf("got platform %+v, want the stone wall with 4 hit points", wall)
+	}
+	if r, g, b, _ := lvl.Platforms[0].RGBA(); r != 0 || g != 1 || b != 0 {
+		t.Errorf("grass color is (%v, %v, %v), want green", r, g, b)
+	}
+	if background := lvl.Platforms[2]; background.HasCollision() || background.HitPoints() != 0 {
+		t.Errorf("background tile %+v collides or can be destroyed", background)
+	}
+	if want := (Rect{MinX: -100, MinY: -200, MaxX: 700, MaxY: 20}); lvl.Bounds != want {
+		t.Errorf("got bounds %+v, want %+v", lvl.Bounds, want)
+	}
+
+	// Only solid platforms collide, and removed ones are skipped
+	area := Rect{MinX: 90, MinY: -60, MaxX: 300, MaxY: 5}
+	if got := lvl.SolidPlatformsIn(area, nil); len(got) != 2 {
+		t.Errorf("found %d solid platforms, want the floor and the wall", len(got))
+	}
+	removed := func(id int32) bool { return id == wall.ID }
+	if got := lvl.SolidPlatformsIn(area, removed); len(got) != 1 || got[0].Type != "grass" {
+		t.Errorf("found %+v with the wall removed, want only the floor", got)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	rect := func(fields string) string {
+		return `{"gridSize": 10, "playerSpawns": [{"x": 0, "y": 0}], "rectangles": [{` + fields + `}]}`
+	}
+
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"not json", `{`, "unexpected end"},
+		{"no grid size", `{"playerSpawns": [{"x": 0, "y": 0}]}`, "gridSize"},
+		{"no spawns", `{"gridSize": 10}`, "playerSpawns"},
+		{"empty rectangle", rect(`"x": 0, "y": 0, "width": 0, "height": 5, "type": "grass"`), "width and height"},
+		{"missing type", rect(`"x": 0, "y": 0, "width": 5, "height": 5`), "missing type"},
+		{"unknown layer", rect(`"x": 0, "y": 0, "width": 5, "height": 5, "type": "grass", "layer": 7`), "unknown layer"},
+	}
+	for _, tt := range tests {
+		_, err := Parse([]byte(tt.data))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: got error %v, want one mentioning %q", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestSpawnPicker(t *testing.T) {
+	spawns := []Spawn{{X: 0, Y: 0}, {X: 100, Y: 0}, {X: 1000, Y: 0}}
+
+	roundRobin := NewSpawnPicker(spawns, SpawnRoundRobin, nil)
+	for i, want := range []Spawn{spawns[0], spawns[1], spawns[2], spawns[0]} {
+		if got := roundRobin.Pick(nil); got != want {
+			t.Errorf("round robin pick %d: got %+v, want %+v", i, got, want)
+		}
+	}
+
+	farthest := NewSpawnPicker(spawns, SpawnFarthest, nil)
+	if got := farthest.Pick([]Point{{X: 900, Y: 0}}); got != spawns[0] {
+		t.Errorf("farthest from an enemy at 900: got %+v, want %+v", got, spawns[0])
+	}
+	if got := farthest.Pick([]Point{{X: 0, Y: 0}, {X: 120, Y: 0}}); got != spawns[2] {
+		t.Errorf("farthest from enemies at 0 and 120: got %+v, want %+v", got, spawns[2])
+	}
+	if got := farthest.Pick(nil); got != spawns[0] {
+		t.Errorf("farthest without enemies: got %+v, want the first spawn in turn", got)
+	}
+
+	random := NewSpawnPicker(spawns, SpawnRandom, rand.New(rand.NewSource(1)))
+	seen := make(map[Spawn]bool)
+	for i := 0; i < 100; i++ {
+		seen[random.Pick(nil)] = true
+	}
+	if len(seen) != len(spawns) {
+		t.Errorf("random picks covered %d of %d spawns", len(seen), len(spawns))
+	}
+
+	if got := NewSpawnPicker(nil, SpawnRoundRobin, nil).Pick(nil); got != (Spawn{}) {
+		t.Errorf("picking without spawns: got %+v, want the origin", got)
+	}
+	if _, err := ParseSpawnPolicy("nearest"); err == nil {
+		t.Error("parsed an unknown spawn policy")
+	}
+}
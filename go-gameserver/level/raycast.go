@@ -0,0 +1,81 @@
+package level
+
+import "math"
+
+// Hit is where a ray or segment first enters a rectangle
+type Hit struct {
+	ID       int32   // Platform or player hit, depending on what was cast against
+	Distance float32 // Distance along the ray from its origin
+	X, Y     float32 // Point where the ray enters the rectangle
+
+	// Unit normal of the side that was hit, pointing back towards the ray.
+	// Zero when the ray starts inside the rectangle.
+	NormalX, NormalY float32
+}
+
+// Intersect returns where the ray from (originX, originY) in direction
+// (dirX, dirY) enters the rectangle within maxDistance. The direction must be
+// a unit vector. A ray starting inside the rectangle hits at its origin.
+func (r Rect) Intersect(originX, originY, dirX, dirY, maxDistance float32) (Hit, bool) {
+	near, far := float32(0), maxDistance
+	var normalX, normalY float32
+
+	// Slab test, one axis at a time, remembering which side the ray entered through
+	axes := [2]struct {
+		origin, dir, min, max float32
+		normal                *float32
+	}{
+		{originX, dirX, r.MinX, r.MaxX, &normalX},
+		{originY, dirY, r.MinY, r.MaxY, &normalY},
+	}
+	for _, a := range axes {
+		if a.dir == 0 {
+			if a.origin < a.min || a.origin > a.max {
+				return Hit{}, false
+			}
+			continue
+		}
+		t1 := (a.min - a.origin) / a.dir
+		t2 := (a.max - a.origin) / a.dir
+		if t1 > t2 {
+			t1, t2 = t2, t1
+		}
+		if t1 > near {
+			near = t1
+			normalX, normalY = 0, 0
+			*a.normal = -float32(math.Copysign(1, float64(a.dir)))
+		}
+		far = min(far, t2)
+		if near > far {
+			return Hit{}, false
+		}
+	}
+
+	return Hit{
+		Distance: near,
+		X:        originX + dirX*near,
+		Y:        originY + dirY*near,
+		NormalX:  normalX,
+		NormalY:  normalY,
+	}, true
+}
+
+// Raycast returns the first solid platform hit by the ray from
+// (originX, originY) in direction (dirX, dirY) within maxDistance, skipping
+// platforms removed reports true for. The direction must be a unit vector and
+// removed may be nil.
+func (l *Level) Raycast(originX, originY, dirX, dirY, maxDistance float32, removed func(id int32) bool) (Hit, bool) {
+	// The grid walks the cells along the ray and returns candidates nearest
+	// first, so the first one is the platform that is hit
+	for _, candidate := range l.solids.QueryRay(originX, originY, dirX, dirY, maxDistance) {
+		if removed != nil && removed(candidate.ID) {
+			continue
+		}
+		platform := l.Platforms[l.platformsByID[candidate.ID]]
+		if hit, ok := platform.Rect().Intersect(originX, originY, dirX, dirY, maxDistance); ok {
+			hit.ID = platform.ID
+			return hit, true
+		}
+	}
+	return Hit{}, false
+}
@@ -0,0 +1,90 @@
+package level
+
+import (
+	"math"
+	"testing"
+)
+
+func TestRectIntersect(t *testing.T) {
+	r := Rect{MinX: 0, MinY: 0, MaxX: 10, MaxY: 10}
+	diagonal := float32(math.Sqrt2 / 2)
+
+	tests := []struct {
+		name             string
+		x, y             float32
+		dirX, dirY       float32
+		maxDistance      float32
+		want             bool
+		distance         float32
+		normalX, normalY float32
+	}{
+		{"from the left", -5, 5, 1, 0, 100, true, 5, -1, 0},
+		{"from the right", 15, 5, -1, 0, 100, true, 5, 1, 0},
+		{"from above", 5, -5, 0, 1, 100, true, 5, 0, -1},
+		{"from below", 5, 15, 0, -1, 100, true, 5, 0, 1},
+		{"diagonally into the top", 0, -5, diagonal, diagonal, 100, true, 5 * math.Sqrt2, 0, -1},
+		{"starting inside", 5, 5, 1, 0, 100, true, 0, 0, 0},
+		{"along an edge", -5, 10, 1, 0, 100, true, 5, -1, 0},
+		{"parallel past it", -5, 11, 1, 0, 100, false, 0, 0, 0},
+		{"pointing away", -5, 5, -1, 0, 100, false, 0, 0, 0},
+		{"out of reach", -5, 5, 1, 0, 4, false, 0, 0, 0},
+		{"zero length", -5, 5, 1, 0, 0, false, 0, 0, 0},
+		{"zero length inside", 5, 5, 1, 0, 0, true, 0, 0, 0},
+	}
+	for _, tt := range tests {
+		hit, ok := r.Intersect(tt.x, tt.y, tt.dirX, tt.dirY, tt.maxDistance)
+		if ok != tt.want {
+			t.Errorf("%s: hit %v, want %v", tt.name, ok, tt.want)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if math.Abs(float64(hit.Distance-tt.distance)) > 1e-4 || hit.NormalX != tt.normalX || hit.NormalY != tt.normalY {
+			t.Errorf("%s: got distance %v normal (%v, %v), want %v (%v, %v)",
+				tt.name, hit.Distance, hit.NormalX, hit.NormalY, tt.distance, tt.normalX, tt.normalY)
+		}
+		if x, y := tt.x+tt.dirX*hit.Distance, tt.y+tt.dirY*hit.Distance; hit.X != x || hit.Y != y {
+			t.Errorf("%s: hit at (%v, %v), want (%v, %v)", tt.name, hit.X, hit.Y, x, y)
+		}
+	}
+}
+
+func TestLevelRaycast(t *testing.T) {
+	// A background tile and two walls, one behind the other
+	lvl := mustParse(t, `{
+		"gridSize": 10,
+		"playerSpawns": [{"x": 0, "y": 0}],
+		"rectangles": [
+			{"x": 40, "y": -100, "width": 10, "height": 100, "type": "dirt", "layer": 0},
+			{"x": 200, "y": -100, "width": 10, "height": 100, "type": "stone", "layer": 1},
+			{"x": 100, "y": -100, "width": 10, "height": 100, "type": "stone", "layer": 1}
+		]
+	}`)
+	near, far := int32(PlatformIDBase+2), int32(PlatformIDBase+1)
+
+	tests := []struct {
+		name     string
+		removed  func(id int32) bool
+		want     bool
+		id       int32
+		distance float32
+	}{
+		{"nearest wall", nil, true, near, 100},
+		{"destroyed wall skipped", func(id int32) bool { return id == near }, true, far, 200},
+		{"every wall destroyed", func(id int32) bool { return true }, false, 0, 0},
+	}
+	for _, tt := range tests {
+		hit, ok := lvl.Raycast(0, -50, 1, 0, 1000, tt.removed)
+		if ok != tt.want || hit.ID != tt.id || hit.Distance != tt.distance {
+			t.Errorf("%s: got hit %v on %d at %v, want %v on %d at %v", tt.name, ok, hit.ID, hit.Distance, tt.want, tt.id, tt.distance)
+		}
+	}
+
+	if _, ok := lvl.Raycast(0, -50, 1, 0, 99, nil); ok {
+		t.Error("hit a wall out of reach")
+	}
+	if _, ok := lvl.Raycast(0, -150, 1, 0, 1000, nil); ok {
+		t.Error("hit a wall passing over it")
+	}
+}
@@ -0,0 +1,100 @@
+package level
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// SpawnPolicy decides which of a level's spawn points a player is placed at
+type SpawnPolicy string
+
+const (
+	// SpawnRoundRobin cycles through the spawn points in file order
+	SpawnRoundRobin SpawnPolicy = "round-robin"
+
+	// SpawnRandom picks a uniformly random spawn point
+	SpawnRandom SpawnPolicy = "random"
+
+	// SpawnFarthest picks the spawn point farthest from the nearest enemy
+	SpawnFarthest SpawnPolicy = "farthest"
+)
+
+// ParseSpawnPolicy converts a flag value into a SpawnPolicy
+func ParseSpawnPolicy(s string) (SpawnPolicy, error) {
+	switch policy := SpawnPolicy(s); policy {
+	case SpawnRoundRobin, SpawnRandom, SpawnFarthest:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unknown spawn policy %q (want %s, %s or %s)", s, SpawnRoundRobin, SpawnRandom, SpawnFarthest)
+	}
+}
+
+// Point is a position in world coordinates
+type Point struct {
+	X, Y float32
+}
+
+// SpawnPicker chooses spawn points for a single room.
+// It is not safe for concurrent use.
+type SpawnPicker struct {
+	spawns []Spawn
+	policy SpawnPolicy
+	next   int
+	rng    *rand.Rand
+}
+
+// NewSpawnPicker creates a picker over the given spawn points
+func NewSpawnPicker(spawns []Spawn, policy SpawnPolicy, rng *rand.Rand) *SpawnPicker {
+	return &SpawnPicker{
+		spawns: spawns,
+		policy: policy,
+		rng:    rng,
+	}
+}
+
+// Pick returns the next spawn point. enemies holds the positions of live
+// opponents and is only consulted by SpawnFarthest.
+func (p *SpawnPicker) Pick(enemies []Point) Spawn {
+	if len(p.spawns) == 0 {
+		return Spawn{}
+	}
+
+	switch p.policy {
+	case SpawnRandom:
+		return p.spawns[p.rng.Intn(len(p.spawns))]
+	case SpawnFarthest:
+		if len(enemies) > 0 {
+			return p.farthest(enemies)
+		}
+	}
+
+	// Round robin, also used by SpawnFarthest when nobody else is alive
+	spawn := p.spawns[p.next%len(p.spawns)]
+	p.next = (p.next + 1) % len(p.spawns)
+	return spawn
+}
+
+// farthest returns the spawn whose closest enemy is as far away as possible
+func (p *SpawnPicker) farthest(enemies []Point) Spawn {
+	best := p.spawns[0]
+	bestDistance := float32(-1)
+
+	for _, spawn := range p.spawns {
+		closest := float32(-1)
+		for _, enemy := range enemies {
+			dx := enemy.X - spawn.X
+			dy := enemy.Y - spawn.Y
+			distanceSquared := dx*dx + dy*dy
+			if closest < 0 || distanceSquared < closest {
+				closest = distanceSquared
+			}
+		}
+
+		if closest > bestDistance {
+			best = spawn
+			bestDistance = closest
+		}
+	}
+
+	return best
+}
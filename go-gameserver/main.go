@@ -1,192 +1,220 @@
 package main
 
 import (
-	"encoding/json"
+	"errors"
+	"expvar"
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
 	"strconv"
-	"sync"
+	"strings"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"gameeserever/gamemode"
+	"gameeserever/level"
 	"gameeserever/protocol"
+	"gameeserever/weapons"
 )
 
-// Define a custom message type that can be either a protocol.Message or a JSON message
+// BroadcastMessage is a message queued for the clients of a room
 type BroadcastMessage struct {
 	BinaryMsg protocol.Message
-	JSONMsg   map[string]interface{}
-	IsBinary  bool
+	// IncludeSelf also delivers a player update to the player it describes,
+	// for server-decided changes such as respawn positions
+	IncludeSelf bool
 }
 
 var (
-	clients     = make(map[*websocket.Conn]*ClientState) // Track clients by connection
-	broadcast   = make(chan BroadcastMessage)            // Broadcast channel for messages
-	mu          sync.Mutex                               // Mutex for safe concurrent access
-	nextPlayerID int32 = 1                               // Next player ID to assign
+	rooms       *RoomManager                         // Active rooms keyed by ID
+	nextPlayerID int32 = 1                           // Next player ID to assign
 	upgrader    = websocket.Upgrader{
+		// Only accepted so that browsers offering them can connect; the
+		// features in the client's Hello decide the wire format
+		Subprotocols: []string{protocol.ProtocolQuantized, protocol.ProtocolFloat},
 		CheckOrigin: func(r *http.Request) bool {
 			return true // Allow all connections (adjust for production)
 		},
 	}
 )
 
-// ClientState holds the state of a connected client
-type ClientState struct {
-	Player protocol.Player
-	Conn   *websocket.Conn
-}
-
 // Handle incoming WebSocket connections
 func handleConnection(w http.ResponseWriter, r *http.Request) {
+	// Reserve a slot in the requested room before upgrading so a full
+	// room can be rejected with a normal HTTP error
+	room, err := rooms.Join(r.URL.Query().Get("room"), r.URL.Query().Get("mode"))
+	if err != nil {
+		log.Printf("Rejecting connection from %s: %v", r.RemoteAddr, err)
+		if errors.Is(err, ErrRoomFull) {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		} else if errors.Is(err, ErrModeMismatch) {
+			http.Error(w, err.Error(), http.StatusConflict)
+		} else {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+		return
+	}
+	defer rooms.Leave(room)
+	
 	conn, err := upgrader.Upgrade(w, r, nil)
 	if err != nil {
 		log.Println("Error upgrading connection:", err)
 		return
 	}
 	
-	// Create a new client state with a server-assigned ID
-	clientID := nextPlayerID
-	nextPlayerID++
+	// The client must open with a Hello the room can serve
+	session, err := room.handshake(conn)
+	if err != nil {
+		log.Printf("Rejected handshake from %s: %v", r.RemoteAddr, err)
+		return
+	}
 	
-	clientState := &ClientState{
-		Player: protocol.Player{
-			ID:           clientID,
-			Name:         "Player" + strconv.Itoa(int(clientID)),
-			Health:       100,
-			MaxHealth:    100,
-			IsDead:       false,
-			// Set default dimensions for player
-			Width:        50,
-			Height:       70,
-			// Set default color
-			ColorR:       1.0,
-			ColorG:       1.0,
-			ColorB:       1.0,
-			ColorA:       1.0,
-			// Set default direction and face direction
-			Direction:    0,
-			FaceDirection: 1,
-			VelocityX:    0,
-			VelocityY:    0,
-		},
-		Conn: conn,
+	// Create a new client state with a server-assigned ID
+	clientID := atomic.AddInt32(&nextPlayerID, 1) - 1
+	
+	clientState := newClientState(conn, protocol.Player{
+		ID:           clientID,
+		Name:         "Player" + strconv.Itoa(int(clientID)),
+		Health:       100,
+		MaxHealth:    100,
+		IsDead:       false,
+		// Set default dimensions for player
+		Width:        playerWidth,
+		Height:       playerHeight,
+		// Set default color
+		ColorR:       1.0,
+		ColorG:       1.0,
+		ColorB:       1.0,
+		ColorA:       1.0,
+		// Set default direction and face direction
+		Direction:    0,
+		FaceDirection: 1,
+		VelocityX:    0,
+		VelocityY:    0,
+	})
+	clientState.json = session.json
+	
+	// Accept the Hello before anything else is sent
+	clientState.Queue(protocol.WelcomeMessage{Welcome: protocol.Welcome{
+		Version:  protocol.ProtocolVersion,
+		PlayerID: clientID,
+		TickRate: uint16(room.tickRate),
+		Features: session.features,
+	}})
+	
+	// Clients that negotiated the quantized wire format first learn the area
+	// positions are quantized across
+	if session.features&protocol.FeatureQuantized != 0 {
+		quantization := room.quantization
+		clientState.quantization = &quantization
+		clientState.Queue(protocol.QuantizationMessage{Quantization: quantization})
 	}
 	
-	// Add the client to the clients map
-	mu.Lock()
-	clients[conn] = clientState
-	mu.Unlock()
+	// Start delivering the client's messages
+	go clientState.writeLoop()
+	
+	// Add the client to the room at a server-chosen spawn point
+	room.addClient(conn, clientState)
 	
 	// Set up a defer to clean up when the connection closes
 	defer func() {
-		mu.Lock()
-		delete(clients, conn)
-		mu.Unlock()
+		room.removeClient(conn)
 		
 		// Notify other clients that this player has left
-		broadcast <- BroadcastMessage{
+		room.Broadcast(BroadcastMessage{
 			BinaryMsg: protocol.BroadcastPlayerLeaveMessage{PlayerID: clientID},
-			IsBinary: true,
-		}
+		})
 		
-		conn.Close()
-		log.Printf("Player %d disconnected", clientID)
+		clientState.close()
+		log.Printf("Player %d disconnected from room %q", clientID, room.ID)
 	}()
 	
-	// Notify other clients that a new player has joined
-	broadcast <- BroadcastMessage{
+	// Notify other clients that a new player has joined, with their full
+	// state so they can create the player before it shows up in snapshots
+	room.Broadcast(BroadcastMessage{
 		BinaryMsg: protocol.BroadcastPlayerJoinMessage{PlayerID: clientID},
-		IsBinary: true,
+	})
+	room.mu.Lock()
+	joined := clientState.Player
+	room.mu.Unlock()
+	room.Broadcast(BroadcastMessage{
+		BinaryMsg: protocol.BroadcastPlayerUpdateMessage{Player: joined},
+	})
+	log.Printf("Player %d connected to room %q from %s (client %q, protocol version %d)",
+		clientID, room.ID, conn.RemoteAddr(), session.hello.ClientBuild, session.hello.Version)
+	if session.json {
+		jsonConnections.Add(1)
+		jsonClients.Add(1)
+		defer jsonClients.Add(-1)
+		log.Printf("Player %d speaks the JSON protocol", clientID)
 	}
-	log.Printf("Player %d connected from %s", clientID, conn.RemoteAddr())
 	
 	// Send the initial state to the new client
-	sendInitialState(conn)
+	room.sendInitialState(conn)
 	
 	// Handle incoming messages
 	for {
-		_, message, err := conn.ReadMessage()
+		messageType, data, err := conn.ReadMessage()
 		if err != nil {
 			log.Printf("Error reading message: %v", err)
 			break
 		}
 		
-		// Try to decode the message as binary first
-		binaryMsg, err := protocol.DecodeMessage(message)
-		if err == nil {
-			// Successfully decoded binary message
-			handleBinaryMessage(binaryMsg, conn)
-		} else {
-			// Try to decode as JSON for backward compatibility
-			var jsonData map[string]interface{}
-			if err := json.Unmarshal(message, &jsonData); err == nil {
-				handleJSONMessage(jsonData, conn)
-			} else {
-				log.Printf("Error decoding message: %v", err)
-			}
+		// Decode the message in the client's protocol
+		msg, err := room.decodeMessage(clientState, messageType, data)
+		if err != nil {
+			log.Printf("Error decoding message from player %d: %v", clientID, err)
+			continue
 		}
+		room.handleMessage(msg, conn)
 	}
 }
 
 // Send the initial state to a new client
-func sendInitialState(conn *websocket.Conn) {
-	mu.Lock()
-	defer mu.Unlock()
+func (r *Room) sendInitialState(conn *websocket.Conn) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
 	
 	// Get the client state for this connection
-	clientState, exists := clients[conn]
+	clientState, exists := r.clients[conn]
 	if !exists {
 		log.Println("Client not found when sending initial state")
 		return
 	}
 	
 	// First, send the client their own player data
-	selfInitialState := protocol.InitialStateMessage{
+	clientState.Queue(protocol.InitialStateMessage{
 		Players: []protocol.Player{clientState.Player},
-	}
+	})
 	
-	data, err := selfInitialState.Encode()
-	if err != nil {
-		log.Printf("Error encoding self initial state: %v", err)
-		return
-	}
-	
-	if err := conn.WriteMessage(websocket.BinaryMessage, data); err != nil {
-		log.Printf("Error sending self initial state: %v", err)
-		return
-	}
-	
-	// Then collect all other players
-	otherPlayers := make([]protocol.Player, 0, len(clients)-1)
-	for _, client := range clients {
-		if client.Conn != conn { // Don't include the new client
+	// Then collect all other players the client can see
+	otherPlayers := make([]protocol.Player, 0, len(r.clients)-1)
+	for _, client := range r.clients {
+		if client.Conn != conn && inView(clientState.visible, client.Player.ID) { // Don't include the new client
 			otherPlayers = append(otherPlayers, client.Player)
 		}
 	}
 	
-	// Create and send the initial state message with other players
-	initialState := protocol.InitialStateMessage{
+	// Queue the initial state message with other players
+	clientState.Queue(protocol.InitialStateMessage{
 		Players: otherPlayers,
-	}
+	})
 	
-	data, err = initialState.Encode()
-	if err != nil {
-		log.Printf("Error encoding initial state: %v", err)
-		return
+	// Then the platforms destroyed and fragments left since the room started
+	if !r.world.terrain.unchanged() {
+		clientState.Queue(protocol.TerrainStateMessage{State: r.world.terrain.state()})
 	}
 	
-	if err := conn.WriteMessage(websocket.BinaryMessage, data); err != nil {
-		log.Printf("Error sending initial state: %v", err)
-	}
+	// Finally, send the match phase and scoreboard
+	clientState.Queue(protocol.MatchStateMessage{State: r.matchState(time.Now())})
+	clientState.Queue(r.scoreboardUpdate())
 }
 
-// Handle a binary protocol message
-func handleBinaryMessage(msg protocol.Message, conn *websocket.Conn) {
-	mu.Lock()
-	clientState, exists := clients[conn]
-	mu.Unlock()
+// Handle a message from a client, whichever protocol it arrived in
+func (r *Room) handleMessage(msg protocol.Message, conn *websocket.Conn) {
+	clientState, exists := r.getClient(conn)
 	
 	if !exists {
 		log.Println("Message from unknown client")
@@ -194,6 +222,17 @@ func handleBinaryMessage(msg protocol.Message, conn *websocket.Conn) {
 	}
 	
 	switch m := msg.(type) {
+	case protocol.BundleMessage:
+		// Handle each bundled message as if it had arrived on its own
+		for _, data := range m.Messages {
+			bundled, err := protocol.DecodeMessage(data)
+			if err != nil {
+				log.Printf("Error decoding bundled message from player %d: %v", clientState.Player.ID, err)
+				continue
+			}
+			r.handleMessage(bundled, conn)
+		}
+		
 	case protocol.PlayerUpdateMessage:
 		// Validate the player ID
 		if m.Player.ID != clientState.Player.ID {
@@ -201,45 +240,24 @@ func handleBinaryMessage(msg protocol.Message, conn *websocket.Conn) {
 			return
 		}
 		
-		mu.Lock()
-		// Update player state but preserve some properties
-		prevHealth := clientState.Player.Health
-		prevMaxHealth := clientState.Player.MaxHealth
-		prevIsDead := clientState.Player.IsDead
+		// Queue the update; it is applied on the next simulation tick and
+		// reaches the other clients in that tick's world snapshot
+		r.mu.Lock()
+		r.world.QueueUpdate(m.Player)
+		r.mu.Unlock()
 		
-		// Update position and movement data
-		clientState.Player.X = m.Player.X
-		clientState.Player.Y = m.Player.Y
-		clientState.Player.Width = m.Player.Width
-		clientState.Player.Height = m.Player.Height
-		clientState.Player.ColorR = m.Player.ColorR
-		clientState.Player.ColorG = m.Player.ColorG
-		clientState.Player.ColorB = m.Player.ColorB
-		clientState.Player.ColorA = m.Player.ColorA
+	case protocol.InputCommandMessage:
+		// Queue the input; the server simulates the resulting movement on the
+		// next tick and acknowledges the sequence in the world snapshot
+		r.mu.Lock()
+		r.world.QueueInput(clientState.Player.ID, m.Input)
+		r.mu.Unlock()
 		
-		// Update direction and face direction
-		clientState.Player.Direction = m.Player.Direction
-		clientState.Player.FaceDirection = m.Player.FaceDirection
-		
-		// Update velocity
-		clientState.Player.VelocityX = m.Player.VelocityX
-		clientState.Player.VelocityY = m.Player.VelocityY
-		
-		// Only update health-related fields if they've changed
-		if m.Player.Health != prevHealth || m.Player.MaxHealth != prevMaxHealth || m.Player.IsDead != prevIsDead {
-			clientState.Player.Health = m.Player.Health
-			clientState.Player.MaxHealth = m.Player.MaxHealth
-			clientState.Player.IsDead = m.Player.IsDead
-		}
-		mu.Unlock()
-		
-		// Broadcast the update to all clients
-		broadcast <- BroadcastMessage{
-			BinaryMsg: protocol.BroadcastPlayerUpdateMessage{
-				Player: clientState.Player,
-			},
-			IsBinary: true,
-		}
+	case protocol.SnapshotAckMessage:
+		// Later snapshots for this client are encoded against the acknowledged one
+		r.mu.Lock()
+		clientState.baselines.ack(m.Tick)
+		r.mu.Unlock()
 		
 	case protocol.ChatMessageMessage:
 		// Validate the message
@@ -249,12 +267,11 @@ func handleBinaryMessage(msg protocol.Message, conn *websocket.Conn) {
 		}
 		
 		// Broadcast the chat message to all clients
-		broadcast <- BroadcastMessage{
+		r.Broadcast(BroadcastMessage{
 			BinaryMsg: protocol.BroadcastChatMessageMessage{
 				Chat: m.Chat,
 			},
-			IsBinary: true,
-		}
+		})
 		
 	case protocol.GunFireMessage:
 		// Validate the message
@@ -263,13 +280,40 @@ func handleBinaryMessage(msg protocol.Message, conn *websocket.Conn) {
 			return
 		}
 		
+		// Remember the shot so hit reports can be checked against it
+		r.mu.Lock()
+		weapon, err := r.world.RecordShot(m.Fire)
+		r.mu.Unlock()
+		if err != nil {
+			log.Printf("Rejected shot from player %d: %v", m.Fire.PlayerID, err)
+			return
+		}
+		
+		// Damage comes from the server's weapon catalogue
+		fire := m.Fire
+		fire.WeaponID = weapon.ID
+		fire.Damage = weapon.Damage
+		
+		// With server projectiles, the server simulates the bullet and decides what it hits
+		if r.serverProjectiles {
+			r.mu.Lock()
+			projectile := r.world.SpawnProjectile(fire, weapon)
+			r.mu.Unlock()
+			
+			r.Broadcast(BroadcastMessage{
+				BinaryMsg: protocol.ProjectileSpawnMessage{
+					Projectile: projectile,
+				},
+			})
+			return
+		}
+		
 		// Broadcast the gun fire to all clients
-		broadcast <- BroadcastMessage{
+		r.Broadcast(BroadcastMessage{
 			BinaryMsg: protocol.BroadcastGunFireMessage{
-				Fire: m.Fire,
+				Fire: fire,
 			},
-			IsBinary: true,
-		}
+		})
 		
 	case protocol.HitReportMessage:
 		// Validate the message
@@ -278,112 +322,60 @@ func handleBinaryMessage(msg protocol.Message, conn *websocket.Conn) {
 			return
 		}
 		
-		// Find the target player
-		var targetClient *ClientState
-		mu.Lock()
-		for _, client := range clients {
-			if client.Player.ID == m.Hit.TargetID {
-				targetClient = client
-				break
-			}
+		// Hits are decided by the server's projectiles, not reported by clients
+		if r.serverProjectiles {
+			return
 		}
-		mu.Unlock()
+		
+		// Find the target player
+		r.mu.Lock()
+		targetClient := r.findPlayer(m.Hit.TargetID)
+		r.mu.Unlock()
 		
 		if targetClient == nil {
 			log.Printf("Player %d tried to hit non-existent player %d", m.Hit.ShooterID, m.Hit.TargetID)
 			return
 		}
 		
-		// Find the shooter player
-		var shooterClient *ClientState
-		mu.Lock()
-		for _, client := range clients {
-			if client.Player.ID == m.Hit.ShooterID {
-				shooterClient = client
-				break
-			}
+		// Re-run the shot against the target's rewound positions
+		hit := m.Hit
+		r.mu.Lock()
+		if err := r.checkDamage(hit.ShooterID, targetClient); err != nil {
+			r.mu.Unlock()
+			log.Printf("Rejected hit from player %d on player %d: %v", hit.ShooterID, hit.TargetID, err)
+			return
 		}
-		mu.Unlock()
+		damage, err := r.world.ValidateHit(hit)
+		if err != nil {
+			r.mu.Unlock()
+			log.Printf("Rejected hit from player %d on player %d for %f damage: %v",
+				hit.ShooterID, hit.TargetID, hit.Damage, err)
+			return
+		}
+		hit.Damage = damage
 		
 		// Apply damage to the target player
-		mu.Lock()
-		if !targetClient.Player.IsDead {
-			targetClient.Player.Health -= m.Hit.Damage
-			log.Printf("Player %d hit player %d for %f damage. Health now: %f",
-				m.Hit.ShooterID, m.Hit.TargetID, m.Hit.Damage, targetClient.Player.Health)
-			
-			if targetClient.Player.Health <= 0 {
-				targetClient.Player.Health = 0
-				targetClient.Player.IsDead = true
-				log.Printf("Player %d was killed by player %d", m.Hit.TargetID, m.Hit.ShooterID)
-				
-				// Start a timer to respawn the player
-				go func(targetID int32) {
-					time.Sleep(3 * time.Second) // 3 second respawn time
-					
-					mu.Lock()
-					defer mu.Unlock()
-					
-					// Find the target player again (they might have disconnected)
-					for _, client := range clients {
-						if client.Player.ID == targetID {
-							// Respawn the player
-							client.Player.Health = client.Player.MaxHealth
-							client.Player.IsDead = false
-							log.Printf("Player %d respawned with health %f", targetID, client.Player.Health)
-							
-							// Broadcast the update
-							broadcast <- BroadcastMessage{
-								BinaryMsg: protocol.BroadcastPlayerUpdateMessage{
-									Player: client.Player,
-								},
-								IsBinary: true,
-							}
-							break
-						}
-					}
-				}(m.Hit.TargetID)
-			}
-		}
-		mu.Unlock()
+		r.applyDamage(hit.ShooterID, targetClient, hit.Damage)
+		r.mu.Unlock()
 		
 		// Broadcast the hit to all clients
-		broadcast <- BroadcastMessage{
+		r.Broadcast(BroadcastMessage{
 			BinaryMsg: protocol.BroadcastHitReportMessage{
-				Hit: m.Hit,
+				Hit: hit,
 			},
-			IsBinary: true,
-		}
+		})
 		
-		// Broadcast the updated target player state to all clients
-		mu.Lock()
-		broadcast <- BroadcastMessage{
+		// Broadcast the updated target player state to all clients,
+		// including the target so their own health stays in sync
+		r.mu.Lock()
+		targetPlayer := targetClient.Player
+		r.mu.Unlock()
+		r.Broadcast(BroadcastMessage{
 			BinaryMsg: protocol.BroadcastPlayerUpdateMessage{
-				Player: targetClient.Player,
+				Player: targetPlayer,
 			},
-			IsBinary: true,
-		}
-		mu.Unlock()
-		
-		// Also send a direct update to the target player to ensure they get the update
-		if targetClient != nil {
-			data, err := protocol.BroadcastPlayerUpdateMessage{
-				Player: targetClient.Player,
-			}.Encode()
-			if err == nil {
-				targetClient.Conn.WriteMessage(websocket.BinaryMessage, data)
-			}
-		}
-		
-		// Also send a direct update to the shooter player to confirm the hit
-		if shooterClient != nil {
-			data, err := protocol.BroadcastHitReportMessage{
-				Hit: m.Hit,
-			}.Encode()
-			if err == nil {
-				shooterClient.Conn.WriteMessage(websocket.BinaryMessage, data)
-			}
-		}
+			IncludeSelf: true,
+		})
 		
 	case protocol.PlatformDestroyMessage:
 		// Validate the message
@@ -392,43 +384,50 @@ func handleBinaryMessage(msg protocol.Message, conn *websocket.Conn) {
 			return
 		}
 		
-		// Broadcast the platform destruction to all clients
-		broadcast <- BroadcastMessage{
-			BinaryMsg: protocol.BroadcastPlatformDestroyMessage{
-				Destroy: m.Destroy,
-			},
-			IsBinary: true,
+		// Platforms are damaged by the server's projectiles, not reported by clients
+		if r.serverProjectiles {
+			return
 		}
 		
-	case protocol.FragmentCreateMessage:
-		// Validate the message
-		if m.Fragment.OriginalEntityID == 0 {
-			log.Printf("Player %d tried to create a fragment with invalid original entity ID", clientState.Player.ID)
+		// Count the hit; only the one that destroys the platform is broadcast,
+		// along with the fragments it breaks into
+		r.mu.Lock()
+		messages, err := r.destroyPlatform(m.Destroy.PlatformID, m.Destroy.ShooterID, time.Now())
+		r.mu.Unlock()
+		if err != nil {
+			log.Printf("Rejected destruction of platform %d by player %d: %v", m.Destroy.PlatformID, m.Destroy.ShooterID, err)
 			return
 		}
-		
-		// Broadcast the fragment creation to all clients
-		broadcast <- BroadcastMessage{
-			BinaryMsg: protocol.BroadcastFragmentCreateMessage{
-				Fragment: m.Fragment,
-			},
-			IsBinary: true,
+		for _, msg := range messages {
+			r.Broadcast(msg)
 		}
 		
-	case protocol.FragmentDestroyMessage:
-		// Validate the message
-		if m.Destroy.FragmentID == 0 {
-			log.Printf("Player %d tried to destroy a fragment with invalid ID", clientState.Player.ID)
+	case protocol.FragmentCreateMessage, protocol.FragmentDestroyMessage:
+		// Fragments are spawned, moved and cleared by the server; clients only
+		// render them
+		
+	case protocol.TeamSwitchMessage:
+		// Move the player if the teams stay balanced
+		r.mu.Lock()
+		if err := r.match.SwitchTeam(clientState.Player.ID, m.TeamID); err != nil {
+			r.mu.Unlock()
+			log.Printf("Player %d could not switch to team %d: %v", clientState.Player.ID, m.TeamID, err)
 			return
 		}
+		clientState.Player.TeamID = m.TeamID
+		applyTeamColor(&clientState.Player)
+		r.scoreboardChanged = true
+		player := clientState.Player
+		r.mu.Unlock()
+		log.Printf("Player %d switched to team %d", player.ID, player.TeamID)
 		
-		// Broadcast the fragment destruction to all clients
-		broadcast <- BroadcastMessage{
-			BinaryMsg: protocol.BroadcastFragmentDestroyMessage{
-				Destroy: m.Destroy,
+		// Broadcast the new team and color, including to the player themselves
+		r.Broadcast(BroadcastMessage{
+			BinaryMsg: protocol.BroadcastPlayerUpdateMessage{
+				Player: player,
 			},
-			IsBinary: true,
-		}
+			IncludeSelf: true,
+		})
 		
 	case protocol.GunAttachmentMessage:
 		// Validate the message
@@ -437,334 +436,111 @@ func handleBinaryMessage(msg protocol.Message, conn *websocket.Conn) {
 			return
 		}
 		
+		// Switch the player to the attached gun's weapon
+		attachment := m.Attachment
+		r.mu.Lock()
+		weapon, err := r.world.Equip(attachment.PlayerID, attachment.WeaponID)
+		r.mu.Unlock()
+		if err != nil {
+			log.Printf("Player %d tried to attach weapon %d: %v", attachment.PlayerID, attachment.WeaponID, err)
+			return
+		}
+		attachment.WeaponID = weapon.ID
+		
 		// Broadcast the gun attachment to all clients
-		broadcast <- BroadcastMessage{
+		r.Broadcast(BroadcastMessage{
 			BinaryMsg: protocol.BroadcastGunAttachmentMessage{
-				Attachment: m.Attachment,
+				Attachment: attachment,
 			},
-			IsBinary: true,
-		}
+		})
 	}
 }
 
-// Handle a JSON message (for backward compatibility)
-func handleJSONMessage(data map[string]interface{}, conn *websocket.Conn) {
-	mu.Lock()
-	clientState, exists := clients[conn]
-	mu.Unlock()
-	
-	if !exists {
-		log.Println("Message from unknown client")
-		return
+func main() {
+	addr := flag.String("addr", "0.0.0.0:8081", "address to listen on")
+	roomCapacity := flag.Int("room-capacity", 16, "maximum players per room (0 = unlimited)")
+	tickRate := flag.Int("tick-rate", DefaultTickRate, "simulation ticks per second")
+	levelPath := flag.String("level", "../client/assets/levels/level.json", "level file to load (empty to run without a level)")
+	spawnPolicyName := flag.String("spawn-policy", string(level.SpawnFarthest), "spawn point selection: round-robin, random or farthest")
+	weaponsPath := flag.String("weapons", "weapons.json", "weapon catalogue to load (empty for the built-in gun only)")
+	modeName := flag.String("mode", gamemode.DeathMatchName, "game mode of rooms created without ?mode=: "+strings.Join(gamemode.Names, ", "))
+	friendlyFire := flag.Bool("friendly-fire", false, "let teammates damage each other in team modes")
+	maxRewind := flag.Duration("max-rewind", DefaultMaxRewind, "how far back in time hit reports are checked against player positions")
+	viewRadius := flag.Float64("view-radius", DefaultViewRadius, "how far away, in pixels, other players are sent to a client (0 = unlimited)")
+	serverProjectiles := flag.Bool("server-projectiles", true, "simulate bullets on the server instead of trusting clients' hit reports")
+	allowJSON := flag.Bool("json", true, "accept clients speaking the legacy JSON protocol (usage is published on -debug-addr)")
+	debugAddr := flag.String("debug-addr", "", "address to serve metrics on at /debug/vars, kept off the public address (empty to disable)")
+	flag.Parse()
+	
+	spawnPolicy, err := level.ParseSpawnPolicy(*spawnPolicyName)
+	if err != nil {
+		log.Fatal(err)
 	}
-	
-	// Check message type
-	msgType, _ := data["type"].(string)
-	
-	// Handle InitialPlayerID message
-	if msgType == "InitialPlayerID" {
-		clientId, ok := data["clientId"].(float64)
-		if ok {
-			log.Printf("Received initial player ID from client: %v", int64(clientId))
-			
-			// Send the server-assigned ID back to the client
-			// This will help the client update its local player ID
-			initialState := protocol.InitialStateMessage{
-				Players: []protocol.Player{
-					{
-						ID:           clientState.Player.ID,
-						Name:         clientState.Player.Name,
-						X:            clientState.Player.X,
-						Y:            clientState.Player.Y,
-						Width:        clientState.Player.Width,
-						Height:       clientState.Player.Height,
-						ColorR:       clientState.Player.ColorR,
-						ColorG:       clientState.Player.ColorG,
-						ColorB:       clientState.Player.ColorB,
-						ColorA:       clientState.Player.ColorA,
-						Health:       clientState.Player.Health,
-						MaxHealth:    clientState.Player.MaxHealth,
-						IsDead:       clientState.Player.IsDead,
-						Direction:    clientState.Player.Direction,
-						FaceDirection: clientState.Player.FaceDirection,
-						VelocityX:    clientState.Player.VelocityX,
-						VelocityY:    clientState.Player.VelocityY,
-					},
-				},
-			}
-			
-			data, err := initialState.Encode()
-			if err != nil {
-				log.Printf("Error encoding initial state: %v", err)
-				return
-			}
-			
-			if err := conn.WriteMessage(websocket.BinaryMessage, data); err != nil {
-				log.Printf("Error sending initial state: %v", err)
-			}
-			
-			return
-		}
+	if *tickRate <= 0 {
+		log.Fatal("tick-rate must be positive")
 	}
-	
-	// Handle gun attachment messages
-	if msgType == "GunAttachment" {
-		attachmentData, ok := data["data"].(map[string]interface{})
-		if ok {
-			gunId, _ := attachmentData["gunId"].(float64)
-			playerId, _ := attachmentData["playerId"].(float64)
-			offsetX, _ := attachmentData["attachmentOffsetX"].(float64)
-			offsetY, _ := attachmentData["attachmentOffsetY"].(float64)
-			rotation, _ := attachmentData["rotation"].(float64)
-			
-			// Validate that the player ID matches the client's player ID
-			if int32(playerId) != clientState.Player.ID {
-				log.Printf("Player %d tried to attach a gun as player %d", clientState.Player.ID, int32(playerId))
-				return
-			}
-			
-			// Create a gun attachment message
-			attachment := protocol.GunAttachment{
-				GunID:    int32(gunId),
-				PlayerID: int32(playerId),
-				OffsetX:  float32(offsetX),
-				OffsetY:  float32(offsetY),
-				Rotation: float32(rotation),
-			}
-			
-			// Broadcast the gun attachment to all clients using binary protocol
-			broadcast <- BroadcastMessage{
-				BinaryMsg: protocol.BroadcastGunAttachmentMessage{
-					Attachment: attachment,
-				},
-				IsBinary: true,
-			}
-			
-			return
-		}
+	if _, err := gamemode.New(*modeName); err != nil {
+		log.Fatal(err)
 	}
-	
-	// Extract player data for regular updates
-	x, _ := data["x"].(float64)
-	y, _ := data["y"].(float64)
-	width, _ := data["width"].(float64)
-	height, _ := data["height"].(float64)
-	colorStr, _ := data["color"].(string)
-	health, _ := data["health"].(float64)
-	maxHealth, _ := data["maxHealth"].(float64)
-	isDead, _ := data["isDead"].(bool)
-	
-	// Parse color
-	colorR, colorG, colorB, colorA := protocol.ParseColorString(colorStr)
-	
-	// Update the player's state
-	mu.Lock()
-	
-	clientState.Player.X = float32(x)
-	clientState.Player.Y = float32(y)
-	clientState.Player.Width = float32(width)
-	clientState.Player.Height = float32(height)
-	clientState.Player.ColorR = colorR
-	clientState.Player.ColorG = colorG
-	clientState.Player.ColorB = colorB
-	clientState.Player.ColorA = colorA
-	
-	// Only update health-related fields if they're provided
-	if health > 0 {
-		clientState.Player.Health = float32(health)
+	if *maxRewind < 0 {
+		log.Fatal("max-rewind must not be negative")
 	}
-	if maxHealth > 0 {
-		clientState.Player.MaxHealth = float32(maxHealth)
-	}
-	clientState.Player.IsDead = isDead
-	mu.Unlock()
-	
-	// Broadcast the update to all clients
-	broadcast <- BroadcastMessage{
-		BinaryMsg: protocol.BroadcastPlayerUpdateMessage{
-			Player: clientState.Player,
-		},
-		IsBinary: true,
+	if *viewRadius < 0 {
+		log.Fatal("view-radius must not be negative")
 	}
-}
-
-// Handle broadcasting messages to all clients with optimizations
-func handleMessages() {
-	ticker := time.NewTicker(1 * time.Second)
-	defer ticker.Stop()
-	
-	var messageCount int
-	var countMutex sync.Mutex // Mutex to protect messageCount
-	
-	// Message batching - faster updates for better responsiveness
-	const batchInterval = 16 * time.Millisecond // ~60 updates per second
-	batchTicker := time.NewTicker(batchInterval)
-	defer batchTicker.Stop()
 	
-	// Message queue for batching
-	messageQueue := make([]BroadcastMessage, 0, 100)
-	
-	// Stats reporting
-	go func() {
-		for range ticker.C {
-			countMutex.Lock()
-			log.Printf("Messages sent per second: %d", messageCount)
-			messageCount = 0 // Reset the counter
-			countMutex.Unlock()
+	// Load the level so the server knows the platforms, spawns and bounds
+	var lvl *level.Level
+	if *levelPath != "" {
+		lvl, err = level.Load(*levelPath)
+		if err != nil {
+			log.Fatal("Error loading level: ", err)
 		}
-	}()
+		log.Printf("Loaded level %s: %d platforms, %d spawns, bounds %+v",
+			*levelPath, len(lvl.Platforms), len(lvl.PlayerSpawns), lvl.Bounds)
+	}
 	
-	// Process batched messages
-	go func() {
-		for range batchTicker.C {
-			if len(messageQueue) == 0 {
-				continue
-			}
-			
-			// Process all queued messages
-			mu.Lock()
-			localQueue := messageQueue
-			messageQueue = make([]BroadcastMessage, 0, 100) // Reset queue
-			clientMap := make(map[*websocket.Conn]*ClientState)
-			
-			// Create a copy of the clients map to avoid holding the lock
-			for client, state := range clients {
-				clientMap[client] = state
-			}
-			mu.Unlock()
-			
-			// Group messages by client and type to reduce the number of WebSocket writes
-			clientMessages := make(map[*websocket.Conn][]interface{})
-			
-			// First, sort messages by priority (player updates first)
-			playerUpdates := make([]interface{}, 0)
-			otherMessages := make([]interface{}, 0)
-			jsonMessages := make([]interface{}, 0)
-			
-			for _, msg := range localQueue {
-				if msg.IsBinary {
-					// Check if it's a player update message
-					if playerUpdateMsg, ok := msg.BinaryMsg.(protocol.BroadcastPlayerUpdateMessage); ok {
-						playerUpdates = append(playerUpdates, playerUpdateMsg)
-					} else {
-						otherMessages = append(otherMessages, msg.BinaryMsg)
-					}
-				} else {
-					// JSON message
-					jsonMessages = append(jsonMessages, msg.JSONMsg)
-				}
-			}
-			
-			// Process player updates first
-			for _, msg := range playerUpdates {
-				m := msg.(protocol.BroadcastPlayerUpdateMessage)
-				playerID := m.Player.ID
-				
-				for client, state := range clientMap {
-					// Skip sending updates about a player to themselves
-					if state.Player.ID == playerID {
-						continue
-					}
-					
-					clientMessages[client] = append(clientMessages[client], m)
-				}
-			}
-			
-			// Then process other binary protocol messages
-			for _, msg := range otherMessages {
-				switch m := msg.(type) {
-				case protocol.BroadcastPlayerJoinMessage, protocol.BroadcastPlayerLeaveMessage,
-					 protocol.BroadcastChatMessageMessage, protocol.BroadcastGunFireMessage,
-					 protocol.BroadcastHitReportMessage, protocol.BroadcastPlatformDestroyMessage,
-					 protocol.BroadcastFragmentCreateMessage, protocol.BroadcastFragmentDestroyMessage,
-					 protocol.BroadcastGunAttachmentMessage:
-					// These messages are sent to all clients
-					for client := range clientMap {
-						clientMessages[client] = append(clientMessages[client], m)
-					}
-				}
-			}
-			
-			// Finally, process JSON messages
-			for _, msg := range jsonMessages {
-				jsonMsg := msg.(map[string]interface{})
-				
-				// Handle gun attachment messages
-				if msgType, ok := jsonMsg["type"].(string); ok && msgType == "GunAttachment" {
-					// Send to all clients
-					for client := range clientMap {
-						clientMessages[client] = append(clientMessages[client], jsonMsg)
-					}
-				}
-			}
-			
-			// Send batched messages to each client
-			for client, messages := range clientMessages {
-				if len(messages) == 0 {
-					continue
-				}
-				
-				// For now, send each message individually
-				// In a more advanced implementation, we could combine multiple messages into a single binary packet
-				for _, msg := range messages {
-					var err error
-					
-					// Check if this is a binary protocol message or a JSON message
-					if binaryMsg, ok := msg.(protocol.Message); ok {
-						// Binary protocol message
-						data, encodeErr := binaryMsg.Encode()
-						if encodeErr != nil {
-							log.Printf("Error encoding binary message: %v", encodeErr)
-							continue
-						}
-						
-						err = client.WriteMessage(websocket.BinaryMessage, data)
-					} else if jsonMsg, ok := msg.(map[string]interface{}); ok {
-						// JSON message
-						data, encodeErr := json.Marshal(jsonMsg)
-						if encodeErr != nil {
-							log.Printf("Error encoding JSON message: %v", encodeErr)
-							continue
-						}
-						
-						err = client.WriteMessage(websocket.TextMessage, data)
-					} else {
-						log.Printf("Unknown message type: %T", msg)
-						continue
-					}
-					if err != nil {
-						log.Printf("Error writing message: %v", err)
-						mu.Lock()
-						client.Close()
-						delete(clients, client)
-						mu.Unlock()
-						break
-					} else {
-						countMutex.Lock()
-						messageCount++ // Safely increment the counter
-						countMutex.Unlock()
-					}
-				}
-			}
+	// Load the weapon catalogue so damage and fire rates come from the server
+	catalog := weapons.Default()
+	if *weaponsPath != "" {
+		catalog, err = weapons.Load(*weaponsPath)
+		if err != nil {
+			log.Fatal("Error loading weapons: ", err)
 		}
-	}()
+		log.Printf("Loaded %d weapons from %s", catalog.Len(), *weaponsPath)
+	}
 	
-	// Main message handling loop
-	for {
-		select {
-		case msg := <-broadcast:
-			// Add message to queue for batched processing
-			messageQueue = append(messageQueue, msg)
-		}
+	rooms = NewRoomManager(RoomConfig{
+		Capacity:          *roomCapacity,
+		TickRate:          *tickRate,
+		Level:             lvl,
+		SpawnPolicy:       spawnPolicy,
+		MaxRewind:         *maxRewind,
+		Weapons:           catalog,
+		Mode:              *modeName,
+		FriendlyFire:      *friendlyFire,
+		ViewRadius:        float32(*viewRadius),
+		ServerProjectiles: *serverProjectiles,
+		AllowJSON:         *allowJSON,
+	})
+	
+	// Metrics are served on their own address, since /debug/vars also
+	// shows the command line and memory statistics
+	if *debugAddr != "" {
+		debugMux := http.NewServeMux()
+		debugMux.Handle("/debug/vars", expvar.Handler())
+		go func() {
+			log.Println("Serving metrics on", *debugAddr)
+			log.Fatal("Debug ListenAndServe failed:", http.ListenAndServe(*debugAddr, debugMux))
+		}()
 	}
-}
-
-func main() {
-	http.HandleFunc("/ws", handleConnection)
-	go handleMessages()
 	
-	fmt.Println("Server started on :8081")
-	err := http.ListenAndServe("0.0.0.0:8081", nil)
+	// The public address only serves the game's WebSocket endpoint
+	mux := http.NewServeMux()
+	mux.HandleFunc("/ws", handleConnection)
+	
+	fmt.Println("Server started on", *addr)
+	err = http.ListenAndServe(*addr, mux)
 	if err != nil {
 		log.Fatal("ListenAndServe failed:", err)
 	}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"math"
+
+	"gameeserever/protocol"
+	"gameeserever/weapons"
+)
+
+// projectile is a bullet in flight, simulated by the server
+type projectile struct {
+	protocol.Projectile
+	weapon   weapons.Weapon
+	traveled float32 // Distance covered so far, in px
+}
+
+// SpawnProjectile starts simulating a bullet for a shot that RecordShot
+// accepted, and returns it as it should be announced to clients. The bullet
+// flies in a random direction within the weapon's spread of the aim.
+func (w *World) SpawnProjectile(fire protocol.GunFire, weapon weapons.Weapon) protocol.Projectile {
+	w.nextProjectileID++
+	angle := fire.Angle + (w.rng.Float32()*2-1)*weapon.Spread
+	sin, cos := math.Sincos(float64(angle))
+
+	p := &projectile{
+		Projectile: protocol.Projectile{
+			ID:        w.nextProjectileID,
+			ShooterID: fire.PlayerID,
+			WeaponID:  weapon.ID,
+			X:         fire.X,
+			Y:         fire.Y,
+			VelocityX: weapon.BulletSpeed * float32(cos),
+			VelocityY: weapon.BulletSpeed * float32(sin),
+			Gravity:   weapon.Gravity,
+			Tick:      w.Tick,
+		},
+		weapon: weapon,
+	}
+	w.projectiles = append(w.projectiles, p)
+	return p.Projectile
+}
+
+// stepProjectiles advances every projectile by one tick and returns the ones
+// that stopped. A projectile stops at the first platform or player other than
+// its shooter along its path, or once it has travelled its weapon's range.
+// Player hits carry the weapon's damage; the room decides whether it applies.
+func (w *World) stepProjectiles() []protocol.ProjectileImpact {
+	var impacts []protocol.ProjectileImpact
+	dt := w.tickDelta
+
+	remaining := w.projectiles[:0]
+	for _, p := range w.projectiles {
+		// Constant acceleration, so the step is exact however long the tick is
+		velocityY := p.VelocityY + p.Gravity*dt
+		dx := p.VelocityX * dt
+		dy := (p.VelocityY + velocityY) / 2 * dt
+
+		length := float32(math.Hypot(float64(dx), float64(dy)))
+		if length == 0 {
+			// Nothing moves a bullet without speed or drop; drop it
+			impacts = append(impacts, p.impact(protocol.ImpactExpired, 0, p.X, p.Y, 0, 0, 0))
+			continue
+		}
+		dirX, dirY := dx/length, dy/length
+
+		expired := false
+		if left := p.weapon.Range - p.traveled; length >= left {
+			length = max(left, 0)
+			expired = true
+		}
+
+		if hit, ok := w.raycast(p.X, p.Y, dirX, dirY, length, p.ShooterID); ok {
+			kind, damage := protocol.ImpactPlatform, float32(0)
+			if hit.Kind == HitPlayer {
+				kind, damage = protocol.ImpactPlayer, p.weapon.Damage
+			}
+			impacts = append(impacts, p.impact(kind, hit.ID, hit.X, hit.Y, hit.NormalX, hit.NormalY, damage))
+			continue
+		}
+
+		p.X += dirX * length
+		p.Y += dirY * length
+		if expired {
+			impacts = append(impacts, p.impact(protocol.ImpactExpired, 0, p.X, p.Y, 0, 0, 0))
+			continue
+		}
+		p.VelocityY = velocityY
+		p.traveled += length
+		remaining = append(remaining, p)
+	}
+
+	// Clear the tail so stopped projectiles can be collected
+	clear(w.projectiles[len(remaining):])
+	w.projectiles = remaining
+	return impacts
+}
+
+// impact describes the projectile stopping at (x, y)
+func (p *projectile) impact(kind byte, targetID int32, x, y, normalX, normalY, damage float32) protocol.ProjectileImpact {
+	return protocol.ProjectileImpact{
+		ProjectileID: p.ID,
+		ShooterID:    p.ShooterID,
+		Kind:         kind,
+		TargetID:     targetID,
+		X:            x,
+		Y:            y,
+		NormalX:      normalX,
+		NormalY:      normalY,
+		Damage:       damage,
+	}
+}
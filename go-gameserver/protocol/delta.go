@@ -0,0 +1,178 @@
+package protocol
+
+import "errors"
+
+// PlayerField is a bit in a PlayerDelta's mask naming a Player field that
+// differs from the baseline
+type PlayerField uint32
+
+// Player fields in the order they are encoded
+const (
+	PlayerFieldName PlayerField = 1 << iota
+	PlayerFieldX
+	PlayerFieldY
+	PlayerFieldWidth
+	PlayerFieldHeight
+	PlayerFieldColorR
+	PlayerFieldColorG
+	PlayerFieldColorB
+	PlayerFieldColorA
+	PlayerFieldHealth
+	PlayerFieldMaxHealth
+	PlayerFieldIsDead
+	PlayerFieldDirection
+	PlayerFieldFaceDirection
+	PlayerFieldVelocityX
+	PlayerFieldVelocityY
+	PlayerFieldTeamID
+
+	// PlayerFieldsAll marks every field, for players the client has no baseline for
+	PlayerFieldsAll = PlayerFieldTeamID<<1 - 1
+)
+
+// minPlayerDeltaSize is the encoded size of a delta with no fields changed:
+// the player's ID and the field mask
+const minPlayerDeltaSize = 4 + 4
+
+// PlayerDelta is a player's state relative to a baseline. Only the fields
+// named in Fields are encoded; the rest of Player is ignored.
+type PlayerDelta struct {
+	Fields PlayerField
+	Player Player
+}
+
+// DiffPlayer returns the fields of current that differ from baseline
+func DiffPlayer(baseline, current Player) PlayerField {
+	var fields PlayerField
+	set := func(field PlayerField, changed bool) {
+		if changed {
+			fields |= field
+		}
+	}
+
+	set(PlayerFieldName, baseline.Name != current.Name)
+	set(PlayerFieldX, baseline.X != current.X)
+	set(PlayerFieldY, baseline.Y != current.Y)
+	set(PlayerFieldWidth, baseline.Width != current.Width)
+	set(PlayerFieldHeight, baseline.Height != current.Height)
+	set(PlayerFieldColorR, baseline.ColorR != current.ColorR)
+	set(PlayerFieldColorG, baseline.ColorG != current.ColorG)
+	set(PlayerFieldColorB, baseline.ColorB != current.ColorB)
+	set(PlayerFieldColorA, baseline.ColorA != current.ColorA)
+	set(PlayerFieldHealth, baseline.Health != current.Health)
+	set(PlayerFieldMaxHealth, baseline.MaxHealth != current.MaxHealth)
+	set(PlayerFieldIsDead, baseline.IsDead != current.IsDead)
+	set(PlayerFieldDirection, baseline.Direction != current.Direction)
+	set(PlayerFieldFaceDirection, baseline.FaceDirection != current.FaceDirection)
+	set(PlayerFieldVelocityX, baseline.VelocityX != current.VelocityX)
+	set(PlayerFieldVelocityY, baseline.VelocityY != current.VelocityY)
+	set(PlayerFieldTeamID, baseline.TeamID != current.TeamID)
+
+	return fields
+}
+
+// Apply returns baseline with the delta's fields copied over it
+func (d PlayerDelta) Apply(baseline Player) Player {
+	p := d.Player
+	baseline.ID = p.ID
+	copyIf := func(field PlayerField, apply func()) {
+		if d.Fields&field != 0 {
+			apply()
+		}
+	}
+
+	copyIf(PlayerFieldName, func() { baseline.Name = p.Name })
+	copyIf(PlayerFieldX, func() { baseline.X = p.X })
+	copyIf(PlayerFieldY, func() { baseline.Y = p.Y })
+	copyIf(PlayerFieldWidth, func() { baseline.Width = p.Width })
+	copyIf(PlayerFieldHeight, func() { baseline.Height = p.Height })
+	copyIf(PlayerFieldColorR, func() { baseline.ColorR = p.ColorR })
+	copyIf(PlayerFieldColorG, func() { baseline.ColorG = p.ColorG })
+	copyIf(PlayerFieldColorB, func() { baseline.ColorB = p.ColorB })
+	copyIf(PlayerFieldColorA, func() { baseline.ColorA = p.ColorA })
+	copyIf(PlayerFieldHealth, func() { baseline.Health = p.Health })
+	copyIf(PlayerFieldMaxHealth, func() { baseline.MaxHealth = p.MaxHealth })
+	copyIf(PlayerFieldIsDead, func() { baseline.IsDead = p.IsDead })
+	copyIf(PlayerFieldDirection, func() { baseline.Direction = p.Direction })
+	copyIf(PlayerFieldFaceDirection, func() { baseline.FaceDirection = p.FaceDirection })
+	copyIf(PlayerFieldVelocityX, func() { baseline.VelocityX = p.VelocityX })
+	copyIf(PlayerFieldVelocityY, func() { baseline.VelocityY = p.VelocityY })
+	copyIf(PlayerFieldTeamID, func() { baseline.TeamID = p.TeamID })
+
+	return baseline
+}
+
+// deltaFields lists, in encoding order, each field's bit and a pointer to it
+// in p, so encoding and decoding walk the same table
+func deltaFields(p *Player) [16]fieldRef {
+	return [16]fieldRef{
+		{PlayerFieldX, &p.X},
+		{PlayerFieldY, &p.Y},
+		{PlayerFieldWidth, &p.Width},
+		{PlayerFieldHeight, &p.Height},
+		{PlayerFieldColorR, &p.ColorR},
+		{PlayerFieldColorG, &p.ColorG},
+		{PlayerFieldColorB, &p.ColorB},
+		{PlayerFieldColorA, &p.ColorA},
+		{PlayerFieldHealth, &p.Health},
+		{PlayerFieldMaxHealth, &p.MaxHealth},
+		{PlayerFieldIsDead, &p.IsDead},
+		{PlayerFieldDirection, &p.Direction},
+		{PlayerFieldFaceDirection, &p.FaceDirection},
+		{PlayerFieldVelocityX, &p.VelocityX},
+		{PlayerFieldVelocityY, &p.VelocityY},
+		{PlayerFieldTeamID, &p.TeamID},
+	}
+}
+
+// appendPlayerDelta appends a player's ID, field mask and changed fields
+func appendPlayerDelta(dst []byte, delta PlayerDelta) ([]byte, error) {
+	// Write player ID and field mask
+	dst = appendInt32(dst, delta.Player.ID)
+	dst = appendUint32(dst, uint32(delta.Fields))
+
+	// Write player name length and name
+	if delta.Fields&PlayerFieldName != 0 {
+		if len(delta.Player.Name) > maxPlayerNameLength {
+			return dst, tooLong("Player.Name")
+		}
+		dst = appendInt32(dst, int32(len(delta.Player.Name)))
+		dst = append(dst, delta.Player.Name...)
+	}
+
+	// Write the remaining changed fields
+	for _, f := range deltaFields(&delta.Player) {
+		if delta.Fields&f.field != 0 {
+			dst = appendField(dst, f.value)
+		}
+	}
+
+	return dst, nil
+}
+
+// decodePlayerDelta reads a delta written by appendPlayerDelta
+func decodePlayerDelta(r *reader) (PlayerDelta, error) {
+	var delta PlayerDelta
+
+	// Read player ID and field mask
+	delta.Player.ID = r.int32()
+	delta.Fields = PlayerField(r.uint32())
+	if delta.Fields&^PlayerFieldsAll != 0 {
+		return delta, errors.New("unknown player fields in delta")
+	}
+
+	// Read player name
+	if delta.Fields&PlayerFieldName != 0 {
+		nameLen := r.length(int(r.int32()), maxPlayerNameLength, 1, "Player.Name")
+		delta.Player.Name = r.string(nameLen)
+	}
+
+	// Read the remaining changed fields
+	for _, f := range deltaFields(&delta.Player) {
+		if delta.Fields&f.field != 0 {
+			r.readField(f.value)
+		}
+	}
+
+	return delta, r.err
+}
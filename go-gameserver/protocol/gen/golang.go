@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// goHeader starts the generated Go file
+const goHeader = `// Code generated by protocol/gen from schema.json. DO NOT EDIT.
+
+package protocol
+
+import "fmt"
+
+`
+
+// goSource returns the unformatted generated Go file
+func (g *generator) goSource() []byte {
+	buf := new(bytes.Buffer)
+	buf.WriteString(goHeader)
+
+	// Message types
+	buf.WriteString("// Message types\nconst (\n")
+	for i, m := range g.schema.Messages {
+		if m.Section != "" {
+			if i > 0 {
+				buf.WriteString("\n")
+			}
+			comment(buf, "\t", m.Section)
+		}
+		fmt.Fprintf(buf, "\t%sType byte = %d\n", m.Name, m.ID)
+	}
+	buf.WriteString(")\n\n")
+
+	// Length limits
+	buf.WriteString("// Longest strings and arrays the schema allows\nconst (\n")
+	for _, s := range g.schema.Structs {
+		goLimits(buf, s.Name, s.Fields)
+	}
+	for _, m := range g.schema.Messages {
+		goLimits(buf, m.Name, m.Fields)
+	}
+	buf.WriteString(")\n\n")
+
+	for _, s := range g.schema.Structs {
+		g.goStruct(buf, s)
+	}
+	for _, m := range g.schema.Messages {
+		if !m.Custom {
+			g.goMessage(buf, m)
+		}
+	}
+	g.goDecodeMessage(buf)
+
+	return buf.Bytes()
+}
+
+// goType returns the Go type of a field
+func goType(f Field) string {
+	if f.GoType != "" {
+		return f.GoType
+	}
+	return goTypeName(f.Type)
+}
+
+func goTypeName(t string) string {
+	if elem, ok := strings.CutPrefix(t, "[]"); ok {
+		return "[]" + goTypeName(elem)
+	}
+	if t == "uint8" {
+		return "byte"
+	}
+	return t
+}
+
+// goLimits declares the length limits of the fields that set a max
+func goLimits(buf *bytes.Buffer, owner string, fields []Field) {
+	for _, f := range fields {
+		if f.Max > 0 {
+			fmt.Fprintf(buf, "\t%s = %d\n", limitName(owner, f), f.Max)
+		}
+	}
+}
+
+// limitName returns the name of the constant holding a field's max
+func limitName(owner string, f Field) string {
+	return "max" + owner + f.Name + "Length"
+}
+
+// goFields declares a struct's fields
+func goFields(buf *bytes.Buffer, fields []Field) {
+	for _, f := range fields {
+		fmt.Fprintf(buf, "\t%s %s", f.Name, goType(f))
+		if f.Doc != "" {
+			fmt.Fprintf(buf, " // %s", f.Doc)
+		}
+		buf.WriteString("\n")
+	}
+}
+
+func (g *generator) goStruct(buf *bytes.Buffer, s Struct) {
+	comment(buf, "", s.Doc)
+	fmt.Fprintf(buf, "type %s struct {\n", s.Name)
+	goFields(buf, s.Fields)
+	buf.WriteString("}\n\n")
+
+	fmt.Fprintf(buf, "// append%s appends %s %s's fields to dst\n", s.Name, article(s.Name), s.Name)
+	fmt.Fprintf(buf, "func append%s(dst []byte, v %s) ([]byte, error) {\n", s.Name, s.Name)
+	w := goWriter{g: g, buf: buf, owner: s.Name, limits: s.Name, fail: "return %s"}
+	w.appendFields(s.Fields, "v.", "return dst, %s")
+	buf.WriteString("\treturn dst, nil\n}\n\n")
+
+	fmt.Fprintf(buf, "// decode%s reads %s %s's fields into v\n", s.Name, article(s.Name), s.Name)
+	fmt.Fprintf(buf, "func decode%s(r *reader, v *%s) error {\n", s.Name, s.Name)
+	w.decodeFields(s.Fields, "v.")
+	buf.WriteString("\treturn r.err\n}\n\n")
+}
+
+func (g *generator) goMessage(buf *bytes.Buffer, m Message) {
+	name := m.Name + "Message"
+	comment(buf, "", m.Doc)
+	fmt.Fprintf(buf, "type %s struct {\n", name)
+	goFields(buf, m.Fields)
+	buf.WriteString("}\n\n")
+
+	fmt.Fprintf(buf, "func (m %s) Type() byte {\n\treturn %sType\n}\n\n", name, m.Name)
+
+	fmt.Fprintf(buf, "func (m %s) AppendEncode(dst []byte) ([]byte, error) {\n", name)
+	buf.WriteString("\tdst = append(dst, m.Type())\n")
+	w := goWriter{g: g, buf: buf, owner: name, limits: m.Name, fail: "return nil, %s"}
+	w.appendFields(m.Fields, "m.", "return dst, %s")
+	buf.WriteString("\treturn dst, nil\n}\n\n")
+
+	fmt.Fprintf(buf, "func (m %s) Encode() ([]byte, error) {\n\treturn encode(m)\n}\n\n", name)
+
+	fmt.Fprintf(buf, "func decode%s(r *reader) (Message, error) {\n", name)
+	fmt.Fprintf(buf, "\tvar m %s\n", name)
+	w.decodeFields(m.Fields, "m.")
+	buf.WriteString("\tif r.err != nil {\n\t\treturn nil, r.err\n\t}\n")
+	buf.WriteString("\treturn m, nil\n}\n\n")
+}
+
+func (g *generator) goDecodeMessage(buf *bytes.Buffer) {
+	buf.WriteString(`// DecodeMessage decodes a binary message into a Message. The quantized
+// message types need the quantization area and are decoded by
+// Quantization.DecodeMessage instead. Errors wrap ErrTruncated, ErrTooLong,
+// ErrTrailingBytes or ErrUnknownType when the message is malformed.
+func DecodeMessage(data []byte) (Message, error) {
+	if len(data) == 0 {
+		return nil, ErrTruncated
+	}
+
+	r := &reader{data: data[1:]}
+	switch data[0] {
+`)
+	for _, m := range g.schema.Messages {
+		if m.Quantized {
+			continue
+		}
+		fmt.Fprintf(buf, "\tcase %sType:\n\t\treturn r.finish(decode%sMessage(r))\n", m.Name, m.Name)
+	}
+	buf.WriteString("\tdefault:\n\t\treturn nil, fmt.Errorf(\"%w %d\", ErrUnknownType, data[0])\n\t}\n}\n")
+}
+
+// goWriter writes the statements encoding and decoding fields inside a
+// function whose failures are returned by the fail format
+type goWriter struct {
+	g      *generator
+	buf    *bytes.Buffer
+	owner  string // Type the fields belong to, for error messages
+	limits string // Schema name the fields' limit constants are named after
+	fail   string
+}
+
+func (w *goWriter) printf(format string, args ...any) {
+	fmt.Fprintf(w.buf, format, args...)
+}
+
+// failIfTooLong returns ErrTooLong for the field when expr is longer than
+// the field allows
+func (w *goWriter) failIfTooLong(f Field, expr string) {
+	var max string
+	switch {
+	case f.Max > 0:
+		max = limitName(w.limits, f)
+	case maxLength(f) > 0:
+		max = fmt.Sprint(maxLength(f))
+	default:
+		return
+	}
+	err := fmt.Sprintf("tooLong(%q)", w.owner+"."+f.Name)
+	w.printf("\tif len(%s) > %s {\n\t\t%s\n\t}\n", expr, max, fmt.Sprintf(w.fail, err))
+}
+
+// appendFields appends fields of prefix to dst, returning errors with the
+// fail format
+func (w *goWriter) appendFields(fields []Field, prefix, fail string) {
+	inner := *w
+	inner.fail = fail
+	for _, f := range fields {
+		if w.g.structs[strings.TrimPrefix(f.Type, "[]")] != nil {
+			w.printf("\tvar err error\n")
+			break
+		}
+	}
+	for _, f := range fields {
+		inner.appendField(f, prefix+f.Name)
+	}
+}
+
+func (w *goWriter) appendField(f Field, expr string) {
+	switch {
+	case f.Type == "string":
+		w.failIfTooLong(f, expr)
+		w.printf("\tdst = %s(dst, %s(len(%s)))\n", appendFunc(lengthType(f)), lengthType(f), expr)
+		w.printf("\tdst = append(dst, %s...)\n", expr)
+
+	case strings.HasPrefix(f.Type, "[]"):
+		w.failIfTooLong(f, expr)
+		w.printf("\tdst = %s(dst, %s(len(%s)))\n", appendFunc(lengthType(f)), lengthType(f), expr)
+		w.printf("\tfor _, elem := range %s {\n", expr)
+		inner := *w
+		inner.appendField(Field{Name: f.Name, Type: f.Type[2:]}, "elem")
+		w.printf("\t}\n")
+
+	case w.g.structs[f.Type] != nil:
+		w.printf("\tif dst, err = append%s(dst, %s); err != nil {\n\t\t%s\n\t}\n", f.Type, expr, fmt.Sprintf(w.fail, "err"))
+
+	case f.GoType != "":
+		w.printf("\tdst = %s(dst, %s(%s))\n", appendFunc(f.Type), f.Type, expr)
+
+	default:
+		w.printf("\tdst = %s(dst, %s)\n", appendFunc(f.Type), expr)
+	}
+}
+
+// appendFunc returns the function in wire.go appending a scalar type
+func appendFunc(t string) string {
+	return "append" + strings.ToUpper(t[:1]) + t[1:]
+}
+
+// decodeFields reads fields into the fields of prefix. Optional fields are
+// only read while the message has bytes left.
+func (w *goWriter) decodeFields(fields []Field, prefix string) {
+	for i, f := range fields {
+		if !f.Optional {
+			w.decodeField(f, prefix+f.Name)
+			continue
+		}
+		if i == 0 || !fields[i-1].Optional {
+			w.printf("\n\t// Older senders may stop before the remaining fields\n")
+		}
+		w.printf("\tif r.Len() > 0 {\n")
+		w.decodeField(f, prefix+f.Name)
+		if f.Default != "" {
+			w.printf("\t} else {\n\t\t%s%s = %s\n", prefix, f.Name, f.Default)
+		}
+		w.printf("\t}\n")
+	}
+}
+
+func (w *goWriter) decodeField(f Field, expr string) {
+	switch {
+	case f.Type == "string":
+		length := lowerFirst(f.Name) + "Length"
+		w.decodeLength(f, length, 1)
+		w.printf("\t%s = r.string(%s)\n", expr, length)
+
+	case strings.HasPrefix(f.Type, "[]"):
+		elem := f.Type[2:]
+		count := lowerFirst(f.Name) + "Count"
+		w.decodeLength(f, count, w.g.fieldMinSize(Field{Type: elem}))
+		w.printf("\t%s = make(%s, %s)\n", expr, goTypeName(f.Type), count)
+		w.printf("\tfor i := range %s {\n", expr)
+		w.decodeField(Field{Name: f.Name, Type: elem}, expr+"[i]")
+		w.printf("\t}\n")
+
+	case w.g.structs[f.Type] != nil:
+		w.printf("\tif err := decode%s(r, &%s); err != nil {\n\t\t%s\n\t}\n", f.Type, expr, fmt.Sprintf(w.fail, "err"))
+
+	case f.GoType != "":
+		w.printf("\t%s = %s(r.%s())\n", expr, f.GoType, f.Type)
+
+	default:
+		w.printf("\t%s = r.%s()\n", expr, f.Type)
+	}
+}
+
+// decodeLength reads the length in front of a string or array into a new
+// variable, checked against the field's limit and the bytes left with each
+// element taking at least elemSize bytes
+func (w *goWriter) decodeLength(f Field, name string, elemSize int) {
+	max := "0"
+	if f.Max > 0 {
+		max = limitName(w.limits, f)
+	}
+	w.printf("\t%s := r.length(int(r.%s()), %s, %d, %q)\n", name, lengthType(f), max, elemSize, w.owner+"."+f.Name)
+}
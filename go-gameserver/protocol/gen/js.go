@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// jsHeader starts the generated JavaScript module, with the reader and
+// writer the generated code builds on
+const jsHeader = `// Code generated by protocol/gen from go-gameserver/protocol/schema.json. DO NOT EDIT.
+//
+// Encoders for the messages the client sends and decoders for the ones the
+// server sends. BinaryProtocol.js builds on these and encodes the messages
+// the schema marks as custom by hand.
+
+const textEncoder = new TextEncoder();
+const textDecoder = new TextDecoder();
+
+// Writes little-endian fields to a buffer that grows as needed
+class Writer {
+    constructor() {
+        this.buffer = new ArrayBuffer(64);
+        this.view = new DataView(this.buffer);
+        this.offset = 0;
+    }
+
+    reserve(size) {
+        if (this.offset + size <= this.buffer.byteLength) return;
+        let capacity = this.buffer.byteLength * 2;
+        while (capacity < this.offset + size) capacity *= 2;
+        const buffer = new ArrayBuffer(capacity);
+        new Uint8Array(buffer).set(new Uint8Array(this.buffer, 0, this.offset));
+        this.buffer = buffer;
+        this.view = new DataView(buffer);
+    }
+
+    bool(value) { this.uint8(value ? 1 : 0); }
+    uint8(value) { this.reserve(1); this.view.setUint8(this.offset, value); this.offset += 1; }
+    uint16(value) { this.reserve(2); this.view.setUint16(this.offset, value, true); this.offset += 2; }
+    uint32(value) { this.reserve(4); this.view.setUint32(this.offset, value, true); this.offset += 4; }
+    int32(value) { this.reserve(4); this.view.setInt32(this.offset, value, true); this.offset += 4; }
+    float32(value) { this.reserve(4); this.view.setFloat32(this.offset, value, true); this.offset += 4; }
+
+    bytes(bytes) {
+        this.reserve(bytes.length);
+        new Uint8Array(this.buffer, this.offset, bytes.length).set(bytes);
+        this.offset += bytes.length;
+    }
+
+    finish() {
+        return this.buffer.slice(0, this.offset);
+    }
+}
+
+// Reads little-endian fields from a DataView; reading past its end throws
+class Reader {
+    constructor(view, offset) {
+        this.view = view;
+        this.offset = offset;
+    }
+
+    remaining() { return this.view.byteLength - this.offset; }
+
+    bool() { return this.uint8() !== 0; }
+    uint8() { const value = this.view.getUint8(this.offset); this.offset += 1; return value; }
+    uint16() { const value = this.view.getUint16(this.offset, true); this.offset += 2; return value; }
+    uint32() { const value = this.view.getUint32(this.offset, true); this.offset += 4; return value; }
+    int32() { const value = this.view.getInt32(this.offset, true); this.offset += 4; return value; }
+    float32() { const value = this.view.getFloat32(this.offset, true); this.offset += 4; return value; }
+
+    bytes(length) {
+        if (length < 0 || length > this.remaining()) {
+            throw new RangeError('Length beyond the end of the message');
+        }
+        const bytes = new Uint8Array(this.view.buffer, this.view.byteOffset + this.offset, length);
+        this.offset += length;
+        return bytes;
+    }
+}
+`
+
+// jsSource returns the generated JavaScript module
+func (g *generator) jsSource() []byte {
+	buf := new(bytes.Buffer)
+	buf.WriteString(jsHeader)
+
+	// Message types
+	buf.WriteString("\n// Message types\nexport const MessageTypes = {\n")
+	for i, m := range g.schema.Messages {
+		if m.Section != "" {
+			if i > 0 {
+				buf.WriteString("\n")
+			}
+			comment(buf, "    ", m.Section)
+		}
+		fmt.Fprintf(buf, "    %s: %d,\n", screamingCase(m.Name), m.ID)
+	}
+	buf.WriteString("};\n")
+
+	for _, s := range g.schema.Structs {
+		w := jsWriter{buf: buf, owner: s.Name, indent: "    "}
+		fmt.Fprintf(buf, "\nfunction write%s(w, v) {\n", s.Name)
+		for _, f := range s.Fields {
+			w.encodeField(f, "v."+jsName(f))
+		}
+		buf.WriteString("}\n")
+
+		fmt.Fprintf(buf, "\nfunction read%s(r) {\n    const v = {};\n", s.Name)
+		for _, f := range s.Fields {
+			w.decodeField(f, "v."+jsName(f))
+		}
+		buf.WriteString("    return v;\n}\n")
+	}
+
+	var decoded []Message
+	for _, m := range g.schema.Messages {
+		if m.Custom {
+			continue
+		}
+		w := jsWriter{buf: buf, owner: m.Name, indent: "    "}
+		if m.Direction != "server" {
+			fmt.Fprintf(buf, "\n// Encode %s %s message\nexport function encode%s(message) {\n", article(m.Name), m.Name, m.Name)
+			fmt.Fprintf(buf, "    const w = new Writer();\n    w.uint8(MessageTypes.%s);\n", screamingCase(m.Name))
+			for _, f := range m.Fields {
+				w.encodeField(f, "message."+jsName(f))
+			}
+			buf.WriteString("    return w.finish();\n}\n")
+		}
+		if m.Direction != "client" {
+			decoded = append(decoded, m)
+			fmt.Fprintf(buf, "\n// Decode %s %s message, from just after its type\nexport function decode%s(view, offset) {\n", article(m.Name), m.Name, m.Name)
+			fmt.Fprintf(buf, "    const r = new Reader(view, offset);\n    const message = { type: '%s' };\n", m.Name)
+			for _, f := range m.Fields {
+				w.decodeField(f, "message."+jsName(f))
+			}
+			buf.WriteString("    return message;\n}\n")
+		}
+	}
+
+	buf.WriteString("\n// Decoders of the messages above, by type\nexport const decoders = {\n")
+	for _, m := range decoded {
+		fmt.Fprintf(buf, "    [MessageTypes.%s]: decode%s,\n", screamingCase(m.Name), m.Name)
+	}
+	buf.WriteString("};\n")
+
+	return buf.Bytes()
+}
+
+// jsWriter writes the statements encoding and decoding fields
+type jsWriter struct {
+	buf    *bytes.Buffer
+	owner  string // Type the fields belong to, for error messages
+	indent string
+}
+
+// line writes one indented line
+func (w *jsWriter) line(format string, args ...any) {
+	w.buf.WriteString(w.indent)
+	fmt.Fprintf(w.buf, format, args...)
+	w.buf.WriteString("\n")
+}
+
+func (w *jsWriter) encodeField(f Field, expr string) {
+	switch {
+	case f.Type == "string":
+		data := jsName(f) + "Bytes"
+		w.line("const %s = textEncoder.encode(%s ?? '');", data, expr)
+		if max := maxLength(f); max > 0 {
+			w.line("if (%s.length > %d) throw new RangeError('%s.%s is too long');", data, max, w.owner, jsName(f))
+		}
+		w.line("w.%s(%s.length);", lengthType(f), data)
+		w.line("w.bytes(%s);", data)
+
+	case strings.HasPrefix(f.Type, "[]"):
+		if max := maxLength(f); max > 0 {
+			w.line("if (%s.length > %d) throw new RangeError('Too many %s.%s');", expr, max, w.owner, jsName(f))
+		}
+		w.line("w.%s(%s.length);", lengthType(f), expr)
+		w.line("for (const elem of %s) {", expr)
+		inner := jsWriter{buf: w.buf, owner: w.owner, indent: w.indent + "    "}
+		inner.encodeField(Field{Name: f.Name, Type: f.Type[2:]}, "elem")
+		w.line("}")
+
+	case scalarSizes[f.Type] == 0:
+		w.line("write%s(w, %s);", f.Type, expr)
+
+	default:
+		w.line("w.%s(%s);", f.Type, expr)
+	}
+}
+
+// decodeField reads a field; optional fields take their default when the
+// message has ended
+func (w *jsWriter) decodeField(f Field, expr string) {
+	if !strings.HasPrefix(f.Type, "[]") {
+		value := w.readExpr(f)
+		if f.Optional {
+			value = fmt.Sprintf("r.remaining() > 0 ? %s : %s", value, jsDefault(f))
+		}
+		w.line("%s = %s;", expr, value)
+		return
+	}
+
+	count := jsName(f) + "Count"
+	w.line("const %s = r.%s();", count, lengthType(f))
+	w.line("%s = [];", expr)
+	w.line("for (let i = 0; i < %s; i++) {", count)
+	w.line("    %s.push(%s);", expr, w.readExpr(Field{Type: f.Type[2:]}))
+	w.line("}")
+}
+
+// readExpr returns the expression reading a single value of the field's type
+func (w *jsWriter) readExpr(f Field) string {
+	switch {
+	case f.Type == "string":
+		return fmt.Sprintf("textDecoder.decode(r.bytes(r.%s()))", lengthType(f))
+	case scalarSizes[f.Type] == 0:
+		return fmt.Sprintf("read%s(r)", f.Type)
+	default:
+		return fmt.Sprintf("r.%s()", f.Type)
+	}
+}
+
+// jsDefault returns what an optional field decodes to when it is missing
+func jsDefault(f Field) string {
+	switch {
+	case f.Default != "":
+		return f.Default
+	case f.Type == "bool":
+		return "false"
+	case f.Type == "string":
+		return "''"
+	case scalarSizes[f.Type] == 0:
+		return "{}"
+	default:
+		return "0"
+	}
+}
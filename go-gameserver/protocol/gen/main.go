@@ -0,0 +1,300 @@
+// Command gen generates the protocol's message types, encoders and decoders
+// from schema.json, for the Go server and the JavaScript client. Run it with
+// go generate in the protocol package after editing the schema.
+//
+// The schema lists shared structs and messages. Every field has one of these
+// types:
+//
+//	bool, uint8, uint16, uint32, int32, float32
+//	string    UTF-8 with its length in front (int32 unless "length" says otherwise)
+//	[]T       elements of any other type, with their count in front
+//	Name      a struct declared in the schema
+//
+// Strings and arrays may set a "max" length, which the Go code declares as
+// a max<Type><Field>Length constant. Trailing "optional" fields may be
+// left out by older senders and decode to their "default", or the zero value.
+// Messages marked "custom" only get a type constant and a DecodeMessage case;
+// their Go and JavaScript code is written by hand. Custom messages marked
+// "quantized" need the quantization area to decode and are left to
+// Quantization.DecodeMessage.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// Schema is the contents of schema.json
+type Schema struct {
+	Structs  []Struct  `json:"structs"`
+	Messages []Message `json:"messages"`
+}
+
+// Struct is a group of fields shared between messages
+type Struct struct {
+	Name   string  `json:"name"`
+	Doc    string  `json:"doc"`
+	Fields []Field `json:"fields"`
+}
+
+// Message is one message type on the wire
+type Message struct {
+	Name      string  `json:"name"` // Without the Message suffix of the Go type
+	ID        byte    `json:"id"`
+	Direction string  `json:"direction"` // client, server or both
+	Section   string  `json:"section"`   // Comment heading the message's type constant
+	Doc       string  `json:"doc"`
+	Custom    bool    `json:"custom"`
+	Quantized bool    `json:"quantized"`
+	Fields    []Field `json:"fields"`
+}
+
+// Field is one field of a struct or message
+type Field struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	Doc      string `json:"doc"`
+	GoType   string `json:"goType"` // Named Go type of a scalar
+	JS       string `json:"js"`     // JavaScript property name, derived from Name by default
+	Length   string `json:"length"` // Type of a string's or array's length prefix
+	Max      int    `json:"max"`    // Longest string or array allowed (0 = what the prefix can hold)
+	Optional bool   `json:"optional"`
+	Default  string `json:"default"`
+}
+
+// scalarSizes are the encoded sizes of the scalar types
+var scalarSizes = map[string]int{
+	"bool":    1,
+	"uint8":   1,
+	"uint16":  2,
+	"uint32":  4,
+	"int32":   4,
+	"float32": 4,
+}
+
+// lengthLimits are the longest lengths each length prefix type can hold,
+// where that is short enough to check for
+var lengthLimits = map[string]int{
+	"uint8":  0xFF,
+	"uint16": 0xFFFF,
+}
+
+func main() {
+	schemaPath := flag.String("schema", "schema.json", "Schema to generate from")
+	goPath := flag.String("go", "messages_gen.go", "Go file to write")
+	jsPath := flag.String("js", "", "JavaScript module to write (none if empty)")
+	flag.Parse()
+
+	data, err := os.ReadFile(*schemaPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	var schema Schema
+	if err := json.Unmarshal(data, &schema); err != nil {
+		log.Fatalf("Error parsing %s: %v", *schemaPath, err)
+	}
+	g, err := newGenerator(&schema)
+	if err != nil {
+		log.Fatalf("Invalid schema: %v", err)
+	}
+
+	source, err := format.Source(g.goSource())
+	if err != nil {
+		log.Fatalf("Error formatting generated Go: %v", err)
+	}
+	if err := os.WriteFile(*goPath, source, 0o644); err != nil {
+		log.Fatal(err)
+	}
+	if *jsPath != "" {
+		if err := os.WriteFile(*jsPath, g.jsSource(), 0o644); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+type generator struct {
+	schema  *Schema
+	structs map[string]*Struct
+}
+
+// newGenerator checks that the schema only uses types it declares
+func newGenerator(schema *Schema) (*generator, error) {
+	g := &generator{schema: schema, structs: make(map[string]*Struct)}
+	for i := range schema.Structs {
+		g.structs[schema.Structs[i].Name] = &schema.Structs[i]
+	}
+
+	ids := make(map[byte]string)
+	for _, m := range schema.Messages {
+		if other, taken := ids[m.ID]; taken {
+			return nil, fmt.Errorf("messages %s and %s share ID %d", other, m.Name, m.ID)
+		}
+		ids[m.ID] = m.Name
+		if err := g.checkFields(m.Name, m.Fields); err != nil {
+			return nil, err
+		}
+	}
+	for _, s := range schema.Structs {
+		if err := g.checkFields(s.Name, s.Fields); err != nil {
+			return nil, err
+		}
+	}
+	return g, nil
+}
+
+func (g *generator) checkFields(owner string, fields []Field) error {
+	optional := false
+	for _, f := range fields {
+		if err := g.checkType(f.Type); err != nil {
+			return fmt.Errorf("%s.%s: %v", owner, f.Name, err)
+		}
+		if f.Length != "" && lengthSize(f.Length) == 0 {
+			return fmt.Errorf("%s.%s: invalid length type %q", owner, f.Name, f.Length)
+		}
+		if optional && !f.Optional {
+			return fmt.Errorf("%s.%s: only trailing fields can be optional", owner, f.Name)
+		}
+		optional = f.Optional
+	}
+	return nil
+}
+
+func (g *generator) checkType(t string) error {
+	if elem, ok := strings.CutPrefix(t, "[]"); ok {
+		return g.checkType(elem)
+	}
+	if _, ok := scalarSizes[t]; ok || t == "string" {
+		return nil
+	}
+	if _, ok := g.structs[t]; ok {
+		return nil
+	}
+	return fmt.Errorf("unknown type %q", t)
+}
+
+// lengthSize returns the encoded size of a length prefix type, or 0 for an
+// invalid one
+func lengthSize(t string) int {
+	switch t {
+	case "uint8":
+		return 1
+	case "uint16":
+		return 2
+	case "int32", "uint32":
+		return 4
+	}
+	return 0
+}
+
+// lengthType returns the type of a field's length prefix
+func lengthType(f Field) string {
+	if f.Length == "" {
+		return "int32"
+	}
+	return f.Length
+}
+
+// maxLength returns the longest a string or array field can be, or 0 when
+// it is only limited by the size of the message
+func maxLength(f Field) int {
+	if f.Max > 0 {
+		return f.Max
+	}
+	return lengthLimits[lengthType(f)]
+}
+
+// minSize returns the fewest bytes a value of the type encodes to
+func (g *generator) minSize(t string) int {
+	if strings.HasPrefix(t, "[]") || t == "string" {
+		return 0 // Callers add the length prefix
+	}
+	if size, ok := scalarSizes[t]; ok {
+		return size
+	}
+	size := 0
+	for _, f := range g.structs[t].Fields {
+		if f.Optional {
+			break
+		}
+		size += g.fieldMinSize(f)
+	}
+	return size
+}
+
+func (g *generator) fieldMinSize(f Field) int {
+	if strings.HasPrefix(f.Type, "[]") || f.Type == "string" {
+		return lengthSize(lengthType(f))
+	}
+	return g.minSize(f.Type)
+}
+
+// words splits a Go identifier into its words, keeping initialisms such as
+// ID together
+func words(name string) []string {
+	var result []string
+	runes := []rune(name)
+	start := 0
+	for i := 1; i < len(runes); i++ {
+		upper := unicode.IsUpper(runes[i])
+		afterLower := !unicode.IsUpper(runes[i-1])
+		beforeLower := i+1 < len(runes) && !unicode.IsUpper(runes[i+1])
+		if upper && (afterLower || beforeLower) {
+			result = append(result, string(runes[start:i]))
+			start = i
+		}
+	}
+	return append(result, string(runes[start:]))
+}
+
+// camelCase turns a Go identifier into a JavaScript property name
+func camelCase(name string) string {
+	var b strings.Builder
+	for i, word := range words(name) {
+		word = strings.ToLower(word)
+		if i > 0 {
+			word = strings.ToUpper(word[:1]) + word[1:]
+		}
+		b.WriteString(word)
+	}
+	return b.String()
+}
+
+// screamingCase turns a message name into its MessageTypes key
+func screamingCase(name string) string {
+	return strings.ToUpper(strings.Join(words(name), "_"))
+}
+
+// lowerFirst lowercases the first letter of a Go identifier
+func lowerFirst(name string) string {
+	return strings.ToLower(name[:1]) + name[1:]
+}
+
+// jsName returns a field's JavaScript property name
+func jsName(f Field) string {
+	if f.JS != "" {
+		return f.JS
+	}
+	return camelCase(f.Name)
+}
+
+// article returns the indefinite article to put before a name
+func article(name string) string {
+	if strings.ContainsRune("AEIOU", rune(name[0])) {
+		return "an"
+	}
+	return "a"
+}
+
+// comment writes text as a // comment, one line per line of text
+func comment(buf *bytes.Buffer, indent, text string) {
+	for _, line := range strings.Split(text, "\n") {
+		fmt.Fprintf(buf, "%s// %s\n", indent, line)
+	}
+}
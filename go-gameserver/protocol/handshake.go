@@ -0,0 +1,31 @@
+package protocol
+
+// Protocol versions. The server accepts clients speaking any version from
+// MinProtocolVersion to ProtocolVersion; bump ProtocolVersion whenever a
+// message changes shape, and MinProtocolVersion when older clients can no
+// longer be served.
+const (
+	ProtocolVersion    uint16 = 1
+	MinProtocolVersion uint16 = 1
+)
+
+// Features is a bitmask of optional protocol features
+type Features uint32
+
+const (
+	// FeatureQuantized is the compact quantized wire format for snapshots,
+	// player updates, players entering view, gun fire and projectile spawns
+	FeatureQuantized Features = 1 << iota
+
+	// FeatureServerProjectiles is understanding ProjectileSpawn and
+	// ProjectileImpact; rooms that simulate bullets on the server require it
+	FeatureServerProjectiles
+)
+
+// WebSocket close codes a handshake is rejected with
+const (
+	CloseHelloRequired      = 4000 // The first message was not a Hello
+	CloseVersionUnsupported = 4001 // The client's protocol version is outside what the server accepts
+	CloseFeatureMissing     = 4002 // The client lacks a feature the room requires
+	CloseJSONDisabled       = 4003 // The client spoke JSON to a server that only accepts binary
+)
@@ -0,0 +1,133 @@
+package protocol
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+// The JSON protocol is what clients spoke before the binary one, kept for
+// the clients that still do. A client picks it by sending its Hello as a
+// text frame, and then sends JSON messages in text frames; it is sent
+// binary messages like any other client. Each JSON message translates into
+// the binary Message it stands for, so the server handles both the same way.
+
+// JSONMessage is a message from a JSON client
+type JSONMessage interface {
+	// Message returns the binary message this stands for, given the
+	// sender's current state
+	Message(sender Player) Message
+}
+
+// JSONHello opens a JSON client's connection, like Hello
+type JSONHello struct {
+	Version     uint16   `json:"version"`
+	ClientBuild string   `json:"clientBuild"`
+	Features    Features `json:"features"`
+}
+
+func (m JSONHello) Message(sender Player) Message {
+	return HelloMessage{Hello: Hello{Version: m.Version, ClientBuild: m.ClientBuild, Features: m.Features}}
+}
+
+// JSONPlayerUpdate is a JSON client's own position and color. Fields it
+// leaves out keep their current values rather than being reset. Health,
+// death and size belong to the server, so they are not read at all.
+type JSONPlayerUpdate struct {
+	X     *float32   `json:"x"`
+	Y     *float32   `json:"y"`
+	Color *JSONColor `json:"color"`
+}
+
+func (m JSONPlayerUpdate) Message(sender Player) Message {
+	p := sender
+	set := func(field *float32, value *float32) {
+		if value != nil {
+			*field = *value
+		}
+	}
+	set(&p.X, m.X)
+	set(&p.Y, m.Y)
+	if m.Color != nil {
+		p.ColorR, p.ColorG, p.ColorB, p.ColorA = m.Color[0], m.Color[1], m.Color[2], m.Color[3]
+	}
+	return PlayerUpdateMessage{Player: p}
+}
+
+// JSONColor is a color as JSON clients send it: an [r,g,b,a] array, or the
+// same array as a string
+type JSONColor [4]float32
+
+func (c *JSONColor) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err == nil {
+		data = []byte(s)
+	}
+	var rgba [4]float32
+	if err := json.Unmarshal(data, &rgba); err != nil {
+		return errors.New("color is not an [r,g,b,a] array")
+	}
+	*c = rgba
+	return nil
+}
+
+// JSONGunAttachment is a JSON client attaching a gun, like GunAttachment
+type JSONGunAttachment struct {
+	Data struct {
+		GunID    int32   `json:"gunId"`
+		PlayerID int32   `json:"playerId"`
+		OffsetX  float32 `json:"attachmentOffsetX"`
+		OffsetY  float32 `json:"attachmentOffsetY"`
+		Rotation float32 `json:"rotation"`
+		WeaponID int32   `json:"weaponId"`
+	} `json:"data"`
+}
+
+func (m JSONGunAttachment) Message(sender Player) Message {
+	d := m.Data
+	return GunAttachmentMessage{Attachment: GunAttachment{
+		GunID:    d.GunID,
+		PlayerID: d.PlayerID,
+		OffsetX:  d.OffsetX,
+		OffsetY:  d.OffsetY,
+		Rotation: d.Rotation,
+		WeaponID: d.WeaponID,
+	}}
+}
+
+// DecodeJSON decodes a JSON message by its "type". Messages without one are
+// player updates, as the first JSON clients sent them.
+func DecodeJSON(data []byte) (JSONMessage, error) {
+	var envelope struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(data, &envelope); err != nil {
+		return nil, err
+	}
+
+	name := envelope.Type
+	if name == "" {
+		name = "PlayerUpdate"
+	}
+
+	var msg JSONMessage
+	switch name {
+	case "Hello":
+		msg = new(JSONHello)
+	case "PlayerUpdate":
+		msg = new(JSONPlayerUpdate)
+	case "GunAttachment":
+		msg = new(JSONGunAttachment)
+	default:
+		return nil, fmt.Errorf("%w %q", ErrUnknownType, name)
+	}
+	if err := json.Unmarshal(data, msg); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	// Hold JSON clients to the binary protocol's limits
+	if hello, ok := msg.(*JSONHello); ok && len(hello.ClientBuild) > maxHelloClientBuildLength {
+		return nil, tooLong("Hello.ClientBuild")
+	}
+	return msg, nil
+}
@@ -0,0 +1,103 @@
+package protocol
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestJSONPlayerUpdateKeepsMissingFields(t *testing.T) {
+	sender := benchPlayer(3)
+	sender.IsDead = true
+
+	msg, err := DecodeJSON([]byte(`{"x": 12.5, "y": -4, "color": "[0.5,0.25,1,1]"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := msg.Message(sender).(PlayerUpdateMessage).Player
+
+	want := sender
+	want.X, want.Y = 12.5, -4
+	want.ColorR, want.ColorG, want.ColorB, want.ColorA = 0.5, 0.25, 1, 1
+	if got != want {
+		t.Errorf("got %+v\nwant %+v", got, want)
+	}
+}
+
+func TestJSONPlayerUpdateIgnoresServerOwnedFields(t *testing.T) {
+	sender := benchPlayer(3)
+
+	msg, err := DecodeJSON([]byte(`{"x": 1, "health": 100000, "maxHealth": 100000, "isDead": true, "width": 0, "height": 0}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := msg.Message(sender).(PlayerUpdateMessage).Player
+
+	want := sender
+	want.X = 1
+	if got != want {
+		t.Errorf("got %+v\nwant %+v", got, want)
+	}
+}
+
+func TestDecodeJSON(t *testing.T) {
+	sender := benchPlayer(3)
+
+	tests := []struct {
+		name string
+		data string
+		want Message
+	}{
+		{
+			"hello",
+			`{"type": "Hello", "version": 1, "clientBuild": "bot", "features": 2}`,
+			HelloMessage{Hello: Hello{Version: 1, ClientBuild: "bot", Features: FeatureServerProjectiles}},
+		},
+		{
+			"typed player update",
+			`{"type": "PlayerUpdate", "isDead": true, "color": [1, 0, 0, 1]}`,
+			func() Message {
+				p := sender
+				p.ColorR, p.ColorG, p.ColorB, p.ColorA = 1, 0, 0, 1
+				return PlayerUpdateMessage{Player: p}
+			}(),
+		},
+		{
+			"gun attachment",
+			`{"type": "GunAttachment", "data": {"gunId": 4, "playerId": 3, "attachmentOffsetX": 1.5, "attachmentOffsetY": -2, "rotation": 0.5, "weaponId": 2}}`,
+			GunAttachmentMessage{Attachment: GunAttachment{GunID: 4, PlayerID: 3, OffsetX: 1.5, OffsetY: -2, Rotation: 0.5, WeaponID: 2}},
+		},
+	}
+	for _, tt := range tests {
+		msg, err := DecodeJSON([]byte(tt.data))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got := msg.Message(sender); got != tt.want {
+			t.Errorf("%s: got %+v\nwant %+v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestDecodeJSONErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want error
+	}{
+		{"unknown type", `{"type": "Teleport"}`, ErrUnknownType},
+		{"long client build", `{"type": "Hello", "clientBuild": "` + strings.Repeat("a", 65) + `"}`, ErrTooLong},
+	}
+	for _, tt := range tests {
+		if _, err := DecodeJSON([]byte(tt.data)); !errors.Is(err, tt.want) {
+			t.Errorf("%s: got error %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	for _, data := range []string{`not json`, `{"x": "far"}`, `{"color": "red"}`} {
+		if _, err := DecodeJSON([]byte(data)); err == nil {
+			t.Errorf("decoded %s", data)
+		}
+	}
+}
@@ -0,0 +1,1742 @@
+// Code generated by protocol/gen from schema.json. DO NOT EDIT.
+
+package protocol
+
+import "fmt"
+
+// Message types
+const (
+	// Client -> Server messages
+	PlayerUpdateType    byte = 1
+	ChatMessageType     byte = 2
+	GunFireType         byte = 3
+	HitReportType       byte = 4
+	PlayerJoinType      byte = 5
+	PlayerLeaveType     byte = 6
+	PlatformDestroyType byte = 7
+	FragmentCreateType  byte = 8
+	FragmentDestroyType byte = 9
+	GunAttachmentType   byte = 10
+	InputCommandType    byte = 11
+	TeamSwitchType      byte = 12
+	SnapshotAckType     byte = 13
+	HelloType           byte = 14
+
+	// Server -> Client messages
+	BroadcastPlayerUpdateType    byte = 101
+	BroadcastChatMessageType     byte = 102
+	BroadcastGunFireType         byte = 103
+	BroadcastHitReportType       byte = 104
+	BroadcastPlayerJoinType      byte = 105
+	BroadcastPlayerLeaveType     byte = 106
+	InitialStateType             byte = 107
+	BroadcastPlatformDestroyType byte = 108
+	BroadcastFragmentCreateType  byte = 109
+	BroadcastFragmentDestroyType byte = 110
+	BroadcastGunAttachmentType   byte = 111
+	WorldSnapshotType            byte = 112
+	ScoreboardUpdateType         byte = 113
+	MatchStateType               byte = 114
+
+	// Quantized server -> client messages, sent instead of their float32
+	// counterparts to clients that negotiated FeatureQuantized
+	QuantizedWorldSnapshotType    byte = 115
+	QuantizationType              byte = 116
+	QuantizedBroadcastGunFireType byte = 117
+
+	// Area of interest events
+	PlayerEnterViewType byte = 118
+	PlayerLeaveViewType byte = 119
+
+	// Server-simulated projectiles
+	ProjectileSpawnType  byte = 120
+	ProjectileImpactType byte = 121
+
+	// Destructible terrain
+	TerrainStateType    byte = 122
+	PlatformRestoreType byte = 123
+
+	// Handshake
+	WelcomeType byte = 124
+
+	// More quantized server -> client messages, added after the area of
+	// interest and server projectiles
+	QuantizedBroadcastPlayerUpdateType byte = 125
+	QuantizedPlayerEnterViewType       byte = 126
+	QuantizedProjectileSpawnType       byte = 127
+
+	// Messages that can travel in either direction
+	BundleType byte = 200
+)
+
+// Longest strings and arrays the schema allows
+const (
+	maxPlayerNameLength         = 32
+	maxChatMessageMessageLength = 256
+	maxHelloClientBuildLength   = 64
+)
+
+// Player represents a player in the game
+type Player struct {
+	ID            int32
+	Name          string
+	X             float32
+	Y             float32
+	Width         float32
+	Height        float32
+	ColorR        float32
+	ColorG        float32
+	ColorB        float32
+	ColorA        float32
+	Health        float32
+	MaxHealth     float32
+	IsDead        bool
+	Direction     float32
+	FaceDirection int32
+	VelocityX     float32
+	VelocityY     float32
+	TeamID        int32 // Assigned by the server (0 = no team)
+}
+
+// appendPlayer appends a Player's fields to dst
+func appendPlayer(dst []byte, v Player) ([]byte, error) {
+	dst = appendInt32(dst, v.ID)
+	if len(v.Name) > maxPlayerNameLength {
+		return dst, tooLong("Player.Name")
+	}
+	dst = appendInt32(dst, int32(len(v.Name)))
+	dst = append(dst, v.Name...)
+	dst = appendFloat32(dst, v.X)
+	dst = appendFloat32(dst, v.Y)
+	dst = appendFloat32(dst, v.Width)
+	dst = appendFloat32(dst, v.Height)
+	dst = appendFloat32(dst, v.ColorR)
+	dst = appendFloat32(dst, v.ColorG)
+	dst = appendFloat32(dst, v.ColorB)
+	dst = appendFloat32(dst, v.ColorA)
+	dst = appendFloat32(dst, v.Health)
+	dst = appendFloat32(dst, v.MaxHealth)
+	dst = appendBool(dst, v.IsDead)
+	dst = appendFloat32(dst, v.Direction)
+	dst = appendInt32(dst, v.FaceDirection)
+	dst = appendFloat32(dst, v.VelocityX)
+	dst = appendFloat32(dst, v.VelocityY)
+	dst = appendInt32(dst, v.TeamID)
+	return dst, nil
+}
+
+// decodePlayer reads a Player's fields into v
+func decodePlayer(r *reader, v *Player) error {
+	v.ID = r.int32()
+	nameLength := r.length(int(r.int32()), maxPlayerNameLength, 1, "Player.Name")
+	v.Name = r.string(nameLength)
+	v.X = r.float32()
+	v.Y = r.float32()
+	v.Width = r.float32()
+	v.Height = r.float32()
+	v.ColorR = r.float32()
+	v.ColorG = r.float32()
+	v.ColorB = r.float32()
+	v.ColorA = r.float32()
+	v.Health = r.float32()
+	v.MaxHealth = r.float32()
+	v.IsDead = r.bool()
+
+	// Older senders may stop before the remaining fields
+	if r.Len() > 0 {
+		v.Direction = r.float32()
+	}
+	if r.Len() > 0 {
+		v.FaceDirection = r.int32()
+	} else {
+		v.FaceDirection = 1
+	}
+	if r.Len() > 0 {
+		v.VelocityX = r.float32()
+	}
+	if r.Len() > 0 {
+		v.VelocityY = r.float32()
+	}
+	if r.Len() > 0 {
+		v.TeamID = r.int32()
+	}
+	return r.err
+}
+
+// ChatMessage represents a chat message
+type ChatMessage struct {
+	PlayerID int32
+	Message  string
+}
+
+// appendChatMessage appends a ChatMessage's fields to dst
+func appendChatMessage(dst []byte, v ChatMessage) ([]byte, error) {
+	dst = appendInt32(dst, v.PlayerID)
+	if len(v.Message) > maxChatMessageMessageLength {
+		return dst, tooLong("ChatMessage.Message")
+	}
+	dst = appendInt32(dst, int32(len(v.Message)))
+	dst = append(dst, v.Message...)
+	return dst, nil
+}
+
+// decodeChatMessage reads a ChatMessage's fields into v
+func decodeChatMessage(r *reader, v *ChatMessage) error {
+	v.PlayerID = r.int32()
+	messageLength := r.length(int(r.int32()), maxChatMessageMessageLength, 1, "ChatMessage.Message")
+	v.Message = r.string(messageLength)
+	return r.err
+}
+
+// GunFire represents a gun firing event
+type GunFire struct {
+	PlayerID int32
+	X        float32
+	Y        float32
+	Angle    float32
+	Damage   float32
+	WeaponID int32 // Weapon catalogue ID (0 = the player's current weapon)
+}
+
+// appendGunFire appends a GunFire's fields to dst
+func appendGunFire(dst []byte, v GunFire) ([]byte, error) {
+	dst = appendInt32(dst, v.PlayerID)
+	dst = appendFloat32(dst, v.X)
+	dst = appendFloat32(dst, v.Y)
+	dst = appendFloat32(dst, v.Angle)
+	dst = appendFloat32(dst, v.Damage)
+	dst = appendInt32(dst, v.WeaponID)
+	return dst, nil
+}
+
+// decodeGunFire reads a GunFire's fields into v
+func decodeGunFire(r *reader, v *GunFire) error {
+	v.PlayerID = r.int32()
+	v.X = r.float32()
+	v.Y = r.float32()
+	v.Angle = r.float32()
+	v.Damage = r.float32()
+
+	// Older senders may stop before the remaining fields
+	if r.Len() > 0 {
+		v.WeaponID = r.int32()
+	}
+	return r.err
+}
+
+// HitReport represents a hit report
+type HitReport struct {
+	ShooterID int32
+	TargetID  int32
+	Damage    float32
+}
+
+// appendHitReport appends a HitReport's fields to dst
+func appendHitReport(dst []byte, v HitReport) ([]byte, error) {
+	dst = appendInt32(dst, v.ShooterID)
+	dst = appendInt32(dst, v.TargetID)
+	dst = appendFloat32(dst, v.Damage)
+	return dst, nil
+}
+
+// decodeHitReport reads a HitReport's fields into v
+func decodeHitReport(r *reader, v *HitReport) error {
+	v.ShooterID = r.int32()
+	v.TargetID = r.int32()
+	v.Damage = r.float32()
+	return r.err
+}
+
+// PlatformDestroy represents a platform destruction event
+type PlatformDestroy struct {
+	PlatformID int32
+	ShooterID  int32
+}
+
+// appendPlatformDestroy appends a PlatformDestroy's fields to dst
+func appendPlatformDestroy(dst []byte, v PlatformDestroy) ([]byte, error) {
+	dst = appendInt32(dst, v.PlatformID)
+	dst = appendInt32(dst, v.ShooterID)
+	return dst, nil
+}
+
+// decodePlatformDestroy reads a PlatformDestroy's fields into v
+func decodePlatformDestroy(r *reader, v *PlatformDestroy) error {
+	v.PlatformID = r.int32()
+	v.ShooterID = r.int32()
+	return r.err
+}
+
+// Fragment represents a fragment created from a destroyed platform
+type Fragment struct {
+	ID               int32
+	OriginalEntityID int32
+	X                float32
+	Y                float32
+	Width            float32
+	Height           float32
+	VelocityX        float32
+	VelocityY        float32
+	ColorR           float32
+	ColorG           float32
+	ColorB           float32
+	ColorA           float32
+}
+
+// appendFragment appends a Fragment's fields to dst
+func appendFragment(dst []byte, v Fragment) ([]byte, error) {
+	dst = appendInt32(dst, v.ID)
+	dst = appendInt32(dst, v.OriginalEntityID)
+	dst = appendFloat32(dst, v.X)
+	dst = appendFloat32(dst, v.Y)
+	dst = appendFloat32(dst, v.Width)
+	dst = appendFloat32(dst, v.Height)
+	dst = appendFloat32(dst, v.VelocityX)
+	dst = appendFloat32(dst, v.VelocityY)
+	dst = appendFloat32(dst, v.ColorR)
+	dst = appendFloat32(dst, v.ColorG)
+	dst = appendFloat32(dst, v.ColorB)
+	dst = appendFloat32(dst, v.ColorA)
+	return dst, nil
+}
+
+// decodeFragment reads a Fragment's fields into v
+func decodeFragment(r *reader, v *Fragment) error {
+	v.ID = r.int32()
+	v.OriginalEntityID = r.int32()
+	v.X = r.float32()
+	v.Y = r.float32()
+	v.Width = r.float32()
+	v.Height = r.float32()
+	v.VelocityX = r.float32()
+	v.VelocityY = r.float32()
+	v.ColorR = r.float32()
+	v.ColorG = r.float32()
+	v.ColorB = r.float32()
+	v.ColorA = r.float32()
+	return r.err
+}
+
+// FragmentDestroy represents a fragment destruction event
+type FragmentDestroy struct {
+	FragmentID int32
+}
+
+// appendFragmentDestroy appends a FragmentDestroy's fields to dst
+func appendFragmentDestroy(dst []byte, v FragmentDestroy) ([]byte, error) {
+	dst = appendInt32(dst, v.FragmentID)
+	return dst, nil
+}
+
+// decodeFragmentDestroy reads a FragmentDestroy's fields into v
+func decodeFragmentDestroy(r *reader, v *FragmentDestroy) error {
+	v.FragmentID = r.int32()
+	return r.err
+}
+
+// GunAttachment represents a gun attachment to a player
+type GunAttachment struct {
+	GunID    int32
+	PlayerID int32
+	OffsetX  float32
+	OffsetY  float32
+	Rotation float32
+	WeaponID int32 // Weapon catalogue ID (0 = the default weapon)
+}
+
+// appendGunAttachment appends a GunAttachment's fields to dst
+func appendGunAttachment(dst []byte, v GunAttachment) ([]byte, error) {
+	dst = appendInt32(dst, v.GunID)
+	dst = appendInt32(dst, v.PlayerID)
+	dst = appendFloat32(dst, v.OffsetX)
+	dst = appendFloat32(dst, v.OffsetY)
+	dst = appendFloat32(dst, v.Rotation)
+	dst = appendInt32(dst, v.WeaponID)
+	return dst, nil
+}
+
+// decodeGunAttachment reads a GunAttachment's fields into v
+func decodeGunAttachment(r *reader, v *GunAttachment) error {
+	v.GunID = r.int32()
+	v.PlayerID = r.int32()
+	v.OffsetX = r.float32()
+	v.OffsetY = r.float32()
+	v.Rotation = r.float32()
+
+	// Older senders may stop before the remaining fields
+	if r.Len() > 0 {
+		v.WeaponID = r.int32()
+	}
+	return r.err
+}
+
+// ScoreEntry is one player's line on the scoreboard
+type ScoreEntry struct {
+	PlayerID int32
+	Kills    int32
+	Deaths   int32
+	Assists  int32
+	TeamID   int32 // 0 outside team modes
+}
+
+// appendScoreEntry appends a ScoreEntry's fields to dst
+func appendScoreEntry(dst []byte, v ScoreEntry) ([]byte, error) {
+	dst = appendInt32(dst, v.PlayerID)
+	dst = appendInt32(dst, v.Kills)
+	dst = appendInt32(dst, v.Deaths)
+	dst = appendInt32(dst, v.Assists)
+	dst = appendInt32(dst, v.TeamID)
+	return dst, nil
+}
+
+// decodeScoreEntry reads a ScoreEntry's fields into v
+func decodeScoreEntry(r *reader, v *ScoreEntry) error {
+	v.PlayerID = r.int32()
+	v.Kills = r.int32()
+	v.Deaths = r.int32()
+	v.Assists = r.int32()
+	v.TeamID = r.int32()
+	return r.err
+}
+
+// MatchState describes the phase of a room's match
+type MatchState struct {
+	Phase         byte
+	TimeRemaining float32 // Seconds left in the phase (0 = no limit)
+	ScoreLimit    int32   // Kills needed to win (0 = no limit)
+	WinnerID      int32   // Winning player once the match has ended (0 = none)
+	Mode          byte    // Game mode the room is playing
+	WinnerTeamID  int32   // Winning team in team modes (0 = none)
+}
+
+// appendMatchState appends a MatchState's fields to dst
+func appendMatchState(dst []byte, v MatchState) ([]byte, error) {
+	dst = appendUint8(dst, v.Phase)
+	dst = appendFloat32(dst, v.TimeRemaining)
+	dst = appendInt32(dst, v.ScoreLimit)
+	dst = appendInt32(dst, v.WinnerID)
+	dst = appendUint8(dst, v.Mode)
+	dst = appendInt32(dst, v.WinnerTeamID)
+	return dst, nil
+}
+
+// decodeMatchState reads a MatchState's fields into v
+func decodeMatchState(r *reader, v *MatchState) error {
+	v.Phase = r.uint8()
+	v.TimeRemaining = r.float32()
+	v.ScoreLimit = r.int32()
+	v.WinnerID = r.int32()
+	v.Mode = r.uint8()
+	v.WinnerTeamID = r.int32()
+	return r.err
+}
+
+// Projectile is a bullet simulated by the server, as it was spawned
+type Projectile struct {
+	ID        int32
+	ShooterID int32
+	WeaponID  int32
+	X         float32
+	Y         float32
+	VelocityX float32 // px/s
+	VelocityY float32 // px/s
+	Gravity   float32 // Downward acceleration in px/s²
+	Tick      uint32  // Server tick the projectile was spawned on
+}
+
+// appendProjectile appends a Projectile's fields to dst
+func appendProjectile(dst []byte, v Projectile) ([]byte, error) {
+	dst = appendInt32(dst, v.ID)
+	dst = appendInt32(dst, v.ShooterID)
+	dst = appendInt32(dst, v.WeaponID)
+	dst = appendFloat32(dst, v.X)
+	dst = appendFloat32(dst, v.Y)
+	dst = appendFloat32(dst, v.VelocityX)
+	dst = appendFloat32(dst, v.VelocityY)
+	dst = appendFloat32(dst, v.Gravity)
+	dst = appendUint32(dst, v.Tick)
+	return dst, nil
+}
+
+// decodeProjectile reads a Projectile's fields into v
+func decodeProjectile(r *reader, v *Projectile) error {
+	v.ID = r.int32()
+	v.ShooterID = r.int32()
+	v.WeaponID = r.int32()
+	v.X = r.float32()
+	v.Y = r.float32()
+	v.VelocityX = r.float32()
+	v.VelocityY = r.float32()
+	v.Gravity = r.float32()
+	v.Tick = r.uint32()
+	return r.err
+}
+
+// ProjectileImpact is where and why a projectile stopped
+type ProjectileImpact struct {
+	ProjectileID int32
+	ShooterID    int32
+	Kind         byte    // ImpactExpired, ImpactPlatform or ImpactPlayer
+	TargetID     int32   // Platform or player hit (0 when expired)
+	X            float32 // Point of impact
+	Y            float32
+	NormalX      float32 // Normal of the surface hit (zero when expired)
+	NormalY      float32
+	Damage       float32 // Damage dealt to the player hit
+}
+
+// appendProjectileImpact appends a ProjectileImpact's fields to dst
+func appendProjectileImpact(dst []byte, v ProjectileImpact) ([]byte, error) {
+	dst = appendInt32(dst, v.ProjectileID)
+	dst = appendInt32(dst, v.ShooterID)
+	dst = appendUint8(dst, v.Kind)
+	dst = appendInt32(dst, v.TargetID)
+	dst = appendFloat32(dst, v.X)
+	dst = appendFloat32(dst, v.Y)
+	dst = appendFloat32(dst, v.NormalX)
+	dst = appendFloat32(dst, v.NormalY)
+	dst = appendFloat32(dst, v.Damage)
+	return dst, nil
+}
+
+// decodeProjectileImpact reads a ProjectileImpact's fields into v
+func decodeProjectileImpact(r *reader, v *ProjectileImpact) error {
+	v.ProjectileID = r.int32()
+	v.ShooterID = r.int32()
+	v.Kind = r.uint8()
+	v.TargetID = r.int32()
+	v.X = r.float32()
+	v.Y = r.float32()
+	v.NormalX = r.float32()
+	v.NormalY = r.float32()
+	v.Damage = r.float32()
+	return r.err
+}
+
+// TerrainState is how a room's terrain differs from its level file
+type TerrainState struct {
+	DestroyedPlatforms []int32
+	Fragments          []Fragment // Fragments that have not been destroyed yet
+}
+
+// appendTerrainState appends a TerrainState's fields to dst
+func appendTerrainState(dst []byte, v TerrainState) ([]byte, error) {
+	var err error
+	dst = appendInt32(dst, int32(len(v.DestroyedPlatforms)))
+	for _, elem := range v.DestroyedPlatforms {
+		dst = appendInt32(dst, elem)
+	}
+	dst = appendInt32(dst, int32(len(v.Fragments)))
+	for _, elem := range v.Fragments {
+		if dst, err = appendFragment(dst, elem); err != nil {
+			return dst, err
+		}
+	}
+	return dst, nil
+}
+
+// decodeTerrainState reads a TerrainState's fields into v
+func decodeTerrainState(r *reader, v *TerrainState) error {
+	destroyedPlatformsCount := r.length(int(r.int32()), 0, 4, "TerrainState.DestroyedPlatforms")
+	v.DestroyedPlatforms = make([]int32, destroyedPlatformsCount)
+	for i := range v.DestroyedPlatforms {
+		v.DestroyedPlatforms[i] = r.int32()
+	}
+	fragmentsCount := r.length(int(r.int32()), 0, 48, "TerrainState.Fragments")
+	v.Fragments = make([]Fragment, fragmentsCount)
+	for i := range v.Fragments {
+		if err := decodeFragment(r, &v.Fragments[i]); err != nil {
+			return err
+		}
+	}
+	return r.err
+}
+
+// Hello is the first message a client sends after connecting
+type Hello struct {
+	Version     uint16 // Protocol version the client speaks
+	ClientBuild string // Free-form build identifier, for logs
+	Features    Features
+}
+
+// appendHello appends a Hello's fields to dst
+func appendHello(dst []byte, v Hello) ([]byte, error) {
+	dst = appendUint16(dst, v.Version)
+	if len(v.ClientBuild) > maxHelloClientBuildLength {
+		return dst, tooLong("Hello.ClientBuild")
+	}
+	dst = appendUint8(dst, uint8(len(v.ClientBuild)))
+	dst = append(dst, v.ClientBuild...)
+	dst = appendUint32(dst, uint32(v.Features))
+	return dst, nil
+}
+
+// decodeHello reads a Hello's fields into v
+func decodeHello(r *reader, v *Hello) error {
+	v.Version = r.uint16()
+	clientBuildLength := r.length(int(r.uint8()), maxHelloClientBuildLength, 1, "Hello.ClientBuild")
+	v.ClientBuild = r.string(clientBuildLength)
+	v.Features = Features(r.uint32())
+	return r.err
+}
+
+// Welcome is the server's answer to an accepted Hello
+type Welcome struct {
+	Version  uint16 // Protocol version the server speaks
+	PlayerID int32  // ID assigned to the client's player
+	TickRate uint16 // Simulation ticks per second
+	Features Features
+}
+
+// appendWelcome appends a Welcome's fields to dst
+func appendWelcome(dst []byte, v Welcome) ([]byte, error) {
+	dst = appendUint16(dst, v.Version)
+	dst = appendInt32(dst, v.PlayerID)
+	dst = appendUint16(dst, v.TickRate)
+	dst = appendUint32(dst, uint32(v.Features))
+	return dst, nil
+}
+
+// decodeWelcome reads a Welcome's fields into v
+func decodeWelcome(r *reader, v *Welcome) error {
+	v.Version = r.uint16()
+	v.PlayerID = r.int32()
+	v.TickRate = r.uint16()
+	v.Features = Features(r.uint32())
+	return r.err
+}
+
+// PlayerUpdateMessage is sent when a player's state changes
+type PlayerUpdateMessage struct {
+	Player Player
+}
+
+func (m PlayerUpdateMessage) Type() byte {
+	return PlayerUpdateType
+}
+
+func (m PlayerUpdateMessage) AppendEncode(dst []byte) ([]byte, error) {
+	dst = append(dst, m.Type())
+	var err error
+	if dst, err = appendPlayer(dst, m.Player); err != nil {
+		return dst, err
+	}
+	return dst, nil
+}
+
+func (m PlayerUpdateMessage) Encode() ([]byte, error) {
+	return encode(m)
+}
+
+func decodePlayerUpdateMessage(r *reader) (Message, error) {
+	var m PlayerUpdateMessage
+	if err := decodePlayer(r, &m.Player); err != nil {
+		return nil, err
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return m, nil
+}
+
+// ChatMessageMessage is sent when a player sends a chat message
+type ChatMessageMessage struct {
+	Chat ChatMessage
+}
+
+func (m ChatMessageMessage) Type() byte {
+	return ChatMessageType
+}
+
+func (m ChatMessageMessage) AppendEncode(dst []byte) ([]byte, error) {
+	dst = append(dst, m.Type())
+	var err error
+	if dst, err = appendChatMessage(dst, m.Chat); err != nil {
+		return dst, err
+	}
+	return dst, nil
+}
+
+func (m ChatMessageMessage) Encode() ([]byte, error) {
+	return encode(m)
+}
+
+func decodeChatMessageMessage(r *reader) (Message, error) {
+	var m ChatMessageMessage
+	if err := decodeChatMessage(r, &m.Chat); err != nil {
+		return nil, err
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return m, nil
+}
+
+// GunFireMessage is sent when a player fires a gun
+type GunFireMessage struct {
+	Fire GunFire
+}
+
+func (m GunFireMessage) Type() byte {
+	return GunFireType
+}
+
+func (m GunFireMessage) AppendEncode(dst []byte) ([]byte, error) {
+	dst = append(dst, m.Type())
+	var err error
+	if dst, err = appendGunFire(dst, m.Fire); err != nil {
+		return dst, err
+	}
+	return dst, nil
+}
+
+func (m GunFireMessage) Encode() ([]byte, error) {
+	return encode(m)
+}
+
+func decodeGunFireMessage(r *reader) (Message, error) {
+	var m GunFireMessage
+	if err := decodeGunFire(r, &m.Fire); err != nil {
+		return nil, err
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return m, nil
+}
+
+// HitReportMessage is sent when a player hits another player
+type HitReportMessage struct {
+	Hit HitReport
+}
+
+func (m HitReportMessage) Type() byte {
+	return HitReportType
+}
+
+func (m HitReportMessage) AppendEncode(dst []byte) ([]byte, error) {
+	dst = append(dst, m.Type())
+	var err error
+	if dst, err = appendHitReport(dst, m.Hit); err != nil {
+		return dst, err
+	}
+	return dst, nil
+}
+
+func (m HitReportMessage) Encode() ([]byte, error) {
+	return encode(m)
+}
+
+func decodeHitReportMessage(r *reader) (Message, error) {
+	var m HitReportMessage
+	if err := decodeHitReport(r, &m.Hit); err != nil {
+		return nil, err
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return m, nil
+}
+
+// PlayerJoinMessage is sent when a player joins the game
+type PlayerJoinMessage struct {
+	PlayerID int32
+}
+
+func (m PlayerJoinMessage) Type() byte {
+	return PlayerJoinType
+}
+
+func (m PlayerJoinMessage) AppendEncode(dst []byte) ([]byte, error) {
+	dst = append(dst, m.Type())
+	dst = appendInt32(dst, m.PlayerID)
+	return dst, nil
+}
+
+func (m PlayerJoinMessage) Encode() ([]byte, error) {
+	return encode(m)
+}
+
+func decodePlayerJoinMessage(r *reader) (Message, error) {
+	var m PlayerJoinMessage
+	m.PlayerID = r.int32()
+	if r.err != nil {
+		return nil, r.err
+	}
+	return m, nil
+}
+
+// PlayerLeaveMessage is sent when a player leaves the game
+type PlayerLeaveMessage struct {
+	PlayerID int32
+}
+
+func (m PlayerLeaveMessage) Type() byte {
+	return PlayerLeaveType
+}
+
+func (m PlayerLeaveMessage) AppendEncode(dst []byte) ([]byte, error) {
+	dst = append(dst, m.Type())
+	dst = appendInt32(dst, m.PlayerID)
+	return dst, nil
+}
+
+func (m PlayerLeaveMessage) Encode() ([]byte, error) {
+	return encode(m)
+}
+
+func decodePlayerLeaveMessage(r *reader) (Message, error) {
+	var m PlayerLeaveMessage
+	m.PlayerID = r.int32()
+	if r.err != nil {
+		return nil, r.err
+	}
+	return m, nil
+}
+
+// PlatformDestroyMessage is sent when a player destroys a platform
+type PlatformDestroyMessage struct {
+	Destroy PlatformDestroy
+}
+
+func (m PlatformDestroyMessage) Type() byte {
+	return PlatformDestroyType
+}
+
+func (m PlatformDestroyMessage) AppendEncode(dst []byte) ([]byte, error) {
+	dst = append(dst, m.Type())
+	var err error
+	if dst, err = appendPlatformDestroy(dst, m.Destroy); err != nil {
+		return dst, err
+	}
+	return dst, nil
+}
+
+func (m PlatformDestroyMessage) Encode() ([]byte, error) {
+	return encode(m)
+}
+
+func decodePlatformDestroyMessage(r *reader) (Message, error) {
+	var m PlatformDestroyMessage
+	if err := decodePlatformDestroy(r, &m.Destroy); err != nil {
+		return nil, err
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return m, nil
+}
+
+// FragmentCreateMessage is sent when a fragment is created from a destroyed platform.
+// Fragments are now spawned by the server, which ignores it.
+type FragmentCreateMessage struct {
+	Fragment Fragment
+}
+
+func (m FragmentCreateMessage) Type() byte {
+	return FragmentCreateType
+}
+
+func (m FragmentCreateMessage) AppendEncode(dst []byte) ([]byte, error) {
+	dst = append(dst, m.Type())
+	var err error
+	if dst, err = appendFragment(dst, m.Fragment); err != nil {
+		return dst, err
+	}
+	return dst, nil
+}
+
+func (m FragmentCreateMessage) Encode() ([]byte, error) {
+	return encode(m)
+}
+
+func decodeFragmentCreateMessage(r *reader) (Message, error) {
+	var m FragmentCreateMessage
+	if err := decodeFragment(r, &m.Fragment); err != nil {
+		return nil, err
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return m, nil
+}
+
+// FragmentDestroyMessage is sent when a fragment is destroyed.
+// Fragments are now cleared by the server, which ignores it.
+type FragmentDestroyMessage struct {
+	Destroy FragmentDestroy
+}
+
+func (m FragmentDestroyMessage) Type() byte {
+	return FragmentDestroyType
+}
+
+func (m FragmentDestroyMessage) AppendEncode(dst []byte) ([]byte, error) {
+	dst = append(dst, m.Type())
+	var err error
+	if dst, err = appendFragmentDestroy(dst, m.Destroy); err != nil {
+		return dst, err
+	}
+	return dst, nil
+}
+
+func (m FragmentDestroyMessage) Encode() ([]byte, error) {
+	return encode(m)
+}
+
+func decodeFragmentDestroyMessage(r *reader) (Message, error) {
+	var m FragmentDestroyMessage
+	if err := decodeFragmentDestroy(r, &m.Destroy); err != nil {
+		return nil, err
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return m, nil
+}
+
+// GunAttachmentMessage is sent when a gun is attached to a player
+type GunAttachmentMessage struct {
+	Attachment GunAttachment
+}
+
+func (m GunAttachmentMessage) Type() byte {
+	return GunAttachmentType
+}
+
+func (m GunAttachmentMessage) AppendEncode(dst []byte) ([]byte, error) {
+	dst = append(dst, m.Type())
+	var err error
+	if dst, err = appendGunAttachment(dst, m.Attachment); err != nil {
+		return dst, err
+	}
+	return dst, nil
+}
+
+func (m GunAttachmentMessage) Encode() ([]byte, error) {
+	return encode(m)
+}
+
+func decodeGunAttachmentMessage(r *reader) (Message, error) {
+	var m GunAttachmentMessage
+	if err := decodeGunAttachment(r, &m.Attachment); err != nil {
+		return nil, err
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return m, nil
+}
+
+// TeamSwitchMessage is sent by a client asking to join another team
+type TeamSwitchMessage struct {
+	TeamID int32
+}
+
+func (m TeamSwitchMessage) Type() byte {
+	return TeamSwitchType
+}
+
+func (m TeamSwitchMessage) AppendEncode(dst []byte) ([]byte, error) {
+	dst = append(dst, m.Type())
+	dst = appendInt32(dst, m.TeamID)
+	return dst, nil
+}
+
+func (m TeamSwitchMessage) Encode() ([]byte, error) {
+	return encode(m)
+}
+
+func decodeTeamSwitchMessage(r *reader) (Message, error) {
+	var m TeamSwitchMessage
+	m.TeamID = r.int32()
+	if r.err != nil {
+		return nil, r.err
+	}
+	return m, nil
+}
+
+// SnapshotAckMessage is sent by a client for each world snapshot it applies,
+// so later snapshots can be encoded against it
+type SnapshotAckMessage struct {
+	Tick uint32
+}
+
+func (m SnapshotAckMessage) Type() byte {
+	return SnapshotAckType
+}
+
+func (m SnapshotAckMessage) AppendEncode(dst []byte) ([]byte, error) {
+	dst = append(dst, m.Type())
+	dst = appendUint32(dst, m.Tick)
+	return dst, nil
+}
+
+func (m SnapshotAckMessage) Encode() ([]byte, error) {
+	return encode(m)
+}
+
+func decodeSnapshotAckMessage(r *reader) (Message, error) {
+	var m SnapshotAckMessage
+	m.Tick = r.uint32()
+	if r.err != nil {
+		return nil, r.err
+	}
+	return m, nil
+}
+
+// HelloMessage opens the handshake. Its version comes first and its layout
+// must never change, so any future server can tell which version sent it.
+type HelloMessage struct {
+	Hello Hello
+}
+
+func (m HelloMessage) Type() byte {
+	return HelloType
+}
+
+func (m HelloMessage) AppendEncode(dst []byte) ([]byte, error) {
+	dst = append(dst, m.Type())
+	var err error
+	if dst, err = appendHello(dst, m.Hello); err != nil {
+		return dst, err
+	}
+	return dst, nil
+}
+
+func (m HelloMessage) Encode() ([]byte, error) {
+	return encode(m)
+}
+
+func decodeHelloMessage(r *reader) (Message, error) {
+	var m HelloMessage
+	if err := decodeHello(r, &m.Hello); err != nil {
+		return nil, err
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return m, nil
+}
+
+// BroadcastPlayerUpdateMessage is sent to all clients when a player's state changes
+type BroadcastPlayerUpdateMessage struct {
+	Player Player
+}
+
+func (m BroadcastPlayerUpdateMessage) Type() byte {
+	return BroadcastPlayerUpdateType
+}
+
+func (m BroadcastPlayerUpdateMessage) AppendEncode(dst []byte) ([]byte, error) {
+	dst = append(dst, m.Type())
+	var err error
+	if dst, err = appendPlayer(dst, m.Player); err != nil {
+		return dst, err
+	}
+	return dst, nil
+}
+
+func (m BroadcastPlayerUpdateMessage) Encode() ([]byte, error) {
+	return encode(m)
+}
+
+func decodeBroadcastPlayerUpdateMessage(r *reader) (Message, error) {
+	var m BroadcastPlayerUpdateMessage
+	if err := decodePlayer(r, &m.Player); err != nil {
+		return nil, err
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return m, nil
+}
+
+// BroadcastChatMessageMessage is sent to all clients when a player sends a chat message
+type BroadcastChatMessageMessage struct {
+	Chat ChatMessage
+}
+
+func (m BroadcastChatMessageMessage) Type() byte {
+	return BroadcastChatMessageType
+}
+
+func (m BroadcastChatMessageMessage) AppendEncode(dst []byte) ([]byte, error) {
+	dst = append(dst, m.Type())
+	var err error
+	if dst, err = appendChatMessage(dst, m.Chat); err != nil {
+		return dst, err
+	}
+	return dst, nil
+}
+
+func (m BroadcastChatMessageMessage) Encode() ([]byte, error) {
+	return encode(m)
+}
+
+func decodeBroadcastChatMessageMessage(r *reader) (Message, error) {
+	var m BroadcastChatMessageMessage
+	if err := decodeChatMessage(r, &m.Chat); err != nil {
+		return nil, err
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return m, nil
+}
+
+// BroadcastGunFireMessage is sent to all clients when a player fires a gun
+type BroadcastGunFireMessage struct {
+	Fire GunFire
+}
+
+func (m BroadcastGunFireMessage) Type() byte {
+	return BroadcastGunFireType
+}
+
+func (m BroadcastGunFireMessage) AppendEncode(dst []byte) ([]byte, error) {
+	dst = append(dst, m.Type())
+	var err error
+	if dst, err = appendGunFire(dst, m.Fire); err != nil {
+		return dst, err
+	}
+	return dst, nil
+}
+
+func (m BroadcastGunFireMessage) Encode() ([]byte, error) {
+	return encode(m)
+}
+
+func decodeBroadcastGunFireMessage(r *reader) (Message, error) {
+	var m BroadcastGunFireMessage
+	if err := decodeGunFire(r, &m.Fire); err != nil {
+		return nil, err
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return m, nil
+}
+
+// BroadcastHitReportMessage is sent to all clients when a player hits another player
+type BroadcastHitReportMessage struct {
+	Hit HitReport
+}
+
+func (m BroadcastHitReportMessage) Type() byte {
+	return BroadcastHitReportType
+}
+
+func (m BroadcastHitReportMessage) AppendEncode(dst []byte) ([]byte, error) {
+	dst = append(dst, m.Type())
+	var err error
+	if dst, err = appendHitReport(dst, m.Hit); err != nil {
+		return dst, err
+	}
+	return dst, nil
+}
+
+func (m BroadcastHitReportMessage) Encode() ([]byte, error) {
+	return encode(m)
+}
+
+func decodeBroadcastHitReportMessage(r *reader) (Message, error) {
+	var m BroadcastHitReportMessage
+	if err := decodeHitReport(r, &m.Hit); err != nil {
+		return nil, err
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return m, nil
+}
+
+// BroadcastPlayerJoinMessage is sent to all clients when a player joins the game
+type BroadcastPlayerJoinMessage struct {
+	PlayerID int32
+}
+
+func (m BroadcastPlayerJoinMessage) Type() byte {
+	return BroadcastPlayerJoinType
+}
+
+func (m BroadcastPlayerJoinMessage) AppendEncode(dst []byte) ([]byte, error) {
+	dst = append(dst, m.Type())
+	dst = appendInt32(dst, m.PlayerID)
+	return dst, nil
+}
+
+func (m BroadcastPlayerJoinMessage) Encode() ([]byte, error) {
+	return encode(m)
+}
+
+func decodeBroadcastPlayerJoinMessage(r *reader) (Message, error) {
+	var m BroadcastPlayerJoinMessage
+	m.PlayerID = r.int32()
+	if r.err != nil {
+		return nil, r.err
+	}
+	return m, nil
+}
+
+// BroadcastPlayerLeaveMessage is sent to all clients when a player leaves the game
+type BroadcastPlayerLeaveMessage struct {
+	PlayerID int32
+}
+
+func (m BroadcastPlayerLeaveMessage) Type() byte {
+	return BroadcastPlayerLeaveType
+}
+
+func (m BroadcastPlayerLeaveMessage) AppendEncode(dst []byte) ([]byte, error) {
+	dst = append(dst, m.Type())
+	dst = appendInt32(dst, m.PlayerID)
+	return dst, nil
+}
+
+func (m BroadcastPlayerLeaveMessage) Encode() ([]byte, error) {
+	return encode(m)
+}
+
+func decodeBroadcastPlayerLeaveMessage(r *reader) (Message, error) {
+	var m BroadcastPlayerLeaveMessage
+	m.PlayerID = r.int32()
+	if r.err != nil {
+		return nil, r.err
+	}
+	return m, nil
+}
+
+// InitialStateMessage is sent to a client when they first connect
+type InitialStateMessage struct {
+	Players []Player
+}
+
+func (m InitialStateMessage) Type() byte {
+	return InitialStateType
+}
+
+func (m InitialStateMessage) AppendEncode(dst []byte) ([]byte, error) {
+	dst = append(dst, m.Type())
+	var err error
+	dst = appendInt32(dst, int32(len(m.Players)))
+	for _, elem := range m.Players {
+		if dst, err = appendPlayer(dst, elem); err != nil {
+			return dst, err
+		}
+	}
+	return dst, nil
+}
+
+func (m InitialStateMessage) Encode() ([]byte, error) {
+	return encode(m)
+}
+
+func decodeInitialStateMessage(r *reader) (Message, error) {
+	var m InitialStateMessage
+	playersCount := r.length(int(r.int32()), 0, 49, "InitialStateMessage.Players")
+	m.Players = make([]Player, playersCount)
+	for i := range m.Players {
+		if err := decodePlayer(r, &m.Players[i]); err != nil {
+			return nil, err
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return m, nil
+}
+
+// BroadcastPlatformDestroyMessage is sent to all clients when a platform is destroyed
+type BroadcastPlatformDestroyMessage struct {
+	Destroy PlatformDestroy
+}
+
+func (m BroadcastPlatformDestroyMessage) Type() byte {
+	return BroadcastPlatformDestroyType
+}
+
+func (m BroadcastPlatformDestroyMessage) AppendEncode(dst []byte) ([]byte, error) {
+	dst = append(dst, m.Type())
+	var err error
+	if dst, err = appendPlatformDestroy(dst, m.Destroy); err != nil {
+		return dst, err
+	}
+	return dst, nil
+}
+
+func (m BroadcastPlatformDestroyMessage) Encode() ([]byte, error) {
+	return encode(m)
+}
+
+func decodeBroadcastPlatformDestroyMessage(r *reader) (Message, error) {
+	var m BroadcastPlatformDestroyMessage
+	if err := decodePlatformDestroy(r, &m.Destroy); err != nil {
+		return nil, err
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return m, nil
+}
+
+// BroadcastFragmentCreateMessage is sent to all clients when a fragment is created,
+// and again whenever a collision changes its motion
+type BroadcastFragmentCreateMessage struct {
+	Fragment Fragment
+}
+
+func (m BroadcastFragmentCreateMessage) Type() byte {
+	return BroadcastFragmentCreateType
+}
+
+func (m BroadcastFragmentCreateMessage) AppendEncode(dst []byte) ([]byte, error) {
+	dst = append(dst, m.Type())
+	var err error
+	if dst, err = appendFragment(dst, m.Fragment); err != nil {
+		return dst, err
+	}
+	return dst, nil
+}
+
+func (m BroadcastFragmentCreateMessage) Encode() ([]byte, error) {
+	return encode(m)
+}
+
+func decodeBroadcastFragmentCreateMessage(r *reader) (Message, error) {
+	var m BroadcastFragmentCreateMessage
+	if err := decodeFragment(r, &m.Fragment); err != nil {
+		return nil, err
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return m, nil
+}
+
+// BroadcastFragmentDestroyMessage is sent to all clients when a fragment is destroyed
+type BroadcastFragmentDestroyMessage struct {
+	Destroy FragmentDestroy
+}
+
+func (m BroadcastFragmentDestroyMessage) Type() byte {
+	return BroadcastFragmentDestroyType
+}
+
+func (m BroadcastFragmentDestroyMessage) AppendEncode(dst []byte) ([]byte, error) {
+	dst = append(dst, m.Type())
+	var err error
+	if dst, err = appendFragmentDestroy(dst, m.Destroy); err != nil {
+		return dst, err
+	}
+	return dst, nil
+}
+
+func (m BroadcastFragmentDestroyMessage) Encode() ([]byte, error) {
+	return encode(m)
+}
+
+func decodeBroadcastFragmentDestroyMessage(r *reader) (Message, error) {
+	var m BroadcastFragmentDestroyMessage
+	if err := decodeFragmentDestroy(r, &m.Destroy); err != nil {
+		return nil, err
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return m, nil
+}
+
+// BroadcastGunAttachmentMessage is sent to all clients when a gun is attached to a player
+type BroadcastGunAttachmentMessage struct {
+	Attachment GunAttachment
+}
+
+func (m BroadcastGunAttachmentMessage) Type() byte {
+	return BroadcastGunAttachmentType
+}
+
+func (m BroadcastGunAttachmentMessage) AppendEncode(dst []byte) ([]byte, error) {
+	dst = append(dst, m.Type())
+	var err error
+	if dst, err = appendGunAttachment(dst, m.Attachment); err != nil {
+		return dst, err
+	}
+	return dst, nil
+}
+
+func (m BroadcastGunAttachmentMessage) Encode() ([]byte, error) {
+	return encode(m)
+}
+
+func decodeBroadcastGunAttachmentMessage(r *reader) (Message, error) {
+	var m BroadcastGunAttachmentMessage
+	if err := decodeGunAttachment(r, &m.Attachment); err != nil {
+		return nil, err
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return m, nil
+}
+
+// ScoreboardUpdateMessage is sent when any player's kills, deaths or assists change
+type ScoreboardUpdateMessage struct {
+	Entries []ScoreEntry
+}
+
+func (m ScoreboardUpdateMessage) Type() byte {
+	return ScoreboardUpdateType
+}
+
+func (m ScoreboardUpdateMessage) AppendEncode(dst []byte) ([]byte, error) {
+	dst = append(dst, m.Type())
+	var err error
+	if len(m.Entries) > 65535 {
+		return dst, tooLong("ScoreboardUpdateMessage.Entries")
+	}
+	dst = appendUint16(dst, uint16(len(m.Entries)))
+	for _, elem := range m.Entries {
+		if dst, err = appendScoreEntry(dst, elem); err != nil {
+			return dst, err
+		}
+	}
+	return dst, nil
+}
+
+func (m ScoreboardUpdateMessage) Encode() ([]byte, error) {
+	return encode(m)
+}
+
+func decodeScoreboardUpdateMessage(r *reader) (Message, error) {
+	var m ScoreboardUpdateMessage
+	entriesCount := r.length(int(r.uint16()), 0, 20, "ScoreboardUpdateMessage.Entries")
+	m.Entries = make([]ScoreEntry, entriesCount)
+	for i := range m.Entries {
+		if err := decodeScoreEntry(r, &m.Entries[i]); err != nil {
+			return nil, err
+		}
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return m, nil
+}
+
+// MatchStateMessage is sent when the match changes phase and to joining players
+type MatchStateMessage struct {
+	State MatchState
+}
+
+func (m MatchStateMessage) Type() byte {
+	return MatchStateType
+}
+
+func (m MatchStateMessage) AppendEncode(dst []byte) ([]byte, error) {
+	dst = append(dst, m.Type())
+	var err error
+	if dst, err = appendMatchState(dst, m.State); err != nil {
+		return dst, err
+	}
+	return dst, nil
+}
+
+func (m MatchStateMessage) Encode() ([]byte, error) {
+	return encode(m)
+}
+
+func decodeMatchStateMessage(r *reader) (Message, error) {
+	var m MatchStateMessage
+	if err := decodeMatchState(r, &m.State); err != nil {
+		return nil, err
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return m, nil
+}
+
+// PlayerLeaveViewMessage is sent to a client when another player moves out of
+// its view radius; the client stops receiving updates about them until they
+// enter view again
+type PlayerLeaveViewMessage struct {
+	PlayerID int32
+}
+
+func (m PlayerLeaveViewMessage) Type() byte {
+	return PlayerLeaveViewType
+}
+
+func (m PlayerLeaveViewMessage) AppendEncode(dst []byte) ([]byte, error) {
+	dst = append(dst, m.Type())
+	dst = appendInt32(dst, m.PlayerID)
+	return dst, nil
+}
+
+func (m PlayerLeaveViewMessage) Encode() ([]byte, error) {
+	return encode(m)
+}
+
+func decodePlayerLeaveViewMessage(r *reader) (Message, error) {
+	var m PlayerLeaveViewMessage
+	m.PlayerID = r.int32()
+	if r.err != nil {
+		return nil, r.err
+	}
+	return m, nil
+}
+
+// ProjectileSpawnMessage is sent to all clients when the server spawns a
+// projectile, so they can simulate it the same way
+type ProjectileSpawnMessage struct {
+	Projectile Projectile
+}
+
+func (m ProjectileSpawnMessage) Type() byte {
+	return ProjectileSpawnType
+}
+
+func (m ProjectileSpawnMessage) AppendEncode(dst []byte) ([]byte, error) {
+	dst = append(dst, m.Type())
+	var err error
+	if dst, err = appendProjectile(dst, m.Projectile); err != nil {
+		return dst, err
+	}
+	return dst, nil
+}
+
+func (m ProjectileSpawnMessage) Encode() ([]byte, error) {
+	return encode(m)
+}
+
+func decodeProjectileSpawnMessage(r *reader) (Message, error) {
+	var m ProjectileSpawnMessage
+	if err := decodeProjectile(r, &m.Projectile); err != nil {
+		return nil, err
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return m, nil
+}
+
+// ProjectileImpactMessage is sent to all clients when a projectile hits a
+// platform or player, or reaches its range
+type ProjectileImpactMessage struct {
+	Impact ProjectileImpact
+}
+
+func (m ProjectileImpactMessage) Type() byte {
+	return ProjectileImpactType
+}
+
+func (m ProjectileImpactMessage) AppendEncode(dst []byte) ([]byte, error) {
+	dst = append(dst, m.Type())
+	var err error
+	if dst, err = appendProjectileImpact(dst, m.Impact); err != nil {
+		return dst, err
+	}
+	return dst, nil
+}
+
+func (m ProjectileImpactMessage) Encode() ([]byte, error) {
+	return encode(m)
+}
+
+func decodeProjectileImpactMessage(r *reader) (Message, error) {
+	var m ProjectileImpactMessage
+	if err := decodeProjectileImpact(r, &m.Impact); err != nil {
+		return nil, err
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return m, nil
+}
+
+// TerrainStateMessage is sent to a client joining a room whose terrain has
+// been shot at, so they see the same platforms and fragments as everyone else
+type TerrainStateMessage struct {
+	State TerrainState
+}
+
+func (m TerrainStateMessage) Type() byte {
+	return TerrainStateType
+}
+
+func (m TerrainStateMessage) AppendEncode(dst []byte) ([]byte, error) {
+	dst = append(dst, m.Type())
+	var err error
+	if dst, err = appendTerrainState(dst, m.State); err != nil {
+		return dst, err
+	}
+	return dst, nil
+}
+
+func (m TerrainStateMessage) Encode() ([]byte, error) {
+	return encode(m)
+}
+
+func decodeTerrainStateMessage(r *reader) (Message, error) {
+	var m TerrainStateMessage
+	if err := decodeTerrainState(r, &m.State); err != nil {
+		return nil, err
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return m, nil
+}
+
+// PlatformRestoreMessage is sent to all clients when a destroyed platform
+// grows back
+type PlatformRestoreMessage struct {
+	PlatformID int32
+}
+
+func (m PlatformRestoreMessage) Type() byte {
+	return PlatformRestoreType
+}
+
+func (m PlatformRestoreMessage) AppendEncode(dst []byte) ([]byte, error) {
+	dst = append(dst, m.Type())
+	dst = appendInt32(dst, m.PlatformID)
+	return dst, nil
+}
+
+func (m PlatformRestoreMessage) Encode() ([]byte, error) {
+	return encode(m)
+}
+
+func decodePlatformRestoreMessage(r *reader) (Message, error) {
+	var m PlatformRestoreMessage
+	m.PlatformID = r.int32()
+	if r.err != nil {
+		return nil, r.err
+	}
+	return m, nil
+}
+
+// WelcomeMessage accepts a client's Hello. It is the first message the
+// server sends on a connection.
+type WelcomeMessage struct {
+	Welcome Welcome
+}
+
+func (m WelcomeMessage) Type() byte {
+	return WelcomeType
+}
+
+func (m WelcomeMessage) AppendEncode(dst []byte) ([]byte, error) {
+	dst = append(dst, m.Type())
+	var err error
+	if dst, err = appendWelcome(dst, m.Welcome); err != nil {
+		return dst, err
+	}
+	return dst, nil
+}
+
+func (m WelcomeMessage) Encode() ([]byte, error) {
+	return encode(m)
+}
+
+func decodeWelcomeMessage(r *reader) (Message, error) {
+	var m WelcomeMessage
+	if err := decodeWelcome(r, &m.Welcome); err != nil {
+		return nil, err
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+	return m, nil
+}
+
+// DecodeMessage decodes a binary message into a Message. The quantized
+// message types need the quantization area and are decoded by
+// Quantization.DecodeMessage instead. Errors wrap ErrTruncated, ErrTooLong,
+// ErrTrailingBytes or ErrUnknownType when the message is malformed.
+func DecodeMessage(data []byte) (Message, error) {
+	if len(data) == 0 {
+		return nil, ErrTruncated
+	}
+
+	r := &reader{data: data[1:]}
+	switch data[0] {
+	case PlayerUpdateType:
+		return r.finish(decodePlayerUpdateMessage(r))
+	case ChatMessageType:
+		return r.finish(decodeChatMessageMessage(r))
+	case GunFireType:
+		return r.finish(decodeGunFireMessage(r))
+	case HitReportType:
+		return r.finish(decodeHitReportMessage(r))
+	case PlayerJoinType:
+		return r.finish(decodePlayerJoinMessage(r))
+	case PlayerLeaveType:
+		return r.finish(decodePlayerLeaveMessage(r))
+	case PlatformDestroyType:
+		return r.finish(decodePlatformDestroyMessage(r))
+	case FragmentCreateType:
+		return r.finish(decodeFragmentCreateMessage(r))
+	case FragmentDestroyType:
+		return r.finish(decodeFragmentDestroyMessage(r))
+	case GunAttachmentType:
+		return r.finish(decodeGunAttachmentMessage(r))
+	case InputCommandType:
+		return r.finish(decodeInputCommandMessage(r))
+	case TeamSwitchType:
+		return r.finish(decodeTeamSwitchMessage(r))
+	case SnapshotAckType:
+		return r.finish(decodeSnapshotAckMessage(r))
+	case HelloType:
+		return r.finish(decodeHelloMessage(r))
+	case BroadcastPlayerUpdateType:
+		return r.finish(decodeBroadcastPlayerUpdateMessage(r))
+	case BroadcastChatMessageType:
+		return r.finish(decodeBroadcastChatMessageMessage(r))
+	case BroadcastGunFireType:
+		return r.finish(decodeBroadcastGunFireMessage(r))
+	case BroadcastHitReportType:
+		return r.finish(decodeBroadcastHitReportMessage(r))
+	case BroadcastPlayerJoinType:
+		return r.finish(decodeBroadcastPlayerJoinMessage(r))
+	case BroadcastPlayerLeaveType:
+		return r.finish(decodeBroadcastPlayerLeaveMessage(r))
+	case InitialStateType:
+		return r.finish(decodeInitialStateMessage(r))
+	case BroadcastPlatformDestroyType:
+		return r.finish(decodeBroadcastPlatformDestroyMessage(r))
+	case BroadcastFragmentCreateType:
+		return r.finish(decodeBroadcastFragmentCreateMessage(r))
+	case BroadcastFragmentDestroyType:
+		return r.finish(decodeBroadcastFragmentDestroyMessage(r))
+	case BroadcastGunAttachmentType:
+		return r.finish(decodeBroadcastGunAttachmentMessage(r))
+	case WorldSnapshotType:
+		return r.finish(decodeWorldSnapshotMessage(r))
+	case ScoreboardUpdateType:
+		return r.finish(decodeScoreboardUpdateMessage(r))
+	case MatchStateType:
+		return r.finish(decodeMatchStateMessage(r))
+	case QuantizationType:
+		return r.finish(decodeQuantizationMessage(r))
+	case PlayerEnterViewType:
+		return r.finish(decodePlayerEnterViewMessage(r))
+	case PlayerLeaveViewType:
+		return r.finish(decodePlayerLeaveViewMessage(r))
+	case ProjectileSpawnType:
+		return r.finish(decodeProjectileSpawnMessage(r))
+	case ProjectileImpactType:
+		return r.finish(decodeProjectileImpactMessage(r))
+	case TerrainStateType:
+		return r.finish(decodeTerrainStateMessage(r))
+	case PlatformRestoreType:
+		return r.finish(decodePlatformRestoreMessage(r))
+	case WelcomeType:
+		return r.finish(decodeWelcomeMessage(r))
+	case BundleType:
+		return r.finish(decodeBundleMessage(r))
+	default:
+		return nil, fmt.Errorf("%w %d", ErrUnknownType, data[0])
+	}
+}
@@ -1,118 +1,69 @@
 package protocol
 
 import (
-	"bytes"
-	"encoding/binary"
 	"errors"
-	"io"
 	"fmt"
 )
 
-// Message types
-const (
-	// Client -> Server messages
-	PlayerUpdateType  byte = 1
-	ChatMessageType   byte = 2
-	GunFireType       byte = 3
-	HitReportType     byte = 4
-	PlayerJoinType    byte = 5
-	PlayerLeaveType   byte = 6
-	PlatformDestroyType byte = 7
-	FragmentCreateType byte = 8
-	FragmentDestroyType byte = 9
-	GunAttachmentType byte = 10
-
-	// Server -> Client messages
-	BroadcastPlayerUpdateType byte = 101
-	BroadcastChatMessageType  byte = 102
-	BroadcastGunFireType      byte = 103
-	BroadcastHitReportType    byte = 104
-	BroadcastPlayerJoinType   byte = 105
-	BroadcastPlayerLeaveType  byte = 106
-	InitialStateType          byte = 107
-	BroadcastPlatformDestroyType byte = 108
-	BroadcastFragmentCreateType byte = 109
-	BroadcastFragmentDestroyType byte = 110
-	BroadcastGunAttachmentType byte = 111
-)
-
-// Player represents a player in the game
-type Player struct {
-	ID           int32
-	Name         string
-	X            float32
-	Y            float32
-	Width        float32
-	Height       float32
-	ColorR       float32
-	ColorG       float32
-	ColorB       float32
-	ColorA       float32
-	Health       float32
-	MaxHealth    float32
-	IsDead       bool
-	Direction    float32
-	FaceDirection int32
-	VelocityX    float32
-	VelocityY    float32
-}
+// Message types, the structs they share and the encoders and decoders of
+// most messages are generated from schema.json into messages_gen.go and the
+// client's BinaryMessages.js. This file holds the messages the schema marks
+// as custom.
+//go:generate go run ./gen -schema schema.json -go messages_gen.go -js ../../client/src/systems/BinaryMessages.js
 
-// ChatMessage represents a chat message
-type ChatMessage struct {
-	PlayerID int32
-	Message  string
-}
+// MaxBundleSize is the encoded size SplitBundles keeps bundles under
+const MaxBundleSize = 16 * 1024
 
-// GunFire represents a gun firing event
-type GunFire struct {
-	PlayerID int32
-	X        float32
-	Y        float32
-	Angle    float32
-	Damage   float32
-}
+// Input button flags
+const (
+	InputJump byte = 1 << 0
+	InputFire byte = 1 << 1
+)
 
-// HitReport represents a hit report
-type HitReport struct {
-	ShooterID int32
-	TargetID  int32
-	Damage    float32
+// InputCommand is one frame of player input. Clients send these instead of
+// their position so the server can simulate movement itself.
+type InputCommand struct {
+	Sequence uint32  // Increases by one per command; echoed back in snapshots
+	Tick     uint32  // Latest snapshot tick the client had applied when sampling
+	MoveX    float32 // Horizontal axis, -1 (left) to 1 (right)
+	MoveY    float32 // Vertical axis, -1 (up) to 1 (down)
+	Jump     bool
+	AimAngle float32 // Aim direction in radians
+	Fire     bool
 }
 
-// PlatformDestroy represents a platform destruction event
-type PlatformDestroy struct {
-	PlatformID int32
-	ShooterID  int32
-}
+// Match phases, in the order a match goes through them
+const (
+	MatchPhaseWarmup byte = 0
+	MatchPhaseLive   byte = 1
+	MatchPhaseEnded  byte = 2
+)
 
-// Fragment represents a fragment created from a destroyed platform
-type Fragment struct {
-	ID             int32
-	OriginalEntityID int32
-	X              float32
-	Y              float32
-	Width          float32
-	Height         float32
-	VelocityX      float32
-	VelocityY      float32
-	ColorR         float32
-	ColorG         float32
-	ColorB         float32
-	ColorA         float32
-}
+// Game modes carried in MatchState
+const (
+	GameModeFreePlay       byte = 0
+	GameModeDeathMatch     byte = 1
+	GameModeTeamDeathMatch byte = 2
+)
 
-// GunAttachment represents a gun attachment to a player
-type GunAttachment struct {
-	GunID    int32
-	PlayerID int32
-	OffsetX  float32
-	OffsetY  float32
-	Rotation float32
-}
+// What a projectile stopped at
+const (
+	ImpactExpired  byte = 0 // Reached the weapon's range
+	ImpactPlatform byte = 1
+	ImpactPlayer   byte = 2
+)
 
 // Message is the interface for all protocol messages
 type Message interface {
 	Type() byte
+
+	// AppendEncode appends the encoded message to dst and returns the
+	// extended buffer. Encoding into a reused buffer does not allocate. When
+	// a field is too long for the wire format it returns an error along with
+	// the buffer, so the buffer can still be reused.
+	AppendEncode(dst []byte) ([]byte, error)
+
+	// Encode returns the encoded message in a buffer of its own
 	Encode() ([]byte, error)
 }
 
@@ -121,1272 +72,280 @@ type Decoder interface {
 	Decode([]byte) (Message, error)
 }
 
-// PlayerUpdateMessage is sent when a player's state changes
-type PlayerUpdateMessage struct {
-	Player Player
-}
-
-func (m PlayerUpdateMessage) Type() byte {
-	return PlayerUpdateType
-}
-
-func (m PlayerUpdateMessage) Encode() ([]byte, error) {
-	buf := new(bytes.Buffer)
-	
-	// Write message type
-	if err := binary.Write(buf, binary.LittleEndian, m.Type()); err != nil {
-		return nil, err
-	}
-	
-	// Write player ID
-	if err := binary.Write(buf, binary.LittleEndian, m.Player.ID); err != nil {
-		return nil, err
-	}
-	
-	// Write player name length and name
-	nameBytes := []byte(m.Player.Name)
-	nameLen := int32(len(nameBytes))
-	if err := binary.Write(buf, binary.LittleEndian, nameLen); err != nil {
-		return nil, err
-	}
-	if _, err := buf.Write(nameBytes); err != nil {
-		return nil, err
-	}
-	
-	// Write player position and dimensions
-	if err := binary.Write(buf, binary.LittleEndian, m.Player.X); err != nil {
-		return nil, err
-	}
-	if err := binary.Write(buf, binary.LittleEndian, m.Player.Y); err != nil {
-		return nil, err
-	}
-	if err := binary.Write(buf, binary.LittleEndian, m.Player.Width); err != nil {
-		return nil, err
-	}
-	if err := binary.Write(buf, binary.LittleEndian, m.Player.Height); err != nil {
-		return nil, err
-	}
-	
-	// Write player color
-	if err := binary.Write(buf, binary.LittleEndian, m.Player.ColorR); err != nil {
-		return nil, err
-	}
-	if err := binary.Write(buf, binary.LittleEndian, m.Player.ColorG); err != nil {
-		return nil, err
-	}
-	if err := binary.Write(buf, binary.LittleEndian, m.Player.ColorB); err != nil {
-		return nil, err
-	}
-	if err := binary.Write(buf, binary.LittleEndian, m.Player.ColorA); err != nil {
-		return nil, err
-	}
-	
-	// Write player health
-	if err := binary.Write(buf, binary.LittleEndian, m.Player.Health); err != nil {
-		return nil, err
-	}
-	if err := binary.Write(buf, binary.LittleEndian, m.Player.MaxHealth); err != nil {
-		return nil, err
-	}
-	
-	// Write player is dead flag
-	isDead := byte(0)
-	if m.Player.IsDead {
-		isDead = 1
-	}
-	if err := binary.Write(buf, binary.LittleEndian, isDead); err != nil {
-		return nil, err
-	}
-	
-	// Write player direction and face direction
-	if err := binary.Write(buf, binary.LittleEndian, m.Player.Direction); err != nil {
-		return nil, err
-	}
-	if err := binary.Write(buf, binary.LittleEndian, m.Player.FaceDirection); err != nil {
-		return nil, err
-	}
-	
-	// Write player velocity
-	if err := binary.Write(buf, binary.LittleEndian, m.Player.VelocityX); err != nil {
-		return nil, err
-	}
-	if err := binary.Write(buf, binary.LittleEndian, m.Player.VelocityY); err != nil {
-		return nil, err
-	}
-	
-	return buf.Bytes(), nil
-}
-
-// BroadcastPlayerUpdateMessage is sent to all clients when a player's state changes
-type BroadcastPlayerUpdateMessage struct {
-	Player Player
+// WorldSnapshotMessage is sent to every client once per simulation tick. It
+// carries each player's state as a delta against the last snapshot the
+// client acknowledged, or in full when the client has no usable baseline.
+type WorldSnapshotMessage struct {
+	Tick         uint32
+	BaselineTick uint32 // Snapshot the deltas are relative to (0 = none; players are sent in full)
+	// Last input command sequence the server applied for the receiving client,
+	// so it can drop acknowledged inputs and replay the rest on top of its own state
+	LastInputSequence uint32
+	Players           []PlayerDelta // Players that changed since the baseline
+	Removed           []int32       // Players in the baseline that are no longer sent
 }
 
-func (m BroadcastPlayerUpdateMessage) Type() byte {
-	return BroadcastPlayerUpdateType
+func (m WorldSnapshotMessage) Type() byte {
+	return WorldSnapshotType
 }
 
-func (m BroadcastPlayerUpdateMessage) Encode() ([]byte, error) {
-	buf := new(bytes.Buffer)
-	
+func (m WorldSnapshotMessage) AppendEncode(dst []byte) ([]byte, error) {
 	// Write message type
-	if err := binary.Write(buf, binary.LittleEndian, m.Type()); err != nil {
-		return nil, err
-	}
-	
-	// Write player ID
-	if err := binary.Write(buf, binary.LittleEndian, m.Player.ID); err != nil {
-		return nil, err
-	}
-	
-	// Write player name length and name
-	nameBytes := []byte(m.Player.Name)
-	nameLen := int32(len(nameBytes))
-	if err := binary.Write(buf, binary.LittleEndian, nameLen); err != nil {
-		return nil, err
-	}
-	if _, err := buf.Write(nameBytes); err != nil {
-		return nil, err
-	}
-	
-	// Write player position and dimensions
-	if err := binary.Write(buf, binary.LittleEndian, m.Player.X); err != nil {
-		return nil, err
-	}
-	if err := binary.Write(buf, binary.LittleEndian, m.Player.Y); err != nil {
-		return nil, err
-	}
-	if err := binary.Write(buf, binary.LittleEndian, m.Player.Width); err != nil {
-		return nil, err
-	}
-	if err := binary.Write(buf, binary.LittleEndian, m.Player.Height); err != nil {
-		return nil, err
-	}
-	
-	// Write player color
-	if err := binary.Write(buf, binary.LittleEndian, m.Player.ColorR); err != nil {
-		return nil, err
-	}
-	if err := binary.Write(buf, binary.LittleEndian, m.Player.ColorG); err != nil {
-		return nil, err
-	}
-	if err := binary.Write(buf, binary.LittleEndian, m.Player.ColorB); err != nil {
-		return nil, err
-	}
-	if err := binary.Write(buf, binary.LittleEndian, m.Player.ColorA); err != nil {
-		return nil, err
-	}
+	dst = append(dst, m.Type())
 	
-	// Write player health
-	if err := binary.Write(buf, binary.LittleEndian, m.Player.Health); err != nil {
-		return nil, err
-	}
-	if err := binary.Write(buf, binary.LittleEndian, m.Player.MaxHealth); err != nil {
-		return nil, err
-	}
+	// Write tick number, baseline and acknowledged input sequence
+	dst = appendUint32(dst, m.Tick)
+	dst = appendUint32(dst, m.BaselineTick)
+	dst = appendUint32(dst, m.LastInputSequence)
 	
-	// Write player is dead flag
-	isDead := byte(0)
-	if m.Player.IsDead {
-		isDead = 1
+	// Write number of players
+	if len(m.Players) > 0xFFFF {
+		return dst, tooLong("WorldSnapshotMessage.Players")
 	}
-	if err := binary.Write(buf, binary.LittleEndian, isDead); err != nil {
-		return nil, err
+	if len(m.Removed) > 0xFFFF {
+		return dst, tooLong("WorldSnapshotMessage.Removed")
 	}
+	dst = appendUint16(dst, uint16(len(m.Players)))
 	
-	// Write player direction and face direction
-	if err := binary.Write(buf, binary.LittleEndian, m.Player.Direction); err != nil {
-		return nil, err
-	}
-	if err := binary.Write(buf, binary.LittleEndian, m.Player.FaceDirection); err != nil {
-		return nil, err
+	// Write each player's changed fields
+	for _, delta := range m.Players {
+		var err error
+		if dst, err = appendPlayerDelta(dst, delta); err != nil {
+			return dst, err
+		}
 	}
 	
-	// Write player velocity
-	if err := binary.Write(buf, binary.LittleEndian, m.Player.VelocityX); err != nil {
-		return nil, err
-	}
-	if err := binary.Write(buf, binary.LittleEndian, m.Player.VelocityY); err != nil {
-		return nil, err
+	// Write removed players
+	dst = appendUint16(dst, uint16(len(m.Removed)))
+	for _, playerID := range m.Removed {
+		dst = appendInt32(dst, playerID)
 	}
 	
-	return buf.Bytes(), nil
+	return dst, nil
 }
 
-// ChatMessageMessage is sent when a player sends a chat message
-type ChatMessageMessage struct {
-	Chat ChatMessage
+func (m WorldSnapshotMessage) Encode() ([]byte, error) {
+	return encode(m)
 }
 
-func (m ChatMessageMessage) Type() byte {
-	return ChatMessageType
-}
-
-func (m ChatMessageMessage) Encode() ([]byte, error) {
-	buf := new(bytes.Buffer)
+func decodeWorldSnapshotMessage(r *reader) (Message, error) {
+	var m WorldSnapshotMessage
 	
-	// Write message type
-	if err := binary.Write(buf, binary.LittleEndian, m.Type()); err != nil {
-		return nil, err
-	}
+	// Read tick number, baseline and acknowledged input sequence
+	m.Tick = r.uint32()
+	m.BaselineTick = r.uint32()
+	m.LastInputSequence = r.uint32()
 	
-	// Write player ID
-	if err := binary.Write(buf, binary.LittleEndian, m.Chat.PlayerID); err != nil {
-		return nil, err
+	// Read each player's changed fields
+	playerCount := r.length(int(r.uint16()), 0, minPlayerDeltaSize, "WorldSnapshotMessage.Players")
+	m.Players = make([]PlayerDelta, 0, playerCount)
+	for i := 0; i < playerCount; i++ {
+		delta, err := decodePlayerDelta(r)
+		if err != nil {
+			return nil, err
+		}
+		m.Players = append(m.Players, delta)
 	}
 	
-	// Write message length and message
-	msgBytes := []byte(m.Chat.Message)
-	msgLen := int32(len(msgBytes))
-	if err := binary.Write(buf, binary.LittleEndian, msgLen); err != nil {
-		return nil, err
+	// Read removed players
+	removedCount := r.length(int(r.uint16()), 0, 4, "WorldSnapshotMessage.Removed")
+	m.Removed = make([]int32, removedCount)
+	for i := range m.Removed {
+		m.Removed[i] = r.int32()
 	}
-	if _, err := buf.Write(msgBytes); err != nil {
-		return nil, err
+	if r.err != nil {
+		return nil, r.err
 	}
 	
-	return buf.Bytes(), nil
+	return m, nil
 }
 
-// BroadcastChatMessageMessage is sent to all clients when a player sends a chat message
-type BroadcastChatMessageMessage struct {
-	Chat ChatMessage
+// PlayerEnterViewMessage is sent to a client when another player comes within
+// its view radius, with the player's full state so the client can spawn them
+type PlayerEnterViewMessage struct {
+	Player Player
 }
 
-func (m BroadcastChatMessageMessage) Type() byte {
-	return BroadcastChatMessageType
+func (m PlayerEnterViewMessage) Type() byte {
+	return PlayerEnterViewType
 }
 
-func (m BroadcastChatMessageMessage) Encode() ([]byte, error) {
-	buf := new(bytes.Buffer)
-	
+func (m PlayerEnterViewMessage) AppendEncode(dst []byte) ([]byte, error) {
 	// Write message type
-	if err := binary.Write(buf, binary.LittleEndian, m.Type()); err != nil {
-		return nil, err
-	}
-	
-	// Write player ID
-	if err := binary.Write(buf, binary.LittleEndian, m.Chat.PlayerID); err != nil {
-		return nil, err
-	}
-	
-	// Write message length and message
-	msgBytes := []byte(m.Chat.Message)
-	msgLen := int32(len(msgBytes))
-	if err := binary.Write(buf, binary.LittleEndian, msgLen); err != nil {
-		return nil, err
-	}
-	if _, err := buf.Write(msgBytes); err != nil {
-		return nil, err
-	}
+	dst = append(dst, m.Type())
 	
-	return buf.Bytes(), nil
-}
-
-// GunFireMessage is sent when a player fires a gun
-type GunFireMessage struct {
-	Fire GunFire
+	// Write every field of the player
+	return appendPlayerDelta(dst, PlayerDelta{Fields: PlayerFieldsAll, Player: m.Player})
 }
 
-func (m GunFireMessage) Type() byte {
-	return GunFireType
+func (m PlayerEnterViewMessage) Encode() ([]byte, error) {
+	return encode(m)
 }
 
-func (m GunFireMessage) Encode() ([]byte, error) {
-	buf := new(bytes.Buffer)
-	
-	// Write message type
-	if err := binary.Write(buf, binary.LittleEndian, m.Type()); err != nil {
-		return nil, err
-	}
-	
-	// Write player ID
-	if err := binary.Write(buf, binary.LittleEndian, m.Fire.PlayerID); err != nil {
-		return nil, err
-	}
-	
-	// Write position and angle
-	if err := binary.Write(buf, binary.LittleEndian, m.Fire.X); err != nil {
+func decodePlayerEnterViewMessage(r *reader) (Message, error) {
+	// Read the player's fields
+	delta, err := decodePlayerDelta(r)
+	if err != nil {
 		return nil, err
 	}
-	if err := binary.Write(buf, binary.LittleEndian, m.Fire.Y); err != nil {
-		return nil, err
-	}
-	if err := binary.Write(buf, binary.LittleEndian, m.Fire.Angle); err != nil {
-		return nil, err
-	}
-	if err := binary.Write(buf, binary.LittleEndian, m.Fire.Damage); err != nil {
-		return nil, err
+	if delta.Fields != PlayerFieldsAll {
+		return nil, errors.New("player entering view without full state")
 	}
 	
-	return buf.Bytes(), nil
+	return PlayerEnterViewMessage{Player: delta.Player}, nil
 }
 
-// BroadcastGunFireMessage is sent to all clients when a player fires a gun
-type BroadcastGunFireMessage struct {
-	Fire GunFire
+// InputCommandMessage is sent by clients once per input frame
+type InputCommandMessage struct {
+	Input InputCommand
 }
 
-func (m BroadcastGunFireMessage) Type() byte {
-	return BroadcastGunFireType
+func (m InputCommandMessage) Type() byte {
+	return InputCommandType
 }
 
-func (m BroadcastGunFireMessage) Encode() ([]byte, error) {
-	buf := new(bytes.Buffer)
-	
+func (m InputCommandMessage) AppendEncode(dst []byte) ([]byte, error) {
 	// Write message type
-	if err := binary.Write(buf, binary.LittleEndian, m.Type()); err != nil {
-		return nil, err
-	}
+	dst = append(dst, m.Type())
 	
-	// Write player ID
-	if err := binary.Write(buf, binary.LittleEndian, m.Fire.PlayerID); err != nil {
-		return nil, err
-	}
-	
-	// Write position and angle
-	if err := binary.Write(buf, binary.LittleEndian, m.Fire.X); err != nil {
-		return nil, err
-	}
-	if err := binary.Write(buf, binary.LittleEndian, m.Fire.Y); err != nil {
-		return nil, err
-	}
-	if err := binary.Write(buf, binary.LittleEndian, m.Fire.Angle); err != nil {
-		return nil, err
-	}
-	if err := binary.Write(buf, binary.LittleEndian, m.Fire.Damage); err != nil {
-		return nil, err
-	}
+	// Write sequence number and tick
+	dst = appendUint32(dst, m.Input.Sequence)
+	dst = appendUint32(dst, m.Input.Tick)
 	
-	return buf.Bytes(), nil
-}
-
-// HitReportMessage is sent when a player hits another player
-type HitReportMessage struct {
-	Hit HitReport
-}
-
-func (m HitReportMessage) Type() byte {
-	return HitReportType
-}
-
-func (m HitReportMessage) Encode() ([]byte, error) {
-	buf := new(bytes.Buffer)
+	// Write movement axes
+	dst = appendFloat32(dst, m.Input.MoveX)
+	dst = appendFloat32(dst, m.Input.MoveY)
 	
-	// Write message type
-	if err := binary.Write(buf, binary.LittleEndian, m.Type()); err != nil {
-		return nil, err
-	}
+	// Write aim angle
+	dst = appendFloat32(dst, m.Input.AimAngle)
 	
-	// Write shooter and target IDs
-	if err := binary.Write(buf, binary.LittleEndian, m.Hit.ShooterID); err != nil {
-		return nil, err
-	}
-	if err := binary.Write(buf, binary.LittleEndian, m.Hit.TargetID); err != nil {
-		return nil, err
+	// Write button flags
+	var buttons byte
+	if m.Input.Jump {
+		buttons |= InputJump
 	}
-	
-	// Write damage
-	if err := binary.Write(buf, binary.LittleEndian, m.Hit.Damage); err != nil {
-		return nil, err
+	if m.Input.Fire {
+		buttons |= InputFire
 	}
+	dst = append(dst, buttons)
 	
-	return buf.Bytes(), nil
-}
-
-// BroadcastHitReportMessage is sent to all clients when a player hits another player
-type BroadcastHitReportMessage struct {
-	Hit HitReport
+	return dst, nil
 }
 
-func (m BroadcastHitReportMessage) Type() byte {
-	return BroadcastHitReportType
+func (m InputCommandMessage) Encode() ([]byte, error) {
+	return encode(m)
 }
 
-func (m BroadcastHitReportMessage) Encode() ([]byte, error) {
-	buf := new(bytes.Buffer)
-	
-	// Write message type
-	if err := binary.Write(buf, binary.LittleEndian, m.Type()); err != nil {
-		return nil, err
-	}
-	
-	// Write shooter and target IDs
-	if err := binary.Write(buf, binary.LittleEndian, m.Hit.ShooterID); err != nil {
-		return nil, err
-	}
-	if err := binary.Write(buf, binary.LittleEndian, m.Hit.TargetID); err != nil {
-		return nil, err
-	}
+func decodeInputCommandMessage(r *reader) (Message, error) {
+	var input InputCommand
 	
-	// Write damage
-	if err := binary.Write(buf, binary.LittleEndian, m.Hit.Damage); err != nil {
-		return nil, err
-	}
+	// Read sequence number and tick
+	input.Sequence = r.uint32()
+	input.Tick = r.uint32()
 	
-	return buf.Bytes(), nil
-}
-
-// PlayerJoinMessage is sent when a player joins the game
-type PlayerJoinMessage struct {
-	PlayerID int32
-}
-
-func (m PlayerJoinMessage) Type() byte {
-	return PlayerJoinType
-}
-
-func (m PlayerJoinMessage) Encode() ([]byte, error) {
-	buf := new(bytes.Buffer)
+	// Read movement axes
+	input.MoveX = r.float32()
+	input.MoveY = r.float32()
 	
-	// Write message type
-	if err := binary.Write(buf, binary.LittleEndian, m.Type()); err != nil {
-		return nil, err
-	}
+	// Read aim angle
+	input.AimAngle = r.float32()
 	
-	// Write player ID
-	if err := binary.Write(buf, binary.LittleEndian, m.PlayerID); err != nil {
-		return nil, err
+	// Read button flags
+	buttons := r.uint8()
+	input.Jump = buttons&InputJump != 0
+	input.Fire = buttons&InputFire != 0
+	if r.err != nil {
+		return nil, r.err
 	}
 	
-	return buf.Bytes(), nil
+	return InputCommandMessage{Input: input}, nil
 }
 
-// BroadcastPlayerJoinMessage is sent to all clients when a player joins the game
-type BroadcastPlayerJoinMessage struct {
-	PlayerID int32
+// BundleMessage packs several encoded messages into a single WebSocket frame
+type BundleMessage struct {
+	// Encoded messages, each starting with its own type byte. Decoded
+	// bundles share their messages' memory with the frame they came in.
+	Messages [][]byte
 }
 
-func (m BroadcastPlayerJoinMessage) Type() byte {
-	return BroadcastPlayerJoinType
+func (m BundleMessage) Type() byte {
+	return BundleType
 }
 
-func (m BroadcastPlayerJoinMessage) Encode() ([]byte, error) {
-	buf := new(bytes.Buffer)
-	
+func (m BundleMessage) AppendEncode(dst []byte) ([]byte, error) {
 	// Write message type
-	if err := binary.Write(buf, binary.LittleEndian, m.Type()); err != nil {
-		return nil, err
-	}
-	
-	// Write player ID
-	if err := binary.Write(buf, binary.LittleEndian, m.PlayerID); err != nil {
-		return nil, err
-	}
-	
-	return buf.Bytes(), nil
-}
-
-// PlayerLeaveMessage is sent when a player leaves the game
-type PlayerLeaveMessage struct {
-	PlayerID int32
-}
-
-func (m PlayerLeaveMessage) Type() byte {
-	return PlayerLeaveType
-}
-
-func (m PlayerLeaveMessage) Encode() ([]byte, error) {
-	buf := new(bytes.Buffer)
+	dst = append(dst, m.Type())
 	
-	// Write message type
-	if err := binary.Write(buf, binary.LittleEndian, m.Type()); err != nil {
-		return nil, err
+	// Write number of messages
+	if len(m.Messages) > 0xFFFF {
+		return dst, tooLong("BundleMessage.Messages")
 	}
+	dst = appendUint16(dst, uint16(len(m.Messages)))
 	
-	// Write player ID
-	if err := binary.Write(buf, binary.LittleEndian, m.PlayerID); err != nil {
-		return nil, err
+	// Write each message with its length in front
+	for _, data := range m.Messages {
+		dst = appendUint32(dst, uint32(len(data)))
+		dst = append(dst, data...)
 	}
 	
-	return buf.Bytes(), nil
+	return dst, nil
 }
 
-// BroadcastPlayerLeaveMessage is sent to all clients when a player leaves the game
-type BroadcastPlayerLeaveMessage struct {
-	PlayerID int32
+func (m BundleMessage) Encode() ([]byte, error) {
+	return encode(m)
 }
 
-func (m BroadcastPlayerLeaveMessage) Type() byte {
-	return BroadcastPlayerLeaveType
-}
-
-func (m BroadcastPlayerLeaveMessage) Encode() ([]byte, error) {
-	buf := new(bytes.Buffer)
+func decodeBundleMessage(r *reader) (Message, error) {
+	// Read number of messages, each at least a length and a type
+	count := r.length(int(r.uint16()), 0, 4+1, "BundleMessage.Messages")
 	
-	// Write message type
-	if err := binary.Write(buf, binary.LittleEndian, m.Type()); err != nil {
-		return nil, err
+	// Read each message; the lengths must fit in what is left of the frame
+	messages := make([][]byte, 0, count)
+	for i := 0; i < count; i++ {
+		length := r.length(int(r.uint32()), 0, 1, "BundleMessage.Messages")
+		if r.err != nil {
+			return nil, r.err
+		}
+		if length == 0 {
+			return nil, fmt.Errorf("BundleMessage.Messages: %w", ErrTruncated)
+		}
+		data := r.bytes(length)
+		if data[0] == BundleType {
+			return nil, errors.New("bundles cannot be nested")
+		}
+		messages = append(messages, data)
 	}
-	
-	// Write player ID
-	if err := binary.Write(buf, binary.LittleEndian, m.PlayerID); err != nil {
-		return nil, err
+	if r.err != nil {
+		return nil, r.err
 	}
 	
-	return buf.Bytes(), nil
-}
-
-// InitialStateMessage is sent to a client when they first connect
-type InitialStateMessage struct {
-	Players []Player
+	return BundleMessage{Messages: messages}, nil
 }
 
-func (m InitialStateMessage) Type() byte {
-	return InitialStateType
-}
+// bundleOverhead is the encoded size of a bundle's type and count
+const bundleOverhead = 1 + 2
 
-func (m InitialStateMessage) Encode() ([]byte, error) {
-	buf := new(bytes.Buffer)
+// SplitBundles packs encoded messages, in order, into as few bundles as
+// possible with each bundle's encoded size at most maxSize. A message too
+// big to share a bundle under maxSize gets a bundle of its own.
+func SplitBundles(messages [][]byte, maxSize int) []BundleMessage {
+	var bundles []BundleMessage
+	var current BundleMessage
+	size := bundleOverhead
 	
-	// Write message type
-	if err := binary.Write(buf, binary.LittleEndian, m.Type()); err != nil {
-		return nil, err
+	for _, data := range messages {
+		entrySize := 4 + len(data)
+		if len(current.Messages) > 0 && (size+entrySize > maxSize || len(current.Messages) == 0xFFFF) {
+			bundles = append(bundles, current)
+			current = BundleMessage{}
+			size = bundleOverhead
+		}
+		current.Messages = append(current.Messages, data)
+		size += entrySize
 	}
-	
-	// Write number of players
-	playerCount := int32(len(m.Players))
-	if err := binary.Write(buf, binary.LittleEndian, playerCount); err != nil {
-		return nil, err
+	if len(current.Messages) > 0 {
+		bundles = append(bundles, current)
 	}
 	
-	// Write each player
-	for _, player := range m.Players {
-		// Write player ID
-		if err := binary.Write(buf, binary.LittleEndian, player.ID); err != nil {
-			return nil, err
-		}
-		
-		// Write player name length and name
-		nameBytes := []byte(player.Name)
-		nameLen := int32(len(nameBytes))
-		if err := binary.Write(buf, binary.LittleEndian, nameLen); err != nil {
-			return nil, err
-		}
-		if _, err := buf.Write(nameBytes); err != nil {
-			return nil, err
-		}
-		
-		// Write player position and dimensions
-		if err := binary.Write(buf, binary.LittleEndian, player.X); err != nil {
-			return nil, err
-		}
-		if err := binary.Write(buf, binary.LittleEndian, player.Y); err != nil {
-			return nil, err
-		}
-		if err := binary.Write(buf, binary.LittleEndian, player.Width); err != nil {
-			return nil, err
-		}
-		if err := binary.Write(buf, binary.LittleEndian, player.Height); err != nil {
-			return nil, err
-		}
-		
-		// Write player color
-		if err := binary.Write(buf, binary.LittleEndian, player.ColorR); err != nil {
-			return nil, err
-		}
-		if err := binary.Write(buf, binary.LittleEndian, player.ColorG); err != nil {
-			return nil, err
-		}
-		if err := binary.Write(buf, binary.LittleEndian, player.ColorB); err != nil {
-			return nil, err
-		}
-		if err := binary.Write(buf, binary.LittleEndian, player.ColorA); err != nil {
-			return nil, err
-		}
-		
-		// Write player health
-		if err := binary.Write(buf, binary.LittleEndian, player.Health); err != nil {
-			return nil, err
-		}
-		if err := binary.Write(buf, binary.LittleEndian, player.MaxHealth); err != nil {
-			return nil, err
-		}
-		
-		// Write player is dead flag
-		isDead := byte(0)
-		if player.IsDead {
-			isDead = 1
-		}
-		if err := binary.Write(buf, binary.LittleEndian, isDead); err != nil {
-			return nil, err
-		}
-		
-		// Write player direction and face direction
-		if err := binary.Write(buf, binary.LittleEndian, player.Direction); err != nil {
-			return nil, err
-		}
-		if err := binary.Write(buf, binary.LittleEndian, player.FaceDirection); err != nil {
-			return nil, err
-		}
-		
-		// Write player velocity
-		if err := binary.Write(buf, binary.LittleEndian, player.VelocityX); err != nil {
-			return nil, err
-		}
-		if err := binary.Write(buf, binary.LittleEndian, player.VelocityY); err != nil {
-			return nil, err
-		}
-	}
-	
-	return buf.Bytes(), nil
-}
-
-// DecodeMessage decodes a binary message into a Message
-func DecodeMessage(data []byte) (Message, error) {
-	if len(data) == 0 {
-		return nil, errors.New("empty message")
-	}
-	
-	msgType := data[0]
-	reader := bytes.NewReader(data[1:])
-	
-	switch msgType {
-	case PlayerUpdateType:
-		return decodePlayerUpdateMessage(reader)
-	case ChatMessageType:
-		return decodeChatMessageMessage(reader)
-	case GunFireType:
-		return decodeGunFireMessage(reader)
-	case HitReportType:
-		return decodeHitReportMessage(reader)
-	case PlayerJoinType:
-		return decodePlayerJoinMessage(reader)
-	case PlayerLeaveType:
-		return decodePlayerLeaveMessage(reader)
-	case PlatformDestroyType:
-		return decodePlatformDestroyMessage(reader)
-	case FragmentCreateType:
-		return decodeFragmentCreateMessage(reader)
-	case FragmentDestroyType:
-		return decodeFragmentDestroyMessage(reader)
-	case GunAttachmentType:
-		return decodeGunAttachmentMessage(reader)
-	default:
-		return nil, errors.New("unknown message type")
-	}
-}
-
-func decodePlayerUpdateMessage(reader *bytes.Reader) (Message, error) {
-	var player Player
-	
-	// Read player ID
-	if err := binary.Read(reader, binary.LittleEndian, &player.ID); err != nil {
-		return nil, err
-	}
-	
-	// Read player name
-	var nameLen int32
-	if err := binary.Read(reader, binary.LittleEndian, &nameLen); err != nil {
-		return nil, err
-	}
-	nameBytes := make([]byte, nameLen)
-	if _, err := io.ReadFull(reader, nameBytes); err != nil {
-		return nil, err
-	}
-	player.Name = string(nameBytes)
-	
-	// Read player position and dimensions
-	if err := binary.Read(reader, binary.LittleEndian, &player.X); err != nil {
-		return nil, err
-	}
-	if err := binary.Read(reader, binary.LittleEndian, &player.Y); err != nil {
-		return nil, err
-	}
-	if err := binary.Read(reader, binary.LittleEndian, &player.Width); err != nil {
-		return nil, err
-	}
-	if err := binary.Read(reader, binary.LittleEndian, &player.Height); err != nil {
-		return nil, err
-	}
-	
-	// Read player color
-	if err := binary.Read(reader, binary.LittleEndian, &player.ColorR); err != nil {
-		return nil, err
-	}
-	if err := binary.Read(reader, binary.LittleEndian, &player.ColorG); err != nil {
-		return nil, err
-	}
-	if err := binary.Read(reader, binary.LittleEndian, &player.ColorB); err != nil {
-		return nil, err
-	}
-	if err := binary.Read(reader, binary.LittleEndian, &player.ColorA); err != nil {
-		return nil, err
-	}
-	
-	// Read player health
-	if err := binary.Read(reader, binary.LittleEndian, &player.Health); err != nil {
-		return nil, err
-	}
-	if err := binary.Read(reader, binary.LittleEndian, &player.MaxHealth); err != nil {
-		return nil, err
-	}
-	
-	// Read player is dead flag
-	var isDead byte
-	if err := binary.Read(reader, binary.LittleEndian, &isDead); err != nil {
-		return nil, err
-	}
-	player.IsDead = isDead != 0
-	
-	// Try to read direction and face direction
-	// These might not be present in older messages, so handle errors gracefully
-	if err := binary.Read(reader, binary.LittleEndian, &player.Direction); err != nil {
-		// If we can't read these fields, they might not be present in older messages
-		// Just set default values and return what we have so far
-		player.Direction = 0
-		player.FaceDirection = 1
-		player.VelocityX = 0
-		player.VelocityY = 0
-		return PlayerUpdateMessage{Player: player}, nil
-	}
-	
-	if err := binary.Read(reader, binary.LittleEndian, &player.FaceDirection); err != nil {
-		player.FaceDirection = 1
-		player.VelocityX = 0
-		player.VelocityY = 0
-		return PlayerUpdateMessage{Player: player}, nil
-	}
-	
-	// Try to read velocity
-	if err := binary.Read(reader, binary.LittleEndian, &player.VelocityX); err != nil {
-		player.VelocityX = 0
-		player.VelocityY = 0
-		return PlayerUpdateMessage{Player: player}, nil
-	}
-	
-	if err := binary.Read(reader, binary.LittleEndian, &player.VelocityY); err != nil {
-		player.VelocityY = 0
-		return PlayerUpdateMessage{Player: player}, nil
-	}
-	
-	return PlayerUpdateMessage{Player: player}, nil
-}
-
-func decodeChatMessageMessage(reader *bytes.Reader) (Message, error) {
-	var chat ChatMessage
-	
-	// Read player ID
-	if err := binary.Read(reader, binary.LittleEndian, &chat.PlayerID); err != nil {
-		return nil, err
-	}
-	
-	// Read message
-	var msgLen int32
-	if err := binary.Read(reader, binary.LittleEndian, &msgLen); err != nil {
-		return nil, err
-	}
-	msgBytes := make([]byte, msgLen)
-	if _, err := io.ReadFull(reader, msgBytes); err != nil {
-		return nil, err
-	}
-	chat.Message = string(msgBytes)
-	
-	return ChatMessageMessage{Chat: chat}, nil
-}
-
-func decodeGunFireMessage(reader *bytes.Reader) (Message, error) {
-	var fire GunFire
-	
-	// Read player ID
-	if err := binary.Read(reader, binary.LittleEndian, &fire.PlayerID); err != nil {
-		return nil, err
-	}
-	
-	// Read position and angle
-	if err := binary.Read(reader, binary.LittleEndian, &fire.X); err != nil {
-		return nil, err
-	}
-	if err := binary.Read(reader, binary.LittleEndian, &fire.Y); err != nil {
-		return nil, err
-	}
-	if err := binary.Read(reader, binary.LittleEndian, &fire.Angle); err != nil {
-		return nil, err
-	}
-	if err := binary.Read(reader, binary.LittleEndian, &fire.Damage); err != nil {
-		return nil, err
-	}
-	
-	return GunFireMessage{Fire: fire}, nil
-}
-
-func decodeHitReportMessage(reader *bytes.Reader) (Message, error) {
-	var hit HitReport
-	
-	// Read shooter and target IDs
-	if err := binary.Read(reader, binary.LittleEndian, &hit.ShooterID); err != nil {
-		return nil, err
-	}
-	if err := binary.Read(reader, binary.LittleEndian, &hit.TargetID); err != nil {
-		return nil, err
-	}
-	
-	// Read damage
-	if err := binary.Read(reader, binary.LittleEndian, &hit.Damage); err != nil {
-		return nil, err
-	}
-	
-	return HitReportMessage{Hit: hit}, nil
-}
-
-func decodePlayerJoinMessage(reader *bytes.Reader) (Message, error) {
-	var playerID int32
-	
-	// Read player ID
-	if err := binary.Read(reader, binary.LittleEndian, &playerID); err != nil {
-		return nil, err
-	}
-	
-	return PlayerJoinMessage{PlayerID: playerID}, nil
-}
-
-func decodePlayerLeaveMessage(reader *bytes.Reader) (Message, error) {
-	var playerID int32
-	
-	// Read player ID
-	if err := binary.Read(reader, binary.LittleEndian, &playerID); err != nil {
-		return nil, err
-	}
-	
-	return PlayerLeaveMessage{PlayerID: playerID}, nil
-}
-
-// PlatformDestroyMessage is sent when a player destroys a platform
-type PlatformDestroyMessage struct {
-	Destroy PlatformDestroy
-}
-
-func (m PlatformDestroyMessage) Type() byte {
-	return PlatformDestroyType
-}
-
-func (m PlatformDestroyMessage) Encode() ([]byte, error) {
-	buf := new(bytes.Buffer)
-	
-	// Write message type
-	if err := binary.Write(buf, binary.LittleEndian, m.Type()); err != nil {
-		return nil, err
-	}
-	
-	// Write platform and shooter IDs
-	if err := binary.Write(buf, binary.LittleEndian, m.Destroy.PlatformID); err != nil {
-		return nil, err
-	}
-	if err := binary.Write(buf, binary.LittleEndian, m.Destroy.ShooterID); err != nil {
-		return nil, err
-	}
-	
-	return buf.Bytes(), nil
-}
-
-// BroadcastPlatformDestroyMessage is sent to all clients when a platform is destroyed
-type BroadcastPlatformDestroyMessage struct {
-	Destroy PlatformDestroy
-}
-
-func (m BroadcastPlatformDestroyMessage) Type() byte {
-	return BroadcastPlatformDestroyType
-}
-
-func (m BroadcastPlatformDestroyMessage) Encode() ([]byte, error) {
-	buf := new(bytes.Buffer)
-	
-	// Write message type
-	if err := binary.Write(buf, binary.LittleEndian, m.Type()); err != nil {
-		return nil, err
-	}
-	
-	// Write platform and shooter IDs
-	if err := binary.Write(buf, binary.LittleEndian, m.Destroy.PlatformID); err != nil {
-		return nil, err
-	}
-	if err := binary.Write(buf, binary.LittleEndian, m.Destroy.ShooterID); err != nil {
-		return nil, err
-	}
-	
-	return buf.Bytes(), nil
-}
-
-// FragmentCreateMessage is sent when a fragment is created from a destroyed platform
-type FragmentCreateMessage struct {
-	Fragment Fragment
-}
-
-func (m FragmentCreateMessage) Type() byte {
-	return FragmentCreateType
-}
-
-func (m FragmentCreateMessage) Encode() ([]byte, error) {
-	buf := new(bytes.Buffer)
-	
-	// Write message type
-	if err := binary.Write(buf, binary.LittleEndian, m.Type()); err != nil {
-		return nil, err
-	}
-	
-	// Write fragment ID and original entity ID
-	if err := binary.Write(buf, binary.LittleEndian, m.Fragment.ID); err != nil {
-		return nil, err
-	}
-	if err := binary.Write(buf, binary.LittleEndian, m.Fragment.OriginalEntityID); err != nil {
-		return nil, err
-	}
-	
-	// Write position and dimensions
-	if err := binary.Write(buf, binary.LittleEndian, m.Fragment.X); err != nil {
-		return nil, err
-	}
-	if err := binary.Write(buf, binary.LittleEndian, m.Fragment.Y); err != nil {
-		return nil, err
-	}
-	if err := binary.Write(buf, binary.LittleEndian, m.Fragment.Width); err != nil {
-		return nil, err
-	}
-	if err := binary.Write(buf, binary.LittleEndian, m.Fragment.Height); err != nil {
-		return nil, err
-	}
-	
-	// Write velocity
-	if err := binary.Write(buf, binary.LittleEndian, m.Fragment.VelocityX); err != nil {
-		return nil, err
-	}
-	if err := binary.Write(buf, binary.LittleEndian, m.Fragment.VelocityY); err != nil {
-		return nil, err
-	}
-	
-	// Write color
-	if err := binary.Write(buf, binary.LittleEndian, m.Fragment.ColorR); err != nil {
-		return nil, err
-	}
-	if err := binary.Write(buf, binary.LittleEndian, m.Fragment.ColorG); err != nil {
-		return nil, err
-	}
-	if err := binary.Write(buf, binary.LittleEndian, m.Fragment.ColorB); err != nil {
-		return nil, err
-	}
-	if err := binary.Write(buf, binary.LittleEndian, m.Fragment.ColorA); err != nil {
-		return nil, err
-	}
-	
-	return buf.Bytes(), nil
-}
-
-// BroadcastFragmentCreateMessage is sent to all clients when a fragment is created
-type BroadcastFragmentCreateMessage struct {
-	Fragment Fragment
-}
-
-func (m BroadcastFragmentCreateMessage) Type() byte {
-	return BroadcastFragmentCreateType
-}
-
-func (m BroadcastFragmentCreateMessage) Encode() ([]byte, error) {
-	buf := new(bytes.Buffer)
-	
-	// Write message type
-	if err := binary.Write(buf, binary.LittleEndian, m.Type()); err != nil {
-		return nil, err
-	}
-	
-	// Write fragment ID and original entity ID
-	if err := binary.Write(buf, binary.LittleEndian, m.Fragment.ID); err != nil {
-		return nil, err
-	}
-	if err := binary.Write(buf, binary.LittleEndian, m.Fragment.OriginalEntityID); err != nil {
-		return nil, err
-	}
-	
-	// Write position and dimensions
-	if err := binary.Write(buf, binary.LittleEndian, m.Fragment.X); err != nil {
-		return nil, err
-	}
-	if err := binary.Write(buf, binary.LittleEndian, m.Fragment.Y); err != nil {
-		return nil, err
-	}
-	if err := binary.Write(buf, binary.LittleEndian, m.Fragment.Width); err != nil {
-		return nil, err
-	}
-	if err := binary.Write(buf, binary.LittleEndian, m.Fragment.Height); err != nil {
-		return nil, err
-	}
-	
-	// Write velocity
-	if err := binary.Write(buf, binary.LittleEndian, m.Fragment.VelocityX); err != nil {
-		return nil, err
-	}
-	if err := binary.Write(buf, binary.LittleEndian, m.Fragment.VelocityY); err != nil {
-		return nil, err
-	}
-	
-	// Write color
-	if err := binary.Write(buf, binary.LittleEndian, m.Fragment.ColorR); err != nil {
-		return nil, err
-	}
-	if err := binary.Write(buf, binary.LittleEndian, m.Fragment.ColorG); err != nil {
-		return nil, err
-	}
-	if err := binary.Write(buf, binary.LittleEndian, m.Fragment.ColorB); err != nil {
-		return nil, err
-	}
-	if err := binary.Write(buf, binary.LittleEndian, m.Fragment.ColorA); err != nil {
-		return nil, err
-	}
-	
-	return buf.Bytes(), nil
-}
-
-func decodePlatformDestroyMessage(reader *bytes.Reader) (Message, error) {
-	var destroy PlatformDestroy
-	
-	// Read platform and shooter IDs
-	if err := binary.Read(reader, binary.LittleEndian, &destroy.PlatformID); err != nil {
-		return nil, err
-	}
-	if err := binary.Read(reader, binary.LittleEndian, &destroy.ShooterID); err != nil {
-		return nil, err
-	}
-	
-	return PlatformDestroyMessage{Destroy: destroy}, nil
-}
-
-// FragmentDestroy represents a fragment destruction event
-type FragmentDestroy struct {
-	FragmentID int32
-}
-
-// FragmentDestroyMessage is sent when a fragment is destroyed
-type FragmentDestroyMessage struct {
-	Destroy FragmentDestroy
-}
-
-func (m FragmentDestroyMessage) Type() byte {
-	return FragmentDestroyType
-}
-
-func (m FragmentDestroyMessage) Encode() ([]byte, error) {
-	buf := new(bytes.Buffer)
-	
-	// Write message type
-	if err := binary.Write(buf, binary.LittleEndian, m.Type()); err != nil {
-		return nil, err
-	}
-	
-	// Write fragment ID
-	if err := binary.Write(buf, binary.LittleEndian, m.Destroy.FragmentID); err != nil {
-		return nil, err
-	}
-	
-	return buf.Bytes(), nil
-}
-
-// BroadcastFragmentDestroyMessage is sent to all clients when a fragment is destroyed
-type BroadcastFragmentDestroyMessage struct {
-	Destroy FragmentDestroy
-}
-
-func (m BroadcastFragmentDestroyMessage) Type() byte {
-	return BroadcastFragmentDestroyType
-}
-
-func (m BroadcastFragmentDestroyMessage) Encode() ([]byte, error) {
-	buf := new(bytes.Buffer)
-	
-	// Write message type
-	if err := binary.Write(buf, binary.LittleEndian, m.Type()); err != nil {
-		return nil, err
-	}
-	
-	// Write fragment ID
-	if err := binary.Write(buf, binary.LittleEndian, m.Destroy.FragmentID); err != nil {
-		return nil, err
-	}
-	
-	return buf.Bytes(), nil
-}
-
-func decodeFragmentDestroyMessage(reader *bytes.Reader) (Message, error) {
-	var destroy FragmentDestroy
-	
-	// Read fragment ID
-	if err := binary.Read(reader, binary.LittleEndian, &destroy.FragmentID); err != nil {
-		return nil, err
-	}
-	
-	return FragmentDestroyMessage{Destroy: destroy}, nil
-}
-
-func decodeFragmentCreateMessage(reader *bytes.Reader) (Message, error) {
-	var fragment Fragment
-	
-	// Read fragment ID and original entity ID
-	if err := binary.Read(reader, binary.LittleEndian, &fragment.ID); err != nil {
-		return nil, err
-	}
-	if err := binary.Read(reader, binary.LittleEndian, &fragment.OriginalEntityID); err != nil {
-		return nil, err
-	}
-	
-	// Read position and dimensions
-	if err := binary.Read(reader, binary.LittleEndian, &fragment.X); err != nil {
-		return nil, err
-	}
-	if err := binary.Read(reader, binary.LittleEndian, &fragment.Y); err != nil {
-		return nil, err
-	}
-	if err := binary.Read(reader, binary.LittleEndian, &fragment.Width); err != nil {
-		return nil, err
-	}
-	if err := binary.Read(reader, binary.LittleEndian, &fragment.Height); err != nil {
-		return nil, err
-	}
-	
-	// Read velocity
-	if err := binary.Read(reader, binary.LittleEndian, &fragment.VelocityX); err != nil {
-		return nil, err
-	}
-	if err := binary.Read(reader, binary.LittleEndian, &fragment.VelocityY); err != nil {
-		return nil, err
-	}
-	
-	// Read color
-	if err := binary.Read(reader, binary.LittleEndian, &fragment.ColorR); err != nil {
-		return nil, err
-	}
-	if err := binary.Read(reader, binary.LittleEndian, &fragment.ColorG); err != nil {
-		return nil, err
-	}
-	if err := binary.Read(reader, binary.LittleEndian, &fragment.ColorB); err != nil {
-		return nil, err
-	}
-	if err := binary.Read(reader, binary.LittleEndian, &fragment.ColorA); err != nil {
-		return nil, err
-	}
-	
-	return FragmentCreateMessage{Fragment: fragment}, nil
-}
-
-// GunAttachmentMessage is sent when a gun is attached to a player
-type GunAttachmentMessage struct {
-	Attachment GunAttachment
-}
-
-func (m GunAttachmentMessage) Type() byte {
-	return GunAttachmentType
-}
-
-func (m GunAttachmentMessage) Encode() ([]byte, error) {
-	buf := new(bytes.Buffer)
-	
-	// Write message type
-	if err := binary.Write(buf, binary.LittleEndian, m.Type()); err != nil {
-		return nil, err
-	}
-	
-	// Write gun and player IDs
-	if err := binary.Write(buf, binary.LittleEndian, m.Attachment.GunID); err != nil {
-		return nil, err
-	}
-	if err := binary.Write(buf, binary.LittleEndian, m.Attachment.PlayerID); err != nil {
-		return nil, err
-	}
-	
-	// Write attachment offset and rotation
-	if err := binary.Write(buf, binary.LittleEndian, m.Attachment.OffsetX); err != nil {
-		return nil, err
-	}
-	if err := binary.Write(buf, binary.LittleEndian, m.Attachment.OffsetY); err != nil {
-		return nil, err
-	}
-	if err := binary.Write(buf, binary.LittleEndian, m.Attachment.Rotation); err != nil {
-		return nil, err
-	}
-	
-	return buf.Bytes(), nil
-}
-
-// BroadcastGunAttachmentMessage is sent to all clients when a gun is attached to a player
-type BroadcastGunAttachmentMessage struct {
-	Attachment GunAttachment
-}
-
-func (m BroadcastGunAttachmentMessage) Type() byte {
-	return BroadcastGunAttachmentType
-}
-
-func (m BroadcastGunAttachmentMessage) Encode() ([]byte, error) {
-	buf := new(bytes.Buffer)
-	
-	// Write message type
-	if err := binary.Write(buf, binary.LittleEndian, m.Type()); err != nil {
-		return nil, err
-	}
-	
-	// Write gun and player IDs
-	if err := binary.Write(buf, binary.LittleEndian, m.Attachment.GunID); err != nil {
-		return nil, err
-	}
-	if err := binary.Write(buf, binary.LittleEndian, m.Attachment.PlayerID); err != nil {
-		return nil, err
-	}
-	
-	// Write attachment offset and rotation
-	if err := binary.Write(buf, binary.LittleEndian, m.Attachment.OffsetX); err != nil {
-		return nil, err
-	}
-	if err := binary.Write(buf, binary.LittleEndian, m.Attachment.OffsetY); err != nil {
-		return nil, err
-	}
-	if err := binary.Write(buf, binary.LittleEndian, m.Attachment.Rotation); err != nil {
-		return nil, err
-	}
-	
-	return buf.Bytes(), nil
-}
-
-func decodeGunAttachmentMessage(reader *bytes.Reader) (Message, error) {
-	var attachment GunAttachment
-	
-	// Read gun and player IDs
-	if err := binary.Read(reader, binary.LittleEndian, &attachment.GunID); err != nil {
-		return nil, err
-	}
-	if err := binary.Read(reader, binary.LittleEndian, &attachment.PlayerID); err != nil {
-		return nil, err
-	}
-	
-	// Read attachment offset and rotation
-	if err := binary.Read(reader, binary.LittleEndian, &attachment.OffsetX); err != nil {
-		return nil, err
-	}
-	if err := binary.Read(reader, binary.LittleEndian, &attachment.OffsetY); err != nil {
-		return nil, err
-	}
-	if err := binary.Read(reader, binary.LittleEndian, &attachment.Rotation); err != nil {
-		return nil, err
-	}
-	
-	return GunAttachmentMessage{Attachment: attachment}, nil
-}
-
-// ParseColorString parses a color string in the format "[r,g,b,a]" into separate components
-func ParseColorString(colorStr string) (r, g, b, a float32) {
-	// Default values
-	r, g, b, a = 1.0, 1.0, 1.0, 1.0
-	
-	// Try to parse the color string
-	var colorArray [4]float64
-	_, err := fmt.Sscanf(colorStr, "[%f,%f,%f,%f]", &colorArray[0], &colorArray[1], &colorArray[2], &colorArray[3])
-	if err == nil {
-		r = float32(colorArray[0])
-		g = float32(colorArray[1])
-		b = float32(colorArray[2])
-		a = float32(colorArray[3])
-	}
-	
-	return r, g, b, a
-}
-
-// ColorToString converts color components to a string in the format "[r,g,b,a]"
-func ColorToString(r, g, b, a float32) string {
-	return fmt.Sprintf("[%f,%f,%f,%f]", r, g, b, a)
+	return bundles
 }
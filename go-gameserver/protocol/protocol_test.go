@@ -0,0 +1,438 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// benchPlayers is how many players the benchmarks' room holds, the load at
+// which profiling showed encoding dominating the tick
+const benchPlayers = 30
+
+var benchQuantization = Quantization{MinX: -2000, MinY: -3000, MaxX: 12000, MaxY: 4000}
+
+func benchPlayer(id int32) Player {
+	return Player{
+		ID:     id,
+		Name:   fmt.Sprintf("player-%d", id),
+		X:      float32(id) * 37.5,
+		Y:      float32(id) * -12.25,
+		Width:  32,
+		Height: 48,
+		ColorR: 0.8, ColorG: 0.2, ColorB: 0.4, ColorA: 1,
+		Health:        75,
+		MaxHealth:     100,
+		Direction:     1,
+		FaceDirection: -1,
+		VelocityX:     120.5,
+		VelocityY:     -340,
+		TeamID:        id % 2,
+	}
+}
+
+// benchMessages returns the messages a busy room sends most, by name
+func benchMessages() []struct {
+	name string
+	msg  Message
+} {
+	players := make([]Player, benchPlayers)
+	deltas := make([]PlayerDelta, benchPlayers)
+	for i := range players {
+		players[i] = benchPlayer(int32(i + 1))
+		deltas[i] = PlayerDelta{Fields: PlayerFieldX | PlayerFieldY | PlayerFieldVelocityX | PlayerFieldVelocityY, Player: players[i]}
+	}
+	snapshot := WorldSnapshotMessage{Tick: 1200, BaselineTick: 1198, LastInputSequence: 77, Players: deltas, Removed: []int32{31}}
+
+	return []struct {
+		name string
+		msg  Message
+	}{
+		{"PlayerUpdate", BroadcastPlayerUpdateMessage{Player: players[0]}},
+		{"GunFire", BroadcastGunFireMessage{Fire: GunFire{PlayerID: 1, X: 10, Y: 20, Angle: 1.5, Damage: 12, WeaponID: 2}}},
+		{"InitialState", InitialStateMessage{Players: players}},
+		{"WorldSnapshot", snapshot},
+		{"QuantizedWorldSnapshot", QuantizedWorldSnapshotMessage{Snapshot: snapshot, Quantization: benchQuantization}},
+	}
+}
+
+func TestAppendEncodeMatchesEncode(t *testing.T) {
+	prefix := []byte("prefix")
+	for _, m := range benchMessages() {
+		want, err := m.msg.Encode()
+		if err != nil {
+			t.Fatalf("%s: Encode: %v", m.name, err)
+		}
+		got, err := m.msg.AppendEncode(bytes.Clone(prefix))
+		if err != nil {
+			t.Fatalf("%s: AppendEncode: %v", m.name, err)
+		}
+		if !bytes.HasPrefix(got, prefix) || !bytes.Equal(got[len(prefix):], want) {
+			t.Errorf("%s: AppendEncode did not append what Encode returns", m.name)
+		}
+	}
+}
+
+func TestAppendEncodeDoesNotAllocate(t *testing.T) {
+	for _, m := range benchMessages() {
+		buf, _ := m.msg.AppendEncode(nil)
+		allocs := testing.AllocsPerRun(100, func() {
+			buf, _ = m.msg.AppendEncode(buf[:0])
+		})
+		if allocs != 0 {
+			t.Errorf("%s: AppendEncode into a reused buffer made %v allocations, want 0", m.name, allocs)
+		}
+	}
+}
+
+func TestLegacyEncodingMatches(t *testing.T) {
+	m := BroadcastPlayerUpdateMessage{Player: benchPlayer(7)}
+	want, err := legacyEncodePlayerUpdate(m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := m.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("Encode changed the wire format:\n got %x\nwant %x", got, want)
+	}
+}
+
+// legacyEncodePlayerUpdate encodes a player update the way Encode did before
+// AppendEncode: into a fresh bytes.Buffer with a binary.Write per field
+func legacyEncodePlayerUpdate(m BroadcastPlayerUpdateMessage) ([]byte, error) {
+	buf := new(bytes.Buffer)
+	p := m.Player
+	fields := []any{m.Type(), p.ID, int32(len(p.Name))}
+	if err := binary.Write(buf, binary.LittleEndian, fields[0]); err != nil {
+		return nil, err
+	}
+	for _, v := range fields[1:] {
+		if err := binary.Write(buf, binary.LittleEndian, v); err != nil {
+			return nil, err
+		}
+	}
+	buf.WriteString(p.Name)
+	for _, v := range []any{
+		p.X, p.Y, p.Width, p.Height, p.ColorR, p.ColorG, p.ColorB, p.ColorA,
+		p.Health, p.MaxHealth, p.IsDead, p.Direction, p.FaceDirection,
+		p.VelocityX, p.VelocityY, p.TeamID,
+	} {
+		if err := binary.Write(buf, binary.LittleEndian, v); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+func BenchmarkEncode(b *testing.B) {
+	for _, m := range benchMessages() {
+		b.Run(m.name+"/Encode", func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := m.msg.Encode(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run(m.name+"/AppendEncode", func(b *testing.B) {
+			var buf []byte
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				var err error
+				if buf, err = m.msg.AppendEncode(buf[:0]); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkDecode(b *testing.B) {
+	for _, m := range benchMessages() {
+		data, err := m.msg.Encode()
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.Run(m.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := benchQuantization.DecodeMessage(data); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkBroadcastPlayerUpdate fans one player update out to every player
+// in the room. "legacy" encodes it per recipient with binary.Write, as the
+// batcher once did; "per-recipient" does the same with Encode; "shared"
+// encodes it once for everyone, as Room.flush does.
+func BenchmarkBroadcastPlayerUpdate(b *testing.B) {
+	m := BroadcastPlayerUpdateMessage{Player: benchPlayer(1)}
+	queues := make([][]byte, benchPlayers)
+
+	b.Run("legacy", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			for j := range queues {
+				queues[j], _ = legacyEncodePlayerUpdate(m)
+			}
+		}
+	})
+	b.Run("per-recipient", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			for j := range queues {
+				queues[j], _ = m.Encode()
+			}
+		}
+	})
+	b.Run("shared", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			data, _ := m.Encode()
+			for j := range queues {
+				queues[j] = data
+			}
+		}
+	})
+}
+
+// allMessages returns a zero value of every message type
+func allMessages() []Message {
+	return []Message{
+		PlayerUpdateMessage{}, ChatMessageMessage{}, GunFireMessage{}, HitReportMessage{},
+		PlayerJoinMessage{}, PlayerLeaveMessage{}, PlatformDestroyMessage{}, FragmentCreateMessage{},
+		FragmentDestroyMessage{}, GunAttachmentMessage{}, TeamSwitchMessage{}, SnapshotAckMessage{},
+		HelloMessage{}, InputCommandMessage{},
+		BroadcastPlayerUpdateMessage{}, BroadcastChatMessageMessage{}, BroadcastGunFireMessage{},
+		BroadcastHitReportMessage{}, BroadcastPlayerJoinMessage{}, BroadcastPlayerLeaveMessage{},
+		InitialStateMessage{}, BroadcastPlatformDestroyMessage{}, BroadcastFragmentCreateMessage{},
+		BroadcastFragmentDestroyMessage{}, BroadcastGunAttachmentMessage{}, ScoreboardUpdateMessage{},
+		MatchStateMessage{}, PlayerLeaveViewMessage{}, ProjectileSpawnMessage{}, ProjectileImpactMessage{},
+		TerrainStateMessage{}, PlatformRestoreMessage{}, WelcomeMessage{}, WorldSnapshotMessage{},
+		PlayerEnterViewMessage{}, BundleMessage{}, QuantizationMessage{},
+		QuantizedWorldSnapshotMessage{}, QuantizedBroadcastGunFireMessage{},
+		QuantizedBroadcastPlayerUpdateMessage{}, QuantizedPlayerEnterViewMessage{}, QuantizedProjectileSpawnMessage{},
+	}
+}
+
+// randomRunes are what random strings are made of, from one to four bytes
+// of UTF-8 each
+var randomRunes = []rune("ab Zé€😀")
+
+// randomValue fills v with random values: strings of up to 8 runes, so they
+// fit every length limit, slices of up to 3 elements and finite floats
+func randomValue(rng *rand.Rand, v reflect.Value) {
+	switch v.Kind() {
+	case reflect.Bool:
+		v.SetBool(rng.Intn(2) == 0)
+	case reflect.Int8, reflect.Int16, reflect.Int32:
+		v.SetInt(int64(rng.Uint64()) >> (64 - v.Type().Bits()))
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		v.SetUint(rng.Uint64() >> (64 - v.Type().Bits()))
+	case reflect.Float32:
+		v.SetFloat(float64(float32(rng.NormFloat64() * 1000)))
+	case reflect.String:
+		var b strings.Builder
+		for n := rng.Intn(9); n > 0; n-- {
+			b.WriteRune(randomRunes[rng.Intn(len(randomRunes))])
+		}
+		v.SetString(b.String())
+	case reflect.Slice:
+		v.Set(reflect.MakeSlice(v.Type(), rng.Intn(4), 3))
+		for i := 0; i < v.Len(); i++ {
+			randomValue(rng, v.Index(i))
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			randomValue(rng, v.Field(i))
+		}
+	default:
+		panic("randomValue: unsupported kind " + v.Kind().String())
+	}
+}
+
+// randomDeltas makes random deltas valid: only known fields changed, and
+// nothing set outside them
+func randomDeltas(deltas []PlayerDelta) {
+	for i, d := range deltas {
+		d.Fields &= PlayerFieldsAll
+		d.Player = d.Apply(Player{ID: d.Player.ID})
+		deltas[i] = d
+	}
+}
+
+// randomMessage returns a message of the same type as msg with random
+// contents that encode and decode without error. Quantized messages use
+// benchQuantization, the area the tests decode them with.
+func randomMessage(rng *rand.Rand, msg Message) Message {
+	v := reflect.New(reflect.TypeOf(msg)).Elem()
+	randomValue(rng, v)
+
+	switch m := v.Interface().(type) {
+	case WorldSnapshotMessage:
+		randomDeltas(m.Players)
+		return m
+	case QuantizedWorldSnapshotMessage:
+		randomDeltas(m.Snapshot.Players)
+		m.Quantization = benchQuantization
+		return m
+	case QuantizedBroadcastGunFireMessage:
+		m.Quantization = benchQuantization
+		return m
+	case QuantizedBroadcastPlayerUpdateMessage:
+		m.Quantization = benchQuantization
+		return m
+	case QuantizedPlayerEnterViewMessage:
+		m.Quantization = benchQuantization
+		return m
+	case QuantizedProjectileSpawnMessage:
+		m.Quantization = benchQuantization
+		return m
+	case QuantizationMessage:
+		m.Quantization = benchQuantization
+		return m
+	case BundleMessage:
+		for i := range m.Messages {
+			m.Messages[i] = append(m.Messages[i], ChatMessageType)
+			m.Messages[i][0] = ChatMessageType
+		}
+		return m
+	default:
+		return m.(Message)
+	}
+}
+
+func TestEveryMessageTypeIsCovered(t *testing.T) {
+	covered := make(map[byte]bool)
+	for _, msg := range allMessages() {
+		covered[msg.Type()] = true
+	}
+	for typ := 0; typ < 256; typ++ {
+		_, err := benchQuantization.DecodeMessage([]byte{byte(typ)})
+		if !errors.Is(err, ErrUnknownType) && !covered[byte(typ)] {
+			t.Errorf("message type %d is decoded but missing from allMessages", typ)
+		}
+	}
+}
+
+func TestMessageRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+
+	for _, zero := range allMessages() {
+		for i := 0; i < 200; i++ {
+			msg := randomMessage(rng, zero)
+			data, err := msg.Encode()
+			if err != nil {
+				t.Fatalf("%T: Encode: %v", msg, err)
+			}
+			decoded, err := benchQuantization.DecodeMessage(data)
+			if err != nil {
+				t.Fatalf("%T: DecodeMessage: %v\n%+v", msg, err, msg)
+			}
+
+			// Quantized messages lose precision, but decoding one and
+			// encoding it again gives back the same bytes
+			again, err := decoded.Encode()
+			if err != nil {
+				t.Fatalf("%T: Encode after decoding: %v", msg, err)
+			}
+			if !bytes.Equal(again, data) {
+				t.Fatalf("%T: encoding changed after a round trip:\n got %x\nwant %x", msg, again, data)
+			}
+			switch msg.(type) {
+			case QuantizedWorldSnapshotMessage, QuantizedBroadcastGunFireMessage, QuantizedBroadcastPlayerUpdateMessage,
+				QuantizedPlayerEnterViewMessage, QuantizedProjectileSpawnMessage:
+				continue
+			}
+			if !reflect.DeepEqual(decoded, msg) {
+				t.Fatalf("%T: round trip changed the message:\n got %+v\nwant %+v", msg, decoded, msg)
+			}
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	chat := func(length int32, message string) []byte {
+		data := appendInt32([]byte{ChatMessageType}, 7)
+		data = appendInt32(data, length)
+		return append(data, message...)
+	}
+	join := appendInt32([]byte{PlayerJoinType}, 7)
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"empty", nil, ErrTruncated},
+		{"unknown type", []byte{99}, ErrUnknownType},
+		{"missing fields", join[:3], ErrTruncated},
+		{"trailing bytes", append(bytes.Clone(join), 0), ErrTrailingBytes},
+		{"negative length", chat(-1, ""), ErrTooLong},
+		{"length over limit", chat(257, strings.Repeat("a", 257)), ErrTooLong},
+		{"length past the end", chat(200, "hi"), ErrTruncated},
+		{"huge length", chat(1<<31-1, "hi"), ErrTooLong},
+		{"string past the end of a struct", appendInt32(appendInt32([]byte{InitialStateType}, 1), 7), ErrTruncated},
+		{"count past the end", appendUint16(appendUint32(appendUint32(appendUint32([]byte{WorldSnapshotType}, 1), 0), 0), 0xFFFF), ErrTruncated},
+		{"bundle count past the end", appendUint16([]byte{BundleType}, 0xFFFF), ErrTruncated},
+		{"bundled length past the end", appendUint32(appendUint16([]byte{BundleType}, 1), 0xFFFFFFFF), ErrTruncated},
+		{"empty bundled message", appendUint32(appendUint16([]byte{BundleType}, 1), 0), ErrTruncated},
+	}
+	for _, tt := range tests {
+		if _, err := benchQuantization.DecodeMessage(tt.data); !errors.Is(err, tt.want) {
+			t.Errorf("%s: got error %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	if _, err := (ChatMessageMessage{Chat: ChatMessage{Message: strings.Repeat("a", 257)}}).Encode(); !errors.Is(err, ErrTooLong) {
+		t.Errorf("encoding an over-long chat message: got error %v, want %v", err, ErrTooLong)
+	}
+}
+
+// FuzzDecodeMessage checks that decoding arbitrary bytes fails cleanly, and
+// that whatever decodes encodes to bytes that decode to the same message
+func FuzzDecodeMessage(f *testing.F) {
+	rng := rand.New(rand.NewSource(1))
+	for _, zero := range allMessages() {
+		data, err := randomMessage(rng, zero).Encode()
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		DecodeMessage(data)
+		msg, err := benchQuantization.DecodeMessage(data)
+		if err != nil {
+			return
+		}
+
+		encoded, err := msg.Encode()
+		if err != nil {
+			t.Fatalf("%T decoded but does not encode: %v", msg, err)
+		}
+		again, err := benchQuantization.DecodeMessage(encoded)
+		if err != nil {
+			t.Fatalf("%T does not decode once encoded again: %v", msg, err)
+		}
+		reencoded, err := again.Encode()
+		if err != nil {
+			t.Fatalf("%T: Encode: %v", again, err)
+		}
+		if !bytes.Equal(reencoded, encoded) {
+			t.Fatalf("%T encodes differently after a round trip:\n got %x\nwant %x", msg, reencoded, encoded)
+		}
+	})
+}
@@ -0,0 +1,591 @@
+package protocol
+
+import (
+	"errors"
+	"math"
+)
+
+// WebSocket subprotocols a client can offer. They are still accepted so that
+// clients from before the Hello handshake are rejected with a close reason
+// rather than a failed upgrade; the wire format is now negotiated in Hello,
+// where clients that ask for FeatureQuantized get every message carrying
+// positions in the compact quantized wire format and everyone else gets
+// float32 fields.
+const (
+	ProtocolFloat     = "gta-binary-v1"
+	ProtocolQuantized = "gta-binary-v2"
+)
+
+// Steps of the fixed-point encodings. Each value is off by at most half a
+// step after a round trip, as long as it is within range.
+const (
+	VelocityStep = 1.0 / 8  // px/s per unit of an int16 (±4096 px/s)
+	HealthStep   = 1.0 / 10 // Health per unit of a uint16 (0 to 6553.5)
+	AngleStep    = 2 * math.Pi / 65536
+	ColorStep    = 1.0 / 255
+)
+
+// MaxVelocity is the fastest velocity the quantized encoding carries; faster
+// ones are clamped to it
+const MaxVelocity = math.MaxInt16 * VelocityStep
+
+// Quantization maps positions onto uint16 steps across an area, normally the
+// level's bounds with a margin. Positions outside the area are clamped to it.
+type Quantization struct {
+	MinX, MinY float32
+	MaxX, MaxY float32
+}
+
+// PositionStep returns the distance between encodable positions on each axis
+func (q Quantization) PositionStep() (x, y float32) {
+	return (q.MaxX - q.MinX) / math.MaxUint16, (q.MaxY - q.MinY) / math.MaxUint16
+}
+
+// QuantizePosition encodes a position as steps across the area
+func (q Quantization) QuantizePosition(x, y float32) (uint16, uint16) {
+	return quantizeRange(x, q.MinX, q.MaxX), quantizeRange(y, q.MinY, q.MaxY)
+}
+
+// DequantizePosition decodes a position encoded by QuantizePosition
+func (q Quantization) DequantizePosition(qx, qy uint16) (float32, float32) {
+	return dequantizeRange(qx, q.MinX, q.MaxX), dequantizeRange(qy, q.MinY, q.MaxY)
+}
+
+func quantizeRange(v, lo, hi float32) uint16 {
+	if hi <= lo || v != v {
+		return 0
+	}
+	steps := (float64(v) - float64(lo)) / (float64(hi) - float64(lo)) * math.MaxUint16
+	return uint16(max(0, min(math.MaxUint16, math.Round(steps))))
+}
+
+func dequantizeRange(q uint16, lo, hi float32) float32 {
+	return float32(float64(lo) + float64(q)/math.MaxUint16*(float64(hi)-float64(lo)))
+}
+
+// QuantizeVelocity encodes a velocity in VelocitySteps
+func QuantizeVelocity(v float32) int16 {
+	return int16(clampRound(float64(v)/VelocityStep, math.MinInt16, math.MaxInt16))
+}
+
+// DequantizeVelocity decodes a velocity encoded by QuantizeVelocity
+func DequantizeVelocity(q int16) float32 {
+	return float32(q) * VelocityStep
+}
+
+// QuantizeHealth encodes a health or damage amount in HealthSteps
+func QuantizeHealth(h float32) uint16 {
+	return uint16(clampRound(float64(h)/HealthStep, 0, math.MaxUint16))
+}
+
+// DequantizeHealth decodes a health amount encoded by QuantizeHealth
+func DequantizeHealth(q uint16) float32 {
+	return float32(float64(q) * HealthStep)
+}
+
+// QuantizeAngle encodes an angle in radians as a fraction of a turn
+func QuantizeAngle(a float32) uint16 {
+	if a != a || math.IsInf(float64(a), 0) {
+		return 0
+	}
+	turns := math.Mod(float64(a)+math.Pi, 2*math.Pi)
+	if turns < 0 {
+		turns += 2 * math.Pi
+	}
+	return uint16(int(math.Round(turns/AngleStep)) & math.MaxUint16)
+}
+
+// DequantizeAngle decodes an angle encoded by QuantizeAngle into [-π, π)
+func DequantizeAngle(q uint16) float32 {
+	return float32(float64(q)*AngleStep - math.Pi)
+}
+
+// QuantizeColor encodes a color component from 0 to 1 as a byte
+func QuantizeColor(c float32) uint8 {
+	return uint8(clampRound(float64(c)/ColorStep, 0, math.MaxUint8))
+}
+
+// DequantizeColor decodes a color component encoded by QuantizeColor
+func DequantizeColor(q uint8) float32 {
+	return float32(q) / 255
+}
+
+// clampRound rounds v to the nearest integer in [lo, hi], treating NaN as 0
+func clampRound(v, lo, hi float64) float64 {
+	if v != v {
+		return 0
+	}
+	return max(lo, min(hi, math.Round(v)))
+}
+
+// QuantizationMessage tells a client that negotiated FeatureQuantized the
+// area positions are quantized across. It is sent before any quantized message.
+type QuantizationMessage struct {
+	Quantization Quantization
+}
+
+func (m QuantizationMessage) Type() byte {
+	return QuantizationType
+}
+
+func (m QuantizationMessage) AppendEncode(dst []byte) ([]byte, error) {
+	// Write message type
+	dst = append(dst, m.Type())
+
+	// Write the quantized area
+	dst = appendFloat32(dst, m.Quantization.MinX)
+	dst = appendFloat32(dst, m.Quantization.MinY)
+	dst = appendFloat32(dst, m.Quantization.MaxX)
+	dst = appendFloat32(dst, m.Quantization.MaxY)
+
+	return dst, nil
+}
+
+func (m QuantizationMessage) Encode() ([]byte, error) {
+	return encode(m)
+}
+
+func decodeQuantizationMessage(r *reader) (Message, error) {
+	var q Quantization
+
+	// Read the quantized area
+	q.MinX = r.float32()
+	q.MinY = r.float32()
+	q.MaxX = r.float32()
+	q.MaxY = r.float32()
+	if r.err != nil {
+		return nil, r.err
+	}
+	if !(q.MaxX > q.MinX && q.MaxY > q.MinY) {
+		return nil, errors.New("invalid quantization area")
+	}
+
+	return QuantizationMessage{Quantization: q}, nil
+}
+
+// QuantizedWorldSnapshotMessage is a WorldSnapshotMessage in the quantized
+// wire format: positions as uint16 steps across the area, velocities as
+// int16, health as uint16, colors as bytes and directions as int8
+type QuantizedWorldSnapshotMessage struct {
+	Snapshot     WorldSnapshotMessage
+	Quantization Quantization
+}
+
+func (m QuantizedWorldSnapshotMessage) Type() byte {
+	return QuantizedWorldSnapshotType
+}
+
+func (m QuantizedWorldSnapshotMessage) AppendEncode(dst []byte) ([]byte, error) {
+	s := m.Snapshot
+
+	// Write message type
+	dst = append(dst, m.Type())
+
+	// Write tick number, baseline and acknowledged input sequence
+	dst = appendUint32(dst, s.Tick)
+	dst = appendUint32(dst, s.BaselineTick)
+	dst = appendUint32(dst, s.LastInputSequence)
+
+	// Write each player's changed fields
+	if len(s.Players) > 0xFFFF {
+		return dst, tooLong("WorldSnapshotMessage.Players")
+	}
+	if len(s.Removed) > 0xFFFF {
+		return dst, tooLong("WorldSnapshotMessage.Removed")
+	}
+	dst = appendUint16(dst, uint16(len(s.Players)))
+	for _, delta := range s.Players {
+		var err error
+		if dst, err = m.Quantization.appendPlayerDelta(dst, delta); err != nil {
+			return dst, err
+		}
+	}
+
+	// Write removed players
+	dst = appendUint16(dst, uint16(len(s.Removed)))
+	for _, playerID := range s.Removed {
+		dst = appendInt32(dst, playerID)
+	}
+
+	return dst, nil
+}
+
+func (m QuantizedWorldSnapshotMessage) Encode() ([]byte, error) {
+	return encode(m)
+}
+
+func (q Quantization) decodeWorldSnapshot(r *reader) (Message, error) {
+	var s WorldSnapshotMessage
+
+	// Read tick number, baseline and acknowledged input sequence
+	s.Tick = r.uint32()
+	s.BaselineTick = r.uint32()
+	s.LastInputSequence = r.uint32()
+
+	// Read each player's changed fields
+	playerCount := r.length(int(r.uint16()), 0, minPlayerDeltaSize, "WorldSnapshotMessage.Players")
+	s.Players = make([]PlayerDelta, 0, playerCount)
+	for i := 0; i < playerCount; i++ {
+		delta, err := q.decodePlayerDelta(r)
+		if err != nil {
+			return nil, err
+		}
+		s.Players = append(s.Players, delta)
+	}
+
+	// Read removed players
+	removedCount := r.length(int(r.uint16()), 0, 4, "WorldSnapshotMessage.Removed")
+	s.Removed = make([]int32, removedCount)
+	for i := range s.Removed {
+		s.Removed[i] = r.int32()
+	}
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	return QuantizedWorldSnapshotMessage{Snapshot: s, Quantization: q}, nil
+}
+
+// quantizedPlayer is the wire form of a player's quantized fields, in
+// PlayerField order
+type quantizedPlayer struct {
+	X, Y                   uint16
+	Width, Height          float32
+	ColorR, ColorG, ColorB uint8
+	ColorA                 uint8
+	Health, MaxHealth      uint16
+	IsDead                 bool
+	Direction              int8
+	FaceDirection          int8
+	VelocityX, VelocityY   int16
+	TeamID                 int32
+}
+
+func (q Quantization) quantizePlayer(p Player) quantizedPlayer {
+	x, y := q.QuantizePosition(p.X, p.Y)
+	return quantizedPlayer{
+		X: x, Y: y,
+		Width: p.Width, Height: p.Height,
+		ColorR: QuantizeColor(p.ColorR), ColorG: QuantizeColor(p.ColorG),
+		ColorB: QuantizeColor(p.ColorB), ColorA: QuantizeColor(p.ColorA),
+		Health: QuantizeHealth(p.Health), MaxHealth: QuantizeHealth(p.MaxHealth),
+		IsDead:        p.IsDead,
+		Direction:     int8(clampRound(float64(p.Direction), math.MinInt8, math.MaxInt8)),
+		FaceDirection: int8(max(math.MinInt8, min(math.MaxInt8, p.FaceDirection))),
+		VelocityX:     QuantizeVelocity(p.VelocityX),
+		VelocityY:     QuantizeVelocity(p.VelocityY),
+		TeamID:        p.TeamID,
+	}
+}
+
+// quantizedFields lists, in encoding order, each field's bit and a pointer to
+// it in qp, like deltaFields does for float32 players
+func quantizedFields(qp *quantizedPlayer) [16]fieldRef {
+	return [16]fieldRef{
+		{PlayerFieldX, &qp.X},
+		{PlayerFieldY, &qp.Y},
+		{PlayerFieldWidth, &qp.Width},
+		{PlayerFieldHeight, &qp.Height},
+		{PlayerFieldColorR, &qp.ColorR},
+		{PlayerFieldColorG, &qp.ColorG},
+		{PlayerFieldColorB, &qp.ColorB},
+		{PlayerFieldColorA, &qp.ColorA},
+		{PlayerFieldHealth, &qp.Health},
+		{PlayerFieldMaxHealth, &qp.MaxHealth},
+		{PlayerFieldIsDead, &qp.IsDead},
+		{PlayerFieldDirection, &qp.Direction},
+		{PlayerFieldFaceDirection, &qp.FaceDirection},
+		{PlayerFieldVelocityX, &qp.VelocityX},
+		{PlayerFieldVelocityY, &qp.VelocityY},
+		{PlayerFieldTeamID, &qp.TeamID},
+	}
+}
+
+// appendPlayerDelta appends a delta like the float32 appendPlayerDelta, with
+// the changed fields quantized
+func (q Quantization) appendPlayerDelta(dst []byte, delta PlayerDelta) ([]byte, error) {
+	// Write player ID and field mask
+	dst = appendInt32(dst, delta.Player.ID)
+	dst = appendUint32(dst, uint32(delta.Fields))
+
+	// Write player name length and name
+	if delta.Fields&PlayerFieldName != 0 {
+		if len(delta.Player.Name) > maxPlayerNameLength {
+			return dst, tooLong("Player.Name")
+		}
+		dst = appendInt32(dst, int32(len(delta.Player.Name)))
+		dst = append(dst, delta.Player.Name...)
+	}
+
+	// Write the remaining changed fields
+	qp := q.quantizePlayer(delta.Player)
+	for _, f := range quantizedFields(&qp) {
+		if delta.Fields&f.field != 0 {
+			dst = appendField(dst, f.value)
+		}
+	}
+
+	return dst, nil
+}
+
+// decodePlayerDelta reads a delta written by Quantization.appendPlayerDelta
+func (q Quantization) decodePlayerDelta(r *reader) (PlayerDelta, error) {
+	var delta PlayerDelta
+
+	// Read player ID and field mask
+	delta.Player.ID = r.int32()
+	delta.Fields = PlayerField(r.uint32())
+	if delta.Fields&^PlayerFieldsAll != 0 {
+		return delta, errors.New("unknown player fields in delta")
+	}
+
+	// Read player name
+	if delta.Fields&PlayerFieldName != 0 {
+		nameLen := r.length(int(r.int32()), maxPlayerNameLength, 1, "Player.Name")
+		delta.Player.Name = r.string(nameLen)
+	}
+
+	// Read the remaining changed fields
+	var qp quantizedPlayer
+	for _, f := range quantizedFields(&qp) {
+		if delta.Fields&f.field != 0 {
+			r.readField(f.value)
+		}
+	}
+	if r.err != nil {
+		return delta, r.err
+	}
+
+	p := &delta.Player
+	p.X, p.Y = q.DequantizePosition(qp.X, qp.Y)
+	p.Width, p.Height = qp.Width, qp.Height
+	p.ColorR, p.ColorG, p.ColorB, p.ColorA = DequantizeColor(qp.ColorR), DequantizeColor(qp.ColorG), DequantizeColor(qp.ColorB), DequantizeColor(qp.ColorA)
+	p.Health, p.MaxHealth = DequantizeHealth(qp.Health), DequantizeHealth(qp.MaxHealth)
+	p.IsDead = qp.IsDead
+	p.Direction = float32(qp.Direction)
+	p.FaceDirection = int32(qp.FaceDirection)
+	p.VelocityX, p.VelocityY = DequantizeVelocity(qp.VelocityX), DequantizeVelocity(qp.VelocityY)
+	p.TeamID = qp.TeamID
+
+	return delta, nil
+}
+
+// QuantizedBroadcastGunFireMessage is a BroadcastGunFireMessage with the
+// position, angle and damage quantized
+type QuantizedBroadcastGunFireMessage struct {
+	Fire         GunFire
+	Quantization Quantization
+}
+
+func (m QuantizedBroadcastGunFireMessage) Type() byte {
+	return QuantizedBroadcastGunFireType
+}
+
+func (m QuantizedBroadcastGunFireMessage) AppendEncode(dst []byte) ([]byte, error) {
+	// Write message type
+	dst = append(dst, m.Type())
+
+	// Write player ID
+	dst = appendInt32(dst, m.Fire.PlayerID)
+
+	// Write position, angle and damage
+	x, y := m.Quantization.QuantizePosition(m.Fire.X, m.Fire.Y)
+	dst = appendUint16(dst, x)
+	dst = appendUint16(dst, y)
+	dst = appendUint16(dst, QuantizeAngle(m.Fire.Angle))
+	dst = appendUint16(dst, QuantizeHealth(m.Fire.Damage))
+
+	// Write weapon ID
+	dst = appendInt32(dst, m.Fire.WeaponID)
+
+	return dst, nil
+}
+
+func (m QuantizedBroadcastGunFireMessage) Encode() ([]byte, error) {
+	return encode(m)
+}
+
+func (q Quantization) decodeBroadcastGunFire(r *reader) (Message, error) {
+	var fire GunFire
+
+	// Read player ID
+	fire.PlayerID = r.int32()
+
+	// Read position, angle and damage
+	fire.X, fire.Y = q.DequantizePosition(r.uint16(), r.uint16())
+	fire.Angle = DequantizeAngle(r.uint16())
+	fire.Damage = DequantizeHealth(r.uint16())
+
+	// Read weapon ID
+	fire.WeaponID = r.int32()
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	return QuantizedBroadcastGunFireMessage{Fire: fire, Quantization: q}, nil
+}
+
+// QuantizedBroadcastPlayerUpdateMessage is a BroadcastPlayerUpdateMessage with
+// the player's fields quantized like in snapshots
+type QuantizedBroadcastPlayerUpdateMessage struct {
+	Player       Player
+	Quantization Quantization
+}
+
+func (m QuantizedBroadcastPlayerUpdateMessage) Type() byte {
+	return QuantizedBroadcastPlayerUpdateType
+}
+
+func (m QuantizedBroadcastPlayerUpdateMessage) AppendEncode(dst []byte) ([]byte, error) {
+	// Write message type
+	dst = append(dst, m.Type())
+
+	// Write every field of the player
+	return m.Quantization.appendPlayerDelta(dst, PlayerDelta{Fields: PlayerFieldsAll, Player: m.Player})
+}
+
+func (m QuantizedBroadcastPlayerUpdateMessage) Encode() ([]byte, error) {
+	return encode(m)
+}
+
+func (q Quantization) decodeBroadcastPlayerUpdate(r *reader) (Message, error) {
+	// Read the player's fields
+	player, err := q.decodeFullPlayer(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return QuantizedBroadcastPlayerUpdateMessage{Player: player, Quantization: q}, nil
+}
+
+// QuantizedPlayerEnterViewMessage is a PlayerEnterViewMessage with the
+// player's fields quantized like in snapshots
+type QuantizedPlayerEnterViewMessage struct {
+	Player       Player
+	Quantization Quantization
+}
+
+func (m QuantizedPlayerEnterViewMessage) Type() byte {
+	return QuantizedPlayerEnterViewType
+}
+
+func (m QuantizedPlayerEnterViewMessage) AppendEncode(dst []byte) ([]byte, error) {
+	// Write message type
+	dst = append(dst, m.Type())
+
+	// Write every field of the player
+	return m.Quantization.appendPlayerDelta(dst, PlayerDelta{Fields: PlayerFieldsAll, Player: m.Player})
+}
+
+func (m QuantizedPlayerEnterViewMessage) Encode() ([]byte, error) {
+	return encode(m)
+}
+
+func (q Quantization) decodePlayerEnterView(r *reader) (Message, error) {
+	// Read the player's fields
+	player, err := q.decodeFullPlayer(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return QuantizedPlayerEnterViewMessage{Player: player, Quantization: q}, nil
+}
+
+// decodeFullPlayer reads a quantized delta that must carry every field
+func (q Quantization) decodeFullPlayer(r *reader) (Player, error) {
+	delta, err := q.decodePlayerDelta(r)
+	if err != nil {
+		return Player{}, err
+	}
+	if delta.Fields != PlayerFieldsAll {
+		return Player{}, errors.New("player without full state")
+	}
+	return delta.Player, nil
+}
+
+// QuantizedProjectileSpawnMessage is a ProjectileSpawnMessage with the
+// position and velocity quantized
+type QuantizedProjectileSpawnMessage struct {
+	Projectile   Projectile
+	Quantization Quantization
+}
+
+func (m QuantizedProjectileSpawnMessage) Type() byte {
+	return QuantizedProjectileSpawnType
+}
+
+func (m QuantizedProjectileSpawnMessage) AppendEncode(dst []byte) ([]byte, error) {
+	p := m.Projectile
+
+	// Write message type
+	dst = append(dst, m.Type())
+
+	// Write projectile, shooter and weapon IDs
+	dst = appendInt32(dst, p.ID)
+	dst = appendInt32(dst, p.ShooterID)
+	dst = appendInt32(dst, p.WeaponID)
+
+	// Write position and velocity
+	x, y := m.Quantization.QuantizePosition(p.X, p.Y)
+	dst = appendUint16(dst, x)
+	dst = appendUint16(dst, y)
+	dst = appendInt16(dst, QuantizeVelocity(p.VelocityX))
+	dst = appendInt16(dst, QuantizeVelocity(p.VelocityY))
+
+	// Write gravity and spawn tick
+	dst = appendFloat32(dst, p.Gravity)
+	dst = appendUint32(dst, p.Tick)
+
+	return dst, nil
+}
+
+func (m QuantizedProjectileSpawnMessage) Encode() ([]byte, error) {
+	return encode(m)
+}
+
+func (q Quantization) decodeProjectileSpawn(r *reader) (Message, error) {
+	var p Projectile
+
+	// Read projectile, shooter and weapon IDs
+	p.ID = r.int32()
+	p.ShooterID = r.int32()
+	p.WeaponID = r.int32()
+
+	// Read position and velocity
+	p.X, p.Y = q.DequantizePosition(r.uint16(), r.uint16())
+	p.VelocityX = DequantizeVelocity(r.int16())
+	p.VelocityY = DequantizeVelocity(r.int16())
+
+	// Read gravity and spawn tick
+	p.Gravity = r.float32()
+	p.Tick = r.uint32()
+	if r.err != nil {
+		return nil, r.err
+	}
+
+	return QuantizedProjectileSpawnMessage{Projectile: p, Quantization: q}, nil
+}
+
+// DecodeMessage decodes a message like the package-level DecodeMessage,
+// using q for the quantized message types
+func (q Quantization) DecodeMessage(data []byte) (Message, error) {
+	if len(data) == 0 {
+		return nil, ErrTruncated
+	}
+
+	r := &reader{data: data[1:]}
+	switch data[0] {
+	case QuantizedWorldSnapshotType:
+		return r.finish(q.decodeWorldSnapshot(r))
+	case QuantizedBroadcastGunFireType:
+		return r.finish(q.decodeBroadcastGunFire(r))
+	case QuantizedBroadcastPlayerUpdateType:
+		return r.finish(q.decodeBroadcastPlayerUpdate(r))
+	case QuantizedPlayerEnterViewType:
+		return r.finish(q.decodePlayerEnterView(r))
+	case QuantizedProjectileSpawnType:
+		return r.finish(q.decodeProjectileSpawn(r))
+	default:
+		return DecodeMessage(data)
+	}
+}
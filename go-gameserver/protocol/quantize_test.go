@@ -0,0 +1,266 @@
+package protocol
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// float32Slack allows for float32 rounding in the decoded value on top of
+// the half step the quantization itself may be off by
+func float32Slack(v float32) float64 {
+	return 4 * float64(math.Nextafter32(float32(math.Abs(float64(v))), math.MaxFloat32)-float32(math.Abs(float64(v))))
+}
+
+func TestPositionRoundTrip(t *testing.T) {
+	q := Quantization{MinX: -2000, MinY: -3000, MaxX: 12000, MaxY: 4000}
+	stepX, stepY := q.PositionStep()
+	rng := rand.New(rand.NewSource(1))
+
+	for i := 0; i < 100000; i++ {
+		x := q.MinX + rng.Float32()*(q.MaxX-q.MinX)
+		y := q.MinY + rng.Float32()*(q.MaxY-q.MinY)
+		gotX, gotY := q.DequantizePosition(q.QuantizePosition(x, y))
+
+		if err := math.Abs(float64(gotX - x)); err > float64(stepX)/2+float32Slack(x) {
+			t.Fatalf("x %v decoded as %v: error %v exceeds half step %v", x, gotX, err, stepX/2)
+		}
+		if err := math.Abs(float64(gotY - y)); err > float64(stepY)/2+float32Slack(y) {
+			t.Fatalf("y %v decoded as %v: error %v exceeds half step %v", y, gotY, err, stepY/2)
+		}
+	}
+}
+
+func TestPositionClampsToArea(t *testing.T) {
+	q := Quantization{MinX: 0, MinY: 0, MaxX: 100, MaxY: 100}
+
+	x, y := q.DequantizePosition(q.QuantizePosition(-50, 250))
+	if x != 0 || y != 100 {
+		t.Errorf("got (%v, %v), want positions clamped to (0, 100)", x, y)
+	}
+
+	x, y = q.DequantizePosition(q.QuantizePosition(float32(math.NaN()), 100))
+	if x != 0 || y != 100 {
+		t.Errorf("got (%v, %v), want NaN encoded as the area's minimum", x, y)
+	}
+}
+
+func TestVelocityRoundTrip(t *testing.T) {
+	for v := float32(-4000); v <= 4000; v += 0.37 {
+		got := DequantizeVelocity(QuantizeVelocity(v))
+		if err := math.Abs(float64(got - v)); err > VelocityStep/2+float32Slack(v) {
+			t.Fatalf("velocity %v decoded as %v: error %v exceeds %v", v, got, err, VelocityStep/2)
+		}
+	}
+
+	if got := DequantizeVelocity(QuantizeVelocity(1e6)); got != MaxVelocity {
+		t.Errorf("velocity 1e6 decoded as %v, want it clamped to %v", got, MaxVelocity)
+	}
+}
+
+func TestHealthRoundTrip(t *testing.T) {
+	for h := float32(0); h <= 1000; h += 0.13 {
+		got := DequantizeHealth(QuantizeHealth(h))
+		if err := math.Abs(float64(got - h)); err > HealthStep/2+float32Slack(h) {
+			t.Fatalf("health %v decoded as %v: error %v exceeds %v", h, got, err, HealthStep/2)
+		}
+	}
+
+	if got := DequantizeHealth(QuantizeHealth(-20)); got != 0 {
+		t.Errorf("health -20 decoded as %v, want 0", got)
+	}
+}
+
+func TestAngleRoundTrip(t *testing.T) {
+	for a := -4 * math.Pi; a <= 4*math.Pi; a += 0.001 {
+		got := DequantizeAngle(QuantizeAngle(float32(a)))
+
+		// Compare directions, since angles a full turn apart are the same
+		diff := math.Mod(float64(got)-a, 2*math.Pi)
+		if diff > math.Pi {
+			diff -= 2 * math.Pi
+		} else if diff < -math.Pi {
+			diff += 2 * math.Pi
+		}
+		if math.Abs(diff) > AngleStep/2+1e-6 {
+			t.Fatalf("angle %v decoded as %v: error %v exceeds %v", a, got, diff, AngleStep/2)
+		}
+		if got < -math.Pi || got >= math.Pi {
+			t.Fatalf("angle %v decoded as %v, outside [-π, π)", a, got)
+		}
+	}
+}
+
+func TestColorRoundTrip(t *testing.T) {
+	for c := float32(0); c <= 1; c += 0.001 {
+		got := DequantizeColor(QuantizeColor(c))
+		if err := math.Abs(float64(got - c)); err > ColorStep/2+1e-6 {
+			t.Fatalf("color %v decoded as %v: error %v exceeds %v", c, got, err, ColorStep/2)
+		}
+	}
+}
+
+func TestQuantizedWorldSnapshotRoundTrip(t *testing.T) {
+	q := Quantization{MinX: -1000, MinY: -1000, MaxX: 5000, MaxY: 3000}
+	player := Player{
+		ID: 7, Name: "Player7",
+		X: 1234.5, Y: -321.25, Width: 50, Height: 70,
+		ColorR: 0.9, ColorG: 0.2, ColorB: 0.2, ColorA: 1,
+		Health: 73.3, MaxHealth: 100,
+		Direction: -1, FaceDirection: -1,
+		VelocityX: -400, VelocityY: 1425.3,
+		TeamID: 2,
+	}
+	snapshot := WorldSnapshotMessage{
+		Tick:              42,
+		BaselineTick:      40,
+		LastInputSequence: 99,
+		Players: []PlayerDelta{
+			{Fields: PlayerFieldsAll, Player: player},
+			{Fields: PlayerFieldX | PlayerFieldHealth, Player: Player{ID: 8, X: 10, Health: 5}},
+		},
+		Removed: []int32{3, 4},
+	}
+
+	data, err := QuantizedWorldSnapshotMessage{Snapshot: snapshot, Quantization: q}.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	float, err := snapshot.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) >= len(float) {
+		t.Errorf("quantized snapshot is %d bytes, float32 snapshot %d", len(data), len(float))
+	}
+
+	msg, err := q.DecodeMessage(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := msg.(QuantizedWorldSnapshotMessage).Snapshot
+
+	if got.Tick != 42 || got.BaselineTick != 40 || got.LastInputSequence != 99 {
+		t.Errorf("got header %d/%d/%d, want 42/40/99", got.Tick, got.BaselineTick, got.LastInputSequence)
+	}
+	if len(got.Removed) != 2 || got.Removed[0] != 3 || got.Removed[1] != 4 {
+		t.Errorf("got removed %v, want [3 4]", got.Removed)
+	}
+	if len(got.Players) != 2 {
+		t.Fatalf("got %d players, want 2", len(got.Players))
+	}
+
+	decoded := got.Players[0].Player
+	stepX, stepY := q.PositionStep()
+	checks := []struct {
+		name      string
+		got, want float32
+		tolerance float64
+	}{
+		{"X", decoded.X, player.X, float64(stepX)/2 + float32Slack(player.X)},
+		{"Y", decoded.Y, player.Y, float64(stepY)/2 + float32Slack(player.Y)},
+		{"Width", decoded.Width, player.Width, 0},
+		{"ColorG", decoded.ColorG, player.ColorG, ColorStep / 2},
+		{"Health", decoded.Health, player.Health, HealthStep/2 + float32Slack(player.Health)},
+		{"MaxHealth", decoded.MaxHealth, player.MaxHealth, 0},
+		{"Direction", decoded.Direction, player.Direction, 0},
+		{"VelocityX", decoded.VelocityX, player.VelocityX, 0},
+		{"VelocityY", decoded.VelocityY, player.VelocityY, VelocityStep / 2},
+	}
+	for _, c := range checks {
+		if err := math.Abs(float64(c.got - c.want)); err > c.tolerance {
+			t.Errorf("%s: got %v, want %v ± %v", c.name, c.got, c.want, c.tolerance)
+		}
+	}
+	if decoded.Name != player.Name || decoded.FaceDirection != -1 || decoded.TeamID != 2 || decoded.ID != 7 {
+		t.Errorf("got %+v, want exact name, face direction, team and ID of %+v", decoded, player)
+	}
+
+	partial := got.Players[1]
+	if partial.Fields != PlayerFieldX|PlayerFieldHealth || partial.Player.ID != 8 || partial.Player.Health != 5 {
+		t.Errorf("got partial delta %+v, want only X and health of player 8", partial)
+	}
+}
+
+func TestQuantizedGunFireRoundTrip(t *testing.T) {
+	q := Quantization{MinX: 0, MinY: 0, MaxX: 8000, MaxY: 4000}
+	fire := GunFire{PlayerID: 3, X: 4000.4, Y: 123.9, Angle: -2.5, Damage: 20, WeaponID: 2}
+
+	data, err := QuantizedBroadcastGunFireMessage{Fire: fire, Quantization: q}.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := q.DecodeMessage(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := msg.(QuantizedBroadcastGunFireMessage).Fire
+
+	stepX, stepY := q.PositionStep()
+	if math.Abs(float64(got.X-fire.X)) > float64(stepX)/2+float32Slack(fire.X) ||
+		math.Abs(float64(got.Y-fire.Y)) > float64(stepY)/2+float32Slack(fire.Y) {
+		t.Errorf("got position (%v, %v), want (%v, %v)", got.X, got.Y, fire.X, fire.Y)
+	}
+	if math.Abs(float64(got.Angle-fire.Angle)) > AngleStep/2+1e-6 {
+		t.Errorf("got angle %v, want %v", got.Angle, fire.Angle)
+	}
+	if got.PlayerID != 3 || got.Damage != 20 || got.WeaponID != 2 {
+		t.Errorf("got %+v, want player 3, damage 20, weapon 2", got)
+	}
+}
+
+func TestQuantizedProjectileSpawnRoundTrip(t *testing.T) {
+	q := Quantization{MinX: 0, MinY: 0, MaxX: 8000, MaxY: 4000}
+	projectile := Projectile{ID: 9, ShooterID: 3, WeaponID: 2, X: 4000.4, Y: 123.9, VelocityX: -1199.3, VelocityY: 35.06, Gravity: 12.5, Tick: 77}
+
+	data, err := QuantizedProjectileSpawnMessage{Projectile: projectile, Quantization: q}.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	float, err := ProjectileSpawnMessage{Projectile: projectile}.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) >= len(float) {
+		t.Errorf("quantized projectile spawn is %d bytes, float32 one %d", len(data), len(float))
+	}
+
+	msg, err := q.DecodeMessage(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := msg.(QuantizedProjectileSpawnMessage).Projectile
+
+	stepX, stepY := q.PositionStep()
+	if math.Abs(float64(got.X-projectile.X)) > float64(stepX)/2+float32Slack(projectile.X) ||
+		math.Abs(float64(got.Y-projectile.Y)) > float64(stepY)/2+float32Slack(projectile.Y) {
+		t.Errorf("got position (%v, %v), want (%v, %v)", got.X, got.Y, projectile.X, projectile.Y)
+	}
+	if math.Abs(float64(got.VelocityX-projectile.VelocityX)) > VelocityStep/2 ||
+		math.Abs(float64(got.VelocityY-projectile.VelocityY)) > VelocityStep/2 {
+		t.Errorf("got velocity (%v, %v), want (%v, %v)", got.VelocityX, got.VelocityY, projectile.VelocityX, projectile.VelocityY)
+	}
+	if got.ID != 9 || got.ShooterID != 3 || got.WeaponID != 2 || got.Gravity != 12.5 || got.Tick != 77 {
+		t.Errorf("got %+v, want exact IDs, gravity and tick of %+v", got, projectile)
+	}
+}
+
+func TestQuantizationMessageRoundTrip(t *testing.T) {
+	q := Quantization{MinX: -1, MinY: -2, MaxX: 3, MaxY: 4}
+	data, err := QuantizationMessage{Quantization: q}.Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := DecodeMessage(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := msg.(QuantizationMessage).Quantization; got != q {
+		t.Errorf("got %+v, want %+v", got, q)
+	}
+
+	empty, _ := QuantizationMessage{}.Encode()
+	if _, err := DecodeMessage(empty); err == nil {
+		t.Error("decoded an empty quantization area")
+	}
+}
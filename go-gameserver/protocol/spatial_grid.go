@@ -1,130 +1,595 @@
 package protocol
 
 import (
-	"fmt"
 	"math"
+	"sort"
+	"sync"
 )
 
-// SpatialGrid is a simple spatial partitioning system for efficient entity queries
+// SpatialGrid is a uniform grid for finding entities by position. Entities are
+// points or axis-aligned boxes; a box is listed in every cell it overlaps,
+// unless it overlaps more than maxEntityCells.
+// It is not safe for concurrent modification; use LockedSpatialGrid when
+// several goroutines share a grid. Queries never modify the grid, so a grid
+// that is no longer written to can be queried from several goroutines.
 type SpatialGrid struct {
-	cellSize  float32
-	cells     map[string]map[int32]bool
-	positions map[int32]Position
+	cellSize float32
+	cells    map[cellKey][]int32
+	entities map[int32]gridEntity
+
+	// Entities overlapping too many cells to list them in each. Every query
+	// checks them, so updating one costs the same however big it is.
+	oversized map[int32]struct{}
 }
 
+// maxEntityCells is how many cells an entity is listed in at most
+const maxEntityCells = 256
+
 // Position represents an entity's position in the world
 type Position struct {
 	X, Y float32
 }
 
+// AABB is an axis-aligned bounding box in world coordinates
+type AABB struct {
+	MinX, MinY, MaxX, MaxY float32
+}
+
+// Overlaps reports whether two boxes intersect or touch
+func (b AABB) Overlaps(other AABB) bool {
+	return b.MinX <= other.MaxX && b.MaxX >= other.MinX && b.MinY <= other.MaxY && b.MaxY >= other.MinY
+}
+
+// distanceSquared returns the squared distance from a point to the nearest
+// point of the box, 0 for points inside it
+func (b AABB) distanceSquared(x, y float32) float32 {
+	dx := max(b.MinX-x, 0, x-b.MaxX)
+	dy := max(b.MinY-y, 0, y-b.MaxY)
+	return dx*dx + dy*dy
+}
+
+// raycast returns the distance along a ray with a unit direction at which it
+// enters the box, or false if it misses within maxDistance
+func (b AABB) raycast(originX, originY, dirX, dirY, maxDistance float32) (float32, bool) {
+	near, far := float32(0), maxDistance
+
+	// Slab test, one axis at a time
+	axes := [2]struct{ origin, dir, min, max float32 }{
+		{originX, dirX, b.MinX, b.MaxX},
+		{originY, dirY, b.MinY, b.MaxY},
+	}
+	for _, a := range axes {
+		if a.dir == 0 {
+			if a.origin < a.min || a.origin > a.max {
+				return 0, false
+			}
+			continue
+		}
+		t1 := (a.min - a.origin) / a.dir
+		t2 := (a.max - a.origin) / a.dir
+		if t1 > t2 {
+			t1, t2 = t2, t1
+		}
+		near = max(near, t1)
+		far = min(far, t2)
+		if near > far {
+			return 0, false
+		}
+	}
+
+	return near, true
+}
+
+// RayHit is an entity crossed by a ray and the distance along it
+type RayHit struct {
+	ID       int32
+	Distance float32
+}
+
+// cellKey packs a cell's column and row into one map key
+type cellKey uint64
+
+func makeCellKey(cellX, cellY int32) cellKey {
+	return cellKey(uint64(uint32(cellX))<<32 | uint64(uint32(cellY)))
+}
+
+// cellRange is an inclusive range of cell columns and rows
+type cellRange struct {
+	minX, minY, maxX, maxY int32
+}
+
+// gridEntity is an entity's box and the cells it is listed in
+type gridEntity struct {
+	box   AABB
+	cells cellRange
+}
+
 // NewSpatialGrid creates a new spatial grid with the specified cell size
 func NewSpatialGrid(cellSize float32) *SpatialGrid {
 	return &SpatialGrid{
 		cellSize:  cellSize,
-		cells:     make(map[string]map[int32]bool),
-		positions: make(map[int32]Position),
+		cells:     make(map[cellKey][]int32),
+		entities:  make(map[int32]gridEntity),
+		oversized: make(map[int32]struct{}),
 	}
 }
 
-// getCellKey returns the key for a cell at the given coordinates
-func (g *SpatialGrid) getCellKey(x, y float32) string {
-	cellX := int(math.Floor(float64(x / g.cellSize)))
-	cellY := int(math.Floor(float64(y / g.cellSize)))
-	return fmt.Sprintf("%d:%d", cellX, cellY)
+// cellCoord returns the column or row containing a coordinate. Coordinates
+// beyond the grid's reach, and NaN, are clamped so every entity has a cell.
+func (g *SpatialGrid) cellCoord(v float32) int32 {
+	c := math.Floor(float64(v) / float64(g.cellSize))
+	if c != c {
+		return 0
+	}
+	return int32(max(math.MinInt32, min(math.MaxInt32, c)))
+}
+
+// count returns how many cells the range covers
+func (c cellRange) count() float64 {
+	return (float64(c.maxX) - float64(c.minX) + 1) * (float64(c.maxY) - float64(c.minY) + 1)
 }
 
-// Insert adds an entity to the grid
+// cellsOf returns the cells a box overlaps. An inverted box covers the cell
+// of its minimum corner.
+func (g *SpatialGrid) cellsOf(box AABB) cellRange {
+	cells := cellRange{
+		minX: g.cellCoord(box.MinX),
+		minY: g.cellCoord(box.MinY),
+		maxX: g.cellCoord(box.MaxX),
+		maxY: g.cellCoord(box.MaxY),
+	}
+	cells.maxX = max(cells.maxX, cells.minX)
+	cells.maxY = max(cells.maxY, cells.minY)
+	return cells
+}
+
+// Insert adds a point entity to the grid, replacing any previous entry for id
 func (g *SpatialGrid) Insert(id int32, x, y float32) {
-	// Remove from old position if exists
+	g.InsertRect(id, AABB{MinX: x, MinY: y, MaxX: x, MaxY: y})
+}
+
+// InsertRect adds a box entity to the grid, replacing any previous entry for id
+func (g *SpatialGrid) InsertRect(id int32, box AABB) {
 	g.Remove(id)
 
-	// Store new position
-	g.positions[id] = Position{X: x, Y: y}
+	cells := g.cellsOf(box)
+	g.entities[id] = gridEntity{box: box, cells: cells}
+	g.addToCells(id, cells)
+}
 
-	// Get cell key
-	key := g.getCellKey(x, y)
+// Move updates a point entity's position, inserting it if it is not in the grid
+func (g *SpatialGrid) Move(id int32, x, y float32) {
+	g.MoveRect(id, AABB{MinX: x, MinY: y, MaxX: x, MaxY: y})
+}
 
-	// Create cell if it doesn't exist
-	if _, exists := g.cells[key]; !exists {
-		g.cells[key] = make(map[int32]bool)
+// MoveRect updates a box entity's bounds, inserting it if it is not in the
+// grid. The cell lists are only touched when the box crosses into other cells.
+func (g *SpatialGrid) MoveRect(id int32, box AABB) {
+	entity, exists := g.entities[id]
+	if !exists {
+		g.InsertRect(id, box)
+		return
 	}
 
-	// Add entity to cell
-	g.cells[key][id] = true
+	cells := g.cellsOf(box)
+	if cells != entity.cells {
+		g.removeFromCells(id, entity.cells)
+		g.addToCells(id, cells)
+	}
+	g.entities[id] = gridEntity{box: box, cells: cells}
 }
 
 // Remove removes an entity from the grid
 func (g *SpatialGrid) Remove(id int32) {
-	// Check if entity exists in the grid
-	pos, exists := g.positions[id]
+	entity, exists := g.entities[id]
 	if !exists {
 		return
 	}
+	g.removeFromCells(id, entity.cells)
+	delete(g.entities, id)
+}
 
-	// Get cell key
-	key := g.getCellKey(pos.X, pos.Y)
+// addToCells lists an entity in its cells, or among the oversized entities
+// when there are too many of them
+func (g *SpatialGrid) addToCells(id int32, cells cellRange) {
+	if cells.count() > maxEntityCells {
+		g.oversized[id] = struct{}{}
+		return
+	}
+	for cellX := cells.minX; ; cellX++ {
+		for cellY := cells.minY; ; cellY++ {
+			key := makeCellKey(cellX, cellY)
+			g.cells[key] = append(g.cells[key], id)
+			if cellY == cells.maxY {
+				break
+			}
+		}
+		if cellX == cells.maxX {
+			break
+		}
+	}
+}
 
-	// Remove entity from cell
-	if cell, exists := g.cells[key]; exists {
-		delete(cell, id)
-		
-		// Remove cell if empty
-		if len(cell) == 0 {
-			delete(g.cells, key)
+// removeFromCells undoes addToCells
+func (g *SpatialGrid) removeFromCells(id int32, cells cellRange) {
+	if cells.count() > maxEntityCells {
+		delete(g.oversized, id)
+		return
+	}
+	for cellX := cells.minX; ; cellX++ {
+		for cellY := cells.minY; ; cellY++ {
+			key := makeCellKey(cellX, cellY)
+			cell := g.cells[key]
+			for i, other := range cell {
+				if other == id {
+					// Order within a cell doesn't matter, so swap in the last entity
+					cell[i] = cell[len(cell)-1]
+					cell = cell[:len(cell)-1]
+					break
+				}
+			}
+			if len(cell) == 0 {
+				delete(g.cells, key)
+			} else {
+				g.cells[key] = cell
+			}
+			if cellY == cells.maxY {
+				break
+			}
+		}
+		if cellX == cells.maxX {
+			break
+		}
+	}
+}
+
+// visit calls fn once for every entity listed in a cell of query, stopping
+// early if fn returns false. An entity listed in several cells is only
+// visited from the first of them the query covers, so queries need no
+// bookkeeping and never write to the grid.
+func (g *SpatialGrid) visit(query cellRange, fn func(id int32, entity gridEntity) bool) {
+	// Looking up more cells than are occupied costs more than scanning every entity
+	if query.count() > float64(len(g.cells)) {
+		for id, entity := range g.entities {
+			if overlapsCells(entity.cells, query) && !fn(id, entity) {
+				return
+			}
 		}
+		return
 	}
 
-	// Remove position
-	delete(g.positions, id)
+	// Oversized entities are in no cell, so they are checked one by one
+	for id := range g.oversized {
+		if entity := g.entities[id]; overlapsCells(entity.cells, query) && !fn(id, entity) {
+			return
+		}
+	}
+
+	for cellX := query.minX; ; cellX++ {
+		for cellY := query.minY; ; cellY++ {
+			for _, id := range g.cells[makeCellKey(cellX, cellY)] {
+				entity := g.entities[id]
+				first := max(entity.cells.minX, query.minX) == cellX && max(entity.cells.minY, query.minY) == cellY
+				if first && !fn(id, entity) {
+					return
+				}
+			}
+			if cellY == query.maxY {
+				break
+			}
+		}
+		if cellX == query.maxX {
+			break
+		}
+	}
 }
 
-// GetNearbyEntities returns all entities within the specified radius of a point
+func overlapsCells(a, b cellRange) bool {
+	return a.minX <= b.maxX && a.maxX >= b.minX && a.minY <= b.maxY && a.maxY >= b.minY
+}
+
+// GetNearbyEntities returns all entities within the specified radius of a
+// point, measured to the nearest point of each entity's box
 func (g *SpatialGrid) GetNearbyEntities(x, y, radius float32) []int32 {
 	result := make([]int32, 0)
 	radiusSquared := radius * radius
 
-	// Calculate cell range to check
-	minCellX := int(math.Floor(float64((x - radius) / g.cellSize)))
-	maxCellX := int(math.Floor(float64((x + radius) / g.cellSize)))
-	minCellY := int(math.Floor(float64((y - radius) / g.cellSize)))
-	maxCellY := int(math.Floor(float64((y + radius) / g.cellSize)))
-
-	// Check all cells in range
-	for cellX := minCellX; cellX <= maxCellX; cellX++ {
-		for cellY := minCellY; cellY <= maxCellY; cellY++ {
-			key := fmt.Sprintf("%d:%d", cellX, cellY)
-			
-			// Skip if cell doesn't exist
-			if cell, exists := g.cells[key]; exists {
-				// Check all entities in cell
-				for id := range cell {
-					pos := g.positions[id]
-					
-					// Calculate distance squared
-					dx := pos.X - x
-					dy := pos.Y - y
-					distanceSquared := dx*dx + dy*dy
-					
-					// Add entity if within radius
-					if distanceSquared <= radiusSquared {
-						result = append(result, id)
-					}
-				}
+	area := AABB{MinX: x - radius, MinY: y - radius, MaxX: x + radius, MaxY: y + radius}
+	g.visit(g.cellsOf(area), func(id int32, entity gridEntity) bool {
+		if entity.box.distanceSquared(x, y) <= radiusSquared {
+			result = append(result, id)
+		}
+		return true
+	})
+
+	return result
+}
+
+// QueryRect returns all entities whose boxes overlap or touch box
+func (g *SpatialGrid) QueryRect(box AABB) []int32 {
+	result := make([]int32, 0)
+
+	g.visit(g.cellsOf(box), func(id int32, entity gridEntity) bool {
+		if entity.box.Overlaps(box) {
+			result = append(result, id)
+		}
+		return true
+	})
+
+	return result
+}
+
+// QueryRay returns the entities crossed by the ray from (originX, originY)
+// in direction (dirX, dirY) within maxDistance, nearest first. The direction
+// does not need to be normalized; distances are in world units. maxDistance
+// must be finite, since the ray is walked cell by cell.
+func (g *SpatialGrid) QueryRay(originX, originY, dirX, dirY, maxDistance float32) []RayHit {
+	hits := make([]RayHit, 0)
+
+	length := float32(math.Hypot(float64(dirX), float64(dirY)))
+	if length == 0 || !(maxDistance >= 0) || math.IsInf(float64(maxDistance), 1) {
+		return hits
+	}
+	dirX, dirY = dirX/length, dirY/length
+
+	// Oversized entities are in no cell, so they are tested one by one
+	for id := range g.oversized {
+		if distance, hit := g.entities[id].box.raycast(originX, originY, dirX, dirY, maxDistance); hit {
+			hits = append(hits, RayHit{ID: id, Distance: distance})
+		}
+	}
+
+	// Entities are tested in each cell the ray passes through, walking the
+	// cells in order with the Amanatides-Woo traversal
+	cellX, cellY := g.cellCoord(originX), g.cellCoord(originY)
+	endX, endY := g.cellCoord(originX+dirX*maxDistance), g.cellCoord(originY+dirY*maxDistance)
+	stepX, nextX, deltaX := g.traversal(originX, dirX, cellX)
+	stepY, nextY, deltaY := g.traversal(originY, dirY, cellY)
+
+	for {
+		for _, id := range g.cells[makeCellKey(cellX, cellY)] {
+			if containsHit(hits, id) {
+				continue
+			}
+			if distance, hit := g.entities[id].box.raycast(originX, originY, dirX, dirY, maxDistance); hit {
+				hits = append(hits, RayHit{ID: id, Distance: distance})
 			}
 		}
+
+		if cellX == endX && cellY == endY {
+			break
+		}
+		if nextX < nextY {
+			if nextX > maxDistance {
+				break
+			}
+			cellX += stepX
+			nextX += deltaX
+		} else {
+			if nextY > maxDistance {
+				break
+			}
+			cellY += stepY
+			nextY += deltaY
+		}
 	}
 
-	return result
+	sort.Slice(hits, func(i, j int) bool { return hits[i].Distance < hits[j].Distance })
+	return hits
+}
+
+// traversal returns the step direction along one axis, the ray distance at
+// which it crosses into the next cell and the distance between crossings
+func (g *SpatialGrid) traversal(origin, dir float32, cell int32) (step int32, next, delta float32) {
+	inf := float32(math.Inf(1))
+	switch {
+	case dir > 0:
+		boundary := float32(cell+1) * g.cellSize
+		return 1, (boundary - origin) / dir, g.cellSize / dir
+	case dir < 0:
+		boundary := float32(cell) * g.cellSize
+		return -1, (boundary - origin) / dir, -g.cellSize / dir
+	default:
+		return 0, inf, inf
+	}
+}
+
+func containsHit(hits []RayHit, id int32) bool {
+	for _, hit := range hits {
+		if hit.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// Nearest returns the entity closest to a point within maxDistance, measured
+// to the nearest point of its box, skipping entities for which skip returns
+// true. skip may be nil.
+func (g *SpatialGrid) Nearest(x, y, maxDistance float32, skip func(id int32) bool) (int32, float32, bool) {
+	bestID, bestSquared, found := int32(0), maxDistance*maxDistance, false
+	consider := func(id int32, entity gridEntity) bool {
+		if skip != nil && skip(id) {
+			return true
+		}
+		if d := entity.box.distanceSquared(x, y); d <= bestSquared && (!found || d < bestSquared || id < bestID) {
+			bestID, bestSquared, found = id, d, true
+		}
+		return true
+	}
+
+	if !(maxDistance >= 0) {
+		return 0, 0, false
+	}
+
+	// Search rings of cells outwards from the point's cell, until no closer
+	// entity can be found in the next ring. When there are more cells in
+	// range than occupied ones, every entity is checked instead.
+	centerX, centerY := g.cellCoord(x), g.cellCoord(y)
+	rings := min(float64(maxDistance/g.cellSize)+1, math.MaxInt16)
+	if (2*rings+1)*(2*rings+1) > float64(len(g.cells)) {
+		for id, entity := range g.entities {
+			consider(id, entity)
+		}
+	} else {
+		for ring := int32(0); ring <= int32(rings); ring++ {
+			if found && float32(ring-1)*g.cellSize > float32(math.Sqrt(float64(bestSquared))) {
+				break
+			}
+			g.visitRing(centerX, centerY, ring, consider)
+		}
+	}
+
+	if !found {
+		return 0, 0, false
+	}
+	return bestID, float32(math.Sqrt(float64(bestSquared))), true
+}
+
+// visitRing visits the entities listed in the cells exactly ring cells away
+// from a center cell. An entity spanning several rings may be visited once
+// per ring.
+func (g *SpatialGrid) visitRing(centerX, centerY, ring int32, fn func(id int32, entity gridEntity) bool) {
+	if ring == 0 {
+		g.visit(cellRange{centerX, centerY, centerX, centerY}, fn)
+		return
+	}
+
+	minX, maxX := centerX-ring, centerX+ring
+	minY, maxY := centerY-ring, centerY+ring
+	g.visit(cellRange{minX, minY, maxX, minY}, fn)         // Top row
+	g.visit(cellRange{minX, maxY, maxX, maxY}, fn)         // Bottom row
+	g.visit(cellRange{minX, minY + 1, minX, maxY - 1}, fn) // Left column
+	g.visit(cellRange{maxX, minY + 1, maxX, maxY - 1}, fn) // Right column
 }
 
-// GetPosition returns the position of an entity
+// GetPosition returns the position of an entity, the center of its box
 func (g *SpatialGrid) GetPosition(id int32) (Position, bool) {
-	pos, exists := g.positions[id]
-	return pos, exists
+	entity, exists := g.entities[id]
+	if !exists {
+		return Position{}, false
+	}
+	return Position{X: (entity.box.MinX + entity.box.MaxX) / 2, Y: (entity.box.MinY + entity.box.MaxY) / 2}, true
+}
+
+// Bounds returns the box of an entity
+func (g *SpatialGrid) Bounds(id int32) (AABB, bool) {
+	entity, exists := g.entities[id]
+	return entity.box, exists
+}
+
+// Len returns how many entities are in the grid
+func (g *SpatialGrid) Len() int {
+	return len(g.entities)
 }
 
 // Clear removes all entities from the grid
 func (g *SpatialGrid) Clear() {
-	g.cells = make(map[string]map[int32]bool)
-	g.positions = make(map[int32]Position)
+	g.cells = make(map[cellKey][]int32)
+	g.entities = make(map[int32]gridEntity)
+	g.oversized = make(map[int32]struct{})
+}
+
+// LockedSpatialGrid is a SpatialGrid that is safe for concurrent use.
+// Queries share a read lock, so they can run in parallel with each other.
+type LockedSpatialGrid struct {
+	mu   sync.RWMutex
+	grid *SpatialGrid
+}
+
+// NewLockedSpatialGrid creates a new concurrency-safe spatial grid with the specified cell size
+func NewLockedSpatialGrid(cellSize float32) *LockedSpatialGrid {
+	return &LockedSpatialGrid{grid: NewSpatialGrid(cellSize)}
+}
+
+// Insert adds a point entity to the grid, replacing any previous entry for id
+func (l *LockedSpatialGrid) Insert(id int32, x, y float32) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.grid.Insert(id, x, y)
+}
+
+// InsertRect adds a box entity to the grid, replacing any previous entry for id
+func (l *LockedSpatialGrid) InsertRect(id int32, box AABB) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.grid.InsertRect(id, box)
+}
+
+// Move updates a point entity's position, inserting it if it is not in the grid
+func (l *LockedSpatialGrid) Move(id int32, x, y float32) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.grid.Move(id, x, y)
+}
+
+// MoveRect updates a box entity's bounds, inserting it if it is not in the grid
+func (l *LockedSpatialGrid) MoveRect(id int32, box AABB) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.grid.MoveRect(id, box)
+}
+
+// Remove removes an entity from the grid
+func (l *LockedSpatialGrid) Remove(id int32) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.grid.Remove(id)
+}
+
+// GetNearbyEntities returns all entities within the specified radius of a point
+func (l *LockedSpatialGrid) GetNearbyEntities(x, y, radius float32) []int32 {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.grid.GetNearbyEntities(x, y, radius)
+}
+
+// QueryRect returns all entities whose boxes overlap or touch box
+func (l *LockedSpatialGrid) QueryRect(box AABB) []int32 {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.grid.QueryRect(box)
+}
+
+// QueryRay returns the entities crossed by a ray within maxDistance, nearest first
+func (l *LockedSpatialGrid) QueryRay(originX, originY, dirX, dirY, maxDistance float32) []RayHit {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.grid.QueryRay(originX, originY, dirX, dirY, maxDistance)
+}
+
+// Nearest returns the entity closest to a point within maxDistance. skip is
+// called with the read lock held and must not use the grid.
+func (l *LockedSpatialGrid) Nearest(x, y, maxDistance float32, skip func(id int32) bool) (int32, float32, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.grid.Nearest(x, y, maxDistance, skip)
+}
+
+// GetPosition returns the position of an entity, the center of its box
+func (l *LockedSpatialGrid) GetPosition(id int32) (Position, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.grid.GetPosition(id)
+}
+
+// Bounds returns the box of an entity
+func (l *LockedSpatialGrid) Bounds(id int32) (AABB, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.grid.Bounds(id)
+}
+
+// Len returns how many entities are in the grid
+func (l *LockedSpatialGrid) Len() int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.grid.Len()
+}
+
+// Clear removes all entities from the grid
+func (l *LockedSpatialGrid) Clear() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.grid.Clear()
 }
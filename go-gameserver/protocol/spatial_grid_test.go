@@ -0,0 +1,409 @@
+package protocol
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+// randomBox returns a point or a box of up to 600x200 inside a 20000x4000 area
+func randomBox(rng *rand.Rand) AABB {
+	x := rng.Float32()*20000 - 10000
+	y := rng.Float32()*4000 - 2000
+	if rng.Intn(2) == 0 {
+		return AABB{MinX: x, MinY: y, MaxX: x, MaxY: y}
+	}
+	return AABB{MinX: x, MinY: y, MaxX: x + rng.Float32()*600, MaxY: y + rng.Float32()*200}
+}
+
+func sortedIDs(ids []int32) []int32 {
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+func sameIDs(a, b []int32) bool {
+	a, b = sortedIDs(a), sortedIDs(b)
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestSpatialGridMatchesBruteForce(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	grid := NewSpatialGrid(256)
+	boxes := make(map[int32]AABB)
+
+	// Insert, move and remove entities, keeping the expected boxes alongside
+	for i := 0; i < 5000; i++ {
+		id := int32(rng.Intn(1000))
+		switch rng.Intn(4) {
+		case 0:
+			grid.Remove(id)
+			delete(boxes, id)
+		case 1:
+			box := boxes[id]
+			box.MinX += 40
+			box.MaxX += 40
+			grid.MoveRect(id, box)
+			boxes[id] = box
+		default:
+			box := randomBox(rng)
+			if rng.Intn(50) == 0 {
+				// Too big to list in each of its cells
+				box.MaxX += 10000
+				box.MaxY += 3000
+			}
+			grid.InsertRect(id, box)
+			boxes[id] = box
+		}
+	}
+	if len(grid.oversized) == 0 {
+		t.Fatal("no oversized entities left to query")
+	}
+	if grid.Len() != len(boxes) {
+		t.Fatalf("grid has %d entities, want %d", grid.Len(), len(boxes))
+	}
+
+	for i := 0; i < 500; i++ {
+		query := randomBox(rng)
+		query.MaxX += 300
+		query.MaxY += 300
+
+		var want []int32
+		for id, box := range boxes {
+			if box.Overlaps(query) {
+				want = append(want, id)
+			}
+		}
+		if got := grid.QueryRect(query); !sameIDs(got, want) {
+			t.Fatalf("QueryRect(%+v) = %v, want %v", query, sortedIDs(got), sortedIDs(want))
+		}
+
+		x, y, radius := query.MinX, query.MinY, rng.Float32()*1500
+		want = want[:0]
+		for id, box := range boxes {
+			if box.distanceSquared(x, y) <= radius*radius {
+				want = append(want, id)
+			}
+		}
+		if got := grid.GetNearbyEntities(x, y, radius); !sameIDs(got, want) {
+			t.Fatalf("GetNearbyEntities(%v, %v, %v) = %v, want %v", x, y, radius, sortedIDs(got), sortedIDs(want))
+		}
+
+		wantID, wantDistance, wantFound := int32(0), float32(0), false
+		for id, box := range boxes {
+			d := float32(math.Sqrt(float64(box.distanceSquared(x, y))))
+			if d <= radius && (!wantFound || d < wantDistance || (d == wantDistance && id < wantID)) {
+				wantID, wantDistance, wantFound = id, d, true
+			}
+		}
+		gotID, gotDistance, gotFound := grid.Nearest(x, y, radius, nil)
+		if gotFound != wantFound || gotID != wantID || math.Abs(float64(gotDistance-wantDistance)) > 1e-3 {
+			t.Fatalf("Nearest(%v, %v, %v) = %d at %v (%v), want %d at %v (%v)",
+				x, y, radius, gotID, gotDistance, gotFound, wantID, wantDistance, wantFound)
+		}
+
+		angle := rng.Float64() * 2 * math.Pi
+		dirX, dirY := float32(math.Cos(angle)), float32(math.Sin(angle))
+		hits := grid.QueryRay(x, y, dirX, dirY, 3000)
+		want = want[:0]
+		for id, box := range boxes {
+			if _, hit := box.raycast(x, y, dirX, dirY, 3000); hit {
+				want = append(want, id)
+			}
+		}
+		got := make([]int32, 0, len(hits))
+		for i, hit := range hits {
+			got = append(got, hit.ID)
+			if i > 0 && hit.Distance < hits[i-1].Distance {
+				t.Fatalf("QueryRay hits out of order: %+v", hits)
+			}
+		}
+		if !sameIDs(got, want) {
+			t.Fatalf("QueryRay from (%v, %v) towards %v = %v, want %v", x, y, angle, sortedIDs(got), sortedIDs(want))
+		}
+	}
+}
+
+func TestSpatialGridWideBoxSpansCells(t *testing.T) {
+	grid := NewSpatialGrid(100)
+	grid.InsertRect(1, AABB{MinX: 0, MinY: 0, MaxX: 1000, MaxY: 10})
+
+	if got := grid.QueryRect(AABB{MinX: 950, MinY: 5, MaxX: 960, MaxY: 6}); !sameIDs(got, []int32{1}) {
+		t.Errorf("query over the far end of a wide box found %v, want [1]", got)
+	}
+	if got := grid.QueryRect(AABB{MinX: -50, MinY: -50, MaxX: 1050, MaxY: 50}); len(got) != 1 {
+		t.Errorf("query over the whole box found %v, want it once", got)
+	}
+
+	grid.Remove(1)
+	if grid.Len() != 0 || len(grid.cells) != 0 {
+		t.Errorf("grid kept %d entities and %d cells after removing the box", grid.Len(), len(grid.cells))
+	}
+}
+
+func TestSpatialGridHugeBox(t *testing.T) {
+	grid := NewSpatialGrid(100)
+	inf := float32(math.Inf(1))
+
+	// Boxes spanning millions of cells, or every cell, are not listed in each
+	grid.InsertRect(1, AABB{MinX: 0, MinY: 0, MaxX: 1e6, MaxY: 1e6})
+	grid.InsertRect(2, AABB{MinX: -inf, MinY: -inf, MaxX: inf, MaxY: inf})
+	if len(grid.cells) != 0 || len(grid.oversized) != 2 {
+		t.Fatalf("grid has %d cells and %d oversized entities, want 0 and 2", len(grid.cells), len(grid.oversized))
+	}
+
+	if got := grid.QueryRect(AABB{MinX: 500, MinY: 500, MaxX: 510, MaxY: 510}); !sameIDs(got, []int32{1, 2}) {
+		t.Errorf("query inside the huge boxes found %v, want [1 2]", got)
+	}
+	if got := grid.GetNearbyEntities(-50, -50, 10); !sameIDs(got, []int32{2}) {
+		t.Errorf("query outside the first box found %v, want [2]", got)
+	}
+	if hits := grid.QueryRay(-50, 5, 1, 0, 100); len(hits) != 2 || hits[0].ID != 2 || hits[1].ID != 1 {
+		t.Errorf("ray hit %+v, want 2 then 1", hits)
+	}
+
+	// Shrinking a box lists it in its cells again
+	grid.MoveRect(1, AABB{MinX: 0, MinY: 0, MaxX: 10, MaxY: 10})
+	if len(grid.cells) != 1 || len(grid.oversized) != 1 {
+		t.Errorf("grid has %d cells and %d oversized entities after shrinking, want 1 and 1", len(grid.cells), len(grid.oversized))
+	}
+	grid.Remove(2)
+	if len(grid.oversized) != 0 {
+		t.Errorf("grid kept %d oversized entities after removing them", len(grid.oversized))
+	}
+}
+
+func TestSpatialGridMoveWithinCell(t *testing.T) {
+	grid := NewSpatialGrid(100)
+	grid.Insert(1, 10, 10)
+	grid.Move(1, 20, 30)
+
+	if pos, _ := grid.GetPosition(1); pos != (Position{X: 20, Y: 30}) {
+		t.Errorf("got position %+v after moving, want (20, 30)", pos)
+	}
+	if got := grid.GetNearbyEntities(20, 30, 1); !sameIDs(got, []int32{1}) {
+		t.Errorf("found %v at the new position, want [1]", got)
+	}
+
+	grid.Move(1, 250, 30)
+	if got := grid.GetNearbyEntities(20, 30, 1); len(got) != 0 {
+		t.Errorf("found %v at the old position after moving to another cell", got)
+	}
+	if len(grid.cells) != 1 {
+		t.Errorf("grid has %d cells for one point, want 1", len(grid.cells))
+	}
+}
+
+// legacySpatialGrid is the string-keyed grid SpatialGrid replaced, kept to
+// benchmark against
+type legacySpatialGrid struct {
+	cellSize  float32
+	cells     map[string]map[int32]bool
+	positions map[int32]Position
+}
+
+func newLegacySpatialGrid(cellSize float32) *legacySpatialGrid {
+	return &legacySpatialGrid{
+		cellSize:  cellSize,
+		cells:     make(map[string]map[int32]bool),
+		positions: make(map[int32]Position),
+	}
+}
+
+func (g *legacySpatialGrid) getCellKey(x, y float32) string {
+	cellX := int(math.Floor(float64(x / g.cellSize)))
+	cellY := int(math.Floor(float64(y / g.cellSize)))
+	return fmt.Sprintf("%d:%d", cellX, cellY)
+}
+
+func (g *legacySpatialGrid) Insert(id int32, x, y float32) {
+	g.Remove(id)
+	g.positions[id] = Position{X: x, Y: y}
+	key := g.getCellKey(x, y)
+	if _, exists := g.cells[key]; !exists {
+		g.cells[key] = make(map[int32]bool)
+	}
+	g.cells[key][id] = true
+}
+
+func (g *legacySpatialGrid) Remove(id int32) {
+	pos, exists := g.positions[id]
+	if !exists {
+		return
+	}
+	key := g.getCellKey(pos.X, pos.Y)
+	if cell, exists := g.cells[key]; exists {
+		delete(cell, id)
+		if len(cell) == 0 {
+			delete(g.cells, key)
+		}
+	}
+	delete(g.positions, id)
+}
+
+func (g *legacySpatialGrid) GetNearbyEntities(x, y, radius float32) []int32 {
+	result := make([]int32, 0)
+	radiusSquared := radius * radius
+	minCellX := int(math.Floor(float64((x - radius) / g.cellSize)))
+	maxCellX := int(math.Floor(float64((x + radius) / g.cellSize)))
+	minCellY := int(math.Floor(float64((y - radius) / g.cellSize)))
+	maxCellY := int(math.Floor(float64((y + radius) / g.cellSize)))
+	for cellX := minCellX; cellX <= maxCellX; cellX++ {
+		for cellY := minCellY; cellY <= maxCellY; cellY++ {
+			key := fmt.Sprintf("%d:%d", cellX, cellY)
+			if cell, exists := g.cells[key]; exists {
+				for id := range cell {
+					pos := g.positions[id]
+					dx := pos.X - x
+					dy := pos.Y - y
+					if dx*dx+dy*dy <= radiusSquared {
+						result = append(result, id)
+					}
+				}
+			}
+		}
+	}
+	return result
+}
+
+// pointGrid is the part of the API both grids share
+type pointGrid interface {
+	Insert(id int32, x, y float32)
+	GetNearbyEntities(x, y, radius float32) []int32
+}
+
+const benchEntities = 2000
+
+func benchPoints() []Position {
+	rng := rand.New(rand.NewSource(1))
+	points := make([]Position, benchEntities)
+	for i := range points {
+		points[i] = Position{X: rng.Float32()*20000 - 10000, Y: rng.Float32()*4000 - 2000}
+	}
+	return points
+}
+
+func benchGrids() []struct {
+	name string
+	make func() pointGrid
+} {
+	return []struct {
+		name string
+		make func() pointGrid
+	}{
+		{"legacy", func() pointGrid { return newLegacySpatialGrid(512) }},
+		{"grid", func() pointGrid { return NewSpatialGrid(512) }},
+	}
+}
+
+func BenchmarkSpatialGridInsert(b *testing.B) {
+	points := benchPoints()
+	for _, g := range benchGrids() {
+		b.Run(g.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				grid := g.make()
+				for id, p := range points {
+					grid.Insert(int32(id), p.X, p.Y)
+				}
+			}
+		})
+	}
+}
+
+// BenchmarkSpatialGridMove moves every entity a few pixels, as a tick does.
+// The legacy grid has no Move, so it reinserts.
+func BenchmarkSpatialGridMove(b *testing.B) {
+	points := benchPoints()
+	for _, g := range benchGrids() {
+		b.Run(g.name, func(b *testing.B) {
+			grid := g.make()
+			for id, p := range points {
+				grid.Insert(int32(id), p.X, p.Y)
+			}
+			move := grid.Insert
+			if grid, ok := grid.(*SpatialGrid); ok {
+				move = grid.Move
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				offset := float32(i%16) * 4
+				for id, p := range points {
+					move(int32(id), p.X+offset, p.Y)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkSpatialGridGetNearbyEntities(b *testing.B) {
+	points := benchPoints()
+	for _, g := range benchGrids() {
+		b.Run(g.name, func(b *testing.B) {
+			grid := g.make()
+			for id, p := range points {
+				grid.Insert(int32(id), p.X, p.Y)
+			}
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				p := points[i%len(points)]
+				grid.GetNearbyEntities(p.X, p.Y, 2500)
+			}
+		})
+	}
+}
+
+func benchBoxGrid() (*SpatialGrid, []AABB) {
+	rng := rand.New(rand.NewSource(1))
+	grid := NewSpatialGrid(512)
+	boxes := make([]AABB, benchEntities)
+	for i := range boxes {
+		boxes[i] = randomBox(rng)
+		grid.InsertRect(int32(i), boxes[i])
+	}
+	return grid, boxes
+}
+
+func BenchmarkSpatialGridQueryRect(b *testing.B) {
+	grid, boxes := benchBoxGrid()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		box := boxes[i%len(boxes)]
+		grid.QueryRect(AABB{MinX: box.MinX, MinY: box.MinY, MaxX: box.MinX + 50, MaxY: box.MinY + 70})
+	}
+}
+
+func BenchmarkSpatialGridQueryRay(b *testing.B) {
+	grid, boxes := benchBoxGrid()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		box := boxes[i%len(boxes)]
+		angle := float64(i%360) * math.Pi / 180
+		grid.QueryRay(box.MinX, box.MinY, float32(math.Cos(angle)), float32(math.Sin(angle)), 2000)
+	}
+}
+
+func BenchmarkSpatialGridNearest(b *testing.B) {
+	grid, boxes := benchBoxGrid()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		box := boxes[i%len(boxes)]
+		grid.Nearest(box.MinX, box.MinY-300, 2500, nil)
+	}
+}
@@ -0,0 +1,261 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+)
+
+// The wire format is little-endian throughout. Messages append their fields
+// to a caller's buffer and decode them from a reader over the received
+// frame, so neither direction allocates beyond the strings and slices a
+// decoded message holds.
+
+var (
+	// ErrTruncated is returned for messages that end before all of their fields
+	ErrTruncated = errors.New("message truncated")
+
+	// ErrTooLong is returned for strings and arrays that are longer than
+	// their field allows, or have a negative length
+	ErrTooLong = errors.New("length over limit")
+
+	// ErrTrailingBytes is returned for messages that go on past their last field
+	ErrTrailingBytes = errors.New("trailing bytes after message")
+
+	// ErrUnknownType is returned for messages of a type the package doesn't decode
+	ErrUnknownType = errors.New("unknown message type")
+)
+
+// tooLong returns ErrTooLong for a field, such as "Player.Name"
+func tooLong(field string) error {
+	return fmt.Errorf("%s: %w", field, ErrTooLong)
+}
+
+func appendBool(dst []byte, v bool) []byte {
+	if v {
+		return append(dst, 1)
+	}
+	return append(dst, 0)
+}
+
+func appendUint8(dst []byte, v uint8) []byte {
+	return append(dst, v)
+}
+
+func appendInt8(dst []byte, v int8) []byte {
+	return append(dst, byte(v))
+}
+
+func appendUint16(dst []byte, v uint16) []byte {
+	return binary.LittleEndian.AppendUint16(dst, v)
+}
+
+func appendInt16(dst []byte, v int16) []byte {
+	return binary.LittleEndian.AppendUint16(dst, uint16(v))
+}
+
+func appendUint32(dst []byte, v uint32) []byte {
+	return binary.LittleEndian.AppendUint32(dst, v)
+}
+
+func appendInt32(dst []byte, v int32) []byte {
+	return binary.LittleEndian.AppendUint32(dst, uint32(v))
+}
+
+func appendFloat32(dst []byte, v float32) []byte {
+	return binary.LittleEndian.AppendUint32(dst, math.Float32bits(v))
+}
+
+// appendField appends the value a fieldRef points to
+func appendField(dst []byte, value any) []byte {
+	switch v := value.(type) {
+	case *bool:
+		return appendBool(dst, *v)
+	case *uint8:
+		return appendUint8(dst, *v)
+	case *int8:
+		return appendInt8(dst, *v)
+	case *uint16:
+		return appendUint16(dst, *v)
+	case *int16:
+		return appendInt16(dst, *v)
+	case *int32:
+		return appendInt32(dst, *v)
+	case *float32:
+		return appendFloat32(dst, *v)
+	}
+	panic("protocol: unsupported field type")
+}
+
+// fieldRef is a player field's bit and a pointer to where its value is
+// kept, so encoding and decoding a delta walk the same table
+type fieldRef struct {
+	field PlayerField
+	value any
+}
+
+// reader decodes fields from the front of a message. The first read past
+// the end sets err to ErrTruncated, and the first bad length to the error
+// length returns; reads after that return zero values, so a decoder can
+// check err once it is done.
+type reader struct {
+	data []byte
+	err  error
+}
+
+// Len returns how many bytes are left to read
+func (r *reader) Len() int {
+	return len(r.data)
+}
+
+// next consumes n bytes, or returns nil and sets err when fewer are left
+func (r *reader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n > len(r.data) {
+		r.err = ErrTruncated
+		r.data = nil
+		return nil
+	}
+	b := r.data[:n]
+	r.data = r.data[n:]
+	return b
+}
+
+// length checks the length read from in front of a string or array: it must
+// not be negative or over max (0 = no limit but the prefix's), and that many
+// elements of at least elemSize bytes each must fit in what is left. A bad
+// length sets err, and length returns 0 so the caller reads nothing more.
+func (r *reader) length(n, max, elemSize int, field string) int {
+	switch {
+	case r.err != nil:
+		return 0
+	case n < 0 || max > 0 && n > max:
+		r.err = tooLong(field)
+	case elemSize > 0 && n > r.Len()/elemSize:
+		r.err = fmt.Errorf("%s: %w", field, ErrTruncated)
+	default:
+		return n
+	}
+	r.data = nil
+	return 0
+}
+
+// finish returns a message decoded from r, failing with ErrTrailingBytes
+// if the decoder left bytes unread
+func (r *reader) finish(msg Message, err error) (Message, error) {
+	if err != nil {
+		return nil, err
+	}
+	if r.Len() > 0 {
+		return nil, ErrTrailingBytes
+	}
+	return msg, nil
+}
+
+func (r *reader) bool() bool {
+	return r.uint8() != 0
+}
+
+func (r *reader) uint8() uint8 {
+	if b := r.next(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *reader) int8() int8 {
+	return int8(r.uint8())
+}
+
+func (r *reader) uint16() uint16 {
+	if b := r.next(2); b != nil {
+		return binary.LittleEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (r *reader) int16() int16 {
+	return int16(r.uint16())
+}
+
+func (r *reader) uint32() uint32 {
+	if b := r.next(4); b != nil {
+		return binary.LittleEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (r *reader) int32() int32 {
+	return int32(r.uint32())
+}
+
+func (r *reader) float32() float32 {
+	return math.Float32frombits(r.uint32())
+}
+
+// bytes consumes n bytes without copying them
+func (r *reader) bytes(n int) []byte {
+	return r.next(n)
+}
+
+// string consumes n bytes as a string
+func (r *reader) string(n int) string {
+	return string(r.next(n))
+}
+
+// readField reads the value a fieldRef points to
+func (r *reader) readField(value any) {
+	switch v := value.(type) {
+	case *bool:
+		*v = r.bool()
+	case *uint8:
+		*v = r.uint8()
+	case *int8:
+		*v = r.int8()
+	case *uint16:
+		*v = r.uint16()
+	case *int16:
+		*v = r.int16()
+	case *int32:
+		*v = r.int32()
+	case *float32:
+		*v = r.float32()
+	default:
+		panic("protocol: unsupported field type")
+	}
+}
+
+// maxPooledBuffer is the largest encode buffer kept for reuse; the rare
+// bigger message gets a buffer of its own rather than pinning the memory
+const maxPooledBuffer = 64 * 1024
+
+// encodeBuffers holds the scratch buffers Encode builds messages in
+var encodeBuffers = sync.Pool{
+	New: func() any {
+		buf := make([]byte, 0, 512)
+		return &buf
+	},
+}
+
+// encode encodes a message into a pooled scratch buffer and returns a copy
+// of exactly its size, so the Encode methods cost one allocation however
+// many fields the message has. It takes the message as a type parameter
+// rather than a Message so that the message isn't boxed on the heap.
+func encode[M Message](msg M) ([]byte, error) {
+	buf := encodeBuffers.Get().(*[]byte)
+	data, err := msg.AppendEncode((*buf)[:0])
+	var out []byte
+	if err == nil {
+		out = bytes.Clone(data)
+	}
+	if cap(data) <= maxPooledBuffer {
+		*buf = data[:0]
+		encodeBuffers.Put(buf)
+	}
+	return out, err
+}
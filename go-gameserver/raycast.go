@@ -0,0 +1,52 @@
+package main
+
+import "gameeserever/level"
+
+// HitKind says what a ray hit
+type HitKind byte
+
+const (
+	HitPlatform HitKind = iota + 1
+	HitPlayer
+)
+
+// RaycastHit is the first platform or player a ray hits. The embedded hit's
+// ID is the platform's or the player's.
+type RaycastHit struct {
+	Kind HitKind
+	level.Hit
+}
+
+// raycast returns the first standing platform or living player hit by the
+// ray from (originX, originY) along the unit vector (dirX, dirY) within
+// maxDistance. The player with ID ignore, usually whoever fired, is never hit.
+func (w *World) raycast(originX, originY, dirX, dirY, maxDistance float32, ignore int32) (RaycastHit, bool) {
+	var result RaycastHit
+	found := false
+
+	// Platforms first; players behind the first platform can't be hit
+	if w.level != nil {
+		if hit, ok := w.level.Raycast(originX, originY, dirX, dirY, maxDistance, w.terrain.isDestroyed); ok {
+			result = RaycastHit{Kind: HitPlatform, Hit: hit}
+			found = true
+			maxDistance = hit.Distance
+		}
+	}
+
+	// The grid has the hitboxes as of the last tick, so every candidate is
+	// checked against the player's current one
+	for _, candidate := range w.grid.QueryRay(originX, originY, dirX, dirY, maxDistance) {
+		player, exists := w.Players[candidate.ID]
+		if !exists || candidate.ID == ignore || player.IsDead {
+			continue
+		}
+		if hit, ok := hitboxOf(player).Intersect(originX, originY, dirX, dirY, maxDistance); ok {
+			hit.ID = player.ID
+			result = RaycastHit{Kind: HitPlayer, Hit: hit}
+			found = true
+			maxDistance = hit.Distance
+		}
+	}
+
+	return result, found
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"gameeserever/level"
+	"gameeserever/weapons"
+)
+
+func TestRaycast(t *testing.T) {
+	lvl, err := level.Parse([]byte(wallLevel))
+	if err != nil {
+		t.Fatal(err)
+	}
+	wallID := int32(level.PlatformIDBase + 1)
+
+	// Player 2 stands in front of the wall and player 3 behind it
+	newWorld := func() *World {
+		w := NewWorld(lvl, weapons.Default(), 60, time.Second)
+		for id, x := range map[int32]float32{1: 0, 2: 100, 3: 300} {
+			player := newTestPlayer(id)
+			player.X, player.Y = x, -70
+			w.AddPlayer(player)
+		}
+		return w
+	}
+
+	tests := []struct {
+		name       string
+		setup      func(w *World)
+		dirX, dirY float32
+		ignore     int32
+		kind       HitKind
+		id         int32
+		distance   float32
+	}{
+		{"nearest player, not the shooter", nil, 1, 0, 1, HitPlayer, 2, 75},
+		{"starting inside a player not ignored", nil, 1, 0, 2, HitPlayer, 1, 0},
+		{"wall in front of the player behind it", func(w *World) { w.Players[2].IsDead = true }, 1, 0, 1, HitPlatform, wallID, 215},
+		{"destroyed wall skipped", func(w *World) {
+			w.Players[2].IsDead = true
+			for destroyed := false; !destroyed; {
+				destroyed, _ = w.terrain.hit(wallID, time.Now())
+			}
+		}, 1, 0, 1, HitPlayer, 3, 275},
+		{"down to the floor", nil, 0, 1, 1, HitPlatform, level.PlatformIDBase, 35},
+	}
+	for _, tt := range tests {
+		w := newWorld()
+		if tt.setup != nil {
+			tt.setup(w)
+		}
+		// From the middle of player 1, so a ray not ignoring them hits them straight away
+		hit, ok := w.raycast(25, -35, tt.dirX, tt.dirY, 1000, tt.ignore)
+		if !ok || hit.Kind != tt.kind || hit.ID != tt.id || hit.Distance != tt.distance {
+			t.Errorf("%s: got hit %v kind %v on %d at %v, want kind %v on %d at %v",
+				tt.name, ok, hit.Kind, hit.ID, hit.Distance, tt.kind, tt.id, tt.distance)
+		}
+	}
+
+	if _, ok := newWorld().raycast(25, -35, -1, 0, 1000, 1); ok {
+		t.Error("hit something in empty space")
+	}
+}
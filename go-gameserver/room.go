@@ -0,0 +1,615 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"math/rand"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"gameeserever/gamemode"
+	"gameeserever/level"
+	"gameeserever/protocol"
+	"gameeserever/weapons"
+)
+
+const (
+	// DefaultRoomID is used when a client connects without a room parameter
+	DefaultRoomID = "default"
+
+	// maxRoomIDLength bounds the room names clients can ask for
+	maxRoomIDLength = 64
+
+	// DefaultTickRate is used when RoomConfig.TickRate is not set
+	DefaultTickRate = 60
+
+	// quantizationMargin is how far outside the level's bounds quantized
+	// positions are still encoded, for players jumping above or falling off it
+	quantizationMargin = 2000
+)
+
+// defaultQuantization is the area positions are quantized across in rooms without a level
+var defaultQuantization = protocol.Quantization{MinX: -16384, MinY: -16384, MaxX: 16384, MaxY: 16384}
+
+var (
+	// ErrRoomFull is returned when a room has reached its capacity
+	ErrRoomFull = errors.New("room is full")
+
+	// ErrInvalidRoomID is returned for empty or oversized room names
+	ErrInvalidRoomID = errors.New("invalid room id")
+
+	// ErrModeMismatch is returned when joining a room with a different game mode than it was created with
+	ErrModeMismatch = errors.New("room is playing a different game mode")
+)
+
+// RoomConfig holds the settings shared by every room a RoomManager creates
+type RoomConfig struct {
+	Capacity     int               // Maximum clients per room (0 = unlimited)
+	TickRate     int               // Simulation ticks per second
+	Level        *level.Level      // Level every new room plays on (nil to run without one)
+	SpawnPolicy  level.SpawnPolicy // How spawn points are chosen from the level
+	MaxRewind    time.Duration     // How far back hit reports are checked
+	Weapons      *weapons.Catalog  // Weapon stats every new room uses
+	Mode         string            // Game mode of rooms created without one
+	FriendlyFire bool              // Whether teammates can damage each other
+	ViewRadius   float32           // How far away players are still sent to a client (0 = unlimited)
+
+	// ServerProjectiles has the server simulate bullets and decide their
+	// hits, instead of trusting clients' hit reports
+	ServerProjectiles bool
+
+	// AllowJSON accepts clients that pick the legacy JSON protocol at their
+	// handshake
+	AllowJSON bool
+}
+
+// Room is an isolated match with its own clients and broadcast queue
+type Room struct {
+	ID    string
+	Level *level.Level // Shared, read-only level geometry (nil when running without a level)
+
+	clients      map[*websocket.Conn]*ClientState // Track clients by connection
+	world        *World                           // Authoritative match state, guarded by mu
+	broadcast    chan BroadcastMessage            // Broadcast channel for messages
+	spawns       *level.SpawnPicker               // Spawn point selection, guarded by mu
+	match        *gamemode.Match                  // Match phases and scoreboard, guarded by mu
+	tickRate     int                              // Simulation ticks per second
+	friendlyFire bool                             // Whether teammates can damage each other
+	viewRadius   float32                          // How far away players are still sent to a client (0 = unlimited)
+	quantization protocol.Quantization            // Area positions are quantized across for compact clients
+	mu           sync.Mutex                       // Protects clients, world, spawns and match
+	done         chan struct{}                    // Closed when the room is torn down
+
+	respawns          map[int32]time.Time // Dead players and when they respawn, guarded by mu
+	scoreboardChanged bool                // A ScoreboardUpdate is due on the next tick, guarded by mu
+	serverProjectiles bool                // Bullets are simulated by the server rather than the shooter's client
+	allowJSON         bool                // Clients may speak the JSON protocol
+
+	occupants int // Reserved slots, guarded by the owning RoomManager's mutex
+}
+
+// newRoom creates an empty room playing the given mode; call run to start its
+// simulation goroutine
+func newRoom(id string, mode gamemode.GameMode, config RoomConfig) *Room {
+	tickRate := config.TickRate
+	if tickRate <= 0 {
+		tickRate = DefaultTickRate
+	}
+	catalog := config.Weapons
+	if catalog == nil {
+		catalog = weapons.Default()
+	}
+
+	room := &Room{
+		ID:           id,
+		Level:        config.Level,
+		clients:      make(map[*websocket.Conn]*ClientState),
+		world:        NewWorld(config.Level, catalog, tickRate, config.MaxRewind),
+		broadcast:    make(chan BroadcastMessage, 256),
+		match:        gamemode.NewMatch(mode, time.Now()),
+		respawns:     make(map[int32]time.Time),
+		tickRate:     tickRate,
+		friendlyFire: config.FriendlyFire,
+		viewRadius:   config.ViewRadius,
+		done:         make(chan struct{}),
+
+		serverProjectiles: config.ServerProjectiles,
+		allowJSON:         config.AllowJSON,
+	}
+	room.quantization = defaultQuantization
+	if config.Level != nil {
+		rng := rand.New(rand.NewSource(time.Now().UnixNano()))
+		room.spawns = level.NewSpawnPicker(config.Level.PlayerSpawns, config.SpawnPolicy, rng)
+
+		area := config.Level.Bounds.Expand(quantizationMargin)
+		room.quantization = protocol.Quantization{MinX: area.MinX, MinY: area.MinY, MaxX: area.MaxX, MaxY: area.MaxY}
+	}
+	return room
+}
+
+// Broadcast queues a message for every client in the room.
+// It never blocks once the room has been torn down.
+func (r *Room) Broadcast(msg BroadcastMessage) {
+	select {
+	case r.broadcast <- msg:
+	case <-r.done:
+	}
+}
+
+// addClient registers a connected client with the room and places them
+// at a server-chosen spawn point
+func (r *Room) addClient(conn *websocket.Conn, state *ClientState) {
+	r.mu.Lock()
+	r.placeAtSpawn(&state.Player)
+	r.clients[conn] = state
+	r.world.AddPlayer(&state.Player)
+	r.match.OnJoin(state.Player.ID, time.Now())
+	state.Player.TeamID = r.match.Team(state.Player.ID)
+	applyTeamColor(&state.Player)
+	if r.viewRadius > 0 {
+		// Other players enter the client's view on the next tick
+		state.visible = map[int32]bool{state.Player.ID: true}
+	}
+	r.scoreboardChanged = true
+	r.mu.Unlock()
+}
+
+// removeClient unregisters a client from the room
+func (r *Room) removeClient(conn *websocket.Conn) {
+	r.mu.Lock()
+	if state, exists := r.clients[conn]; exists {
+		r.world.RemovePlayer(state.Player.ID)
+		r.match.OnLeave(state.Player.ID)
+		delete(r.respawns, state.Player.ID)
+		r.scoreboardChanged = true
+	}
+	delete(r.clients, conn)
+	r.mu.Unlock()
+}
+
+// getClient returns the state for a connection in this room
+func (r *Room) getClient(conn *websocket.Conn) (*ClientState, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	state, exists := r.clients[conn]
+	return state, exists
+}
+
+// findPlayer returns the client with the given player ID, or nil
+// The caller must hold r.mu.
+func (r *Room) findPlayer(playerID int32) *ClientState {
+	for _, client := range r.clients {
+		if client.Player.ID == playerID {
+			return client
+		}
+	}
+	return nil
+}
+
+// placeAtSpawn moves a player to the next spawn point and stops them.
+// The caller must hold r.mu.
+func (r *Room) placeAtSpawn(player *protocol.Player) {
+	if r.spawns == nil {
+		return
+	}
+
+	// Collect live opponents so the farthest policy can avoid them;
+	// teammates are not opponents
+	enemies := make([]level.Point, 0, len(r.clients))
+	for _, client := range r.clients {
+		if client.Player.ID == player.ID || client.Player.IsDead {
+			continue
+		}
+		if player.TeamID != 0 && client.Player.TeamID == player.TeamID {
+			continue
+		}
+		enemies = append(enemies, level.Point{X: client.Player.X, Y: client.Player.Y})
+	}
+
+	spawn := r.spawns.Pick(enemies)
+	player.X = spawn.X
+	player.Y = spawn.Y
+	player.VelocityX = 0
+	player.VelocityY = 0
+}
+
+// run advances the room's world at a fixed tick rate and queues each tick's
+// snapshot and broadcasts for the clients until the room is torn down
+func (r *Room) run() {
+	ticker := time.NewTicker(1 * time.Second)
+	defer ticker.Stop()
+
+	tickTicker := time.NewTicker(time.Second / time.Duration(r.tickRate))
+	defer tickTicker.Stop()
+
+	// Message queue for batching
+	messageQueue := make([]BroadcastMessage, 0, 100)
+	var messageCount int
+
+	for {
+		select {
+		case msg := <-r.broadcast:
+			// Add message to queue for the next tick
+			messageQueue = append(messageQueue, msg)
+
+		case <-tickTicker.C:
+			messageCount += r.tick(messageQueue)
+			messageQueue = make([]BroadcastMessage, 0, 100) // Reset queue
+
+		case <-ticker.C:
+			if messageCount > 0 {
+				log.Printf("Room %q: messages queued per second: %d", r.ID, messageCount)
+			}
+			messageCount = 0 // Reset the counter
+
+		case <-r.done:
+			return
+		}
+	}
+}
+
+// tick runs one simulation step and sends the results along with the queued
+// broadcasts. It returns how many messages were queued.
+func (r *Room) tick(messageQueue []BroadcastMessage) int {
+	now := time.Now()
+	r.mu.Lock()
+	messageQueue = append(messageQueue, r.tickMatch(now)...)
+	messageQueue = append(messageQueue, r.respawnDue(now)...)
+	events := r.world.Step()
+	messageQueue = append(messageQueue, r.resolveImpacts(events.Impacts, now)...)
+	messageQueue = append(messageQueue, r.fragmentUpdates(events)...)
+	messageQueue = append(messageQueue, r.regenerateTerrain(now)...)
+	players := r.world.Snapshot()
+
+	// Each client's snapshot only carries the players in their view that
+	// changed since the last snapshot they acknowledged, and acknowledges
+	// their own last applied input
+	updates := make(map[*ClientState]clientUpdate, len(r.clients))
+	if len(players) > 0 {
+		for _, client := range r.clients {
+			inView, events := r.updateInterest(client, players)
+			snapshot := client.baselines.snapshot(r.world.Tick, inView)
+			snapshot.LastInputSequence = r.world.LastInputSequence(client.Player.ID)
+			updates[client] = clientUpdate{views: events, snapshot: snapshot}
+		}
+	}
+	r.mu.Unlock()
+
+	return r.flush(updates, messageQueue)
+}
+
+// clientUpdate is what a tick sends one client ahead of the room's broadcasts
+type clientUpdate struct {
+	views    []protocol.Message // Players entering or leaving the client's view
+	snapshot protocol.WorldSnapshotMessage
+}
+
+// tickMatch advances the match and returns the messages announcing any phase
+// or scoreboard change. The caller must hold r.mu.
+func (r *Room) tickMatch(now time.Time) []BroadcastMessage {
+	var messages []BroadcastMessage
+
+	if r.match.Tick(now) {
+		phase := r.match.Phase()
+		log.Printf("Room %q: match is now %s", r.ID, phase)
+
+		switch phase {
+		case gamemode.PhaseLive:
+			// Everyone starts the live phase at full health on a fresh spawn,
+			// which replaces any respawn still pending
+			clear(r.respawns)
+			for _, client := range r.clients {
+				client.Player.Health = client.Player.MaxHealth
+				client.Player.IsDead = false
+				r.placeAtSpawn(&client.Player)
+				messages = append(messages, BroadcastMessage{
+					BinaryMsg:   protocol.BroadcastPlayerUpdateMessage{Player: client.Player},
+					IncludeSelf: true,
+				})
+			}
+		case gamemode.PhaseEnded:
+			if winner := r.match.Winner(); winner.TeamID != 0 {
+				log.Printf("Room %q: match won by team %d", r.ID, winner.TeamID)
+			} else {
+				log.Printf("Room %q: match won by player %d", r.ID, winner.PlayerID)
+			}
+		}
+
+		messages = append(messages, BroadcastMessage{
+			BinaryMsg: protocol.MatchStateMessage{State: r.matchState(now)},
+		})
+		r.scoreboardChanged = true
+	}
+
+	if r.scoreboardChanged {
+		messages = append(messages, BroadcastMessage{
+			BinaryMsg: r.scoreboardUpdate(),
+		})
+		r.scoreboardChanged = false
+	}
+
+	return messages
+}
+
+// regenerateTerrain restores the platforms that have been destroyed for as
+// long as the mode allows and returns the messages announcing them. The
+// caller must hold r.mu.
+func (r *Room) regenerateTerrain(now time.Time) []BroadcastMessage {
+	var messages []BroadcastMessage
+	for _, platformID := range r.world.terrain.regenerate(now, r.match.Rules.PlatformRegen) {
+		messages = append(messages, BroadcastMessage{
+			BinaryMsg: protocol.PlatformRestoreMessage{PlatformID: platformID},
+		})
+	}
+	return messages
+}
+
+// destroyPlatform counts a hit on a platform and, when that destroys it,
+// shatters it and returns the messages announcing the destruction and the
+// new fragments. The caller must hold r.mu.
+func (r *Room) destroyPlatform(platformID, shooterID int32, now time.Time) ([]BroadcastMessage, error) {
+	destroyed, err := r.world.terrain.hit(platformID, now)
+	if err != nil || !destroyed {
+		return nil, err
+	}
+
+	messages := []BroadcastMessage{{
+		BinaryMsg: protocol.BroadcastPlatformDestroyMessage{
+			Destroy: protocol.PlatformDestroy{PlatformID: platformID, ShooterID: shooterID},
+		},
+	}}
+	if r.Level == nil {
+		return messages, nil
+	}
+	platform, _ := r.Level.Platform(platformID)
+	for _, fragment := range r.world.terrain.shatter(platform) {
+		messages = append(messages, BroadcastMessage{
+			BinaryMsg: protocol.BroadcastFragmentCreateMessage{Fragment: fragment},
+		})
+	}
+	return messages, nil
+}
+
+// fragmentUpdates returns the messages correcting the fragments that bounced
+// during a tick and removing the ones that expired
+func (r *Room) fragmentUpdates(events StepEvents) []BroadcastMessage {
+	var messages []BroadcastMessage
+	for _, fragment := range events.MovedFragments {
+		// Clients update a fragment they already have in place
+		messages = append(messages, BroadcastMessage{
+			BinaryMsg: protocol.BroadcastFragmentCreateMessage{Fragment: fragment},
+		})
+	}
+	for _, fragmentID := range events.ExpiredFragments {
+		messages = append(messages, BroadcastMessage{
+			BinaryMsg: protocol.BroadcastFragmentDestroyMessage{
+				Destroy: protocol.FragmentDestroy{FragmentID: fragmentID},
+			},
+		})
+	}
+	return messages
+}
+
+// matchState describes the match for clients. The caller must hold r.mu.
+func (r *Room) matchState(now time.Time) protocol.MatchState {
+	return protocol.MatchState{
+		Phase:         byte(r.match.Phase()),
+		TimeRemaining: float32(r.match.TimeRemaining(now).Seconds()),
+		ScoreLimit:    int32(r.match.Rules.ScoreLimit),
+		WinnerID:      r.match.Winner().PlayerID,
+		Mode:          byte(r.match.Mode.ID()),
+		WinnerTeamID:  r.match.Winner().TeamID,
+	}
+}
+
+// scoreboardUpdate returns the current scoreboard, best player first.
+// The caller must hold r.mu.
+func (r *Room) scoreboardUpdate() protocol.ScoreboardUpdateMessage {
+	entries := r.match.Scoreboard.Entries()
+	update := protocol.ScoreboardUpdateMessage{
+		Entries: make([]protocol.ScoreEntry, 0, len(entries)),
+	}
+	for _, stats := range entries {
+		update.Entries = append(update.Entries, protocol.ScoreEntry{
+			PlayerID: stats.PlayerID,
+			Kills:    int32(stats.Kills),
+			Deaths:   int32(stats.Deaths),
+			Assists:  int32(stats.Assists),
+			TeamID:   r.match.Team(stats.PlayerID),
+		})
+	}
+	return update
+}
+
+// flush queues a tick's snapshots and broadcasts for every client and returns
+// how many messages were queued. Each broadcast is encoded once and shared by
+// all of its recipients; the clients' writer goroutines do the sending.
+func (r *Room) flush(updates map[*ClientState]clientUpdate, localQueue []BroadcastMessage) int {
+	// Copy the clients and what they can see to avoid holding the lock
+	r.mu.Lock()
+	clients := make([]*ClientState, 0, len(r.clients))
+	visible := make(map[*ClientState]map[int32]bool, len(r.clients))
+	for _, state := range r.clients {
+		clients = append(clients, state)
+		visible[state] = state.visible
+	}
+	r.mu.Unlock()
+
+	queued := 0
+	queue := func(client *ClientState, msg outboundMessage) {
+		if client.enqueue(msg) {
+			queued++
+		}
+	}
+
+	// Broadcasts are encoded once per wire format and shared by the clients using it
+	broadcast := func(msg protocol.Message, skip func(*ClientState) bool) {
+		encoded := make(map[byte]outboundMessage, 2) // Keyed by the encoded message type
+		for _, client := range clients {
+			if skip != nil && skip(client) {
+				continue
+			}
+			wire := client.wireFormat(msg)
+			out, exists := encoded[wire.Type()]
+			if !exists {
+				var err error
+				out, err = newOutboundMessage(wire)
+				if err != nil {
+					log.Printf("Error encoding binary message: %v", err)
+					return
+				}
+				encoded[wire.Type()] = out
+			}
+			queue(client, out)
+		}
+	}
+
+	// Every client gets their own view changes and world snapshot first. A
+	// player entering or leaving several views on the same tick is encoded
+	// once per wire format; view messages hold no slices, so they can be map keys.
+	views := make(map[protocol.Message]outboundMessage)
+	for _, client := range clients {
+		update, exists := updates[client]
+		if !exists {
+			continue
+		}
+		for _, view := range update.views {
+			view = client.wireFormat(view)
+			msg, exists := views[view]
+			if !exists {
+				var err error
+				msg, err = newOutboundMessage(view)
+				if err != nil {
+					log.Printf("Error encoding view change: %v", err)
+					continue
+				}
+				views[view] = msg
+			}
+			queue(client, msg)
+		}
+		msg, err := newOutboundMessage(client.wireFormat(update.snapshot))
+		if err != nil {
+			log.Printf("Error encoding world snapshot: %v", err)
+			continue
+		}
+		queue(client, msg)
+	}
+
+	// First, sort messages by priority (player updates first)
+	playerUpdates := make([]BroadcastMessage, 0)
+	otherMessages := make([]protocol.Message, 0)
+
+	for _, msg := range localQueue {
+		if _, ok := msg.BinaryMsg.(protocol.BroadcastPlayerUpdateMessage); ok {
+			playerUpdates = append(playerUpdates, msg)
+		} else {
+			otherMessages = append(otherMessages, msg.BinaryMsg)
+		}
+	}
+
+	// Process player updates first
+	for _, update := range playerUpdates {
+		m := update.BinaryMsg.(protocol.BroadcastPlayerUpdateMessage)
+		includeSelf := update.IncludeSelf
+
+		// Skip sending updates about a player to themselves, and to clients
+		// they are out of view of
+		broadcast(m, func(client *ClientState) bool {
+			if client.id == m.Player.ID {
+				return !includeSelf
+			}
+			return !inView(visible[client], m.Player.ID)
+		})
+	}
+
+	// Then process other binary protocol messages
+	for _, msg := range otherMessages {
+		switch m := msg.(type) {
+		case protocol.BroadcastPlayerJoinMessage, protocol.BroadcastPlayerLeaveMessage,
+			protocol.BroadcastChatMessageMessage, protocol.BroadcastGunFireMessage,
+			protocol.BroadcastHitReportMessage, protocol.BroadcastPlatformDestroyMessage,
+			protocol.BroadcastFragmentCreateMessage, protocol.BroadcastFragmentDestroyMessage,
+			protocol.BroadcastGunAttachmentMessage, protocol.ScoreboardUpdateMessage,
+			protocol.MatchStateMessage, protocol.ProjectileSpawnMessage,
+			protocol.ProjectileImpactMessage, protocol.PlatformRestoreMessage:
+			// These messages are sent to all clients
+			broadcast(m, nil)
+		}
+	}
+
+	return queued
+}
+
+// RoomManager creates rooms on demand and tears them down once empty
+type RoomManager struct {
+	rooms  map[string]*Room
+	config RoomConfig
+	mu     sync.Mutex
+}
+
+// NewRoomManager creates a room manager that builds rooms from config
+func NewRoomManager(config RoomConfig) *RoomManager {
+	return &RoomManager{
+		rooms:  make(map[string]*Room),
+		config: config,
+	}
+}
+
+// Join reserves a slot in the named room, creating the room with the given
+// game mode if needed. An empty mode joins the room whatever it is playing,
+// or creates it with the default mode. Every successful Join must be paired
+// with a Leave.
+func (rm *RoomManager) Join(id, modeName string) (*Room, error) {
+	if id == "" {
+		id = DefaultRoomID
+	}
+	if len(id) > maxRoomIDLength {
+		return nil, ErrInvalidRoomID
+	}
+
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	room, exists := rm.rooms[id]
+	if exists && modeName != "" && room.match.Mode.Name() != modeName {
+		return nil, ErrModeMismatch
+	}
+	if !exists {
+		if modeName == "" {
+			modeName = rm.config.Mode
+		}
+		mode, err := gamemode.New(modeName)
+		if err != nil {
+			return nil, err
+		}
+		room = newRoom(id, mode, rm.config)
+		rm.rooms[id] = room
+		go room.run()
+		log.Printf("Room %q created playing %s", id, mode.Name())
+	}
+
+	if rm.config.Capacity > 0 && room.occupants >= rm.config.Capacity {
+		return nil, ErrRoomFull
+	}
+	room.occupants++
+
+	return room, nil
+}
+
+// Leave releases a slot reserved by Join and tears the room down when it is empty
+func (rm *RoomManager) Leave(room *Room) {
+	rm.mu.Lock()
+	defer rm.mu.Unlock()
+
+	room.occupants--
+	if room.occupants > 0 {
+		return
+	}
+
+	if rm.rooms[room.ID] == room {
+		delete(rm.rooms, room.ID)
+	}
+	close(room.done)
+	log.Printf("Room %q closed", room.ID)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"gameeserever/gamemode"
+	"gameeserever/level"
+)
+
+// newTestRoom returns a free-play room on a level with spawns at x 0 and
+// 1000, picking the spawn farthest from enemies
+func newTestRoom(t *testing.T) *Room {
+	t.Helper()
+	lvl, err := level.Parse([]byte(`{"gridSize": 10, "playerSpawns": [{"x": 0, "y": 0}, {"x": 1000, "y": 0}]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	mode, err := gamemode.New(gamemode.FreePlayName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return newRoom("test", mode, RoomConfig{Level: lvl, SpawnPolicy: level.SpawnFarthest})
+}
+
+// addTestClient puts a player into the room without a connection
+func addTestClient(r *Room, id int32, x float32, teamID int32) *ClientState {
+	client := &ClientState{Player: *newTestPlayer(id), id: id}
+	client.Player.X, client.Player.TeamID = x, teamID
+	r.clients[&websocket.Conn{}] = client
+	return client
+}
+
+func TestPlaceAtSpawnIgnoresTeammates(t *testing.T) {
+	r := newTestRoom(t)
+	addTestClient(r, 1, 0, 1)
+	addTestClient(r, 2, 1000, 2)
+	player := addTestClient(r, 3, 500, 1)
+
+	r.placeAtSpawn(&player.Player)
+	if player.Player.X != 0 {
+		t.Errorf("spawned at x %v, want 0, away from the enemy and beside the teammate", player.Player.X)
+	}
+}
+
+func TestRespawnDue(t *testing.T) {
+	r := newTestRoom(t)
+	addTestClient(r, 1, 1000, 0)
+	victim := addTestClient(r, 2, 500, 0)
+
+	now := time.Now()
+	r.applyDamage(1, victim, victim.Player.Health)
+	if !victim.Player.IsDead {
+		t.Fatal("a fatal hit left the victim alive")
+	}
+
+	if messages := r.respawnDue(now); len(messages) != 0 || !victim.Player.IsDead {
+		t.Fatal("respawned before the respawn delay passed")
+	}
+	messages := r.respawnDue(now.Add(r.match.RespawnDelay() + time.Second))
+	if len(messages) != 1 || !messages[0].IncludeSelf {
+		t.Fatalf("got %d respawn messages, want one the victim is sent too", len(messages))
+	}
+	if victim.Player.IsDead || victim.Player.Health != victim.Player.MaxHealth || victim.Player.X != 0 {
+		t.Errorf("victim %+v is not alive at full health on the far spawn", victim.Player)
+	}
+
+	// A respawn made stale by the player coming back another way is dropped
+	r.applyDamage(1, victim, victim.Player.Health)
+	victim.Player.IsDead = false
+	if messages := r.respawnDue(now.Add(time.Hour)); len(messages) != 0 || len(r.respawns) != 0 {
+		t.Errorf("respawned a player who was already alive")
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"errors"
+	"math/rand"
+	"sort"
+	"time"
+
+	"gameeserever/level"
+	"gameeserever/protocol"
+)
+
+// Reasons a terrain change is rejected
+var (
+	errUnknownPlatform  = errors.New("platform is not in the level")
+	errIndestructible   = errors.New("platform can't be destroyed")
+	errAlreadyDestroyed = errors.New("platform is already destroyed")
+	errTooManyDestroyed = errors.New("too many platforms are destroyed")
+)
+
+// maxDestroyedWithoutLevel bounds how many platforms can be down at once when
+// there is no level to check platform IDs against, so clients cannot grow
+// the terrain state without limit by destroying made-up platforms
+const maxDestroyedWithoutLevel = 1024
+
+// terrain is how a room's platforms differ from the shared level: the damage
+// taken by platforms still standing, the platforms destroyed and the fragments
+// they broke into. It is not safe for concurrent use.
+type terrain struct {
+	level     *level.Level        // nil when running without a level
+	damage    map[int32]int       // Hits taken by platforms still standing
+	destroyed map[int32]time.Time // Destroyed platforms and when they went down
+	fragments map[int32]*fragment // Live fragments by ID
+
+	nextFragmentID int32
+	rng            *rand.Rand // Scatters fragments
+}
+
+func newTerrain(lvl *level.Level) *terrain {
+	return &terrain{
+		level:     lvl,
+		damage:    make(map[int32]int),
+		destroyed: make(map[int32]time.Time),
+		fragments: make(map[int32]*fragment),
+		rng:       rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// isDestroyed reports whether a platform has been destroyed
+func (t *terrain) isDestroyed(platformID int32) bool {
+	_, destroyed := t.destroyed[platformID]
+	return destroyed
+}
+
+// hit damages a platform and reports whether that destroyed it. Without a
+// level there is nothing to check platforms against, so any platform is
+// destroyed by its first hit, up to maxDestroyedWithoutLevel at a time.
+func (t *terrain) hit(platformID int32, now time.Time) (bool, error) {
+	if t.isDestroyed(platformID) {
+		return false, errAlreadyDestroyed
+	}
+
+	hitPoints := 1
+	if t.level != nil {
+		platform, exists := t.level.Platform(platformID)
+		if !exists {
+			return false, errUnknownPlatform
+		}
+		hitPoints = platform.HitPoints()
+		if hitPoints == 0 {
+			return false, errIndestructible
+		}
+	} else if len(t.destroyed) >= maxDestroyedWithoutLevel {
+		return false, errTooManyDestroyed
+	}
+
+	t.damage[platformID]++
+	if t.damage[platformID] < hitPoints {
+		return false, nil
+	}
+	delete(t.damage, platformID)
+	t.destroyed[platformID] = now
+	return true, nil
+}
+
+// regenerate restores the platforms that have been destroyed for at least
+// delay and returns their IDs. A delay of 0 never restores anything.
+func (t *terrain) regenerate(now time.Time, delay time.Duration) []int32 {
+	if delay <= 0 {
+		return nil
+	}
+	var restored []int32
+	for platformID, destroyedAt := range t.destroyed {
+		if now.Sub(destroyedAt) >= delay {
+			delete(t.destroyed, platformID)
+			restored = append(restored, platformID)
+		}
+	}
+	return restored
+}
+
+// state returns the destroyed platforms and live fragments, ordered by ID
+func (t *terrain) state() protocol.TerrainState {
+	state := protocol.TerrainState{
+		DestroyedPlatforms: make([]int32, 0, len(t.destroyed)),
+		Fragments:          make([]protocol.Fragment, 0, len(t.fragments)),
+	}
+	for platformID := range t.destroyed {
+		state.DestroyedPlatforms = append(state.DestroyedPlatforms, platformID)
+	}
+	for _, fragment := range t.fragments {
+		state.Fragments = append(state.Fragments, fragment.Fragment)
+	}
+	sort.Slice(state.DestroyedPlatforms, func(i, j int) bool {
+		return state.DestroyedPlatforms[i] < state.DestroyedPlatforms[j]
+	})
+	sort.Slice(state.Fragments, func(i, j int) bool {
+		return state.Fragments[i].ID < state.Fragments[j].ID
+	})
+	return state
+}
+
+// unchanged reports whether the terrain still matches the level file
+func (t *terrain) unchanged() bool {
+	return len(t.destroyed) == 0 && len(t.fragments) == 0
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTerrainWithoutLevelBoundsDestroyedPlatforms(t *testing.T) {
+	terrain := newTerrain(nil)
+	now := time.Now()
+
+	for platformID := int32(0); platformID < maxDestroyedWithoutLevel; platformID++ {
+		if destroyed, err := terrain.hit(platformID, now); !destroyed || err != nil {
+			t.Fatalf("hitting platform %d: destroyed %v, error %v", platformID, destroyed, err)
+		}
+	}
+	if _, err := terrain.hit(maxDestroyedWithoutLevel, now); !errors.Is(err, errTooManyDestroyed) {
+		t.Errorf("got error %v once the limit was reached, want %v", err, errTooManyDestroyed)
+	}
+	if got := len(terrain.state().DestroyedPlatforms); got != maxDestroyedWithoutLevel {
+		t.Errorf("terrain state has %d destroyed platforms, want %d", got, maxDestroyedWithoutLevel)
+	}
+
+	// Platforms growing back make room again
+	terrain.regenerate(now.Add(time.Minute), time.Second)
+	if destroyed, err := terrain.hit(maxDestroyedWithoutLevel, now); !destroyed || err != nil {
+		t.Errorf("hitting a platform after regeneration: destroyed %v, error %v", destroyed, err)
+	}
+}
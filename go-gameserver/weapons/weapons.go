@@ -0,0 +1,177 @@
+package weapons
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"time"
+
+	"gameeserever/protocol"
+)
+
+// Weapon is one entry of the weapon catalogue
+type Weapon struct {
+	ID           int32
+	Name         string
+	Damage       float32       // Damage of one bullet
+	FireRate     float32       // Shots per second
+	Spread       float32       // Maximum deviation from the aim direction, in radians
+	Range        float32       // Distance a bullet travels before it disappears, in px
+	BulletSpeed  float32       // px/s
+	Gravity      float32       // Bullet drop in px/s² (0 = straight line)
+	MagazineSize int           // Shots before a reload (0 = unlimited)
+	ReloadTime   time.Duration // Time to refill an empty magazine
+}
+
+// FireInterval returns the minimum time between two shots
+func (w Weapon) FireInterval() time.Duration {
+	return time.Duration(float64(time.Second) / float64(w.FireRate))
+}
+
+// Lifetime returns how long a bullet flies before reaching its range
+func (w Weapon) Lifetime() time.Duration {
+	return time.Duration(float64(w.Range) / float64(w.BulletSpeed) * float64(time.Second))
+}
+
+// Catalog is a validated set of weapons keyed by ID
+type Catalog struct {
+	weapons   map[int32]Weapon
+	defaultID int32
+}
+
+// file mirrors the JSON weapon catalogue
+type file struct {
+	DefaultWeapon int32        `json:"defaultWeapon"`
+	Weapons       []weaponJSON `json:"weapons"`
+}
+
+type weaponJSON struct {
+	ID           int32   `json:"id"`
+	Name         string  `json:"name"`
+	Damage       float64 `json:"damage"`
+	FireRate     float64 `json:"fireRate"`
+	Spread       float64 `json:"spread"`
+	Range        float64 `json:"range"`
+	BulletSpeed  float64 `json:"bulletSpeed"`
+	Gravity      float64 `json:"gravity"`
+	MagazineSize int     `json:"magazineSize"`
+	ReloadTime   float64 `json:"reloadTime"` // Seconds
+}
+
+// Default returns a catalogue with only the client's built-in gun, used when
+// the server runs without a weapons file
+func Default() *Catalog {
+	gun := Weapon{
+		ID:          1,
+		Name:        "Gun",
+		Damage:      10,
+		FireRate:    15,
+		Range:       2000,
+		BulletSpeed: 1000,
+	}
+	return &Catalog{weapons: map[int32]Weapon{gun.ID: gun}, defaultID: gun.ID}
+}
+
+// Load reads and parses a weapon catalogue from disk
+func Load(path string) (*Catalog, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	catalog, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return catalog, nil
+}
+
+// Parse decodes and validates a weapon catalogue. When defaultWeapon is
+// omitted, the first weapon in the file is the default.
+func Parse(data []byte) (*Catalog, error) {
+	var f file
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, err
+	}
+
+	if len(f.Weapons) == 0 {
+		return nil, errors.New("catalogue has no weapons")
+	}
+
+	catalog := &Catalog{
+		weapons:   make(map[int32]Weapon, len(f.Weapons)),
+		defaultID: f.DefaultWeapon,
+	}
+	if catalog.defaultID == 0 {
+		catalog.defaultID = f.Weapons[0].ID
+	}
+
+	for i, w := range f.Weapons {
+		if w.ID <= 0 {
+			return nil, fmt.Errorf("weapons[%d]: id must be positive, got %d", i, w.ID)
+		}
+		if _, exists := catalog.weapons[w.ID]; exists {
+			return nil, fmt.Errorf("weapons[%d]: duplicate id %d", i, w.ID)
+		}
+		for _, field := range []struct {
+			name     string
+			value    float64
+			positive bool
+		}{
+			{"damage", w.Damage, false},
+			{"fireRate", w.FireRate, true},
+			{"spread", w.Spread, false},
+			{"range", w.Range, true},
+			{"bulletSpeed", w.BulletSpeed, true},
+			{"gravity", w.Gravity, false},
+			{"reloadTime", w.ReloadTime, false},
+		} {
+			if math.IsNaN(field.value) || math.IsInf(field.value, 0) || field.value < 0 || (field.positive && field.value == 0) {
+				return nil, fmt.Errorf("weapons[%d]: invalid %s %v", i, field.name, field.value)
+			}
+		}
+		if w.BulletSpeed > protocol.MaxVelocity {
+			// Projectile velocities would be clamped on the quantized wire
+			return nil, fmt.Errorf("weapons[%d]: bulletSpeed %v is over the %v px/s limit", i, w.BulletSpeed, protocol.MaxVelocity)
+		}
+		if w.MagazineSize < 0 {
+			return nil, fmt.Errorf("weapons[%d]: magazineSize must not be negative", i)
+		}
+
+		catalog.weapons[w.ID] = Weapon{
+			ID:           w.ID,
+			Name:         w.Name,
+			Damage:       float32(w.Damage),
+			FireRate:     float32(w.FireRate),
+			Spread:       float32(w.Spread),
+			Range:        float32(w.Range),
+			BulletSpeed:  float32(w.BulletSpeed),
+			Gravity:      float32(w.Gravity),
+			MagazineSize: w.MagazineSize,
+			ReloadTime:   time.Duration(w.ReloadTime * float64(time.Second)),
+		}
+	}
+
+	if _, exists := catalog.weapons[catalog.defaultID]; !exists {
+		return nil, fmt.Errorf("defaultWeapon %d is not in the catalogue", catalog.defaultID)
+	}
+	return catalog, nil
+}
+
+// Weapon returns the weapon with the given ID
+func (c *Catalog) Weapon(id int32) (Weapon, bool) {
+	w, exists := c.weapons[id]
+	return w, exists
+}
+
+// DefaultWeapon returns the weapon players hold when they have not picked one
+func (c *Catalog) DefaultWeapon() Weapon {
+	return c.weapons[c.defaultID]
+}
+
+// Len returns the number of weapons in the catalogue
+func (c *Catalog) Len() int {
+	return len(c.weapons)
+}
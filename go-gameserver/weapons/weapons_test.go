@@ -0,0 +1,73 @@
+package weapons
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	catalog, err := Parse([]byte(`{"weapons": [
+		{"id": 3, "name": "Rifle", "damage": 25, "fireRate": 5, "range": 3000, "bulletSpeed": 2000, "magazineSize": 10, "reloadTime": 1.5},
+		{"id": 7, "name": "Pistol", "damage": 10, "fireRate": 2, "range": 800, "bulletSpeed": 900}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if catalog.Len() != 2 {
+		t.Errorf("got %d weapons, want 2", catalog.Len())
+	}
+	if got := catalog.DefaultWeapon(); got.ID != 3 {
+		t.Errorf("default weapon is %d, want the first one, 3", got.ID)
+	}
+	rifle, exists := catalog.Weapon(3)
+	if !exists || rifle.Damage != 25 || rifle.MagazineSize != 10 || rifle.ReloadTime != 1500*time.Millisecond {
+		t.Errorf("got rifle %+v", rifle)
+	}
+	if _, exists := catalog.Weapon(4); exists {
+		t.Error("found a weapon that is not in the catalogue")
+	}
+
+	catalog, err = Parse([]byte(`{"defaultWeapon": 7, "weapons": [
+		{"id": 3, "fireRate": 5, "range": 3000, "bulletSpeed": 2000},
+		{"id": 7, "fireRate": 2, "range": 800, "bulletSpeed": 900}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := catalog.DefaultWeapon(); got.ID != 7 {
+		t.Errorf("default weapon is %d, want the chosen 7", got.ID)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	weapon := func(fields string) string {
+		return `{"weapons": [{"id": 1, "fireRate": 5, "range": 1000, "bulletSpeed": 1000, ` + fields + `}]}`
+	}
+
+	tests := []struct {
+		name string
+		data string
+		want string
+	}{
+		{"not json", `{`, "unexpected end"},
+		{"no weapons", `{"weapons": []}`, "no weapons"},
+		{"zero id", `{"weapons": [{"id": 0, "fireRate": 5, "range": 1000, "bulletSpeed": 1000}]}`, "id must be positive"},
+		{"duplicate id", `{"weapons": [
+			{"id": 1, "fireRate": 5, "range": 1000, "bulletSpeed": 1000},
+			{"id": 1, "fireRate": 5, "range": 1000, "bulletSpeed": 1000}
+		]}`, "duplicate id"},
+		{"negative damage", weapon(`"damage": -1`), "invalid damage"},
+		{"zero fire rate", weapon(`"fireRate": 0`), "invalid fireRate"},
+		{"bullets too fast to send", weapon(`"bulletSpeed": 5000`), "bulletSpeed 5000"},
+		{"negative magazine", weapon(`"magazineSize": -1`), "magazineSize"},
+		{"unknown default", `{"defaultWeapon": 2, "weapons": [{"id": 1, "fireRate": 5, "range": 1000, "bulletSpeed": 1000}]}`, "defaultWeapon 2"},
+	}
+	for _, tt := range tests {
+		_, err := Parse([]byte(tt.data))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: got error %v, want one mentioning %q", tt.name, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,412 @@
+package main
+
+import (
+	"math"
+	"math/rand"
+	"time"
+
+	"gameeserever/gamemode"
+	"gameeserever/level"
+	"gameeserever/protocol"
+	"gameeserever/weapons"
+)
+
+// Movement constants, tuned to feel like the client's Player physics at 60 fps
+const (
+	playerGravity         = 2480 // px/s², gravity in the client's constants.js
+	playerJumpSpeed       = 1425 // px/s, the client's jumpForce applied over one 60 fps frame
+	playerRunAcceleration = 4800 // px/s²
+	playerMaxRunSpeed     = 400  // px/s
+	playerMaxFallSpeed    = 2000 // px/s
+	playerGroundFriction  = 0.82 // Velocity kept per 60 fps frame on the ground
+	playerAirFriction     = 0.85 // Velocity kept per 60 fps frame in the air
+
+	// Every tick earns a player credit for one input command, and unused
+	// credit is kept up to maxInputCatchUp extra commands. Commands that
+	// arrive bunched up are applied from the saved credit, but over any
+	// stretch of ticks a player moves at most maxInputCatchUp ticks ahead, so
+	// a client cannot speed up by flooding inputs. Commands waiting for
+	// credit stay queued, up to maxQueuedInputs; the oldest are dropped first.
+	maxInputCatchUp = 3
+	maxQueuedInputs = 16
+
+	// Client-reported movement, from clients that do not send input
+	// commands, may cover moveTolerance times the distance the speed limits
+	// allow in the time since the last accepted update, counting at most
+	// maxUpdateGap of it
+	moveTolerance = 2
+	maxUpdateGap  = time.Second
+
+	// Size of every player's hitbox, matching the client's player sprite.
+	// Clients cannot change it, so they cannot shrink out of the way of hits.
+	playerWidth  = 50
+	playerHeight = 70
+
+	// playerGridCellSize is the cell size of the grid players are looked up in by position
+	playerGridCellSize = 512
+)
+
+// playerSim is the server-side simulation state that is not part of protocol.Player
+type playerSim struct {
+	inputs      []protocol.InputCommand // Queued commands, applied as credit allows
+	inputCredit int                     // Commands that may be applied, earned one per tick
+	lastInput   uint32                  // Sequence of the last applied command
+	inputDriven bool                    // Movement comes from input commands, not client positions
+	lastMoved   uint32                  // Tick a client-reported position was last accepted
+	grounded    bool
+	aimAngle    float32
+	firing      bool
+	viewTick    uint32 // Snapshot tick the client had applied when sending its last command
+
+	history *rewindBuffer // Recent hitboxes, for lag-compensated hit checks
+	shots   []shotRecord  // Recent shots that have not hit anyone yet
+
+	weaponID int32                  // Equipped weapon (0 = the catalogue's default)
+	arsenal  map[int32]*weaponState // Ammo and cooldowns per weapon used
+}
+
+// StepEvents is what happened during a tick that clients have to hear about
+type StepEvents struct {
+	Impacts          []protocol.ProjectileImpact // Projectiles that stopped
+	MovedFragments   []protocol.Fragment         // Fragments that bounced off a platform
+	ExpiredFragments []int32                     // Fragments that settled or grew too old
+}
+
+// World is the authoritative state of a room's match, advanced one tick at a time.
+// It is not safe for concurrent use; the owning Room guards it with its mutex.
+type World struct {
+	Tick    uint32
+	Players map[int32]*protocol.Player
+
+	level     *level.Level     // Level geometry for collisions (nil when running without a level)
+	terrain   *terrain         // Platforms destroyed in this world and their fragments
+	weapons   *weapons.Catalog // Weapon stats used for shots and damage
+	tickDelta float32          // Seconds simulated per tick and per input command
+	sims      map[int32]*playerSim
+	grid      *protocol.SpatialGrid // Player hitboxes as of the last tick
+
+	maxRewindTicks uint32 // How many ticks of history hit checks may look back
+
+	projectiles      []*projectile // Bullets in flight
+	nextProjectileID int32
+	rng              *rand.Rand // Scatters bullets within their weapon's spread
+
+	// Latest client update per player, applied on the next tick
+	pending map[int32]protocol.Player
+}
+
+// NewWorld creates an empty world on the given level, stepped tickRate times
+// per second. Hits are checked against positions up to maxRewind in the past.
+func NewWorld(lvl *level.Level, catalog *weapons.Catalog, tickRate int, maxRewind time.Duration) *World {
+	w := &World{
+		Players:   make(map[int32]*protocol.Player),
+		level:     lvl,
+		terrain:   newTerrain(lvl),
+		weapons:   catalog,
+		tickDelta: 1 / float32(tickRate),
+		sims:      make(map[int32]*playerSim),
+		grid:      protocol.NewSpatialGrid(playerGridCellSize),
+		pending:   make(map[int32]protocol.Player),
+		rng:       rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+	w.maxRewindTicks = w.ticksFor(maxRewind)
+	return w
+}
+
+// AddPlayer starts simulating a player. The world keeps the pointer, so the
+// caller's copy always reflects the authoritative state.
+func (w *World) AddPlayer(player *protocol.Player) {
+	w.Players[player.ID] = player
+	w.sims[player.ID] = &playerSim{
+		history:   newRewindBuffer(int(w.maxRewindTicks) + 1),
+		arsenal:   make(map[int32]*weaponState),
+		lastMoved: w.Tick,
+	}
+	w.grid.InsertRect(player.ID, hitboxOf(player).AABB())
+}
+
+// RemovePlayer stops simulating a player and drops any queued update
+func (w *World) RemovePlayer(playerID int32) {
+	delete(w.Players, playerID)
+	delete(w.sims, playerID)
+	delete(w.pending, playerID)
+	w.grid.Remove(playerID)
+}
+
+// QueueUpdate stores a client's reported state until the next tick.
+// Only the most recent update per player is kept.
+func (w *World) QueueUpdate(update protocol.Player) {
+	if _, exists := w.Players[update.ID]; !exists {
+		return
+	}
+	w.pending[update.ID] = update
+}
+
+// QueueInput stores an input command until the next tick. Commands that are
+// older than the last applied one are ignored. Once a player sends input
+// commands, the positions in their player updates are no longer trusted.
+func (w *World) QueueInput(playerID int32, input protocol.InputCommand) {
+	sim, exists := w.sims[playerID]
+	if !exists || input.Sequence <= sim.lastInput {
+		return
+	}
+	if queued := len(sim.inputs); queued > 0 && input.Sequence <= sim.inputs[queued-1].Sequence {
+		return
+	}
+	sim.inputDriven = true
+	if len(sim.inputs) >= maxQueuedInputs {
+		// Drop the oldest command; the client reconciles against the ack
+		sim.inputs = append(sim.inputs[:0], sim.inputs[1:]...)
+	}
+	sim.inputs = append(sim.inputs, input)
+}
+
+// LastInputSequence returns the sequence of the last input applied for a player
+func (w *World) LastInputSequence(playerID int32) uint32 {
+	if sim, exists := w.sims[playerID]; exists {
+		return sim.lastInput
+	}
+	return 0
+}
+
+// Step advances the world by one tick, applying queued client updates and
+// input commands, and moving projectiles and fragments
+func (w *World) Step() StepEvents {
+	w.Tick++
+
+	for playerID, update := range w.pending {
+		player := w.Players[playerID]
+		if sim := w.sims[playerID]; sim.inputDriven {
+			// Movement is simulated from input commands, so only the
+			// player's appearance comes from the client
+			applyPlayerAppearance(player, update)
+		} else {
+			w.applyPlayerUpdate(player, sim, update)
+		}
+		delete(w.pending, playerID)
+	}
+
+	for playerID, sim := range w.sims {
+		sim.inputCredit = min(sim.inputCredit+1, 1+maxInputCatchUp)
+		applied := min(len(sim.inputs), sim.inputCredit)
+		for _, input := range sim.inputs[:applied] {
+			w.applyInput(w.Players[playerID], sim, input)
+		}
+		sim.inputCredit -= applied
+		sim.inputs = append(sim.inputs[:0], sim.inputs[applied:]...)
+	}
+
+	w.recordHistory()
+
+	for playerID, player := range w.Players {
+		w.grid.MoveRect(playerID, hitboxOf(player).AABB())
+	}
+
+	// Projectiles move after the players, so they hit this tick's positions
+	var events StepEvents
+	events.Impacts = w.stepProjectiles()
+	events.MovedFragments, events.ExpiredFragments = w.stepFragments()
+	return events
+}
+
+// PlayersNear returns the IDs of the players whose hitboxes were within
+// radius of (x, y) at the end of the last tick
+func (w *World) PlayersNear(x, y, radius float32) []int32 {
+	return w.grid.GetNearbyEntities(x, y, radius)
+}
+
+// Snapshot copies the state of every player for this tick
+func (w *World) Snapshot() map[int32]protocol.Player {
+	players := make(map[int32]protocol.Player, len(w.Players))
+	for playerID, player := range w.Players {
+		players[playerID] = *player
+	}
+	return players
+}
+
+// applyInput moves a player by one input command's worth of time
+func (w *World) applyInput(player *protocol.Player, sim *playerSim, input protocol.InputCommand) {
+	sim.lastInput = input.Sequence
+	sim.viewTick = input.Tick
+	sim.aimAngle = input.AimAngle
+	sim.firing = input.Fire
+
+	if player.IsDead {
+		return
+	}
+
+	dt := w.tickDelta
+	moveX := clampAxis(input.MoveX)
+
+	// Run
+	switch {
+	case moveX > 0:
+		player.Direction = 1
+		player.FaceDirection = 1
+	case moveX < 0:
+		player.Direction = -1
+		player.FaceDirection = -1
+	default:
+		player.Direction = 0
+	}
+	player.VelocityX += moveX * playerRunAcceleration * dt
+	player.VelocityX = max(-playerMaxRunSpeed, min(playerMaxRunSpeed, player.VelocityX))
+
+	// Jump
+	if input.Jump && sim.grounded {
+		player.VelocityY = -playerJumpSpeed
+		sim.grounded = false
+	}
+
+	// Without level geometry there is nothing to stand on, so skip gravity
+	if w.level == nil {
+		sim.grounded = true
+	} else {
+		player.VelocityY = min(player.VelocityY+playerGravity*dt, playerMaxFallSpeed)
+	}
+
+	// Move horizontally, then vertically, undoing a step that ends inside a
+	// platform. A player that already overlaps one (e.g. a spawn point inside
+	// the terrain) moves freely until they are out.
+	stuck := w.collides(player)
+
+	dx := player.VelocityX * dt
+	player.X += dx
+	if !stuck && w.collides(player) {
+		player.X -= dx
+		player.VelocityX = 0
+	}
+
+	dy := player.VelocityY * dt
+	player.Y += dy
+	if !stuck && w.collides(player) {
+		player.Y -= dy
+		player.VelocityY = 0
+		sim.grounded = dy > 0
+	} else if w.level != nil {
+		sim.grounded = false
+	}
+
+	// Friction, scaled from the client's per-frame factors
+	friction := playerAirFriction
+	if sim.grounded {
+		friction = playerGroundFriction
+	}
+	if moveX == 0 {
+		player.VelocityX *= float32(math.Pow(friction, float64(dt*60)))
+		if player.VelocityX > -0.01 && player.VelocityX < 0.01 {
+			player.VelocityX = 0
+		}
+	}
+}
+
+// collides reports whether a player overlaps any solid platform
+func (w *World) collides(player *protocol.Player) bool {
+	return w.solidAt(hitboxOf(player))
+}
+
+// solidAt reports whether a rectangle overlaps any solid platform still standing
+func (w *World) solidAt(rect level.Rect) bool {
+	if w.level == nil {
+		return false
+	}
+	return len(w.level.SolidPlatformsIn(rect, w.terrain.isDestroyed)) > 0
+}
+
+// clampAxis limits an input axis to [-1, 1], treating NaN as no input
+func clampAxis(v float32) float32 {
+	if v != v {
+		return 0
+	}
+	return max(-1, min(1, v))
+}
+
+// applyPlayerAppearance copies the colors a client chose onto the authoritative player
+func applyPlayerAppearance(player *protocol.Player, update protocol.Player) {
+	player.ColorR = update.ColorR
+	player.ColorG = update.ColorG
+	player.ColorB = update.ColorB
+	player.ColorA = update.ColorA
+
+	// Teams are assigned by the server, and team players wear the team color
+	applyTeamColor(player)
+}
+
+// applyPlayerUpdate copies a client-reported position and appearance onto the
+// authoritative player. Health, death and hitbox size are owned by the server
+// and never taken from the client, and movement the server's physics could
+// not have produced is ignored.
+func (w *World) applyPlayerUpdate(player *protocol.Player, sim *playerSim, update protocol.Player) {
+	applyPlayerAppearance(player, update)
+
+	// Movement that is not finite would break collisions and grid lookups
+	if !allFinite(update.X, update.Y, update.VelocityX, update.VelocityY, update.Direction) {
+		return
+	}
+	if !w.plausibleMove(player, sim, update) {
+		return
+	}
+	sim.lastMoved = w.Tick
+
+	// Update position and movement data
+	player.X = update.X
+	player.Y = update.Y
+
+	// Update direction and face direction
+	player.Direction = update.Direction
+	player.FaceDirection = update.FaceDirection
+
+	// Update velocity
+	player.VelocityX = update.VelocityX
+	player.VelocityY = update.VelocityY
+}
+
+// plausibleMove reports whether a living player moves within the speed
+// limits, stays near the level and does not end up inside a solid platform.
+// Dead players do not move at all.
+func (w *World) plausibleMove(player *protocol.Player, sim *playerSim, update protocol.Player) bool {
+	if player.IsDead {
+		return false
+	}
+
+	if abs(update.VelocityX) > playerMaxRunSpeed ||
+		update.VelocityY < -playerJumpSpeed || update.VelocityY > playerMaxFallSpeed {
+		return false
+	}
+
+	elapsed := min(float32(w.Tick-sim.lastMoved)*w.tickDelta, float32(maxUpdateGap.Seconds()))
+	if abs(update.X-player.X) > playerMaxRunSpeed*elapsed*moveTolerance ||
+		abs(update.Y-player.Y) > max(playerJumpSpeed, playerMaxFallSpeed)*elapsed*moveTolerance {
+		return false
+	}
+
+	if w.level == nil {
+		return true
+	}
+	moved := *player
+	moved.X, moved.Y = update.X, update.Y
+	box := hitboxOf(&moved)
+	if area := w.level.Bounds.Expand(quantizationMargin); !area.Contains(box.MinX, box.MinY) || !area.Contains(box.MaxX, box.MaxY) {
+		return false
+	}
+	// A player already stuck in the terrain, e.g. on a spawn point inside
+	// it, may move while they get out
+	return w.collides(player) || !w.solidAt(box)
+}
+
+// allFinite reports whether none of the values are NaN or infinite
+func allFinite(values ...float32) bool {
+	for _, v := range values {
+		if math.IsNaN(float64(v)) || math.IsInf(float64(v), 0) {
+			return false
+		}
+	}
+	return true
+}
+
+// applyTeamColor overrides a player's color with their team's color
+func applyTeamColor(player *protocol.Player) {
+	if color, ok := gamemode.TeamColor(player.TeamID); ok {
+		player.ColorR, player.ColorG, player.ColorB, player.ColorA = color.R, color.G, color.B, color.A
+	}
+}
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"gameeserever/level"
+	"gameeserever/protocol"
+	"gameeserever/weapons"
+)
+
+func newTestPlayer(id int32) *protocol.Player {
+	return &protocol.Player{
+		ID:        id,
+		Health:    100,
+		MaxHealth: 100,
+		Width:     playerWidth,
+		Height:    playerHeight,
+		ColorA:    1,
+	}
+}
+
+func TestPlayerUpdateCannotChangeServerOwnedFields(t *testing.T) {
+	tests := []struct {
+		name        string
+		inputDriven bool
+		wantX       float32
+	}{
+		{"position updates", false, 5},
+		{"input commands", true, 0},
+	}
+	for _, tt := range tests {
+		w := NewWorld(nil, weapons.Default(), 60, time.Second)
+		player := newTestPlayer(1)
+		w.AddPlayer(player)
+		if tt.inputDriven {
+			w.QueueInput(player.ID, protocol.InputCommand{Sequence: 1})
+		}
+
+		update := *player
+		update.X = 5
+		update.Health, update.MaxHealth, update.IsDead = 100000, 100000, true
+		update.Width, update.Height = 0, 0
+		update.ColorR = 0.5
+		w.QueueUpdate(update)
+		w.Step()
+
+		if player.Health != 100 || player.MaxHealth != 100 || player.IsDead {
+			t.Errorf("%s: health %v/%v dead %v, want 100/100 alive", tt.name, player.Health, player.MaxHealth, player.IsDead)
+		}
+		if player.Width != playerWidth || player.Height != playerHeight {
+			t.Errorf("%s: hitbox %vx%v, want %vx%v", tt.name, player.Width, player.Height, playerWidth, playerHeight)
+		}
+		if box, _ := w.grid.Bounds(player.ID); box.MaxX-box.MinX != playerWidth || box.MaxY-box.MinY != playerHeight {
+			t.Errorf("%s: grid box %+v is not the server's hitbox size", tt.name, box)
+		}
+		if player.X != tt.wantX {
+			t.Errorf("%s: x = %v, want %v", tt.name, player.X, tt.wantX)
+		}
+		if player.ColorR != 0.5 {
+			t.Errorf("%s: color not taken from the update", tt.name)
+		}
+	}
+}
+
+func TestPlayerUpdateIgnoresNonFiniteMovement(t *testing.T) {
+	w := NewWorld(nil, weapons.Default(), 60, time.Second)
+	player := newTestPlayer(1)
+	player.X, player.Y = 10, 20
+	w.AddPlayer(player)
+
+	for _, v := range []float32{float32(math.NaN()), float32(math.Inf(1)), float32(math.Inf(-1))} {
+		update := *player
+		update.X, update.VelocityY = v, v
+		w.QueueUpdate(update)
+		w.Step()
+
+		if player.X != 10 || player.Y != 20 || player.VelocityY != 0 {
+			t.Errorf("update with %v moved the player to (%v, %v) at velocity %v", v, player.X, player.Y, player.VelocityY)
+		}
+	}
+	if box, _ := w.grid.Bounds(player.ID); box != (protocol.AABB{MinX: 10, MinY: 20, MaxX: 10 + playerWidth, MaxY: 20 + playerHeight}) {
+		t.Errorf("grid box %+v does not match the player", box)
+	}
+}
+
+// wallLevel has a floor at y 0 with a wall standing on it at x 240-260
+const wallLevel = `{
+	"gridSize": 10,
+	"playerSpawns": [{"x": 0, "y": -100}],
+	"rectangles": [
+		{"x": -100, "y": 0, "width": 800, "height": 20, "type": "grass", "layer": 1},
+		{"x": 240, "y": -200, "width": 20, "height": 200, "type": "stone", "layer": 1}
+	]
+}`
+
+func TestPlayerUpdateRejectsImplausibleMovement(t *testing.T) {
+	lvl, err := level.Parse([]byte(wallLevel))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		dead   bool
+		x, y   float32
+		vx, vy float32
+		want   bool
+	}{
+		{"a step", false, 105, -70, 100, 0, true},
+		{"running too fast", false, 105, -70, playerMaxRunSpeed + 1, 0, false},
+		{"falling too fast", false, 100, -69, 0, playerMaxFallSpeed + 1, false},
+		{"teleporting", false, 400, -70, 0, 0, false},
+		{"up to the wall", false, 189, -70, 0, 0, true},
+		{"into the wall", false, 200, -70, 0, 0, false},
+		{"inside the floor", false, 100, -60, 0, 0, false},
+		{"while dead", true, 101, -70, 0, 0, false},
+	}
+	for _, tt := range tests {
+		w := NewWorld(lvl, weapons.Default(), 60, time.Second)
+		player := newTestPlayer(1)
+		player.X, player.Y, player.IsDead = 100, -70, tt.dead
+		w.AddPlayer(player)
+
+		update := *player
+		update.X, update.Y, update.VelocityX, update.VelocityY = tt.x, tt.y, tt.vx, tt.vy
+		w.QueueUpdate(update)
+		w.Tick += 10 // The last update was a while ago
+		w.Step()
+
+		if moved := player.X == tt.x && player.Y == tt.y; moved != tt.want {
+			t.Errorf("%s: moved to (%v, %v), want moved %v", tt.name, player.X, player.Y, tt.want)
+		}
+	}
+}
+
+func TestInputCredit(t *testing.T) {
+	w := NewWorld(nil, weapons.Default(), 60, time.Second)
+	player := newTestPlayer(1)
+	w.AddPlayer(player)
+
+	var sequence uint32
+	send := func(n int) {
+		for i := 0; i < n; i++ {
+			sequence++
+			w.QueueInput(player.ID, protocol.InputCommand{Sequence: sequence, MoveX: 1})
+		}
+	}
+
+	// Flooding moves the player no faster than one command per tick
+	steady := NewWorld(nil, weapons.Default(), 60, time.Second)
+	paced := newTestPlayer(2)
+	steady.AddPlayer(paced)
+	for tick := 1; tick <= 10; tick++ {
+		send(8)
+		w.Step()
+		steady.QueueInput(paced.ID, protocol.InputCommand{Sequence: uint32(tick), MoveX: 1})
+		steady.Step()
+	}
+	if player.X != paced.X {
+		t.Errorf("flooding player is at x %v, one sending a command per tick at %v", player.X, paced.X)
+	}
+	if queued := len(w.sims[player.ID].inputs); queued != maxQueuedInputs-1 {
+		t.Errorf("%d commands left queued, want the cap of %d less the one applied", queued, maxQueuedInputs)
+	}
+
+	// Idle ticks save credit for a bunched-up burst, but no more than the catch-up allowance
+	w = NewWorld(nil, weapons.Default(), 60, time.Second)
+	w.AddPlayer(player)
+	sequence = 0
+	for tick := 0; tick < 10; tick++ {
+		w.Step()
+	}
+	send(10)
+	w.Step()
+	if got, want := w.LastInputSequence(player.ID), uint32(1+maxInputCatchUp); got != want {
+		t.Errorf("burst after idling applied %d commands, want %d", got, want)
+	}
+	w.Step()
+	if got, want := w.LastInputSequence(player.ID), uint32(2+maxInputCatchUp); got != want {
+		t.Errorf("tick after the burst applied up to command %d, want %d", got, want)
+	}
+}